@@ -0,0 +1,14 @@
+package auditlogtest
+
+import (
+	"fmt"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+// ConnectionID returns a predictable connection ID in the format of the random IDs generated by ContainerSSH, 32
+// hexadecimal characters. Combined with a clock.Fake it produces the same audit log names and contents in every test
+// run.
+func ConnectionID(n uint64) message.ConnectionID {
+	return message.ConnectionID(fmt.Sprintf("%032x", n))
+}
@@ -0,0 +1,103 @@
+package auditlogtest
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+// Matcher checks a single audit log message.
+type Matcher interface {
+	// Matches returns true if the message matches.
+	Matches(msg message.Message) bool
+	// String describes the expected message for error messages.
+	String() string
+}
+
+// Match creates a matcher from a function. The description is used in error messages.
+func Match(description string, matches func(msg message.Message) bool) Matcher {
+	return &funcMatcher{description: description, matches: matches}
+}
+
+type funcMatcher struct {
+	description string
+	matches     func(msg message.Message) bool
+}
+
+func (f *funcMatcher) Matches(msg message.Message) bool {
+	return f.matches(msg)
+}
+
+func (f *funcMatcher) String() string {
+	return f.description
+}
+
+// OfType matches messages of a type regardless of the payload.
+func OfType(messageType message.Type) Matcher {
+	return Match(messageType.Name(), func(msg message.Message) bool {
+		return msg.MessageType == messageType
+	})
+}
+
+// OnChannel matches messages of a channel that also match the matcher.
+func OnChannel(channelID uint64, matcher Matcher) Matcher {
+	return Match(fmt.Sprintf("%s on channel %d", matcher, channelID), func(msg message.Message) bool {
+		return msg.ChannelID != nil && *msg.ChannelID == channelID && matcher.Matches(msg)
+	})
+}
+
+// HandshakeSuccessful matches the successful handshake of a user.
+func HandshakeSuccessful(username string) Matcher {
+	return Match(fmt.Sprintf("successful handshake of %s", username), func(msg message.Message) bool {
+		payload, ok := msg.Payload.(message.PayloadHandshakeSuccessful)
+		return ok && msg.MessageType == message.TypeHandshakeSuccessful && payload.Username == username
+	})
+}
+
+// Exec matches the request to execute a program.
+func Exec(program string) Matcher {
+	return Match(fmt.Sprintf("exec of %q", program), func(msg message.Message) bool {
+		payload, ok := msg.Payload.(message.PayloadChannelRequestExec)
+		return ok && msg.MessageType == message.TypeChannelRequestExec && payload.Program == program
+	})
+}
+
+// Exit matches the exit of a program with an exit status.
+func Exit(exitStatus uint32) Matcher {
+	return Match(fmt.Sprintf("exit with status %d", exitStatus), func(msg message.Message) bool {
+		payload, ok := msg.Payload.(message.PayloadExit)
+		return ok && msg.MessageType == message.TypeExit && payload.ExitStatus == exitStatus
+	})
+}
+
+// IO matches an I/O message transferring exactly the data on the stream.
+func IO(stream message.Stream, data []byte) Matcher {
+	return Match(fmt.Sprintf("%q on stream %d", data, stream), func(msg message.Message) bool {
+		payload, ok := msg.Payload.(message.PayloadIO)
+		return ok && msg.MessageType == message.TypeIO && payload.Stream == stream && bytes.Equal(payload.Data, data)
+	})
+}
+
+// FindSequence checks that the messages contain messages matching the matchers in the order of the matchers. Other
+// messages may appear before, between and after the matching ones. Each message matches at most one matcher.
+func FindSequence(messages []message.Message, matchers ...Matcher) error {
+	next := 0
+	for i, matcher := range matchers {
+		found := false
+		for ; next < len(messages); next++ {
+			if matcher.Matches(messages[next]) {
+				found = true
+				next++
+				break
+			}
+		}
+		if !found {
+			if i == 0 {
+				return fmt.Errorf("no message matching %s", matcher)
+			}
+			return fmt.Errorf("no message matching %s after %s", matcher, matchers[i-1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package auditlogtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containerssh/geoip/dummy"
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog"
+	"github.com/containerssh/auditlog/codec/binary"
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/memory"
+)
+
+// WaitTimeout is the time the assertions of the Recorder wait for a connection to end.
+const WaitTimeout = 10 * time.Second
+
+// Recorder is an audit logger for tests of applications using the audit log. It records each connection in the binary
+// format to an in-memory storage and decodes the recorded messages on request, so the tests exercise the same encoder
+// as production.
+type Recorder struct {
+	auditlog.Logger
+
+	storage storage.ReadWriteStorage
+}
+
+// NewRecorder creates a Recorder intercepting the I/O according to the intercept configuration. The GeoIP lookup
+// always returns the XX country code.
+func NewRecorder(intercept auditlog.InterceptConfig, logger log.Logger, options ...auditlog.Option) (*Recorder, error) {
+	geoIPLookup, err := dummy.New()
+	if err != nil {
+		return nil, err
+	}
+	st := memory.NewStorage()
+	auditLogger, err := auditlog.NewLogger(
+		intercept,
+		binary.NewEncoder(geoIPLookup),
+		st,
+		logger,
+		geoIPLookup,
+		options...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		Logger:  auditLogger,
+		storage: st,
+	}, nil
+}
+
+// ConnectionIDs returns the IDs of the recorded connections in lexical order.
+func (r *Recorder) ConnectionIDs() []message.ConnectionID {
+	var connectionIDs []message.ConnectionID
+	entries, _ := r.storage.List(context.Background(), storage.Query{SkipMetadata: true})
+	for entry := range entries {
+		connectionIDs = append(connectionIDs, message.ConnectionID(entry.Name))
+	}
+	return connectionIDs
+}
+
+// Messages waits until the connection has ended and returns its decoded messages. It returns storage.ErrNotFound if
+// the connection was not recorded, or the context error if the connection does not end before the context is
+// cancelled.
+func (r *Recorder) Messages(ctx context.Context, connectionID message.ConnectionID) ([]message.Message, error) {
+	reader, err := r.storage.(storage.FollowableStorage).Follow(ctx, string(connectionID))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	messageChannel, errorChannel := binary.NewDecoder().Decode(reader)
+	var messages []message.Message
+	var decodeErr error
+	for messageChannel != nil || errorChannel != nil {
+		select {
+		case msg, ok := <-messageChannel:
+			if !ok {
+				messageChannel = nil
+				continue
+			}
+			messages = append(messages, msg)
+		case err, ok := <-errorChannel:
+			if !ok {
+				errorChannel = nil
+				continue
+			}
+			if decodeErr == nil {
+				decodeErr = err
+			}
+		}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("failed to decode the audit log of connection %s (%w)", connectionID, decodeErr)
+	}
+	return messages, nil
+}
+
+// AssertSequence waits up to WaitTimeout for the connection to end, then checks that its messages contain messages
+// matching the matchers in order. It marks the test failed and returns false otherwise.
+func (r *Recorder) AssertSequence(t testing.TB, connectionID message.ConnectionID, matchers ...Matcher) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), WaitTimeout)
+	defer cancel()
+	messages, err := r.Messages(ctx, connectionID)
+	if err != nil {
+		t.Errorf("failed to fetch the messages of connection %s (%v)", connectionID, err)
+		return false
+	}
+	if err := FindSequence(messages, matchers...); err != nil {
+		t.Errorf("connection %s: %v", connectionID, err)
+		return false
+	}
+	return true
+}
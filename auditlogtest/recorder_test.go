@@ -0,0 +1,60 @@
+package auditlogtest_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog"
+	"github.com/containerssh/auditlog/auditlogtest"
+	"github.com/containerssh/auditlog/message"
+)
+
+func TestRecorder(t *testing.T) {
+	recorder, err := auditlogtest.NewRecorder(auditlog.InterceptConfig{Stdout: true}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Shutdown(context.Background())
+
+	connectionID := auditlogtest.ConnectionID(1)
+	assert.Equal(t, message.ConnectionID("00000000000000000000000000000001"), connectionID)
+	connection, err := recorder.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(1, "ls -l")
+	stdout := channel.GetStdoutProxy(&bytes.Buffer{})
+	_, err = stdout.Write([]byte("Hello world!"))
+	assert.NoError(t, err)
+	channel.OnExit(0)
+	channel.OnClose()
+	connection.OnDisconnect()
+
+	assert.Equal(t, []message.ConnectionID{connectionID}, recorder.ConnectionIDs())
+	recorder.AssertSequence(
+		t,
+		connectionID,
+		auditlogtest.OfType(message.TypeConnect),
+		auditlogtest.HandshakeSuccessful("foo"),
+		auditlogtest.OnChannel(0, auditlogtest.Exec("ls -l")),
+		auditlogtest.IO(message.StreamStdout, []byte("Hello world!")),
+		auditlogtest.OnChannel(0, auditlogtest.Exit(0)),
+		auditlogtest.OfType(message.TypeDisconnect),
+	)
+
+	messages, err := recorder.Messages(context.Background(), connectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = auditlogtest.FindSequence(messages, auditlogtest.Exit(0), auditlogtest.Exec("ls -l"))
+	assert.EqualError(t, err, `no message matching exec of "ls -l" after exit with status 0`)
+	err = auditlogtest.FindSequence(messages, auditlogtest.Exec("rm -rf /"))
+	assert.EqualError(t, err, `no message matching exec of "rm -rf /"`)
+}
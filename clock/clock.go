@@ -0,0 +1,31 @@
+package clock
+
+import (
+	"time"
+)
+
+// Clock provides the time the audit logger records in the messages.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// System returns the clock of the operating system.
+func System() Clock {
+	return systemClock{}
+}
+
+// OrSystem returns the clock, or the system clock if it is nil.
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System()
+	}
+	return c
+}
+
+type systemClock struct {
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// NewFake creates a clock for tests that starts at the start time and only changes when told to. Each call to Now
+// advances the clock by step after reading it, so consecutive messages get distinct timestamps. The step may be 0.
+func NewFake(start time.Time, step time.Duration) *Fake {
+	return &Fake{
+		lock: &sync.Mutex{},
+		now:  start,
+		step: step,
+	}
+}
+
+// Fake is a clock for tests. It is safe for concurrent use.
+type Fake struct {
+	lock *sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+// Now returns the time of the clock and advances the clock by the step.
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	now := f.now
+	f.now = f.now.Add(f.step)
+	return now
+}
+
+// Advance moves the clock forward by the duration.
+func (f *Fake) Advance(duration time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = f.now.Add(duration)
+}
+
+// Set sets the time of the clock.
+func (f *Fake) Set(now time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.now = now
+}
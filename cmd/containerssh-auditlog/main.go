@@ -0,0 +1,164 @@
+// Command containerssh-auditlog works with ContainerSSH audit logs. The index subcommand searches the local session
+// index and backfills it from an audit log storage:
+//
+//	containerssh-auditlog index search -index /var/lib/containerssh/index -username alice -program kubectl \
+//	    -exclude-country AT,BE,DE -since 168h
+//	containerssh-auditlog index backfill -index /var/lib/containerssh/index -config auditlog.json
+//
+// The search prints the matching session summaries as newline-delimited JSON, newest first. The backfill reads the
+// storage configuration from a JSON-encoded audit log configuration file. It only reads the storage, so it can run
+// next to ContainerSSH with the same configuration.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog"
+	"github.com/containerssh/auditlog/codec/binary"
+	"github.com/containerssh/auditlog/index"
+	"github.com/containerssh/auditlog/storage"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) < 2 || args[0] != "index" {
+		return fmt.Errorf("usage: containerssh-auditlog index search|backfill [options]")
+	}
+	switch args[1] {
+	case "search":
+		return search(args[2:], stdout, stderr)
+	case "backfill":
+		return backfill(args[2:], stdout, stderr)
+	default:
+		return fmt.Errorf("unknown index subcommand: %s (expected search or backfill)", args[1])
+	}
+}
+
+func search(args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	directory := flags.String("index", "", "Directory of the session index.")
+	username := flags.String("username", "", "Only sessions of this user.")
+	program := flags.String("program", "", "Only sessions that ran a program containing this word.")
+	countries := flags.String("country", "", "Only sessions from these comma-separated country codes.")
+	excludeCountries := flags.String("exclude-country", "", "Skip sessions from these comma-separated country codes.")
+	remoteAddr := flags.String("ip", "", "Only sessions from this IP address.")
+	since := flags.Duration("since", 0, "Only sessions started within this duration, for example 168h.")
+	limit := flags.Int("limit", 0, "Maximum number of sessions to print.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	idx, err := index.New(index.Config{Directory: *directory})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+
+	query := index.Query{
+		Username:         *username,
+		Program:          *program,
+		Countries:        splitList(*countries),
+		ExcludeCountries: splitList(*excludeCountries),
+		RemoteAddr:       *remoteAddr,
+		Limit:            *limit,
+	}
+	if *since > 0 {
+		query.StartTime = time.Now().Add(-*since)
+	}
+	summaries, err := idx.Search(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	for _, s := range summaries {
+		if err := encoder.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfill(args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	directory := flags.String("index", "", "Directory of the session index.")
+	configFile := flags.String("config", "", "JSON file containing the audit log configuration.")
+	prefix := flags.String("prefix", "", "Only audit logs with this name prefix.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file %s (%w)", *configFile, err)
+	}
+	config := auditlog.Config{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse configuration file %s (%w)", *configFile, err)
+	}
+	if err := config.Storage.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration file %s (%w)", *configFile, err)
+	}
+
+	logger, err := log.NewLogger(log.Config{
+		Level:       log.LevelWarning,
+		Format:      log.FormatText,
+		Destination: log.DestinationStdout,
+		Stdout:      stderr,
+	})
+	if err != nil {
+		return err
+	}
+	readableStorage, err := auditlog.NewReadOnlyStorage(config, logger)
+	if err != nil {
+		return err
+	}
+
+	idx, err := index.New(index.Config{Directory: *directory})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+
+	indexed, err := index.Backfill(
+		context.Background(),
+		idx,
+		readableStorage,
+		binary.NewDecoder(),
+		storage.Query{Prefix: *prefix},
+		logger,
+	)
+	_, _ = fmt.Fprintf(stdout, "indexed %d audit logs\n", indexed)
+	return err
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
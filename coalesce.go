@@ -0,0 +1,119 @@
+package auditlog
+
+import (
+	"time"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+// coalesce returns a channel receiving the messages of the input channel with consecutive I/O messages of the same
+// channel and stream merged according to the configuration. The returned channel is closed when the input channel is
+// closed.
+func coalesce(input <-chan message.Message, config CoalesceConfig) <-chan message.Message {
+	output := make(chan message.Message)
+	c := &coalescer{
+		config: config.withDefaults(),
+		output: output,
+	}
+	go c.run(input)
+	return output
+}
+
+type coalescer struct {
+	config CoalesceConfig
+	output chan<- message.Message
+	// pending is the merged I/O message not written yet, nil if there is none.
+	pending *message.Message
+}
+
+func (c *coalescer) run(input <-chan message.Message) {
+	defer close(c.output)
+	// The timer writes the pending message when the window has passed without a message that does not fit.
+	timer := time.NewTimer(c.config.Window)
+	stopTimer(timer)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-input:
+			if !ok {
+				c.flush()
+				return
+			}
+			if c.merge(msg) {
+				continue
+			}
+			c.flush()
+			if c.canMerge(msg) {
+				c.hold(msg)
+				stopTimer(timer)
+				timer.Reset(c.config.Window)
+				continue
+			}
+			c.output <- msg
+		case <-timer.C:
+			c.flush()
+		}
+	}
+}
+
+// canMerge returns true if the message is an I/O message small enough to be merged with following messages.
+func (c *coalescer) canMerge(msg message.Message) bool {
+	if msg.MessageType != message.TypeIO {
+		return false
+	}
+	return uint(len(msg.Payload.(message.PayloadIO).Data)) < c.config.MaxBytes
+}
+
+// merge appends the data of the message to the pending message if they belong to the same channel and stream, the
+// message is within the window and the merged data does not exceed the size limit.
+func (c *coalescer) merge(msg message.Message) bool {
+	if c.pending == nil || msg.MessageType != message.TypeIO {
+		return false
+	}
+	pendingPayload := c.pending.Payload.(message.PayloadIO)
+	payload := msg.Payload.(message.PayloadIO)
+	if payload.Stream != pendingPayload.Stream || !sameChannel(msg.ChannelID, c.pending.ChannelID) {
+		return false
+	}
+	if time.Duration(msg.Offset-c.pending.Offset) > c.config.Window {
+		return false
+	}
+	if uint(len(pendingPayload.Data)+len(payload.Data)) > c.config.MaxBytes {
+		return false
+	}
+	pendingPayload.Data = append(pendingPayload.Data, payload.Data...)
+	c.pending.Payload = pendingPayload
+	return true
+}
+
+// hold keeps the message as the pending message. The data is copied as the writer may reuse its buffer.
+func (c *coalescer) hold(msg message.Message) {
+	payload := msg.Payload.(message.PayloadIO)
+	payload.Data = append(make([]byte, 0, c.config.MaxBytes), payload.Data...)
+	msg.Payload = payload
+	c.pending = &msg
+}
+
+func (c *coalescer) flush() {
+	if c.pending != nil {
+		c.output <- *c.pending
+		c.pending = nil
+	}
+}
+
+// stopTimer stops the timer and drains its channel so a following Reset does not deliver an outdated expiry.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+func sameChannel(a message.ChannelID, b message.ChannelID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,151 @@
+package auditlog_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/containerssh/geoip/dummy"
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog"
+	"github.com/containerssh/auditlog/auditlogtest"
+	"github.com/containerssh/auditlog/clock"
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	noneStorage "github.com/containerssh/auditlog/storage/none"
+)
+
+func TestCoalesce(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1600000000, 0), 0)
+	recorder, err := auditlogtest.NewRecorder(
+		auditlog.InterceptConfig{
+			Stdin:    true,
+			Stdout:   true,
+			Coalesce: auditlog.CoalesceConfig{Window: time.Second, MaxBytes: 8},
+		},
+		log.NewTestLogger(t),
+		auditlog.WithClock(fakeClock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Shutdown(context.Background())
+
+	connection, err := recorder.OnConnect("test", net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	stdout := channel.GetStdoutProxy(&bytes.Buffer{})
+	stdin := channel.GetStdinProxy(bytes.NewReader([]byte("x")))
+	buf := make([]byte, 1)
+	for _, data := range []string{"He", "llo"} {
+		_, _ = stdout.Write([]byte(data))
+	}
+	_, _ = stdin.Read(buf)
+	channel.OnRequestWindow(1, 80, 25, 800, 600)
+	// The second write would exceed the size limit.
+	for _, data := range []string{"world", "!!!!"} {
+		_, _ = stdout.Write([]byte(data))
+	}
+	// The third write is outside the window.
+	fakeClock.Advance(2 * time.Second)
+	_, _ = stdout.Write([]byte("?"))
+	connection.OnDisconnect()
+
+	messages, err := recorder.Messages(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []message.Type
+	var data []string
+	for _, msg := range messages {
+		types = append(types, msg.MessageType)
+		if payload, ok := msg.Payload.(message.PayloadIO); ok {
+			data = append(data, string(payload.Data))
+		}
+	}
+	assert.Equal(t, []message.Type{
+		message.TypeConnect,
+		message.TypeNewChannelSuccessful,
+		message.TypeIO,
+		message.TypeIO,
+		message.TypeChannelRequestWindow,
+		message.TypeIO,
+		message.TypeIO,
+		message.TypeIO,
+		message.TypeDisconnect,
+	}, types)
+	assert.Equal(t, []string{"Hello", "x", "world", "!!!!", "?"}, data)
+}
+
+// channelEncoder passes the messages to a channel instead of encoding them.
+type channelEncoder struct {
+	messages chan message.Message
+}
+
+func (c *channelEncoder) Encode(messages <-chan message.Message, storage storage.Writer) error {
+	for msg := range messages {
+		c.messages <- msg
+	}
+	return storage.Close()
+}
+
+func (c *channelEncoder) GetMimeType() string {
+	return "application/octet-stream"
+}
+
+func (c *channelEncoder) GetFileExtension() string {
+	return ""
+}
+
+func TestCoalesceWindowExpiry(t *testing.T) {
+	encoder := &channelEncoder{messages: make(chan message.Message, 10)}
+	geoIPLookupProvider, _ := dummy.New()
+	auditLogger, err := auditlog.NewLogger(
+		auditlog.InterceptConfig{
+			Stdout:   true,
+			Coalesce: auditlog.CoalesceConfig{Window: 50 * time.Millisecond},
+		},
+		encoder,
+		noneStorage.NewStorage(),
+		log.NewTestLogger(t),
+		geoIPLookupProvider,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLogger.Shutdown(context.Background())
+
+	connection, err := auditLogger.OnConnect("test", net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.OnDisconnect()
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	<-encoder.messages
+	<-encoder.messages
+	_, _ = channel.GetStdoutProxy(&bytes.Buffer{}).Write([]byte("Hello world!"))
+
+	// The pending data is passed on when the window has passed, even though no other message follows.
+	select {
+	case msg := <-encoder.messages:
+		assert.Equal(t, []byte("Hello world!"), msg.Payload.(message.PayloadIO).Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the coalesced message was not written after the window has passed")
+	}
+}
+
+func TestCoalesceInvalidConfig(t *testing.T) {
+	config := auditlog.Config{
+		Enable: true,
+		Intercept: auditlog.InterceptConfig{
+			Coalesce: auditlog.CoalesceConfig{Window: -time.Second},
+		},
+	}
+	assert.Error(t, config.Validate())
+}
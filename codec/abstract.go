@@ -1,6 +1,7 @@
 package codec
 
 import (
+	"context"
 	"io"
 
 	"github.com/containerssh/auditlog/message"
@@ -18,6 +19,14 @@ type Encoder interface {
 	GetFileExtension() string
 }
 
+// ClosableEncoder is an Encoder holding resources shared by all connections, for example a connection to a server.
+type ClosableEncoder interface {
+	Encoder
+	// Close releases the shared resources after all connections have ended. It returns when the shutdown context is
+	// cancelled at the latest.
+	Close(shutdownContext context.Context)
+}
+
 // Decoder is a module that is resonsible for decoding a binary data stream into audit log messages.
 type Decoder interface {
 	Decode(reader io.Reader) (<-chan message.Message, <-chan error)
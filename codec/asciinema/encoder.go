@@ -205,7 +205,8 @@ func (e *encoder) handleIO(startTime int64, msg message.Message, asciicastHeader
 	payload := msg.Payload.(message.PayloadIO)
 	if payload.Stream == message.StreamStdout ||
 		payload.Stream == message.StreamStderr {
-		time := float64(msg.Timestamp-startTime) / 1000000000
+		// The offset is monotonic, so the frame times are not affected by changes to the wall clock during the session.
+		time := float64(msg.Offset) / 1000000000
 		frame := Frame{
 			Time:      time,
 			EventType: EventTypeOutput,
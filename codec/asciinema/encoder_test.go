@@ -139,6 +139,7 @@ var fullOutputTestMessages = []message.Message{
 	{
 		ConnectionID: "0123456789ABCDEF",
 		Timestamp:    int64(time.Second),
+		Offset:       int64(time.Second),
 		MessageType:  message.TypeNewChannel,
 		Payload: message.PayloadNewChannel{
 			ChannelType: "session",
@@ -148,6 +149,7 @@ var fullOutputTestMessages = []message.Message{
 	{
 		ConnectionID: "0123456789ABCDEF",
 		Timestamp:    int64(2 * time.Second),
+		Offset:       int64(2 * time.Second),
 		MessageType:  message.TypeNewChannelSuccessful,
 		Payload: message.PayloadNewChannelSuccessful{
 			ChannelType: "session",
@@ -157,6 +159,7 @@ var fullOutputTestMessages = []message.Message{
 	{
 		ConnectionID: "0123456789ABCDEF",
 		Timestamp:    int64(3 * time.Second),
+		Offset:       int64(3 * time.Second),
 		MessageType:  message.TypeChannelRequestShell,
 		Payload:      message.PayloadChannelRequestShell{},
 		ChannelID:    message.MakeChannelID(0),
@@ -164,6 +167,7 @@ var fullOutputTestMessages = []message.Message{
 	{
 		ConnectionID: "0123456789ABCDEF",
 		Timestamp:    int64(4 * time.Second),
+		Offset:       int64(4 * time.Second),
 		MessageType:  message.TypeIO,
 		Payload: message.PayloadIO{
 			Stream: message.StreamStdout,
@@ -174,6 +178,7 @@ var fullOutputTestMessages = []message.Message{
 	{
 		ConnectionID: "0123456789ABCDEF",
 		Timestamp:    int64(5 * time.Second),
+		Offset:       int64(5 * time.Second),
 		MessageType:  message.TypeDisconnect,
 		Payload:      nil,
 		ChannelID:    nil,
@@ -194,7 +199,7 @@ func TestOutput(t *testing.T) {
 
 	assert.Equal(t, 1, len(frames))
 
-	assert.Equal(t, float64(fullOutputTestMessages[4].Timestamp)/1000000000, frames[0].Time)
+	assert.Equal(t, float64(fullOutputTestMessages[4].Offset)/1000000000, frames[0].Time)
 	assert.Equal(t, asciinema.EventTypeOutput, frames[0].EventType)
 	assert.Equal(t, string(fullOutputTestMessages[4].Payload.(message.PayloadIO).Data), frames[0].Data)
 }
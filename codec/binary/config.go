@@ -0,0 +1,34 @@
+package binary
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config configures the binary encoder. The gzip stream is always flushed after control events, which are all
+// messages except I/O, so authentication and program execution are on disk immediately.
+type Config struct {
+	// FlushInterval is the maximum time encoded messages are held in the gzip buffer before being flushed to the
+	// storage.
+	FlushInterval time.Duration `json:"flushInterval" yaml:"flushInterval" default:"1s"`
+	// FlushMessages flushes the gzip stream after this many messages. 0 disables flushing based on message count.
+	FlushMessages uint `json:"flushMessages" yaml:"flushMessages" default:"0"`
+	// FlushBytes flushes the gzip stream after this many uncompressed bytes have been encoded. 0 disables flushing
+	// based on size.
+	FlushBytes uint `json:"flushBytes" yaml:"flushBytes" default:"0"`
+}
+
+// Validate validates the binary encoder configuration.
+func (c Config) Validate() error {
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("invalid flush interval: %s", c.FlushInterval)
+	}
+	return nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+	return c
+}
@@ -1,6 +1,8 @@
 package binary
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -20,60 +22,173 @@ func NewDecoder() codec.Decoder {
 type decoder struct {
 }
 
+// Decode decodes the messages as they become available from the reader. This allows decoding audit logs that are
+// still being written when combined with a reader that waits for more data, such as the ones returned by
+// storage.FollowableStorage.
 func (d *decoder) Decode(reader io.Reader) (<-chan message.Message, <-chan error) {
 	result := make(chan message.Message)
 	errors := make(chan error)
 
-	if err := readHeader(reader, CurrentVersion); err != nil {
-		go func() {
-			errors <- err
+	go func() {
+		defer func() {
 			close(result)
 			close(errors)
 		}()
-		return result, errors
-	}
+		if err := readHeader(reader, CurrentVersion); err != nil {
+			errors <- err
+			return
+		}
 
-	gzipReader, err := gzip.NewReader(reader)
-	if err != nil {
-		go func() {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
 			errors <- fmt.Errorf("failed to open gzip stream (%w)", err)
-			close(result)
-			close(errors)
-		}()
-		return result, errors
-	}
-
-	cborReader := cbor.NewDecoder(gzipReader)
-
-	var messages []decodedMessage
+			return
+		}
 
-	go func() {
-		if err = cborReader.Decode(&messages); err != nil {
+		arrayStart := make([]byte, 1)
+		if _, err := io.ReadFull(gzipReader, arrayStart); err != nil {
 			errors <- fmt.Errorf("failed to decode messages (%w)", err)
-			close(result)
-			close(errors)
+			return
+		}
+		if arrayStart[0] != cborIndefiniteArrayStart {
+			errors <- fmt.Errorf("failed to decode messages (invalid array start: %x)", arrayStart[0])
 			return
 		}
 
-		for _, v := range messages {
-			decodedMessage, err := decodeMessage(v)
+		// The messages are split before decoding because the CBOR decoder reads ahead and would not leave the break
+		// code terminating the array for us to check.
+		bufferedReader := bufio.NewReader(gzipReader)
+		item := &bytes.Buffer{}
+		firstTimestamp := int64(0)
+		first := true
+		for {
+			next, err := bufferedReader.Peek(1)
+			if err != nil {
+				errors <- fmt.Errorf("failed to decode messages (%w)", err)
+				return
+			}
+			if next[0] == cborBreak {
+				return
+			}
+			item.Reset()
+			if err := readItem(bufferedReader, item, 0); err != nil {
+				errors <- fmt.Errorf("failed to decode messages (%w)", err)
+				return
+			}
+			var v decodedMessage
+			if err := cbor.Unmarshal(item.Bytes(), &v); err != nil {
+				errors <- fmt.Errorf("failed to decode messages (%w)", err)
+				return
+			}
+			if first {
+				firstTimestamp = v.Timestamp
+				first = false
+			}
+			decodedMessage, err := decodeMessage(v, firstTimestamp)
 			if err != nil {
 				errors <- err
 			} else {
 				result <- *decodedMessage
 			}
 		}
-		close(result)
-		close(errors)
 	}()
 	return result, errors
 }
 
+// cborIndefiniteArrayStart is the initial byte of the indefinite-length array containing the messages.
+const cborIndefiniteArrayStart = 0x9f
+
+// cborBreak is the "break" code terminating the indefinite-length array of messages.
+const cborBreak = 0xff
+
+// maxItemDepth is the maximum nesting depth of a message, matching the default limit of the CBOR decoder.
+const maxItemDepth = 32
+
+// readItem copies a single complete CBOR data item (RFC 7049 section 2) from the reader to the buffer without decoding
+// it.
+func readItem(reader *bufio.Reader, buffer *bytes.Buffer, depth int) error {
+	if depth > maxItemDepth {
+		return fmt.Errorf("data item nested deeper than %d levels", maxItemDepth)
+	}
+	initialByte, err := reader.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	buffer.WriteByte(initialByte)
+	majorType := initialByte >> 5
+	additionalInfo := initialByte & 0x1f
+
+	var length uint64
+	switch {
+	case additionalInfo < 24:
+		length = uint64(additionalInfo)
+	case additionalInfo <= 27:
+		lengthBytes := make([]byte, 1<<(additionalInfo-24))
+		if _, err := io.ReadFull(reader, lengthBytes); err != nil {
+			return unexpectedEOF(err)
+		}
+		buffer.Write(lengthBytes)
+		for _, b := range lengthBytes {
+			length = length<<8 | uint64(b)
+		}
+	case additionalInfo == 31 && majorType >= 2 && majorType <= 5:
+		// Indefinite-length item, the nested items are terminated by a break code.
+		for {
+			next, err := reader.Peek(1)
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if next[0] == cborBreak {
+				_, _ = reader.ReadByte()
+				buffer.WriteByte(cborBreak)
+				return nil
+			}
+			if err := readItem(reader, buffer, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid initial byte 0x%02x", initialByte)
+	}
+
+	switch majorType {
+	case 2, 3:
+		if _, err := io.CopyN(buffer, reader, int64(length)); err != nil {
+			return unexpectedEOF(err)
+		}
+	case 4, 5, 6:
+		items := length
+		if majorType == 5 {
+			items = 2 * length
+		} else if majorType == 6 {
+			items = 1
+		}
+		for i := uint64(0); i < items; i++ {
+			if err := readItem(reader, buffer, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF since the end of the stream inside a data item means the audit
+// log is truncated.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 type decodedMessage struct {
 	// ConnectionID is an opaque ID of the connection
 	ConnectionID message.ConnectionID `json:"connectionId" yaml:"connectionId"`
 	// Timestamp is a nanosecond timestamp when the message was created
 	Timestamp int64 `json:"timestamp" yaml:"timestamp"`
+	// Offset is the monotonic time in nanoseconds since the first message of the connection. Audit logs recorded
+	// before the offset was introduced do not contain it.
+	Offset *int64 `json:"offset" yaml:"offset"`
 	// Type of the Payload object
 	MessageType message.Type `json:"type" yaml:"type"`
 	// Payload is always a pointer to a payload object.
@@ -82,7 +197,9 @@ type decodedMessage struct {
 	ChannelID message.ChannelID `json:"channelId" yaml:"channelId"`
 }
 
-func decodeMessage(v decodedMessage) (*message.Message, error) {
+// decodeMessage converts a decoded message. If the message has no offset, the offset is calculated from the timestamp
+// of the first message of the audit log.
+func decodeMessage(v decodedMessage, firstTimestamp int64) (*message.Message, error) {
 	payload, err := v.MessageType.Payload()
 	if err != nil {
 		return nil, err
@@ -93,9 +210,14 @@ func decodeMessage(v decodedMessage) (*message.Message, error) {
 			return nil, err
 		}
 	}
+	offset := v.Timestamp - firstTimestamp
+	if v.Offset != nil {
+		offset = *v.Offset
+	}
 	return &message.Message{
 		ConnectionID: v.ConnectionID,
 		Timestamp:    v.Timestamp,
+		Offset:       offset,
 		MessageType:  v.MessageType,
 		Payload:      payload,
 		ChannelID:    v.ChannelID,
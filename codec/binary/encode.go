@@ -3,7 +3,9 @@ package binary
 import (
 	"compress/gzip"
 	"fmt"
+	"io"
 	"net"
+	"time"
 
 	"github.com/containerssh/auditlog/codec"
 	"github.com/containerssh/auditlog/message"
@@ -17,11 +19,24 @@ import (
 //            on https://containerssh.github.io/advanced/audit/format/
 func NewEncoder(geoIPProvider geoipprovider.LookupProvider) codec.Encoder {
 	return &encoder{
+		config:        Config{}.withDefaults(),
 		geoIPProvider: geoIPProvider,
 	}
 }
 
+// NewEncoderWithConfig creates a binary encoder with the specified flushing behavior.
+func NewEncoderWithConfig(config Config, geoIPProvider geoipprovider.LookupProvider) (codec.Encoder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &encoder{
+		config:        config.withDefaults(),
+		geoIPProvider: geoIPProvider,
+	}, nil
+}
+
 type encoder struct {
+	config        Config
 	geoIPProvider geoipprovider.LookupProvider
 }
 
@@ -42,7 +57,8 @@ func (e *encoder) Encode(messages <-chan message.Message, storage storage.Writer
 	var gzipHandle *gzip.Writer
 	var encoder *cbor.Encoder
 	gzipHandle = gzip.NewWriter(storage)
-	encoder = cbor.NewEncoder(gzipHandle)
+	counter := &countingWriter{backend: gzipHandle}
+	encoder = cbor.NewEncoder(counter)
 	if err := encoder.StartIndefiniteArray(); err != nil {
 		return fmt.Errorf("failed to start infinite array (%w)", err)
 	}
@@ -51,20 +67,48 @@ func (e *encoder) Encode(messages <-chan message.Message, storage storage.Writer
 	var ip = ""
 	var country = "XX"
 	var username *string
-	for {
-		msg, ok := <-messages
-		if !ok {
-			break
-		}
-		if startTime == 0 {
-			startTime = msg.Timestamp
+	// The gzip stream is flushed at message boundaries so audit logs can be read while they are written and a crash
+	// only loses the most recent messages.
+	flushTicker := time.NewTicker(e.config.FlushInterval)
+	defer flushTicker.Stop()
+	unflushedMessages := uint(0)
+	flush := func() error {
+		if err := gzipHandle.Flush(); err != nil {
+			return fmt.Errorf("failed to flush audit log gzip stream (%w)", err)
 		}
-		ip, country, username = e.storeMetadata(msg, storage, startTime, ip, country, username)
-		if err := encoder.Encode(&msg); err != nil {
-			return fmt.Errorf("failed to encode audit log message (%w)", err)
-		}
-		if msg.MessageType == message.TypeDisconnect {
-			break
+		unflushedMessages = 0
+		counter.bytes = 0
+		return nil
+	}
+loop:
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				break loop
+			}
+			if startTime == 0 {
+				startTime = msg.Timestamp
+			}
+			ip, country, username = e.storeMetadata(msg, storage, startTime, ip, country, username)
+			if err := encoder.Encode(&msg); err != nil {
+				return fmt.Errorf("failed to encode audit log message (%w)", err)
+			}
+			if msg.MessageType == message.TypeDisconnect {
+				break loop
+			}
+			unflushedMessages++
+			if e.shouldFlush(msg, unflushedMessages, counter.bytes) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-flushTicker.C:
+			if unflushedMessages > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	if err := encoder.EndIndefinite(); err != nil {
@@ -79,6 +123,29 @@ func (e *encoder) Encode(messages <-chan message.Message, storage storage.Writer
 	return nil
 }
 
+// shouldFlush returns true if the gzip stream should be flushed after encoding the message.
+func (e *encoder) shouldFlush(msg message.Message, unflushedMessages uint, unflushedBytes uint) bool {
+	if msg.MessageType != message.TypeIO {
+		return true
+	}
+	if e.config.FlushMessages > 0 && unflushedMessages >= e.config.FlushMessages {
+		return true
+	}
+	return e.config.FlushBytes > 0 && unflushedBytes >= e.config.FlushBytes
+}
+
+// countingWriter counts the bytes written since the last reset.
+type countingWriter struct {
+	backend io.Writer
+	bytes   uint
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.backend.Write(p)
+	c.bytes += uint(n)
+	return n, err
+}
+
 func (e *encoder) storeMetadata(
 	msg message.Message,
 	storage storage.Writer,
@@ -1,9 +1,13 @@
 package binary_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	encodingBinary "encoding/binary"
 	"io"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/containerssh/geoip/dummy"
 
@@ -75,6 +79,19 @@ func TestTypeConnect(t *testing.T) {
 	testPipeline(t, msg)
 }
 
+func TestOffset(t *testing.T) {
+	msg := message.Message{
+		ConnectionID: "0123456789ABCDEF",
+		Timestamp:    1234,
+		Offset:       5678,
+		MessageType:  message.TypeIO,
+		Payload:      message.PayloadIO{Stream: message.StreamStdout, Data: []byte("Hello world!")},
+		ChannelID:    message.MakeChannelID(0),
+	}
+
+	testPipeline(t, msg)
+}
+
 func TestTypeDisconnect(t *testing.T) {
 	msg := message.Message{
 		ConnectionID: "0123456789ABCDEF",
@@ -518,3 +535,93 @@ func TestTypeChannelClose(t *testing.T) {
 
 	testPipeline(t, msg)
 }
+
+func TestFlushing(t *testing.T) {
+	geoip, _ := dummy.New()
+	encoder, err := binary.NewEncoderWithConfig(binary.Config{
+		FlushInterval: time.Hour,
+		FlushMessages: 2,
+	}, geoip)
+	assert.NoError(t, err)
+	decoder := binary.NewDecoder()
+
+	pipeReader, pipeWriter := io.Pipe()
+	messageChannel := make(chan message.Message)
+	encodeDone := make(chan error, 1)
+	go func() {
+		encodeDone <- encoder.Encode(messageChannel, codec.NewStorageWriterProxy(pipeWriter))
+	}()
+	decodedMessageChannel, errorsChannel := decoder.Decode(pipeReader)
+
+	expectMessages := func(count int) {
+		for i := 0; i < count; i++ {
+			select {
+			case _, ok := <-decodedMessageChannel:
+				if !ok {
+					t.Fatal("decoded message channel closed")
+				}
+			case err := <-errorsChannel:
+				t.Fatal(err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timeout while waiting for the flushed messages")
+			}
+		}
+	}
+
+	// Control events are flushed immediately.
+	messageChannel <- message.Message{
+		ConnectionID: "0123456789ABCDEF",
+		Timestamp:    1234,
+		MessageType:  message.TypeConnect,
+		Payload:      message.PayloadConnect{RemoteAddr: "127.0.0.1"},
+		ChannelID:    nil,
+	}
+	expectMessages(1)
+
+	// I/O is flushed after FlushMessages messages.
+	for i := 0; i < 2; i++ {
+		messageChannel <- message.Message{
+			ConnectionID: "0123456789ABCDEF",
+			Timestamp:    1235,
+			MessageType:  message.TypeIO,
+			Payload:      message.PayloadIO{Stream: message.StreamStdout, Data: []byte("Hello world!")},
+			ChannelID:    message.MakeChannelID(0),
+		}
+	}
+	expectMessages(2)
+
+	close(messageChannel)
+	assert.NoError(t, <-encodeDone)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	geoip, _ := dummy.New()
+	_, err := binary.NewEncoderWithConfig(binary.Config{FlushInterval: -time.Second}, geoip)
+	assert.Error(t, err)
+}
+
+func TestBreakInsideMessage(t *testing.T) {
+	data := &bytes.Buffer{}
+	header := make([]byte, binary.FileFormatLength+8)
+	copy(header, binary.FileFormatMagic)
+	encodingBinary.LittleEndian.PutUint64(header[binary.FileFormatLength:], binary.CurrentVersion)
+	data.Write(header)
+	gzipWriter := gzip.NewWriter(data)
+	// A map with a misplaced break code where its first key should be, followed by the break code of the array.
+	_, err := gzipWriter.Write([]byte{0x9f, 0xa1, 0xff, 0xff})
+	assert.NoError(t, err)
+	assert.NoError(t, gzipWriter.Close())
+
+	decodedMessageChannel, errorsChannel := binary.NewDecoder().Decode(data)
+	select {
+	case msg, ok := <-decodedMessageChannel:
+		if ok {
+			t.Fatalf("unexpected message: %v", msg)
+		}
+		t.Fatal("the corrupt audit log was decoded without an error")
+	case err := <-errorsChannel:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout while decoding")
+	}
+}
@@ -0,0 +1,198 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Transport is the network transport used to send syslog messages.
+type Transport string
+
+const (
+	// TransportUDP sends each syslog message as a single UDP datagram (RFC 5426).
+	TransportUDP Transport = "udp"
+	// TransportTCP sends syslog messages over TCP using octet-counting framing (RFC 6587).
+	TransportTCP Transport = "tcp"
+	// TransportTLS sends syslog messages over TLS using octet-counting framing (RFC 5425).
+	TransportTLS Transport = "tls"
+)
+
+// Validate checks the transport.
+func (t Transport) Validate() error {
+	switch t {
+	case TransportUDP:
+	case TransportTCP:
+	case TransportTLS:
+	default:
+		return fmt.Errorf("invalid syslog transport: %s", t)
+	}
+	return nil
+}
+
+// Facility is the syslog facility messages are sent with.
+type Facility string
+
+var facilities = map[Facility]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// Validate checks the facility.
+func (f Facility) Validate() error {
+	if _, ok := facilities[f]; !ok {
+		return fmt.Errorf("invalid syslog facility: %s", f)
+	}
+	return nil
+}
+
+func (f Facility) code() int {
+	return facilities[f]
+}
+
+// Config is the configuration of the syslog audit log format.
+type Config struct {
+	// Transport is the network transport to use: udp, tcp or tls.
+	Transport Transport `json:"transport" yaml:"transport" default:"udp"`
+	// Server is the host and port of the syslog server.
+	Server string `json:"server" yaml:"server"`
+	// Facility is the syslog facility of the messages, for example auth, authpriv or local0.
+	Facility Facility `json:"facility" yaml:"facility" default:"auth"`
+	// AppName is the APP-NAME field of the messages.
+	AppName string `json:"appName" yaml:"appName" default:"containerssh"`
+	// Hostname is the HOSTNAME field of the messages. Defaults to the hostname of the system.
+	Hostname string `json:"hostname" yaml:"hostname"`
+	// SDID is the structured data ID the audit event parameters are sent under. Must be in the name@enterpriseID
+	// format unless registered with IANA.
+	SDID string `json:"sdId" yaml:"sdId" default:"containerssh@32473"`
+	// IncludeIO sends the high-volume I/O messages with their data as the message text. Control characters and invalid
+	// UTF-8 in the data are escaped so each message stays on a single line.
+	IncludeIO bool `json:"includeIO" yaml:"includeIO"`
+	// Timeout is the timeout for connecting to the syslog server and sending a message.
+	Timeout time.Duration `json:"timeout" yaml:"timeout" default:"10s"`
+	// BufferSize is the number of messages buffered while the syslog server is slow or unreachable. Messages are
+	// dropped when the buffer is full so recording is never blocked.
+	BufferSize uint `json:"bufferSize" yaml:"bufferSize" default:"1000"`
+	// CACert is the PEM-encoded CA certificate to verify the server certificate with when using TLS. Defaults to the
+	// system CAs.
+	CACert string `json:"cacert" yaml:"cacert"`
+	// Cert is the PEM-encoded client certificate for mutual TLS authentication.
+	Cert string `json:"cert" yaml:"cert"`
+	// Key is the PEM-encoded private key of the client certificate.
+	Key string `json:"key" yaml:"key"`
+}
+
+// Validate validates the syslog configuration.
+func (c Config) Validate() error {
+	c = c.withDefaults()
+	if err := c.Transport.Validate(); err != nil {
+		return err
+	}
+	if err := c.Facility.Validate(); err != nil {
+		return err
+	}
+	if c.Server == "" {
+		return fmt.Errorf("no syslog server provided")
+	}
+	if _, _, err := net.SplitHostPort(c.Server); err != nil {
+		return fmt.Errorf("invalid syslog server: %s (%w)", c.Server, err)
+	}
+	if len(c.AppName) > 48 || !isPrintUSASCII(c.AppName) {
+		return fmt.Errorf("invalid syslog app name: %s (must be at most 48 printable ASCII characters)", c.AppName)
+	}
+	if len(c.Hostname) > 255 || !isPrintUSASCII(c.Hostname) {
+		return fmt.Errorf("invalid syslog hostname: %s (must be at most 255 printable ASCII characters)", c.Hostname)
+	}
+	if len(c.SDID) > 32 || !isPrintUSASCII(c.SDID) || strings.ContainsAny(c.SDID, "=]\"") {
+		return fmt.Errorf("invalid syslog structured data ID: %s", c.SDID)
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("the client certificate and key must be provided together")
+	}
+	return nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Transport == "" {
+		c.Transport = TransportUDP
+	}
+	if c.Facility == "" {
+		c.Facility = "auth"
+	}
+	if c.AppName == "" {
+		c.AppName = "containerssh"
+	}
+	if c.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err == nil {
+			c.Hostname = hostname
+		}
+	}
+	if c.SDID == "" {
+		c.SDID = "containerssh@32473"
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.BufferSize == 0 {
+		c.BufferSize = 1000
+	}
+	return c
+}
+
+func (c Config) getTLSConfig() (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+	}
+	if c.CACert != "" {
+		rootCAs := x509.NewCertPool()
+		if ok := rootCAs.AppendCertsFromPEM([]byte(c.CACert)); !ok {
+			return nil, fmt.Errorf("failed to add CA certificate from config file")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if c.Cert != "" {
+		cert, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate (%w)", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func isPrintUSASCII(s string) bool {
+	for _, c := range []byte(s) {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package syslog
+
+import (
+	"context"
+	"net"
+
+	"github.com/containerssh/geoip/geoipprovider"
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+)
+
+type encoder struct {
+	formatter     *formatter
+	sender        *sender
+	logger        log.Logger
+	geoIPProvider geoipprovider.LookupProvider
+}
+
+func (e *encoder) GetMimeType() string {
+	return "text/plain"
+}
+
+func (e *encoder) GetFileExtension() string {
+	return ".log"
+}
+
+func (e *encoder) Encode(messages <-chan message.Message, storage storage.Writer) error {
+	state := &connectionState{}
+	startTime := int64(0)
+	for {
+		msg, ok := <-messages
+		if !ok {
+			break
+		}
+		if startTime == 0 {
+			startTime = msg.Timestamp
+		}
+		if msg.MessageType == message.TypeConnect {
+			e.lookupCountry(msg, state)
+		}
+		line, send := e.formatter.format(msg, state)
+		e.storeMetadata(msg, storage, startTime, state)
+		if !send {
+			continue
+		}
+		e.sender.send(line)
+		if _, err := storage.Write(append(line, '\n')); err != nil {
+			if err := storage.Close(); err != nil {
+				e.logger.Error(log.Wrap(err, codes.EAuditLogStorageCloseFailed, "failed to close audit log storage writer"))
+			}
+			return err
+		}
+	}
+	if err := storage.Close(); err != nil {
+		e.logger.Error(log.Wrap(err, codes.EAuditLogStorageCloseFailed, "failed to close audit log storage writer"))
+	}
+	return nil
+}
+
+// Close sends the queued messages to the syslog server and closes the connection.
+func (e *encoder) Close(shutdownContext context.Context) {
+	e.sender.close(shutdownContext)
+}
+
+func (e *encoder) lookupCountry(msg message.Message, state *connectionState) {
+	payload := msg.Payload.(message.PayloadConnect)
+	if payload.Country == "" {
+		state.country = e.geoIPProvider.Lookup(net.ParseIP(payload.RemoteAddr))
+	}
+}
+
+func (e *encoder) storeMetadata(msg message.Message, storage storage.Writer, startTime int64, state *connectionState) {
+	switch msg.MessageType {
+	case message.TypeConnect:
+	case message.TypeAuthPasswordSuccessful:
+	case message.TypeAuthPubKeySuccessful:
+	case message.TypeHandshakeSuccessful:
+	default:
+		return
+	}
+	var username *string
+	if state.username != "" {
+		u := state.username
+		username = &u
+	}
+	storage.SetMetadata(startTime/1000000000, state.remoteAddr, state.country, username)
+}
@@ -0,0 +1,238 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+// Severity levels as defined in RFC 5424 section 6.2.1.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityNotice  = 5
+	severityInfo    = 6
+)
+
+const maxMsgIDLength = 32
+
+// connectionState holds the details of a connection that are attached to every message of the connection.
+type connectionState struct {
+	remoteAddr string
+	country    string
+	username   string
+}
+
+// param is a single structured data parameter.
+type param struct {
+	name  string
+	value string
+}
+
+// formatter formats audit log messages as RFC 5424 syslog messages.
+type formatter struct {
+	facility  int
+	hostname  string
+	appName   string
+	sdID      string
+	includeIO bool
+}
+
+// format returns the syslog message for an audit log message, or false if the message should not be sent.
+func (f *formatter) format(msg message.Message, state *connectionState) ([]byte, bool) {
+	severity := severityInfo
+	var params []param
+	text := msg.MessageType.Name()
+
+	switch msg.MessageType {
+	case message.TypeConnect:
+		payload := msg.Payload.(message.PayloadConnect)
+		state.remoteAddr = payload.RemoteAddr
+		if payload.Country != "" {
+			state.country = payload.Country
+		}
+	case message.TypeDisconnect:
+	case message.TypeAuthPasswordSuccessful:
+		state.username = msg.Payload.(message.PayloadAuthPassword).Username
+	case message.TypeAuthPasswordFailed:
+		severity = severityNotice
+		params = append(params, param{"attemptedUsername", msg.Payload.(message.PayloadAuthPassword).Username})
+	case message.TypeAuthPasswordBackendError:
+		severity = severityError
+		payload := msg.Payload.(message.PayloadAuthPasswordBackendError)
+		params = append(params, param{"attemptedUsername", payload.Username}, param{"reason", payload.Reason})
+	case message.TypeAuthPubKeySuccessful:
+		state.username = msg.Payload.(message.PayloadAuthPubKey).Username
+	case message.TypeAuthPubKeyFailed:
+		severity = severityNotice
+		payload := msg.Payload.(message.PayloadAuthPubKey)
+		params = append(params, param{"attemptedUsername", payload.Username}, param{"key", payload.Key})
+	case message.TypeAuthPubKeyBackendError:
+		severity = severityError
+		payload := msg.Payload.(message.PayloadAuthPubKeyBackendError)
+		params = append(params, param{"attemptedUsername", payload.Username}, param{"reason", payload.Reason})
+	case message.TypeAuthKeyboardInteractiveFailed:
+		severity = severityNotice
+		params = append(
+			params,
+			param{"attemptedUsername", msg.Payload.(message.PayloadAuthKeyboardInteractiveFailed).Username},
+		)
+	case message.TypeAuthKeyboardInteractiveBackendError:
+		severity = severityError
+		payload := msg.Payload.(message.PayloadAuthKeyboardInteractiveBackendError)
+		params = append(params, param{"attemptedUsername", payload.Username}, param{"reason", payload.Reason})
+	case message.TypeHandshakeFailed:
+		severity = severityWarning
+		params = append(params, param{"reason", msg.Payload.(message.PayloadHandshakeFailed).Reason})
+	case message.TypeHandshakeSuccessful:
+		state.username = msg.Payload.(message.PayloadHandshakeSuccessful).Username
+	case message.TypeNewChannel:
+		params = append(params, param{"channelType", msg.Payload.(message.PayloadNewChannel).ChannelType})
+	case message.TypeNewChannelSuccessful:
+		params = append(params, param{"channelType", msg.Payload.(message.PayloadNewChannelSuccessful).ChannelType})
+	case message.TypeNewChannelFailed:
+		severity = severityNotice
+		payload := msg.Payload.(message.PayloadNewChannelFailed)
+		params = append(params, param{"channelType", payload.ChannelType}, param{"reason", payload.Reason})
+	case message.TypeChannelRequestExec:
+		params = append(params, param{"program", msg.Payload.(message.PayloadChannelRequestExec).Program})
+	case message.TypeChannelRequestShell:
+	case message.TypeChannelRequestSubsystem:
+		params = append(
+			params,
+			param{"subsystem", msg.Payload.(message.PayloadChannelRequestSubsystem).Subsystem},
+		)
+	case message.TypeExit:
+		params = append(
+			params,
+			param{"exitStatus", strconv.FormatUint(uint64(msg.Payload.(message.PayloadExit).ExitStatus), 10)},
+		)
+	case message.TypeExitSignal:
+		payload := msg.Payload.(message.PayloadExitSignal)
+		params = append(params, param{"signal", payload.Signal})
+		if payload.ErrorMessage != "" {
+			params = append(params, param{"errorMessage", payload.ErrorMessage})
+		}
+	case message.TypeIO:
+		if !f.includeIO {
+			return nil, false
+		}
+		payload := msg.Payload.(message.PayloadIO)
+		params = append(params, param{"stream", ioStreamName(payload.Stream)})
+		text = escapeText(string(payload.Data))
+	default:
+		return nil, false
+	}
+
+	return f.build(msg, severity, state, params, text), true
+}
+
+func (f *formatter) build(
+	msg message.Message,
+	severity int,
+	state *connectionState,
+	params []param,
+	text string,
+) []byte {
+	sdParams := []param{
+		{"connectionId", string(msg.ConnectionID)},
+		{"type", msg.MessageType.ID()},
+	}
+	if msg.ChannelID != nil {
+		sdParams = append(sdParams, param{"channelId", strconv.FormatUint(*msg.ChannelID, 10)})
+	}
+	if state.remoteAddr != "" {
+		sdParams = append(sdParams, param{"remoteAddr", state.remoteAddr})
+	}
+	if state.country != "" {
+		sdParams = append(sdParams, param{"country", state.country})
+	}
+	if state.username != "" {
+		sdParams = append(sdParams, param{"username", state.username})
+	}
+	sdParams = append(sdParams, params...)
+
+	msgID := msg.MessageType.ID()
+	if len(msgID) > maxMsgIDLength {
+		msgID = msgID[:maxMsgIDLength]
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf(
+		"<%d>1 %s %s %s - %s [%s",
+		f.facility*8+severity,
+		time.Unix(0, msg.Timestamp).UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(f.hostname),
+		nilValue(f.appName),
+		nilValue(msgID),
+		f.sdID,
+	))
+	for _, p := range sdParams {
+		result.WriteString(" ")
+		result.WriteString(p.name)
+		result.WriteString("=\"")
+		result.WriteString(escapeParamValue(p.value))
+		result.WriteString("\"")
+	}
+	result.WriteString("]")
+	if text != "" {
+		result.WriteString(" ")
+		result.WriteString(text)
+	}
+	return []byte(result.String())
+}
+
+// escapeParamValue escapes the characters that must be escaped in structured data parameter values
+// (RFC 5424 section 6.3.3). Control characters and invalid UTF-8 bytes are escaped as in the message text, as values
+// such as the program may contain them.
+func escapeParamValue(value string) string {
+	return strings.NewReplacer(`"`, `\"`, `]`, `\]`).Replace(escapeText(value))
+}
+
+// escapeText escapes backslashes, control characters and invalid UTF-8 bytes in the message text as in Go string
+// literals. The message is then always a single line of valid UTF-8, so receivers using non-transparent framing
+// (RFC 6587 section 3.4.2) and the one message per line storage format do not split it.
+func escapeText(text string) string {
+	var result strings.Builder
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			result.WriteString(fmt.Sprintf(`\x%02x`, text[i]))
+		case r == '\\':
+			result.WriteString(`\\`)
+		case unicode.IsControl(r):
+			quoted := strconv.QuoteRune(r)
+			result.WriteString(quoted[1 : len(quoted)-1])
+		default:
+			result.WriteRune(r)
+		}
+		i += size
+	}
+	return result.String()
+}
+
+func nilValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func ioStreamName(stream message.Stream) string {
+	switch stream {
+	case message.StreamStdin:
+		return "stdin"
+	case message.StreamStdout:
+		return "stdout"
+	case message.StreamStderr:
+		return "stderr"
+	default:
+		return strconv.FormatUint(uint64(stream), 10)
+	}
+}
@@ -0,0 +1,34 @@
+package syslog
+
+import (
+	"github.com/containerssh/geoip/geoipprovider"
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codec"
+)
+
+// NewEncoder creates an encoder that sends connection-level audit events to a syslog server as RFC 5424 messages
+// with structured data (see https://tools.ietf.org/html/rfc5424 ). The messages are also written to the audit log
+// storage, one per line. All connections share a single connection to the syslog server.
+func NewEncoder(config Config, logger log.Logger, geoIPProvider geoipprovider.LookupProvider) (codec.Encoder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config = config.withDefaults()
+	s, err := newSender(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &encoder{
+		formatter: &formatter{
+			facility:  config.Facility.code(),
+			hostname:  config.Hostname,
+			appName:   config.AppName,
+			sdID:      config.SDID,
+			includeIO: config.IncludeIO,
+		},
+		sender:        s,
+		logger:        logger,
+		geoIPProvider: geoIPProvider,
+	}, nil
+}
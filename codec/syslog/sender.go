@@ -0,0 +1,181 @@
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+)
+
+// maxUDPMessageSize is the message size all receivers must accept over UDP (RFC 5426 section 3.2). Longer messages are
+// truncated.
+const maxUDPMessageSize = 2048
+
+// sender delivers syslog messages to the server from a single goroutine. Messages are queued without blocking and
+// dropped if the queue is full or the server cannot be reached.
+type sender struct {
+	transport Transport
+	server    string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	logger    log.Logger
+	queue     chan []byte
+	// lock guards closed. Messages are queued with the read lock held so the queue is not closed while sending.
+	lock    *sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	conn    net.Conn
+	failing bool
+	// dropping is set to 1 while messages are dropped because the queue is full.
+	dropping int32
+}
+
+func newSender(config Config, logger log.Logger) (*sender, error) {
+	s := &sender{
+		transport: config.Transport,
+		server:    config.Server,
+		timeout:   config.Timeout,
+		logger:    logger,
+		queue:     make(chan []byte, config.BufferSize),
+		lock:      &sync.RWMutex{},
+		done:      make(chan struct{}),
+	}
+	if config.Transport == TransportTLS {
+		tlsConfig, err := config.getTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		s.tlsConfig = tlsConfig
+	}
+	go s.run()
+	return s, nil
+}
+
+// send queues a message for delivery. It never blocks. Messages sent after close are dropped.
+func (s *sender) send(msg []byte) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- msg:
+		atomic.StoreInt32(&s.dropping, 0)
+	default:
+		if !atomic.CompareAndSwapInt32(&s.dropping, 0, 1) {
+			return
+		}
+		s.logger.Warning(
+			log.NewMessage(
+				codes.ESyslogMessageDropped,
+				"syslog send buffer full, dropping audit events",
+			).Label("server", s.server),
+		)
+	}
+}
+
+// close stops accepting messages and waits until the queued messages are sent, the timeout passes, or the shutdown
+// context is cancelled.
+func (s *sender) close(shutdownContext context.Context) {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.lock.Unlock()
+	ctx, cancel := context.WithTimeout(shutdownContext, s.timeout)
+	defer cancel()
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.logger.Warning(
+			log.NewMessage(
+				codes.ESyslogMessageDropped,
+				"shutting down with %d unsent audit events",
+				len(s.queue),
+			).Label("server", s.server),
+		)
+	}
+}
+
+func (s *sender) run() {
+	defer close(s.done)
+	defer s.reset()
+	for msg := range s.queue {
+		if err := s.write(msg); err != nil {
+			if !s.failing {
+				s.logger.Warning(
+					log.Wrap(
+						err,
+						codes.ESyslogSendFailed,
+						"failed to send audit event to syslog server %s, dropping events until the server is reachable",
+						s.server,
+					).Label("server", s.server),
+				)
+			}
+			s.failing = true
+			continue
+		}
+		s.failing = false
+	}
+}
+
+func (s *sender) write(msg []byte) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	data := msg
+	if s.transport == TransportUDP && len(data) > maxUDPMessageSize {
+		n := maxUDPMessageSize
+		for n > 0 && !utf8.RuneStart(data[n]) {
+			n--
+		}
+		data = data[:n]
+	}
+	if s.transport != TransportUDP {
+		// Octet-counting framing as described in RFC 6587 section 3.4.1 and RFC 5425 section 4.3.
+		data = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.timeout)); err != nil {
+		s.reset()
+		return err
+	}
+	if _, err := s.conn.Write(data); err != nil {
+		s.reset()
+		return err
+	}
+	return nil
+}
+
+func (s *sender) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout}
+	switch s.transport {
+	case TransportUDP:
+		return dialer.Dial("udp", s.server)
+	case TransportTCP:
+		return dialer.Dial("tcp", s.server)
+	case TransportTLS:
+		return tls.DialWithDialer(dialer, "tcp", s.server, s.tlsConfig)
+	default:
+		return nil, fmt.Errorf("invalid syslog transport: %s", s.transport)
+	}
+}
+
+func (s *sender) reset() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,470 @@
+package syslog_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/containerssh/geoip/dummy"
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/codec"
+	"github.com/containerssh/auditlog/codec/syslog"
+	"github.com/containerssh/auditlog/message"
+)
+
+type writer struct {
+	data     bytes.Buffer
+	username *string
+	closed   chan struct{}
+}
+
+func newWriter() *writer {
+	return &writer{closed: make(chan struct{})}
+}
+
+func (w *writer) Write(p []byte) (n int, err error) {
+	return w.data.Write(p)
+}
+
+func (w *writer) Close() error {
+	close(w.closed)
+	return nil
+}
+
+func (w *writer) SetMetadata(_ int64, _ string, _ string, username *string) {
+	w.username = username
+}
+
+func testMessages() []message.Message {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+	return []message.Message{
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start,
+			MessageType:  message.TypeConnect,
+			Payload:      message.PayloadConnect{RemoteAddr: "127.0.0.1"},
+		},
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start + 1,
+			MessageType:  message.TypeAuthPasswordFailed,
+			Payload:      message.PayloadAuthPassword{Username: `fo"o]`, Password: []byte("secret")},
+		},
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start + 2,
+			MessageType:  message.TypeAuthPasswordSuccessful,
+			Payload:      message.PayloadAuthPassword{Username: "foo", Password: []byte("secret")},
+		},
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start + 3,
+			MessageType:  message.TypeChannelRequestExec,
+			Payload:      message.PayloadChannelRequestExec{Program: "ls"},
+			ChannelID:    message.MakeChannelID(0),
+		},
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start + 4,
+			MessageType:  message.TypeIO,
+			Payload:      message.PayloadIO{Stream: message.StreamStdout, Data: []byte("hello\r\nworld\\\xff")},
+			ChannelID:    message.MakeChannelID(0),
+		},
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start + 5,
+			MessageType:  message.TypeExit,
+			Payload:      message.PayloadExit{ExitStatus: 1},
+			ChannelID:    message.MakeChannelID(0),
+		},
+		{
+			ConnectionID: "asdf",
+			Timestamp:    start + 6,
+			MessageType:  message.TypeDisconnect,
+			Payload:      nil,
+		},
+	}
+}
+
+func newEncoder(t *testing.T, config syslog.Config, logger log.Logger) codec.Encoder {
+	geoIPProvider, _ := dummy.New()
+	encoder, err := syslog.NewEncoder(config, logger, geoIPProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoder
+}
+
+func encode(t *testing.T, config syslog.Config, logger log.Logger) *writer {
+	return encodeMessages(newEncoder(t, config, logger), testMessages())
+}
+
+func encodeMessages(encoder codec.Encoder, msgs []message.Message) *writer {
+	messages := make(chan message.Message)
+	w := newWriter()
+	go func() {
+		_ = encoder.Encode(messages, w)
+	}()
+	for _, msg := range msgs {
+		messages <- msg
+	}
+	close(messages)
+	<-w.closed
+	return w
+}
+
+func readUDP(t *testing.T, conn net.PacketConn, count int) []string {
+	var result []string
+	buf := make([]byte, 65536)
+	for i := 0; i < count; i++ {
+		if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, string(buf[:n]))
+	}
+	return result
+}
+
+// readFramed reads octet-counted syslog messages from a stream connection.
+func readFramed(t *testing.T, conn net.Conn, count int) []string {
+	var result []string
+	reader := bufio.NewReader(conn)
+	for i := 0; i < count; i++ {
+		if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, string(buf))
+	}
+	return result
+}
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	w := encode(t, syslog.Config{
+		Transport: syslog.TransportUDP,
+		Server:    conn.LocalAddr().String(),
+		Facility:  "local0",
+		AppName:   "sshd",
+		Hostname:  "test",
+	}, log.NewTestLogger(t))
+
+	lines := readUDP(t, conn, 6)
+	assert.Equal(
+		t,
+		`<134>1 2021-03-01T12:00:00.000000Z test sshd - connect [containerssh@32473 connectionId="asdf" `+
+			`type="connect" remoteAddr="127.0.0.1" country="XX"] Connect`,
+		lines[0],
+	)
+	assert.Equal(
+		t,
+		`<133>1 2021-03-01T12:00:00.000000Z test sshd - auth_password_failed [containerssh@32473 `+
+			`connectionId="asdf" type="auth_password_failed" remoteAddr="127.0.0.1" country="XX" `+
+			`attemptedUsername="fo\"o\]"] Password authentication failed`,
+		lines[1],
+	)
+	assert.NotContains(t, strings.Join(lines, "\n"), "secret")
+	assert.Contains(t, lines[3], `channelId="0"`)
+	assert.Contains(t, lines[3], `username="foo"`)
+	assert.Contains(t, lines[3], `program="ls"`)
+	assert.Contains(t, lines[4], `exitStatus="1"`)
+	assert.Contains(t, lines[5], " disconnect ")
+
+	assert.Equal(t, strings.Join(lines, "\n")+"\n", w.data.String())
+	assert.NotNil(t, w.username)
+	assert.Equal(t, "foo", *w.username)
+}
+
+func TestTCPWithIO(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	connections := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			connections <- conn
+		}
+	}()
+
+	encode(t, syslog.Config{
+		Transport: syslog.TransportTCP,
+		Server:    listener.Addr().String(),
+		Facility:  "auth",
+		IncludeIO: true,
+	}, log.NewTestLogger(t))
+
+	conn := <-connections
+	defer func() {
+		_ = conn.Close()
+	}()
+	lines := readFramed(t, conn, 7)
+	assert.True(t, strings.HasPrefix(lines[0], "<38>1 "))
+	assert.Contains(t, lines[4], `stream="stdout"] hello\r\nworld\\\xff`)
+}
+
+func TestParamValueEscaping(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	encoder := newEncoder(t, syslog.Config{
+		Transport: syslog.TransportUDP,
+		Server:    conn.LocalAddr().String(),
+	}, log.NewTestLogger(t))
+	encodeMessages(encoder, []message.Message{
+		{
+			ConnectionID: "asdf",
+			MessageType:  message.TypeChannelRequestExec,
+			Payload:      message.PayloadChannelRequestExec{Program: "a\nb\xff"},
+			ChannelID:    message.MakeChannelID(0),
+		},
+	})
+
+	lines := readUDP(t, conn, 1)
+	assert.Contains(t, lines[0], `program="a\nb\xff"`)
+	assert.NotContains(t, lines[0], "\n")
+	assert.True(t, utf8.ValidString(lines[0]))
+}
+
+func TestUDPTruncation(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	encoder := newEncoder(t, syslog.Config{
+		Transport: syslog.TransportUDP,
+		Server:    conn.LocalAddr().String(),
+		IncludeIO: true,
+	}, log.NewTestLogger(t))
+	w := encodeMessages(encoder, []message.Message{
+		{
+			ConnectionID: "asdf",
+			MessageType:  message.TypeIO,
+			Payload:      message.PayloadIO{Stream: message.StreamStdout, Data: bytes.Repeat([]byte("\u00e9"), 2000)},
+			ChannelID:    message.MakeChannelID(0),
+		},
+	})
+
+	lines := readUDP(t, conn, 1)
+	assert.LessOrEqual(t, len(lines[0]), 2048)
+	assert.True(t, utf8.ValidString(lines[0]))
+	assert.Greater(t, w.data.Len(), 4000)
+}
+
+func TestClose(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	connections := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			connections <- conn
+		}
+	}()
+
+	encoder := newEncoder(t, syslog.Config{
+		Transport: syslog.TransportTCP,
+		Server:    listener.Addr().String(),
+	}, log.NewTestLogger(t))
+	encodeMessages(encoder, testMessages())
+	encoder.(codec.ClosableEncoder).Close(context.Background())
+
+	// All queued messages are sent before the connection is closed.
+	conn := <-connections
+	defer func() {
+		_ = conn.Close()
+	}()
+	data, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, strings.Count(string(data), "1 2021-03-01T12:00:00"))
+}
+
+func TestTLS(t *testing.T) {
+	caCert, serverCert := createCertificates(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	connections := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			connections <- conn
+		}
+	}()
+
+	encode(t, syslog.Config{
+		Transport: syslog.TransportTLS,
+		Server:    listener.Addr().String(),
+		Facility:  "auth",
+		CACert:    caCert,
+	}, log.NewTestLogger(t))
+
+	conn := <-connections
+	defer func() {
+		_ = conn.Close()
+	}()
+	lines := readFramed(t, conn, 6)
+	assert.Contains(t, lines[0], " connect ")
+}
+
+func TestUnreachableServerDoesNotBlock(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+	// The sender keeps running after the test, so its failure warnings must not go to the test log.
+	logger, err := log.NewLogger(log.Config{
+		Level:       log.LevelWarning,
+		Format:      log.FormatLJSON,
+		Destination: log.DestinationStdout,
+		Stdout:      ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			encode(t, syslog.Config{
+				Transport:  syslog.TransportTCP,
+				Server:     addr,
+				BufferSize: 1,
+				Timeout:    time.Second,
+			}, logger)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("encoding blocked on an unreachable syslog server")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	assert.NoError(t, syslog.Config{Server: "localhost:514"}.Validate())
+	assert.Error(t, syslog.Config{}.Validate())
+	assert.Error(t, syslog.Config{Server: "localhost"}.Validate())
+	assert.Error(t, syslog.Config{Server: "localhost:514", Transport: "http"}.Validate())
+	assert.Error(t, syslog.Config{Server: "localhost:514", Facility: "foo"}.Validate())
+	assert.Error(t, syslog.Config{Server: "localhost:514", AppName: "with space"}.Validate())
+	assert.Error(t, syslog.Config{Server: "localhost:514", Cert: "foo"}.Validate())
+}
+
+func createCertificates(t *testing.T) (string, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caTemplate, &serverKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: serverKeyDER}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})), serverCert
+}
@@ -81,5 +81,109 @@ const EMultipartAborting = "AUDIT_S3_MULTIPART_ABORTING"
 // ContainerSSH found a previously aborted multipart upload locally and is now attempting to recover the upload.
 const MRecovering = "AUDIT_S3_RECOVERING"
 
+// ContainerSSH could not read a file in the local directory of the S3 storage on startup and did not recover it. The
+// file may have been removed or have wrong permissions. Check the message for details.
+const ERecoveryFailed = "AUDIT_S3_RECOVERY_FAILED"
+
 // ContainerSSH failed to close the audit log storage handler.
 const EAuditLogStorageCloseFailed = "AUDIT_STORAGE_CLOSE_FAILED"
+
+// ContainerSSH failed to update the metadata and tags of an audit log after the upload was finalized. The audit log
+// itself has been uploaded successfully. Check if the S3 credentials have permissions to copy and tag objects.
+const EFailedUpdatingMetadata = "AUDIT_S3_FAILED_UPDATING_METADATA"
+
+// ContainerSSH gave up uploading an audit log and moved it to the quarantine directory. Check the preceding messages
+// for the reason the upload failed. The audit log can be uploaded manually from the quarantine directory.
+const EUploadQuarantined = "AUDIT_S3_UPLOAD_QUARANTINED"
+
+// ContainerSSH failed to move an audit log to the quarantine directory after giving up the upload. Check if the
+// quarantine directory is writable.
+const EQuarantineFailed = "AUDIT_S3_QUARANTINE_FAILED"
+
+// A storage backend of the multi storage failed to open, write or close an audit log. If the backend is configured as
+// best effort the audit log is still written to the other backends. Check the message for details.
+const EMultiStorageBackendFailed = "AUDIT_MULTI_STORAGE_BACKEND_FAILED"
+
+// ContainerSSH failed to deliver a batch of an audit log to the webhook and will retry. Check if the webhook endpoint
+// is reachable.
+const EWebhookDeliveryFailed = "AUDIT_WEBHOOK_DELIVERY_FAILED"
+
+// ContainerSSH dropped a batch of an audit log destined to the webhook, either because the spooled batch could not be
+// read or the in-memory spool was full. If the spool was full the audit log is aborted and the receiver is sent an empty
+// final batch with the X-Audit-Log-Aborted header, otherwise the audit log on the receiving end is incomplete.
+const EWebhookBatchDropped = "AUDIT_WEBHOOK_BATCH_DROPPED"
+
+// The webhook permanently rejected a batch of an audit log. The remaining batches of the audit log are dropped and the
+// receiver is sent an empty final batch with the X-Audit-Log-Aborted header so it can discard the partial audit log.
+// Check the webhook endpoint logs for the reason of the rejection.
+const EWebhookLogRejected = "AUDIT_WEBHOOK_LOG_REJECTED"
+
+// ContainerSSH failed to write or read the webhook spool directory. Check if the spool directory is writable.
+const EWebhookSpoolFailed = "AUDIT_WEBHOOK_SPOOL_FAILED"
+
+// ContainerSSH shut down the webhook storage before all batches were delivered. Batches in the spool directory are
+// delivered on the next start, batches kept in memory are lost.
+const EWebhookUndelivered = "AUDIT_WEBHOOK_UNDELIVERED"
+
+// ContainerSSH failed to send an audit event to the syslog server. Events are dropped until the server is reachable
+// again. Check if the syslog server is running and the transport settings match.
+const ESyslogSendFailed = "AUDIT_SYSLOG_SEND_FAILED"
+
+// ContainerSSH dropped audit events destined to the syslog server because the send buffer was full. The syslog server
+// is too slow or unreachable. Increase the buffer size or check the syslog server.
+const ESyslogMessageDropped = "AUDIT_SYSLOG_MESSAGE_DROPPED"
+
+// ContainerSSH dropped audit log messages for a live observer because the observer did not read them fast enough.
+// The recording itself is not affected. Increase the buffer size of the observer or check its network connection.
+const ELiveObserverMessagesDropped = "AUDIT_LIVE_OBSERVER_MESSAGES_DROPPED"
+
+// An audit log output could not keep up with a connection and its message buffer filled up. The audit log of the
+// connection is aborted on that output instead of holding up the connection and the other outputs. Check the storage
+// of the output.
+const EOutputOverflow = "AUDIT_OUTPUT_OVERFLOW"
+
+// ContainerSSH failed to write the JSON summary of a connection to the storage. The audit log itself is not affected.
+// Check the message for details.
+const ESummaryWriteFailed = "AUDIT_SUMMARY_WRITE_FAILED"
+
+// ContainerSSH could not add an audit log to the session index while backfilling from the storage and skipped it.
+// The audit log may be in a format that cannot be decoded, or may be damaged. Check the message for details.
+const EIndexBackfillFailed = "AUDIT_INDEX_BACKFILL_FAILED"
+
+// The local directory of the S3 storage exceeds a spool warning threshold because audit logs are not uploaded fast
+// enough. Check if the S3 storage is reachable.
+const ES3SpoolWarning = "AUDIT_S3_SPOOL_WARNING"
+
+// The local directory of the S3 storage exceeds the spool limits. Depending on the configuration new audit logs are
+// rejected, the I/O of connections is no longer recorded, or the oldest audit logs waiting for upload are evicted.
+// Check if the S3 storage is reachable.
+const ES3SpoolFull = "AUDIT_S3_SPOOL_FULL"
+
+// ContainerSSH removed an audit log from the local directory of the S3 storage before it was uploaded to make room for
+// new audit logs. The audit log is lost. Check if the S3 storage is reachable.
+const ES3SpoolEvicted = "AUDIT_S3_SPOOL_EVICTED"
+
+// ContainerSSH stopped recording the I/O of a connection in an audit log because the local directory of the S3 storage
+// exceeds the spool limits. The audit log is incomplete until the recording resumes. Check if the S3 storage is
+// reachable.
+const ES3SpoolIOSuspended = "AUDIT_S3_SPOOL_IO_SUSPENDED"
+
+// ContainerSSH resumed recording the I/O of a connection in an audit log after the local directory of the S3 storage
+// dropped below the spool limits.
+const MS3SpoolIOResumed = "AUDIT_S3_SPOOL_IO_RESUMED"
+
+// ContainerSSH found that an audit log stored in the S3-compatible object storage does not match the SHA-256 checksum
+// recorded during the upload. The stored audit log may have been corrupted or tampered with.
+const EChecksumMismatch = "AUDIT_S3_CHECKSUM_MISMATCH"
+
+// ContainerSSH could not read the local audit log file to calculate the SHA-256 checksum of an upload. The upload is
+// retried. Check if the local directory of the S3 storage is readable.
+const EChecksumFailed = "AUDIT_S3_CHECKSUM_FAILED"
+
+// ContainerSSH could not read the local audit log file to calculate the MD5 checksum S3 requires for uploads with an
+// object lock retention. The upload is retried. Check if the local directory of the S3 storage is readable.
+const EContentMD5Failed = "AUDIT_S3_CONTENT_MD5_FAILED"
+
+// ContainerSSH found an identical copy of a recovered audit log in the S3-compatible object storage and skipped the
+// upload. This happens when an upload completed, but ContainerSSH stopped before removing the local copy.
+const MUploadDeduplicated = "AUDIT_S3_UPLOAD_DEDUPLICATED"
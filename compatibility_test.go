@@ -1,6 +1,7 @@
 package auditlog_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/containerssh/auditlog/codec/binary"
@@ -19,7 +20,7 @@ func TestDecodingOldAuditLogs(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	logChan, errChan := fileStorage.List()
+	logChan, errChan := fileStorage.List(context.Background(), storage.Query{})
 	loop:
 	for {
 		var entry storage.Entry
@@ -55,6 +56,7 @@ func testDecodeOldLog(t *testing.T, fileStorage storage.ReadWriteStorage, name s
 	decoder := binary.NewDecoder()
 	messageChannel, errors := decoder.Decode(reader)
 	var types []message.Type
+	var offsets []int64
 	loop:
 	for {
 		select {
@@ -63,6 +65,7 @@ func testDecodeOldLog(t *testing.T, fileStorage storage.ReadWriteStorage, name s
 				break loop
 			}
 			types = append(types, msg.MessageType)
+			offsets = append(offsets, msg.Offset)
 		case err, ok := <-errors:
 			if !ok {
 				break loop
@@ -83,4 +86,7 @@ func testDecodeOldLog(t *testing.T, fileStorage storage.ReadWriteStorage, name s
 		message.TypeClose,
 		message.TypeDisconnect,
 	}, types)
+	// Old audit logs have no offsets, they are calculated from the timestamps.
+	assert.Equal(t, int64(0), offsets[0])
+	assert.True(t, offsets[len(offsets)-1] > 0)
 }
\ No newline at end of file
@@ -2,9 +2,16 @@ package auditlog
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/containerssh/auditlog/codec/binary"
+	"github.com/containerssh/auditlog/codec/syslog"
+	"github.com/containerssh/auditlog/index"
 	"github.com/containerssh/auditlog/storage/file"
+	"github.com/containerssh/auditlog/storage/multi"
 	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/webhook"
 )
 
 // Format describes the audit log format in use.
@@ -19,6 +26,9 @@ const (
 	// FormatAsciinema signals that audit logging should take place in Asciicast v2 format
 	//                 (see https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md )
 	FormatAsciinema Format = "asciinema"
+	// FormatSyslog signals that connection-level audit events should be sent to a syslog server as RFC 5424 messages
+	//              (see https://tools.ietf.org/html/rfc5424 )
+	FormatSyslog Format = "syslog"
 )
 
 // Validate checks the format.
@@ -26,6 +36,7 @@ func (f Format) Validate() error {
 	switch f {
 	case FormatBinary:
 	case FormatAsciinema:
+	case FormatSyslog:
 	case FormatNone:
 	default:
 		return fmt.Errorf("invalid audit log format: %s", f)
@@ -43,6 +54,10 @@ const (
 	StorageFile Storage = "file"
 	// StorageS3 signals that audit logs should be stored in an S3-compatible object storage.
 	StorageS3 Storage = "s3"
+	// StorageWebhook signals that audit logs should be sent in batches to an HTTP endpoint.
+	StorageWebhook Storage = "webhook"
+	// StorageMulti signals that audit logs should be stored in all storages configured in the multi option.
+	StorageMulti Storage = "multi"
 )
 
 // Validate checks the storage.
@@ -51,6 +66,8 @@ func (s Storage) Validate() error {
 	case StorageNone:
 	case StorageFile:
 	case StorageS3:
+	case StorageWebhook:
+	case StorageMulti:
 	default:
 		return fmt.Errorf("invalid audit log storage: %s", s)
 	}
@@ -65,14 +82,109 @@ type Config struct {
 	Format Format `json:"format" yaml:"format" default:"none"`
 	// Storage audit storage type
 	Storage Storage `json:"storage" yaml:"storage" default:"none"`
+	// Binary is the configuration of the binary format.
+	Binary binary.Config `json:"binary" yaml:"binary"`
+	// Syslog is the configuration of the syslog format.
+	Syslog syslog.Config `json:"syslog" yaml:"syslog"`
 	// File audit logger configuration
 	File file.Config `json:"file" yaml:"file"`
 	// S3 configuration
 	S3 s3.Config `json:"s3" yaml:"s3"`
+	// Webhook is the configuration of the HTTP webhook storage.
+	Webhook webhook.Config `json:"webhook" yaml:"webhook"`
+	// Multi lists the storages audit logs are written to when the multi storage is selected.
+	Multi []MultiStorageConfig `json:"multi" yaml:"multi"`
+	// Summary writes a JSON summary of each connection next to the audit log in the storage.
+	Summary bool `json:"summary" yaml:"summary" default:"false"`
+	// Index adds the summary of each connection to a local searchable index.
+	Index index.Config `json:"index" yaml:"index"`
+	// Outputs lists several format and storage pairs each audit log is written to. If set, the format, binary,
+	// syslog, storage, file, s3, webhook, multi and summary options are ignored.
+	Outputs []OutputConfig `json:"outputs" yaml:"outputs"`
 	// Intercept configures what should be intercepted
 	Intercept InterceptConfig `json:"intercept" yaml:"intercept"`
 }
 
+// OutputConfig configures an audit log format and the storage it is written to.
+type OutputConfig struct {
+	// Format is the audit log format of this output.
+	Format Format `json:"format" yaml:"format" default:"none"`
+	// Binary is the configuration of the binary format.
+	Binary binary.Config `json:"binary" yaml:"binary"`
+	// Syslog is the configuration of the syslog format.
+	Syslog syslog.Config `json:"syslog" yaml:"syslog"`
+	// Storage is the storage type of this output.
+	Storage Storage `json:"storage" yaml:"storage" default:"none"`
+	// File is the configuration of the file storage.
+	File file.Config `json:"file" yaml:"file"`
+	// S3 is the configuration of the S3 storage.
+	S3 s3.Config `json:"s3" yaml:"s3"`
+	// Webhook is the configuration of the HTTP webhook storage.
+	Webhook webhook.Config `json:"webhook" yaml:"webhook"`
+	// Multi lists the backends of the multi storage.
+	Multi []MultiStorageConfig `json:"multi" yaml:"multi"`
+	// NameSuffix is appended to the connection ID to form the audit log name. Set this when several outputs write to
+	// the same storage location. Must not contain a dot.
+	NameSuffix string `json:"nameSuffix" yaml:"nameSuffix"`
+	// Summary writes a JSON summary of each connection next to the audit log in the storage of this output.
+	Summary bool `json:"summary" yaml:"summary" default:"false"`
+}
+
+// Validate checks the output configuration.
+func (c OutputConfig) Validate() error {
+	if strings.Contains(c.NameSuffix, ".") || strings.Contains(c.NameSuffix, "/") {
+		return fmt.Errorf("invalid name suffix: %s (must not contain a dot or slash)", c.NameSuffix)
+	}
+	return (&Config{
+		Enable:  true,
+		Format:  c.Format,
+		Binary:  c.Binary,
+		Syslog:  c.Syslog,
+		Storage: c.Storage,
+		File:    c.File,
+		S3:      c.S3,
+		Webhook: c.Webhook,
+		Multi:   c.Multi,
+	}).Validate()
+}
+
+// MultiStorageConfig configures one backend of the multi storage.
+type MultiStorageConfig struct {
+	// Name identifies the backend in log messages. Defaults to the index of the backend.
+	Name string `json:"name" yaml:"name"`
+	// Storage is the storage type of the backend. Cannot be multi.
+	Storage Storage `json:"storage" yaml:"storage"`
+	// File is the configuration of the file storage backend.
+	File file.Config `json:"file" yaml:"file"`
+	// S3 is the configuration of the S3 storage backend.
+	S3 s3.Config `json:"s3" yaml:"s3"`
+	// Webhook is the configuration of the HTTP webhook storage backend.
+	Webhook webhook.Config `json:"webhook" yaml:"webhook"`
+	// Policy configures if a failure of this backend fails the audit log (required) or is only logged (bestEffort).
+	Policy multi.Policy `json:"policy" yaml:"policy" default:"required"`
+}
+
+// Validate checks the backend configuration.
+func (c MultiStorageConfig) Validate() error {
+	if err := c.Storage.Validate(); err != nil {
+		return err
+	}
+	if err := c.Policy.Validate(); err != nil {
+		return err
+	}
+	switch c.Storage {
+	case StorageFile:
+		return c.File.Validate()
+	case StorageS3:
+		return c.S3.Validate()
+	case StorageWebhook:
+		return c.Webhook.Validate()
+	case StorageMulti:
+		return fmt.Errorf("multi storages cannot be nested")
+	}
+	return nil
+}
+
 // InterceptConfig configures what should be intercepted by the auditing facility.
 type InterceptConfig struct {
 	// Stdin signals that the standard input from the user should be captured.
@@ -83,6 +195,43 @@ type InterceptConfig struct {
 	Stderr bool `json:"stderr" yaml:"stderr" default:"false"`
 	// Passwords signals that passwords during authentication should be captured.
 	Passwords bool `json:"passwords" yaml:"passwords" default:"false"`
+	// Coalesce merges consecutive I/O messages before they are encoded.
+	Coalesce CoalesceConfig `json:"coalesce" yaml:"coalesce"`
+}
+
+// Validate checks the intercept configuration.
+func (c InterceptConfig) Validate() error {
+	if err := c.Coalesce.Validate(); err != nil {
+		return fmt.Errorf("invalid coalesce configuration (%w)", err)
+	}
+	return nil
+}
+
+// CoalesceConfig configures the merging of consecutive I/O messages of the same channel and stream into one message
+// before they are encoded. Interactive sessions otherwise produce a message for every echoed keystroke. The merged
+// message has the timestamp and offset of the first merged message. Other messages are never delayed behind I/O,
+// pending I/O is written before them. Live observers and metrics still receive every message.
+type CoalesceConfig struct {
+	// Window is the maximum time between the first and the last merged message. Merged data is written at the latest
+	// when the window has passed. 0 disables coalescing.
+	Window time.Duration `json:"window" yaml:"window" default:"0"`
+	// MaxBytes is the maximum data size of a merged message. Messages larger than this are not merged.
+	MaxBytes uint `json:"maxBytes" yaml:"maxBytes" default:"4096"`
+}
+
+// Validate checks the coalesce configuration.
+func (c CoalesceConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("invalid window: %s", c.Window)
+	}
+	return nil
+}
+
+func (c CoalesceConfig) withDefaults() CoalesceConfig {
+	if c.MaxBytes == 0 {
+		c.MaxBytes = 4096
+	}
+	return c
 }
 
 // Validate checks the configuration to enable global configuration check.
@@ -90,9 +239,33 @@ func (config *Config) Validate() error {
 	if !config.Enable {
 		return nil
 	}
+	if err := config.Intercept.Validate(); err != nil {
+		return fmt.Errorf("invalid intercept configuration (%w)", err)
+	}
+	if err := config.Index.Validate(); err != nil {
+		return fmt.Errorf("invalid index configuration (%w)", err)
+	}
+	if len(config.Outputs) > 0 {
+		for i, output := range config.Outputs {
+			if err := output.Validate(); err != nil {
+				return fmt.Errorf("invalid audit log output %d (%w)", i, err)
+			}
+		}
+		return nil
+	}
 	if err := config.Format.Validate(); err != nil {
 		return err
 	}
+	switch config.Format {
+	case FormatBinary:
+		if err := config.Binary.Validate(); err != nil {
+			return fmt.Errorf("invalid binary format configuration (%w)", err)
+		}
+	case FormatSyslog:
+		if err := config.Syslog.Validate(); err != nil {
+			return fmt.Errorf("invalid syslog configuration (%w)", err)
+		}
+	}
 	if err := config.Storage.Validate(); err != nil {
 		return fmt.Errorf("invalid audit log storage (%w)", err)
 	}
@@ -101,6 +274,17 @@ func (config *Config) Validate() error {
 		return config.File.Validate()
 	case StorageS3:
 		return config.S3.Validate()
+	case StorageWebhook:
+		return config.Webhook.Validate()
+	case StorageMulti:
+		if len(config.Multi) == 0 {
+			return fmt.Errorf("no backends configured for the multi storage")
+		}
+		for i, backend := range config.Multi {
+			if err := backend.Validate(); err != nil {
+				return fmt.Errorf("invalid multi storage backend %d (%w)", i, err)
+			}
+		}
 	}
 	return nil
 }
@@ -1,47 +1,123 @@
 package auditlog
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
+	"github.com/containerssh/auditlog/clock"
 	"github.com/containerssh/auditlog/codec"
 	"github.com/containerssh/auditlog/codec/asciinema"
 	"github.com/containerssh/auditlog/codec/binary"
 	noneCodec "github.com/containerssh/auditlog/codec/none"
+	"github.com/containerssh/auditlog/codec/syslog"
+	"github.com/containerssh/auditlog/index"
+	"github.com/containerssh/auditlog/metrics"
 	"github.com/containerssh/auditlog/storage"
 	"github.com/containerssh/auditlog/storage/file"
+	"github.com/containerssh/auditlog/storage/multi"
 	noneStorage "github.com/containerssh/auditlog/storage/none"
 	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/webhook"
+	"github.com/containerssh/auditlog/tap"
 
 	"github.com/containerssh/geoip/geoipprovider"
 	"github.com/containerssh/log"
 )
 
-// New Creates a new audit logging pipeline based on the provided configuration.
-func New(config Config, geoIPLookupProvider geoipprovider.LookupProvider, logger log.Logger) (Logger, error) {
+// New Creates a new audit logging pipeline based on the provided configuration. The options are applied to the logger
+// and the metrics collector and the clock are also passed to the storages.
+func New(
+	config Config,
+	geoIPLookupProvider geoipprovider.LookupProvider,
+	logger log.Logger,
+	options ...Option,
+) (Logger, error) {
 	if !config.Enable {
 		return &empty{}, nil
 	}
 
-	encoder, err := NewEncoder(config.Format, logger, geoIPLookupProvider)
-	if err != nil {
-		return nil, err
+	outputConfigs := config.Outputs
+	if len(outputConfigs) == 0 {
+		outputConfigs = []OutputConfig{
+			{
+				Format:  config.Format,
+				Binary:  config.Binary,
+				Syslog:  config.Syslog,
+				Storage: config.Storage,
+				File:    config.File,
+				S3:      config.S3,
+				Webhook: config.Webhook,
+				Multi:   config.Multi,
+				Summary: config.Summary,
+			},
+		}
+	}
+
+	var outputs []Output
+	for _, outputConfig := range outputConfigs {
+		encoder, err := newEncoder(outputConfig, logger, geoIPLookupProvider)
+		if err != nil {
+			shutdownOutputs(outputs)
+			return nil, err
+		}
+
+		st, err := NewStorage(Config{
+			Storage: outputConfig.Storage,
+			File:    outputConfig.File,
+			S3:      outputConfig.S3,
+			Webhook: outputConfig.Webhook,
+			Multi:   outputConfig.Multi,
+		}, logger, options...)
+		if err != nil {
+			closeEncoder(encoder)
+			shutdownOutputs(outputs)
+			return nil, err
+		}
+
+		outputs = append(outputs, Output{
+			Encoder:    encoder,
+			Storage:    st,
+			NameSuffix: outputConfig.NameSuffix,
+			Summary:    outputConfig.Summary,
+		})
 	}
 
-	st, err := NewStorage(config, logger)
-	if err != nil {
-		return nil, err
+	if config.Index.Enable {
+		idx, err := index.New(config.Index)
+		if err != nil {
+			shutdownOutputs(outputs)
+			return nil, err
+		}
+		outputs = append(outputs, Output{
+			Encoder: idx.Encoder(),
+			Storage: idx,
+		})
 	}
 
-	return NewLogger(
+	return NewMultiOutputLogger(
 		config.Intercept,
-		encoder,
-		st,
+		outputs,
 		logger,
 		geoIPLookupProvider,
+		options...,
 	)
 }
 
+// shutdownOutputs releases the encoders and storages created before the pipeline failed to start.
+func shutdownOutputs(outputs []Output) {
+	for _, output := range outputs {
+		closeEncoder(output.Encoder)
+		output.Storage.Shutdown(context.Background())
+	}
+}
+
+func closeEncoder(encoder codec.Encoder) {
+	if closableEncoder, ok := encoder.(codec.ClosableEncoder); ok {
+		closableEncoder.Close(context.Background())
+	}
+}
+
 // NewLogger creates a new audit logging pipeline with the provided elements.
 func NewLogger(
 	intercept InterceptConfig,
@@ -49,18 +125,104 @@ func NewLogger(
 	storage storage.WritableStorage,
 	logger log.Logger,
 	geoIPLookup geoipprovider.LookupProvider,
+	options ...Option,
 ) (Logger, error) {
-	return &loggerImplementation{
+	return NewMultiOutputLogger(
+		intercept,
+		[]Output{
+			{
+				Encoder: encoder,
+				Storage: storage,
+			},
+		},
+		logger,
+		geoIPLookup,
+		options...,
+	)
+}
+
+// Output is an encoder and the storage the encoded audit logs are written to.
+type Output struct {
+	// Encoder encodes the audit log messages.
+	Encoder codec.Encoder
+	// Storage stores the encoded audit logs.
+	Storage storage.WritableStorage
+	// NameSuffix is appended to the connection ID to form the audit log name. This is required when several outputs
+	// write to the same storage location.
+	NameSuffix string
+	// Summary writes a JSON summary of each connection to the storage next to the audit log. The name of the summary
+	// is the audit log name followed by summary.NameSuffix.
+	Summary bool
+}
+
+// NewMultiOutputLogger creates a new audit logging pipeline that writes each connection to all outputs. Each output has
+// its own encoder goroutine and message buffer per connection, while the intercept configuration is shared. If an
+// output falls so far behind that its buffer fills up, its audit log of the connection is aborted instead of holding up
+// the connection and the other outputs.
+//
+// The returned logger also implements tap.Subscriber, allowing live observation of ongoing connections.
+func NewMultiOutputLogger(
+	intercept InterceptConfig,
+	outputs []Output,
+	logger log.Logger,
+	geoIPLookup geoipprovider.LookupProvider,
+	options ...Option,
+) (Logger, error) {
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no audit log outputs provided")
+	}
+	l := &loggerImplementation{
 		intercept:   intercept,
-		encoder:     encoder,
-		storage:     storage,
+		outputs:     outputs,
 		logger:      logger,
 		wg:          &sync.WaitGroup{},
 		geoIPLookup: geoIPLookup,
-	}, nil
+		tap:         tap.New(),
+		metrics:     metrics.NewNoopCollector(),
+		clock:       clock.System(),
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l, nil
+}
+
+// Option configures optional features of the loggers created by New, NewLogger and NewMultiOutputLogger.
+type Option func(l *loggerImplementation)
+
+// WithMetrics sets the collector receiving the metrics of the logger. By default the metrics are discarded.
+func WithMetrics(collector metrics.Collector) Option {
+	return func(l *loggerImplementation) {
+		l.metrics = metrics.OrNoop(collector)
+	}
+}
+
+// WithClock sets the clock providing the timestamps of the messages, for example a clock.Fake to record sessions with
+// predictable timestamps in tests. New, NewStorage and NewStorageV2 also pass the clock to the S3 storage, which
+// calculates the object lock retention dates from it. By default the system clock is used.
+func WithClock(c clock.Clock) Option {
+	return func(l *loggerImplementation) {
+		l.clock = clock.OrSystem(c)
+	}
+}
+
+func newEncoder(
+	config OutputConfig,
+	logger log.Logger,
+	geoIPLookupProvider geoipprovider.LookupProvider,
+) (codec.Encoder, error) {
+	switch config.Format {
+	case FormatBinary:
+		return binary.NewEncoderWithConfig(config.Binary, geoIPLookupProvider)
+	case FormatSyslog:
+		return syslog.NewEncoder(config.Syslog, logger, geoIPLookupProvider)
+	}
+	return NewEncoder(config.Format, logger, geoIPLookupProvider)
 }
 
-// NewEncoder creates a new audit log encoder of the specified format.
+// NewEncoder creates a new audit log encoder of the specified format. The binary encoder uses the default flushing
+// behavior, use binary.NewEncoderWithConfig() to configure it. The syslog format requires configuration and must be
+// created with syslog.NewEncoder() instead.
 func NewEncoder(encoder Format, logger log.Logger, geoIPLookupProvider geoipprovider.LookupProvider) (codec.Encoder, error) {
 	switch encoder {
 	case FormatNone:
@@ -69,20 +231,105 @@ func NewEncoder(encoder Format, logger log.Logger, geoIPLookupProvider geoipprov
 		return asciinema.NewEncoder(logger, geoIPLookupProvider), nil
 	case FormatBinary:
 		return binary.NewEncoder(geoIPLookupProvider), nil
+	case FormatSyslog:
+		return nil, fmt.Errorf("the syslog audit log encoder requires configuration, use syslog.NewEncoder()")
 	default:
 		return nil, fmt.Errorf("invalid audit log encoder: %s", encoder)
 	}
 }
 
-// NewStorage creates a new audit log storage of the specified type and with the specified configuration.
-func NewStorage(config Config, logger log.Logger) (storage.WritableStorage, error) {
+// NewStorage creates a new audit log storage of the specified type and with the specified configuration. Only the
+// metrics collector set by WithMetrics and the clock set by WithClock are used from the options.
+func NewStorage(config Config, logger log.Logger, options ...Option) (storage.WritableStorage, error) {
+	settings := applyOptions(options)
 	switch config.Storage {
 	case StorageNone:
 		return noneStorage.NewStorage(), nil
+	case StorageFile:
+		return file.NewStorage(config.File, logger, file.WithMetrics(settings.metrics))
+	case StorageS3:
+		return s3.NewStorage(config.S3, logger, s3.WithMetrics(settings.metrics), s3.WithClock(settings.clock))
+	case StorageWebhook:
+		return webhook.NewStorage(config.Webhook, logger)
+	case StorageMulti:
+		return newMultiStorage(config.Multi, logger, options)
+	default:
+		return nil, fmt.Errorf("invalid audit log storage: %s", config.Storage)
+	}
+}
+
+// applyOptions returns the logger settings configured by the options, so they can be passed on to the storages.
+func applyOptions(options []Option) *loggerImplementation {
+	l := &loggerImplementation{
+		metrics: metrics.NewNoopCollector(),
+		clock:   clock.System(),
+	}
+	for _, option := range options {
+		option(l)
+	}
+	return l
+}
+
+func newMultiStorage(
+	configs []MultiStorageConfig,
+	logger log.Logger,
+	options []Option,
+) (storage.WritableStorage, error) {
+	var backends []multi.Backend
+	for i, backendConfig := range configs {
+		if backendConfig.Storage == StorageMulti {
+			return nil, fmt.Errorf("multi storages cannot be nested")
+		}
+		st, err := NewStorage(Config{
+			Storage: backendConfig.Storage,
+			File:    backendConfig.File,
+			S3:      backendConfig.S3,
+			Webhook: backendConfig.Webhook,
+		}, logger, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create multi storage backend %d (%w)", i, err)
+		}
+		backends = append(backends, multi.Backend{
+			Name:    backendConfig.Name,
+			Storage: st,
+			Policy:  backendConfig.Policy,
+		})
+	}
+	return multi.NewStorage(backends, logger)
+}
+
+// NewReadOnlyStorage creates an audit log storage for reading the audit logs written by a storage with the specified
+// configuration, for example to process the audit logs with a separate tool. Unlike NewStorage it does not start
+// uploading the audit logs left over in the local directory of the S3 storage.
+func NewReadOnlyStorage(config Config, logger log.Logger) (storage.ReadableStorage, error) {
+	switch config.Storage {
 	case StorageFile:
 		return file.NewStorage(config.File, logger)
 	case StorageS3:
-		return s3.NewStorage(config.S3, logger)
+		return s3.NewReadOnlyStorage(config.S3, logger)
+	case StorageNone, StorageWebhook, StorageMulti:
+		return nil, fmt.Errorf("the %s storage cannot be read", config.Storage)
+	default:
+		return nil, fmt.Errorf("invalid audit log storage: %s", config.Storage)
+	}
+}
+
+// NewStorageV2 creates a new context-aware audit log storage of the specified type and with the specified
+// configuration. Only the metrics collector set by WithMetrics and the clock set by WithClock are used from the
+// options.
+func NewStorageV2(config Config, logger log.Logger, options ...Option) (storage.ReadWriteStorageV2, error) {
+	settings := applyOptions(options)
+	switch config.Storage {
+	case StorageNone:
+		return noneStorage.NewStorageV2(), nil
+	case StorageFile:
+		return file.NewStorageV2(config.File, logger, file.WithMetrics(settings.metrics))
+	case StorageS3:
+		return s3.NewStorageV2(config.S3, logger, s3.WithMetrics(settings.metrics), s3.WithClock(settings.clock))
+	case StorageWebhook:
+		return nil, fmt.Errorf("the webhook storage can only be used for writing audit logs")
+	case StorageMulti:
+		return nil, fmt.Errorf("the multi storage can only be used for writing audit logs")
 	default:
 		return nil, fmt.Errorf("invalid audit log storage: %s", config.Storage)
 	}
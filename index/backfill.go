@@ -0,0 +1,88 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codec"
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
+)
+
+// Backfill adds the audit logs in the storage matching the query to the index and returns the number of indexed
+// audit logs. The summary written next to an audit log is used if present, otherwise the audit log is downloaded and
+// decoded with the decoder. Audit logs that cannot be read or decoded are skipped with a warning.
+func Backfill(
+	ctx context.Context,
+	index Index,
+	st storage.ReadableStorage,
+	decoder codec.Decoder,
+	query storage.Query,
+	logger log.Logger,
+) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	entries, errs := st.List(ctx, query)
+	indexed := 0
+	for entries != nil || errs != nil {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				entries = nil
+				continue
+			}
+			if strings.HasSuffix(entry.Name, summary.NameSuffix) {
+				continue
+			}
+			s, err := readSummary(st, decoder, entry.Name)
+			if err != nil {
+				logger.Warning(log.Wrap(err, codes.EIndexBackfillFailed, "failed to index audit log %s", entry.Name))
+				continue
+			}
+			if err := index.Add(s); err != nil {
+				return indexed, err
+			}
+			indexed++
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return indexed, fmt.Errorf("failed to list audit logs (%w)", err)
+		}
+	}
+	return indexed, ctx.Err()
+}
+
+// readSummary reads the summary written next to the audit log, or computes it by decoding the audit log.
+func readSummary(st storage.ReadableStorage, decoder codec.Decoder, name string) (summary.Summary, error) {
+	s := summary.Summary{}
+	if reader, err := st.OpenReader(name + summary.NameSuffix); err == nil {
+		err := json.NewDecoder(reader).Decode(&s)
+		_ = reader.Close()
+		if err == nil && s.ConnectionID != "" {
+			return s, nil
+		}
+	}
+
+	reader, err := st.OpenReader(name)
+	if err != nil {
+		return s, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	s, err = summary.FromMessages(decoder.Decode(reader))
+	if err != nil {
+		return s, err
+	}
+	if s.ConnectionID == "" {
+		return s, fmt.Errorf("the audit log contains no messages")
+	}
+	return s, nil
+}
@@ -0,0 +1,33 @@
+package index
+
+import (
+	"fmt"
+	"os"
+)
+
+// Config configures the local session index.
+type Config struct {
+	// Enable adds the summary of each connection to the index when the connection ends.
+	Enable bool `json:"enable" yaml:"enable" default:"false"`
+	// Directory is the directory the index is stored in. It must exist.
+	Directory string `json:"directory" yaml:"directory" default:"/var/lib/containerssh/index"`
+}
+
+// Validate validates the index configuration.
+func (c Config) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	return c.validateDirectory()
+}
+
+func (c Config) validateDirectory() error {
+	stat, err := os.Stat(c.Directory)
+	if err != nil {
+		return fmt.Errorf("invalid index directory: %s (%w)", c.Directory, err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("invalid index directory: %s (not a directory)", c.Directory)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package index
+
+import (
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
+)
+
+// encoder aggregates the messages of a connection and adds the summary to the index when the connection ends. It
+// does not write anything to the storage.
+type encoder struct {
+	index *index
+}
+
+func (e *encoder) Encode(messages <-chan message.Message, storage storage.Writer) error {
+	aggregator := summary.NewAggregator()
+	for msg := range messages {
+		aggregator.Add(msg)
+	}
+	if err := e.index.Add(aggregator.Summary()); err != nil {
+		_ = storage.Close()
+		return err
+	}
+	return storage.Close()
+}
+
+func (e *encoder) GetMimeType() string {
+	return summary.MimeType
+}
+
+func (e *encoder) GetFileExtension() string {
+	return ".json"
+}
@@ -0,0 +1,301 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containerssh/auditlog/codec"
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
+)
+
+// FileName is the name of the file storing the index in the index directory. The file contains one JSON-encoded
+// summary per line; when a connection is indexed several times the last line wins.
+const FileName = "sessions.jsonl"
+
+// maxLineLength is the maximum length of a line in the index file.
+const maxLineLength = 64 * 1024 * 1024
+
+type connectionSet map[message.ConnectionID]struct{}
+
+type index struct {
+	lock       *sync.RWMutex
+	file       *os.File
+	summaries  map[message.ConnectionID]summary.Summary
+	byUsername map[string]connectionSet
+	byCountry  map[string]connectionSet
+	byProgram  map[string]connectionSet
+}
+
+func (i *index) Add(s summary.Summary) error {
+	if s.ConnectionID == "" {
+		return fmt.Errorf("cannot index a summary without a connection ID")
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary (%w)", err)
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.file == nil {
+		return fmt.Errorf("the index is closed")
+	}
+	if _, err := i.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write index file (%w)", err)
+	}
+	i.add(s)
+	return nil
+}
+
+// add updates the in-memory indexes. The caller must hold the write lock.
+func (i *index) add(s summary.Summary) {
+	if previous, ok := i.summaries[s.ConnectionID]; ok {
+		i.remove(previous)
+	}
+	i.summaries[s.ConnectionID] = s
+	if s.Authenticated {
+		addToSet(i.byUsername, s.Username, s.ConnectionID)
+	}
+	addToSet(i.byCountry, strings.ToUpper(s.Country), s.ConnectionID)
+	for _, word := range programWords(s.Programs) {
+		addToSet(i.byProgram, word, s.ConnectionID)
+	}
+}
+
+func (i *index) remove(s summary.Summary) {
+	delete(i.summaries, s.ConnectionID)
+	removeFromSet(i.byUsername, s.Username, s.ConnectionID)
+	removeFromSet(i.byCountry, strings.ToUpper(s.Country), s.ConnectionID)
+	for _, word := range programWords(s.Programs) {
+		removeFromSet(i.byProgram, word, s.ConnectionID)
+	}
+}
+
+func addToSet(sets map[string]connectionSet, key string, connectionID message.ConnectionID) {
+	set, ok := sets[key]
+	if !ok {
+		set = connectionSet{}
+		sets[key] = set
+	}
+	set[connectionID] = struct{}{}
+}
+
+func removeFromSet(sets map[string]connectionSet, key string, connectionID message.ConnectionID) {
+	if set, ok := sets[key]; ok {
+		delete(set, connectionID)
+		if len(set) == 0 {
+			delete(sets, key)
+		}
+	}
+}
+
+func (i *index) Search(ctx context.Context, query Query) ([]summary.Summary, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	var candidates []connectionSet
+	if query.Username != "" {
+		candidates = append(candidates, i.byUsername[query.Username])
+	}
+	if query.Program != "" {
+		candidates = append(candidates, i.byProgram[strings.ToLower(query.Program)])
+	}
+	if len(query.Countries) > 0 {
+		countries := connectionSet{}
+		for _, country := range query.Countries {
+			for connectionID := range i.byCountry[strings.ToUpper(country)] {
+				countries[connectionID] = struct{}{}
+			}
+		}
+		candidates = append(candidates, countries)
+	}
+
+	var result []summary.Summary
+	check := func(connectionID message.ConnectionID) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, set := range candidates {
+			if _, ok := set[connectionID]; !ok {
+				return nil
+			}
+		}
+		s := i.summaries[connectionID]
+		if query.matches(s) {
+			result = append(result, s)
+		}
+		return nil
+	}
+	if len(candidates) > 0 {
+		// Iterate over the smallest set and look up the rest.
+		sort.Slice(candidates, func(a, b int) bool {
+			return len(candidates[a]) < len(candidates[b])
+		})
+		for connectionID := range candidates[0] {
+			if err := check(connectionID); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for connectionID := range i.summaries {
+			if err := check(connectionID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].StartTime != result[b].StartTime {
+			return result[a].StartTime > result[b].StartTime
+		}
+		return result[a].ConnectionID < result[b].ConnectionID
+	})
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+func (i *index) Encoder() codec.Encoder {
+	return &encoder{index: i}
+}
+
+func (i *index) OpenWriter(_ string) (storage.Writer, error) {
+	return &discardWriter{}, nil
+}
+
+func (i *index) Shutdown(_ context.Context) {
+	_ = i.Close()
+}
+
+func (i *index) Close() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.file == nil {
+		return nil
+	}
+	err := i.file.Close()
+	i.file = nil
+	return err
+}
+
+// load reads the index file. It returns true if the file should be compacted because it contains replaced summaries
+// or an incomplete last line, for example after a crash.
+func (i *index) load(file string) (bool, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open index file %s (%w)", file, err)
+	}
+	defer func() {
+		_ = fh.Close()
+	}()
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	// terminated records if the last line read ended with a newline. A write interrupted by a crash leaves an incomplete
+	// line at the end of the file.
+	terminated := true
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			terminated = bytes.IndexByte(data[:advance], '\n') >= 0
+		}
+		return advance, token, err
+	})
+	lines := 0
+	skipped := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		s := summary.Summary{}
+		if err := json.Unmarshal(line, &s); err != nil || s.ConnectionID == "" {
+			// Undecodable lines are skipped so they don't hide the summaries after them. They are removed by the
+			// compaction.
+			skipped++
+			continue
+		}
+		lines++
+		i.add(s)
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read index file %s (%w)", file, err)
+	}
+	return skipped > 0 || !terminated || lines != len(i.summaries), nil
+}
+
+// compact rewrites the index file with the current summaries only.
+func (i *index) compact(file string) error {
+	tmpFile := file + ".tmp"
+	fh, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to create index file %s (%w)", tmpFile, err)
+	}
+	encoder := json.NewEncoder(fh)
+	for _, s := range i.summaries {
+		if err := encoder.Encode(s); err != nil {
+			_ = fh.Close()
+			_ = os.Remove(tmpFile)
+			return fmt.Errorf("failed to write index file %s (%w)", tmpFile, err)
+		}
+	}
+	if err := fh.Close(); err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("failed to close index file %s (%w)", tmpFile, err)
+	}
+	if err := os.Rename(tmpFile, file); err != nil {
+		return fmt.Errorf("failed to replace index file %s (%w)", file, err)
+	}
+	return nil
+}
+
+func open(directory string) (*index, error) {
+	i := &index{
+		lock:       &sync.RWMutex{},
+		summaries:  map[message.ConnectionID]summary.Summary{},
+		byUsername: map[string]connectionSet{},
+		byCountry:  map[string]connectionSet{},
+		byProgram:  map[string]connectionSet{},
+	}
+	file := filepath.Join(directory, FileName)
+	needsCompaction, err := i.load(file)
+	if err != nil {
+		return nil, err
+	}
+	if needsCompaction {
+		if err := i.compact(file); err != nil {
+			return nil, err
+		}
+	}
+	i.file, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file %s (%w)", file, err)
+	}
+	return i, nil
+}
+
+type discardWriter struct {
+}
+
+func (d *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (d *discardWriter) Close() error {
+	return nil
+}
+
+func (d *discardWriter) SetMetadata(_ int64, _ string, _ string, _ *string) {
+}
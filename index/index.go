@@ -0,0 +1,27 @@
+package index
+
+import (
+	"context"
+
+	"github.com/containerssh/auditlog/codec"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
+)
+
+// Index is a local, embedded index of session summaries that can be searched without downloading and decoding the
+// audit logs.
+//
+// The index is also a storage.WritableStorage discarding everything written to it, so it can be combined with the
+// encoder returned by Encoder as an audit log output. Shutdown closes the index.
+type Index interface {
+	storage.WritableStorage
+
+	// Add adds the summary of a connection to the index, replacing the previous summary of the same connection.
+	Add(s summary.Summary) error
+	// Search returns the summaries matching the query, newest first.
+	Search(ctx context.Context, query Query) ([]summary.Summary, error)
+	// Encoder returns an encoder that adds the summary of each connection to the index when the connection ends.
+	Encoder() codec.Encoder
+	// Close closes the index file. The index cannot be used after it is closed.
+	Close() error
+}
@@ -0,0 +1,235 @@
+package index_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerssh/geoip/dummy"
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog"
+	"github.com/containerssh/auditlog/codec/binary"
+	"github.com/containerssh/auditlog/index"
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/file"
+	"github.com/containerssh/auditlog/summary"
+)
+
+func newSummary(connectionID string, start time.Time, username string, country string, programs ...string) summary.Summary {
+	s := summary.Summary{
+		ConnectionID:  message.ConnectionID(connectionID),
+		StartTime:     start.UnixNano(),
+		RemoteAddr:    "127.0.0.1",
+		Country:       country,
+		Authenticated: username != "",
+		Username:      username,
+	}
+	for _, program := range programs {
+		s.Programs = append(s.Programs, summary.Program{Type: summary.ProgramTypeExec, Command: program})
+	}
+	return s
+}
+
+func connectionIDs(summaries []summary.Summary) []message.ConnectionID {
+	var result []message.ConnectionID
+	for _, s := range summaries {
+		result = append(result, s.ConnectionID)
+	}
+	return result
+}
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	idx, err := index.New(index.Config{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, s := range []summary.Summary{
+		newSummary("1", now.Add(-10*24*time.Hour), "alice", "US", "kubectl get pods"),
+		newSummary("2", now.Add(-2*time.Hour), "alice", "US", "/usr/local/bin/kubectl delete pod foo"),
+		newSummary("3", now.Add(-1*time.Hour), "alice", "DE", "kubectl logs foo"),
+		newSummary("4", now.Add(-3*time.Hour), "bob", "US", "kubectl get pods"),
+		newSummary("5", now.Add(-4*time.Hour), "alice", "US", "ls -l"),
+		newSummary("6", now.Add(-5*time.Hour), "", "US"),
+	} {
+		assert.NoError(t, idx.Add(s))
+	}
+
+	ctx := context.Background()
+	result, err := idx.Search(ctx, index.Query{
+		Username:         "alice",
+		Program:          "kubectl",
+		ExcludeCountries: []string{"AT", "DE"},
+		StartTime:        now.Add(-7 * 24 * time.Hour),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []message.ConnectionID{"2"}, connectionIDs(result))
+
+	result, err = idx.Search(ctx, index.Query{Program: "KUBECTL", Countries: []string{"us"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []message.ConnectionID{"2", "4", "1"}, connectionIDs(result))
+
+	result, err = idx.Search(ctx, index.Query{Limit: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []message.ConnectionID{"3", "2"}, connectionIDs(result))
+
+	// Replacing a summary removes the previous one from the indexes.
+	assert.NoError(t, idx.Add(newSummary("5", now.Add(-4*time.Hour), "alice", "US", "kubectl version")))
+	assert.NoError(t, idx.Close())
+
+	idx, err = index.New(index.Config{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+	result, err = idx.Search(ctx, index.Query{Username: "alice", Countries: []string{"US"}, Program: "kubectl"})
+	assert.NoError(t, err)
+	assert.Equal(t, []message.ConnectionID{"2", "5", "1"}, connectionIDs(result))
+	result, err = idx.Search(ctx, index.Query{Program: "ls"})
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestLoadSkipsCorruptLines(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	// A corrupt line in the middle and a line left incomplete by a crash.
+	data := `{"connectionId":"1","authenticated":true,"username":"alice"}` + "\n" +
+		`{"connectionId":` + "\n" +
+		`{"connectionId":"2","authenticated":true,"username":"alice"}` + "\n" +
+		`{"connectionId":"3","user`
+	if err := ioutil.WriteFile(filepath.Join(dir, index.FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := index.New(index.Config{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := idx.Search(context.Background(), index.Query{Username: "alice"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []message.ConnectionID{"1", "2"}, connectionIDs(result))
+	// The incomplete line was removed, so new summaries are not appended to it.
+	assert.NoError(t, idx.Add(newSummary("4", time.Now(), "alice", "US")))
+	assert.NoError(t, idx.Close())
+
+	idx, err = index.New(index.Config{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = idx.Close()
+	}()
+	result, err = idx.Search(context.Background(), index.Query{Username: "alice"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []message.ConnectionID{"1", "2", "4"}, connectionIDs(result))
+}
+
+func TestBackfillAndEncoder(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	indexDir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(indexDir)
+	}()
+
+	logger := log.NewTestLogger(t)
+	geoIPLookupProvider, _ := dummy.New()
+	auditLogger, err := auditlog.New(auditlog.Config{
+		Enable:  true,
+		Format:  auditlog.FormatBinary,
+		Storage: auditlog.StorageFile,
+		File:    file.Config{Directory: dir},
+		Index:   index.Config{Enable: true, Directory: indexDir},
+	}, geoIPLookupProvider, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "bob"} {
+		connection, err := auditLogger.OnConnect(
+			message.ConnectionID(username+"-connection"),
+			net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		connection.OnHandshakeSuccessful(username)
+		channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+		channel.OnRequestExec(0, "kubectl get pods")
+		channel.OnExit(0)
+		channel.OnClose()
+		connection.OnDisconnect()
+	}
+	auditLogger.Shutdown(context.Background())
+
+	idx, err := index.New(index.Config{Directory: indexDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := idx.Search(context.Background(), index.Query{Username: "alice", Program: "kubectl"})
+	assert.NoError(t, err)
+	assert.Equal(t, []message.ConnectionID{"alice-connection"}, connectionIDs(result))
+	assert.NoError(t, idx.Close())
+
+	backfillDir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(backfillDir)
+	}()
+	backfilled, err := index.New(index.Config{Directory: backfillDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = backfilled.Close()
+	}()
+	fileStorage, err := file.NewStorage(file.Config{Directory: dir}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed, err := index.Backfill(
+		context.Background(),
+		backfilled,
+		fileStorage,
+		binary.NewDecoder(),
+		storage.Query{},
+		logger,
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, indexed)
+	backfilledResult, err := backfilled.Search(context.Background(), index.Query{Username: "alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, result, backfilledResult)
+}
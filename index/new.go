@@ -0,0 +1,10 @@
+package index
+
+// New opens the index in the configured directory, creating the index file if it does not exist yet. The directory
+// must exist.
+func New(config Config) (Index, error) {
+	if err := config.validateDirectory(); err != nil {
+		return nil, err
+	}
+	return open(config.Directory)
+}
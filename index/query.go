@@ -0,0 +1,74 @@
+package index
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/containerssh/auditlog/summary"
+)
+
+// Query filters the sessions returned by Index.Search. Empty fields do not filter.
+type Query struct {
+	// Username only returns sessions where the user authenticated with this username.
+	Username string
+	// Program only returns sessions that started a program containing this word, for example "kubectl" matches
+	// "/usr/local/bin/kubectl get pods". Matching is case-insensitive.
+	Program string
+	// Countries only returns sessions from one of these country codes.
+	Countries []string
+	// ExcludeCountries skips sessions from these country codes.
+	ExcludeCountries []string
+	// RemoteAddr only returns sessions from this IP address.
+	RemoteAddr string
+	// StartTime only returns sessions that started at or after this time.
+	StartTime time.Time
+	// EndTime only returns sessions that started before this time.
+	EndTime time.Time
+	// Limit is the maximum number of sessions returned. 0 returns all matching sessions.
+	Limit int
+}
+
+// matches checks the filters that are not served by the inverted indexes.
+func (q Query) matches(s summary.Summary) bool {
+	for _, country := range q.ExcludeCountries {
+		if strings.EqualFold(country, s.Country) {
+			return false
+		}
+	}
+	if q.RemoteAddr != "" && q.RemoteAddr != s.RemoteAddr {
+		return false
+	}
+	if !q.StartTime.IsZero() && s.StartTime < q.StartTime.UnixNano() {
+		return false
+	}
+	if !q.EndTime.IsZero() && s.StartTime >= q.EndTime.UnixNano() {
+		return false
+	}
+	return true
+}
+
+// programWords splits the commands of the programs into lowercase words. Paths are also indexed by their base name
+// so a program can be found regardless of where it is installed.
+func programWords(programs []summary.Program) []string {
+	var words []string
+	for _, program := range programs {
+		for _, word := range strings.FieldsFunc(program.Command, isSeparator) {
+			word = strings.ToLower(word)
+			words = append(words, word)
+			if strings.Contains(word, "/") {
+				words = append(words, path.Base(word))
+			}
+		}
+	}
+	return words
+}
+
+func isSeparator(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', ';', '|', '&', '(', ')', '`', '"', '\'':
+		return true
+	default:
+		return false
+	}
+}
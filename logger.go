@@ -6,9 +6,11 @@ import (
 	"net"
 
 	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
 )
 
-// Logger is a top level audit logger.
+// Logger is a top level audit logger. The loggers created by New, NewLogger and NewMultiOutputLogger also implement
+// tap.Subscriber to observe ongoing connections live and HealthChecker to check the storages.
 type Logger interface {
 	// OnConnect creates an audit log message for a new connection and simultaneously returns a connection object for
 	//           connection-specific messages
@@ -18,6 +20,15 @@ type Logger interface {
 	Shutdown(shutdownContext context.Context)
 }
 
+// HealthChecker reports whether the audit logger is able to record audit logs. Host applications can use it to refuse
+// new connections while the audit logs cannot be stored.
+type HealthChecker interface {
+	// HealthCheck checks the storages of all outputs. Storages that do not implement storage.HealthCheckableStorage
+	// are considered healthy. With several outputs the check names are prefixed with the output index, for example
+	// "output1.s3.bucket".
+	HealthCheck(ctx context.Context) storage.Health
+}
+
 // Connection is an audit logger for a specific connection
 type Connection interface {
 	// OnDisconnect creates an audit log message for a disconnect event.
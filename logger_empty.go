@@ -6,6 +6,8 @@ import (
 	"net"
 
 	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/tap"
 )
 
 type empty struct{}
@@ -99,4 +101,15 @@ func (e *empty) OnConnect(_ message.ConnectionID, _ net.TCPAddr) (Connection, er
 	return e, nil
 }
 
+func (e *empty) Subscribe(connectionID message.ConnectionID, bufferSize uint) tap.Subscription {
+	// Nothing is ever logged, so the subscription ends immediately.
+	subscription := tap.New().Subscribe(connectionID, bufferSize)
+	subscription.Close()
+	return subscription
+}
+
+func (e *empty) HealthCheck(_ context.Context) storage.Health {
+	return storage.NewHealth()
+}
+
 func (e *empty) Shutdown(_ context.Context) {}
@@ -2,83 +2,234 @@ package auditlog
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"sync"
 	"time"
 
+	"github.com/containerssh/auditlog/clock"
 	"github.com/containerssh/auditlog/codec"
+	"github.com/containerssh/auditlog/codes"
 	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/metrics"
 	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
+	"github.com/containerssh/auditlog/tap"
 
 	"github.com/containerssh/geoip/geoipprovider"
 	"github.com/containerssh/log"
 )
 
+// outputBufferSize is the number of messages buffered for each output of a connection. If an output falls this far
+// behind, its audit log of the connection is aborted so it does not hold up the connection and the other outputs.
+const outputBufferSize = 1024
+
 type loggerImplementation struct {
 	intercept   InterceptConfig
-	encoder     codec.Encoder
-	storage     storage.WritableStorage
+	outputs     []Output
 	logger      log.Logger
 	wg          *sync.WaitGroup
 	geoIPLookup geoipprovider.LookupProvider
+	tap         tap.Tap
+	metrics     metrics.Collector
+	clock       clock.Clock
 }
 
 type loggerConnection struct {
 	l *loggerImplementation
 
-	ip             net.TCPAddr
-	messageChannel chan message.Message
-	connectionID   message.ConnectionID
-	lock           *sync.Mutex
-	closed         bool
+	ip              net.TCPAddr
+	// messageChannels contains the buffered channels of the outputs, nil for outputs that overflowed.
+	messageChannels []chan message.Message
+	writers         []*sessionInfoWriter
+	// ioFilters contains the writers of the outputs that can stop the recording of I/O, nil for other outputs.
+	ioFilters    []storage.IOFilterWriter
+	connectionID message.ConnectionID
+	lock         *sync.Mutex
+	closed       bool
+	summary      summary.Aggregator
+	// start is the time of the first message, guarded by lock. With the system clock it carries a monotonic clock
+	// reading, so the offsets of the messages are not affected by changes to the wall clock.
+	start time.Time
 }
 
 func (l *loggerConnection) log(msg message.Message) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	if !l.closed {
-		l.messageChannel <- msg
+		// The time is taken while holding the lock so the offsets are in the order of the messages.
+		now := l.l.clock.Now()
+		if l.start.IsZero() {
+			l.start = now
+		}
+		msg.Timestamp = now.UnixNano()
+		msg.Offset = int64(now.Sub(l.start))
+		l.summary.Add(msg)
+		l.l.collectMessageMetrics(msg)
+		for i, messageChannel := range l.messageChannels {
+			if messageChannel == nil {
+				continue
+			}
+			if msg.MessageType == message.TypeIO && l.ioFilters[i] != nil && !l.ioFilters[i].AcceptsIO() {
+				continue
+			}
+			// The send must not block while holding the lock, as that would hold up the connection and the other
+			// outputs.
+			select {
+			case messageChannel <- msg:
+			default:
+				l.abortOutput(i)
+			}
+		}
+		l.l.tap.Publish(msg)
 	}
 }
 
+// abortOutput stops sending messages to an output whose buffer is full and aborts its audit log, since the audit log
+// would miss messages. It must be called with the lock held.
+func (l *loggerConnection) abortOutput(i int) {
+	output := l.l.outputs[i]
+	l.writers[i].aborted = true
+	close(l.messageChannels[i])
+	l.messageChannels[i] = nil
+	l.l.metrics.Add(
+		metrics.OutputOverflowsTotal,
+		1,
+		metrics.Label{Name: "mime_type", Value: output.Encoder.GetMimeType()},
+	)
+	l.l.logger.Warning(log.NewMessage(
+		codes.EOutputOverflow,
+		"aborting audit log %s, the output did not keep up with the connection",
+		string(l.connectionID)+output.NameSuffix,
+	).Label("log", string(l.connectionID)+output.NameSuffix))
+}
+
+func (l *loggerConnection) getSessionInfo() storage.SessionInfo {
+	s := l.summary.Summary()
+	info := storage.SessionInfo{
+		EndTime:     s.EndTime / 1000000000,
+		Channels:    s.ChannelsOpened(),
+		StdinBytes:  s.Bytes.Stdin,
+		StdoutBytes: s.Bytes.Stdout,
+		StderrBytes: s.Bytes.Stderr,
+		ExitStatus:  s.LastExitStatus(),
+	}
+	for _, method := range s.AuthMethods() {
+		info.AuthMethods = append(info.AuthMethods, string(method))
+	}
+	for _, program := range s.Programs {
+		if program.Type == summary.ProgramTypeExec {
+			info.Programs = append(info.Programs, program.Command)
+		}
+	}
+	return info
+}
+
 type loggerChannel struct {
 	c *loggerConnection
 
 	channelID message.ChannelID
 }
 
+func (l *loggerImplementation) HealthCheck(ctx context.Context) storage.Health {
+	if len(l.outputs) == 1 {
+		return storage.HealthCheck(ctx, l.outputs[0].Storage)
+	}
+	health := storage.NewHealth()
+	for i, output := range l.outputs {
+		health = health.Merge(fmt.Sprintf("output%d.", i), storage.HealthCheck(ctx, output.Storage))
+	}
+	return health
+}
+
+func (l *loggerImplementation) Subscribe(connectionID message.ConnectionID, bufferSize uint) tap.Subscription {
+	return l.tap.Subscribe(connectionID, bufferSize)
+}
+
 func (l *loggerImplementation) Shutdown(shutdownContext context.Context) {
 	l.wg.Wait()
-	l.storage.Shutdown(shutdownContext)
+	shutdownWg := &sync.WaitGroup{}
+	for _, output := range l.outputs {
+		shutdownWg.Add(1)
+		go func(output Output) {
+			defer shutdownWg.Done()
+			if encoder, ok := output.Encoder.(codec.ClosableEncoder); ok {
+				encoder.Close(shutdownContext)
+			}
+			output.Storage.Shutdown(shutdownContext)
+		}(output)
+	}
+	shutdownWg.Wait()
 }
 
 //region Connection
 
 func (l *loggerImplementation) OnConnect(connectionID message.ConnectionID, ip net.TCPAddr) (Connection, error) {
-	name := string(connectionID)
-	writer, err := l.storage.OpenWriter(name)
-	if err != nil {
-		return nil, err
+	writers := make([]storage.Writer, len(l.outputs))
+	for i, output := range l.outputs {
+		writer, err := output.Storage.OpenWriter(string(connectionID) + output.NameSuffix)
+		if err != nil {
+			// The connection is refused, so the audit logs already opened are discarded if possible.
+			for _, openedWriter := range writers[:i] {
+				if abortableWriter, ok := openedWriter.(storage.AbortableWriter); ok {
+					_ = abortableWriter.Abort()
+				} else {
+					_ = openedWriter.Close()
+				}
+			}
+			return nil, err
+		}
+		if contentTypeWriter, ok := writer.(storage.ContentTypeWriter); ok {
+			contentTypeWriter.SetContentType(output.Encoder.GetMimeType())
+		}
+		writers[i] = writer
 	}
 	conn := &loggerConnection{
-		l:              l,
-		ip:             ip,
-		connectionID:   connectionID,
-		messageChannel: make(chan message.Message),
-		lock:           &sync.Mutex{},
+		l:               l,
+		ip:              ip,
+		connectionID:    connectionID,
+		messageChannels: make([]chan message.Message, len(l.outputs)),
+		writers:         make([]*sessionInfoWriter, len(l.outputs)),
+		ioFilters:       make([]storage.IOFilterWriter, len(l.outputs)),
+		lock:            &sync.Mutex{},
+		summary:         summary.NewAggregator(),
 	}
-	l.wg.Add(1)
-	go func() {
-		defer l.wg.Done()
-		err := l.encoder.Encode(conn.messageChannel, writer)
-		if err != nil {
-			l.logger.Emergency(err)
+	for i, output := range l.outputs {
+		messageChannel := make(chan message.Message, outputBufferSize)
+		conn.messageChannels[i] = messageChannel
+		if ioFilter, ok := writers[i].(storage.IOFilterWriter); ok {
+			conn.ioFilters[i] = ioFilter
 		}
-	}()
+		var encoderChannel <-chan message.Message = messageChannel
+		if l.intercept.Coalesce.Window > 0 {
+			encoderChannel = coalesce(messageChannel, l.intercept.Coalesce)
+		}
+		conn.writers[i] = &sessionInfoWriter{
+			Writer: writers[i],
+			conn:   conn,
+		}
+		l.wg.Add(1)
+		go func(encoder codec.Encoder, writer storage.Writer) {
+			defer l.wg.Done()
+			err := encoder.Encode(encoderChannel, &metricsWriter{
+				Writer:    writer,
+				collector: l.metrics,
+				mimeType:  encoder.GetMimeType(),
+			})
+			if err != nil {
+				l.metrics.Add(
+					metrics.EncoderErrorsTotal,
+					1,
+					metrics.Label{Name: "mime_type", Value: encoder.GetMimeType()},
+				)
+				l.logger.Emergency(err)
+			}
+		}(output.Encoder, conn.writers[i])
+	}
+	l.metrics.Add(metrics.ActiveConnections, 1)
 	conn.log(message.Message{
 		ConnectionID: connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeConnect,
 		Payload: message.PayloadConnect{
 			RemoteAddr: ip.IP.String(),
@@ -92,21 +243,28 @@ func (l *loggerImplementation) OnConnect(connectionID message.ConnectionID, ip n
 func (l *loggerConnection) OnDisconnect() {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeDisconnect,
 		Payload:      nil,
 		ChannelID:    nil,
 	})
 	l.lock.Lock()
 	defer l.lock.Unlock()
-	close(l.messageChannel)
+	if l.closed {
+		return
+	}
+	for _, messageChannel := range l.messageChannels {
+		if messageChannel != nil {
+			close(messageChannel)
+		}
+	}
 	l.closed = true
+	l.l.metrics.Add(metrics.ActiveConnections, -1)
+	l.writeSummaries()
 }
 
 func (l *loggerConnection) OnAuthPassword(username string, password []byte) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPassword,
 		Payload: message.PayloadAuthPassword{
 			Username: username,
@@ -119,7 +277,6 @@ func (l *loggerConnection) OnAuthPassword(username string, password []byte) {
 func (l *loggerConnection) OnAuthPasswordSuccess(username string, password []byte) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPasswordSuccessful,
 		Payload: message.PayloadAuthPassword{
 			Username: username,
@@ -132,7 +289,6 @@ func (l *loggerConnection) OnAuthPasswordSuccess(username string, password []byt
 func (l *loggerConnection) OnAuthPasswordFailed(username string, password []byte) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPasswordFailed,
 		Payload: message.PayloadAuthPassword{
 			Username: username,
@@ -145,7 +301,6 @@ func (l *loggerConnection) OnAuthPasswordFailed(username string, password []byte
 func (l *loggerConnection) OnAuthPasswordBackendError(username string, password []byte, reason string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPasswordBackendError,
 		Payload: message.PayloadAuthPasswordBackendError{
 			Username: username,
@@ -159,7 +314,6 @@ func (l *loggerConnection) OnAuthPasswordBackendError(username string, password
 func (l *loggerConnection) OnAuthPubKey(username string, pubKey string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPubKey,
 		Payload: message.PayloadAuthPubKey{
 			Username: username,
@@ -172,7 +326,6 @@ func (l *loggerConnection) OnAuthPubKey(username string, pubKey string) {
 func (l *loggerConnection) OnAuthPubKeySuccess(username string, pubKey string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPubKeySuccessful,
 		Payload: message.PayloadAuthPubKey{
 			Username: username,
@@ -185,7 +338,6 @@ func (l *loggerConnection) OnAuthPubKeySuccess(username string, pubKey string) {
 func (l *loggerConnection) OnAuthPubKeyFailed(username string, pubKey string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPubKeyFailed,
 		Payload: message.PayloadAuthPubKey{
 			Username: username,
@@ -198,7 +350,6 @@ func (l *loggerConnection) OnAuthPubKeyFailed(username string, pubKey string) {
 func (l *loggerConnection) OnAuthPubKeyBackendError(username string, pubKey string, reason string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthPubKeyBackendError,
 		Payload: message.PayloadAuthPubKeyBackendError{
 			Username: username,
@@ -216,7 +367,6 @@ func (l *loggerConnection) OnAuthKeyboardInteractiveChallenge(
 ) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthKeyboardInteractiveChallenge,
 		Payload: message.PayloadAuthKeyboardInteractiveChallenge{
 			Username:    username,
@@ -230,7 +380,6 @@ func (l *loggerConnection) OnAuthKeyboardInteractiveChallenge(
 func (l *loggerConnection) OnAuthKeyboardInteractiveAnswer(username string, answers []message.KeyboardInteractiveAnswer) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthKeyboardInteractiveAnswer,
 		Payload: message.PayloadAuthKeyboardInteractiveAnswer{
 			Username: username,
@@ -243,7 +392,6 @@ func (l *loggerConnection) OnAuthKeyboardInteractiveAnswer(username string, answ
 func (l *loggerConnection) OnAuthKeyboardInteractiveFailed(username string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthKeyboardInteractiveFailed,
 		Payload: message.PayloadAuthKeyboardInteractiveFailed{
 			Username: username,
@@ -255,7 +403,6 @@ func (l *loggerConnection) OnAuthKeyboardInteractiveFailed(username string) {
 func (l *loggerConnection) OnAuthKeyboardInteractiveBackendError(username string, reason string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeAuthKeyboardInteractiveBackendError,
 		Payload: message.PayloadAuthKeyboardInteractiveBackendError{
 			Username: username,
@@ -268,7 +415,6 @@ func (l *loggerConnection) OnAuthKeyboardInteractiveBackendError(username string
 func (l *loggerConnection) OnHandshakeFailed(reason string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeHandshakeFailed,
 		Payload: message.PayloadHandshakeFailed{
 			Reason: reason,
@@ -280,7 +426,6 @@ func (l *loggerConnection) OnHandshakeFailed(reason string) {
 func (l *loggerConnection) OnHandshakeSuccessful(username string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeHandshakeSuccessful,
 		Payload: message.PayloadHandshakeSuccessful{
 			Username: username,
@@ -292,7 +437,6 @@ func (l *loggerConnection) OnHandshakeSuccessful(username string) {
 func (l *loggerConnection) OnGlobalRequestUnknown(requestType string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeGlobalRequestUnknown,
 		Payload: message.PayloadGlobalRequestUnknown{
 			RequestType: requestType,
@@ -304,7 +448,6 @@ func (l *loggerConnection) OnGlobalRequestUnknown(requestType string) {
 func (l *loggerConnection) OnNewChannel(channelID message.ChannelID, channelType string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeNewChannel,
 		Payload: message.PayloadNewChannel{
 			ChannelType: channelType,
@@ -316,7 +459,6 @@ func (l *loggerConnection) OnNewChannel(channelID message.ChannelID, channelType
 func (l *loggerConnection) OnNewChannelFailed(channelID message.ChannelID, channelType string, reason string) {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeNewChannelFailed,
 		Payload: message.PayloadNewChannelFailed{
 			ChannelType: channelType,
@@ -329,7 +471,6 @@ func (l *loggerConnection) OnNewChannelFailed(channelID message.ChannelID, chann
 func (l *loggerConnection) OnNewChannelSuccess(channelID message.ChannelID, channelType string) Channel {
 	l.log(message.Message{
 		ConnectionID: l.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeNewChannelSuccessful,
 		Payload: message.PayloadNewChannelSuccessful{
 			ChannelType: channelType,
@@ -349,7 +490,6 @@ func (l *loggerConnection) OnNewChannelSuccess(channelID message.ChannelID, chan
 func (l *loggerChannel) OnRequestUnknown(requestID uint64, requestType string, payload []byte) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestUnknownType,
 		Payload: message.PayloadChannelRequestUnknownType{
 			RequestID:   requestID,
@@ -363,7 +503,6 @@ func (l *loggerChannel) OnRequestUnknown(requestID uint64, requestType string, p
 func (l *loggerChannel) OnRequestDecodeFailed(requestID uint64, requestType string, payload []byte, reason string) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestDecodeFailed,
 		Payload: message.PayloadChannelRequestDecodeFailed{
 			RequestID:   requestID,
@@ -378,7 +517,6 @@ func (l *loggerChannel) OnRequestDecodeFailed(requestID uint64, requestType stri
 func (l *loggerChannel) OnRequestSetEnv(requestID uint64, name string, value string) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestSetEnv,
 		Payload: message.PayloadChannelRequestSetEnv{
 			RequestID: requestID,
@@ -392,7 +530,6 @@ func (l *loggerChannel) OnRequestSetEnv(requestID uint64, name string, value str
 func (l *loggerChannel) OnRequestExec(requestID uint64, program string) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestExec,
 		Payload: message.PayloadChannelRequestExec{
 			RequestID: requestID,
@@ -413,7 +550,6 @@ func (l *loggerChannel) OnRequestPty(
 ) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestPty,
 		Payload: message.PayloadChannelRequestPty{
 			RequestID: requestID,
@@ -431,7 +567,6 @@ func (l *loggerChannel) OnRequestPty(
 func (l *loggerChannel) OnRequestShell(requestID uint64) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestShell,
 		Payload: message.PayloadChannelRequestShell{
 			RequestID: requestID,
@@ -443,7 +578,6 @@ func (l *loggerChannel) OnRequestShell(requestID uint64) {
 func (l *loggerChannel) OnRequestSignal(requestID uint64, signal string) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestSignal,
 		Payload: message.PayloadChannelRequestSignal{
 			RequestID: requestID,
@@ -456,7 +590,6 @@ func (l *loggerChannel) OnRequestSignal(requestID uint64, signal string) {
 func (l *loggerChannel) OnRequestSubsystem(requestID uint64, subsystem string) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestSubsystem,
 		Payload: message.PayloadChannelRequestSubsystem{
 			RequestID: requestID,
@@ -469,7 +602,6 @@ func (l *loggerChannel) OnRequestSubsystem(requestID uint64, subsystem string) {
 func (l *loggerChannel) OnRequestWindow(requestID uint64, columns uint32, rows uint32, width uint32, height uint32) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeChannelRequestWindow,
 		Payload: message.PayloadChannelRequestWindow{
 			RequestID: requestID,
@@ -485,7 +617,6 @@ func (l *loggerChannel) OnRequestWindow(requestID uint64, columns uint32, rows u
 func (l *loggerChannel) io(stream message.Stream, data []byte) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeIO,
 		Payload: message.PayloadIO{
 			Stream: stream,
@@ -531,7 +662,6 @@ func (l *loggerChannel) GetStderrProxy(stderr io.Writer) io.Writer {
 func (l *loggerChannel) OnRequestFailed(requestID uint64, reason error) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeRequestFailed,
 		Payload: message.PayloadRequestFailed{
 			RequestID: requestID,
@@ -544,7 +674,6 @@ func (l *loggerChannel) OnRequestFailed(requestID uint64, reason error) {
 func (l *loggerChannel) OnExit(exitStatus uint32) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeExit,
 		Payload: message.PayloadExit{
 			ExitStatus: exitStatus,
@@ -556,7 +685,6 @@ func (l *loggerChannel) OnExit(exitStatus uint32) {
 func (l *loggerChannel) OnExitSignal(signal string, coreDumped bool, errorMessage string, languageTag string) {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeExitSignal,
 		Payload: message.PayloadExitSignal{
 			Signal:       signal,
@@ -571,7 +699,6 @@ func (l *loggerChannel) OnExitSignal(signal string, coreDumped bool, errorMessag
 func (l *loggerChannel) OnWriteClose() {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeWriteClose,
 		ChannelID:    l.channelID,
 	})
@@ -580,7 +707,6 @@ func (l *loggerChannel) OnWriteClose() {
 func (l *loggerChannel) OnClose() {
 	l.c.log(message.Message{
 		ConnectionID: l.c.connectionID,
-		Timestamp:    time.Now().UnixNano(),
 		MessageType:  message.TypeClose,
 		ChannelID:    l.channelID,
 	})
@@ -1,13 +1,18 @@
 package auditlog_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
+	"path"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,10 +21,20 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/containerssh/auditlog"
+	"github.com/containerssh/auditlog/auditlogtest"
+	"github.com/containerssh/auditlog/clock"
+	"github.com/containerssh/auditlog/codec/asciinema"
 	"github.com/containerssh/auditlog/codec/binary"
+	"github.com/containerssh/auditlog/codec/syslog"
+	"github.com/containerssh/auditlog/index"
 	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/metrics/prometheus"
 	"github.com/containerssh/auditlog/storage"
 	"github.com/containerssh/auditlog/storage/file"
+	"github.com/containerssh/auditlog/storage/memory"
+	"github.com/containerssh/auditlog/storage/webhook"
+	"github.com/containerssh/auditlog/summary"
+	"github.com/containerssh/auditlog/tap"
 )
 
 func newConnectionID() message.ConnectionID {
@@ -89,7 +104,7 @@ func (c *testCase) listAuditLogs() ([]storage.Entry, error) {
 		return nil, err
 	}
 	var logs []storage.Entry
-	logsChannel, errors := fileStorage.List()
+	logsChannel, errors := fileStorage.List(context.Background(), storage.Query{})
 	for {
 		finished := false
 		select {
@@ -283,3 +298,749 @@ func TestAuth(t *testing.T) {
 	assert.Equal(t, message.TypeAuthPubKey, messages[11].MessageType)
 	assert.Equal(t, message.TypeAuthPubKeySuccessful, messages[12].MessageType)
 }
+
+type sessionInfoStorage struct {
+	writer *sessionInfoStorageWriter
+}
+
+func (s *sessionInfoStorage) OpenWriter(_ string) (storage.Writer, error) {
+	return s.writer, nil
+}
+
+func (s *sessionInfoStorage) Shutdown(_ context.Context) {}
+
+type sessionInfoStorageWriter struct {
+	contentType string
+	sessionInfo *storage.SessionInfo
+	closed      bool
+}
+
+func (w *sessionInfoStorageWriter) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (w *sessionInfoStorageWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func (w *sessionInfoStorageWriter) SetMetadata(_ int64, _ string, _ string, _ *string) {}
+
+func (w *sessionInfoStorageWriter) SetContentType(contentType string) {
+	w.contentType = contentType
+}
+
+func (w *sessionInfoStorageWriter) SetSessionInfo(info storage.SessionInfo) {
+	if w.closed {
+		panic("session info set after close")
+	}
+	w.sessionInfo = &info
+}
+
+type ioFilterStorage struct {
+	writer *ioFilterStorageWriter
+}
+
+func (s *ioFilterStorage) OpenWriter(_ string) (storage.Writer, error) {
+	return s.writer, nil
+}
+
+func (s *ioFilterStorage) Shutdown(_ context.Context) {}
+
+type ioFilterStorageWriter struct {
+	bytes.Buffer
+
+	acceptsIO bool
+}
+
+func (w *ioFilterStorageWriter) Close() error {
+	return nil
+}
+
+func (w *ioFilterStorageWriter) SetMetadata(_ int64, _ string, _ string, _ *string) {}
+
+func (w *ioFilterStorageWriter) AcceptsIO() bool {
+	return w.acceptsIO
+}
+
+// blockingStorage holds up all writes until release is closed.
+type blockingStorage struct {
+	release chan struct{}
+	aborted chan struct{}
+}
+
+func (s *blockingStorage) OpenWriter(_ string) (storage.Writer, error) {
+	return &blockingStorageWriter{release: s.release, aborted: s.aborted}, nil
+}
+
+func (s *blockingStorage) Shutdown(_ context.Context) {}
+
+type blockingStorageWriter struct {
+	release chan struct{}
+	aborted chan struct{}
+}
+
+func (w *blockingStorageWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func (w *blockingStorageWriter) Close() error {
+	return nil
+}
+
+func (w *blockingStorageWriter) SetMetadata(_ int64, _ string, _ string, _ *string) {}
+
+func (w *blockingStorageWriter) Abort() error {
+	close(w.aborted)
+	return nil
+}
+
+func TestSlowOutput(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	slowStorage := &blockingStorage{release: make(chan struct{}), aborted: make(chan struct{})}
+	fastStorage := memory.NewStorage()
+	auditLogger, err := auditlog.NewMultiOutputLogger(
+		auditlog.InterceptConfig{Stdout: true},
+		[]auditlog.Output{
+			{Encoder: binary.NewEncoder(geoIPLookupProvider), Storage: slowStorage},
+			{Encoder: binary.NewEncoder(geoIPLookupProvider), Storage: fastStorage},
+		},
+		log.NewTestLogger(t),
+		geoIPLookupProvider,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	connectionID := newConnectionID()
+	connection, err := auditLogger.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if !assert.NoError(t, err) {
+		return
+	}
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(0, "cat")
+	for i := 0; i < 100; i++ {
+		_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+	}
+	channel.OnExit(0)
+	channel.OnClose()
+	connection.OnDisconnect()
+
+	// The fast output finishes while the slow output is still blocked.
+	assert.Eventually(t, func() bool {
+		info, err := storage.ToV2(fastStorage).Stat(context.Background(), string(connectionID))
+		return err == nil && info.Finished
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(slowStorage.release)
+	auditLogger.Shutdown(context.Background())
+}
+
+// countingEncoder counts the messages it receives without encoding them.
+type countingEncoder struct {
+	messages int64
+}
+
+func (e *countingEncoder) Encode(messages <-chan message.Message, storage storage.Writer) error {
+	for range messages {
+		atomic.AddInt64(&e.messages, 1)
+	}
+	return storage.Close()
+}
+
+func (e *countingEncoder) GetMimeType() string {
+	return "application/octet-stream"
+}
+
+func (e *countingEncoder) GetFileExtension() string {
+	return ""
+}
+
+func TestOutputOverflow(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	slowStorage := &blockingStorage{release: make(chan struct{}), aborted: make(chan struct{})}
+	fastEncoder := &countingEncoder{}
+	fastStorage := memory.NewStorage()
+	auditLogger, err := auditlog.NewMultiOutputLogger(
+		auditlog.InterceptConfig{Stdout: true},
+		[]auditlog.Output{
+			{Encoder: binary.NewEncoder(geoIPLookupProvider), Storage: slowStorage},
+			{Encoder: fastEncoder, Storage: fastStorage},
+		},
+		log.NewTestLogger(t),
+		geoIPLookupProvider,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	connectionID := newConnectionID()
+	connection, err := auditLogger.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if !assert.NoError(t, err) {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+		channel.OnRequestExec(0, "cat")
+		for i := 0; i < 2000; i++ {
+			received := atomic.LoadInt64(&fastEncoder.messages)
+			_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+			// Wait for the fast output so only the slow output falls behind.
+			for atomic.LoadInt64(&fastEncoder.messages) == received {
+				runtime.Gosched()
+			}
+		}
+		channel.OnExit(0)
+		channel.OnClose()
+		connection.OnDisconnect()
+	}()
+
+	// The connection is not held up by the slow output once its buffer is full.
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		close(slowStorage.release)
+		t.Fatal("the connection was held up by the slow output")
+	}
+	assert.Eventually(t, func() bool {
+		info, err := storage.ToV2(fastStorage).Stat(context.Background(), string(connectionID))
+		return err == nil && info.Finished
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(slowStorage.release)
+	auditLogger.Shutdown(context.Background())
+	select {
+	case <-slowStorage.aborted:
+	default:
+		t.Fatal("the audit log of the slow output was not aborted")
+	}
+}
+
+// failingStorage refuses to open audit logs.
+type failingStorage struct{}
+
+func (s *failingStorage) OpenWriter(_ string) (storage.Writer, error) {
+	return nil, fmt.Errorf("storage unavailable")
+}
+
+func (s *failingStorage) Shutdown(_ context.Context) {}
+
+func TestOnConnectAbortsOpenedWriters(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	memoryStorage := memory.NewStorage()
+	auditLogger, err := auditlog.NewMultiOutputLogger(
+		auditlog.InterceptConfig{},
+		[]auditlog.Output{
+			{Encoder: binary.NewEncoder(geoIPLookupProvider), Storage: memoryStorage},
+			{Encoder: binary.NewEncoder(geoIPLookupProvider), Storage: &failingStorage{}},
+		},
+		log.NewTestLogger(t),
+		geoIPLookupProvider,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer auditLogger.Shutdown(context.Background())
+
+	connectionID := newConnectionID()
+	_, err = auditLogger.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	assert.Error(t, err)
+	_, err = storage.ToV2(memoryStorage).Stat(context.Background(), string(connectionID))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestIOFilter(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	writer := &ioFilterStorageWriter{acceptsIO: false}
+	auditLogger, err := auditlog.NewLogger(
+		auditlog.InterceptConfig{Stdin: true, Stdout: true},
+		binary.NewEncoder(geoIPLookupProvider),
+		&ioFilterStorage{writer: writer},
+		log.NewTestLogger(t),
+		geoIPLookupProvider,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	connection, err := auditLogger.OnConnect(newConnectionID(), net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if !assert.NoError(t, err) {
+		return
+	}
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(0, "cat")
+	_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+	channel.OnExit(0)
+	channel.OnClose()
+	connection.OnDisconnect()
+	auditLogger.Shutdown(context.Background())
+
+	computed, err := summary.FromMessages(binary.NewDecoder().Decode(&writer.Buffer))
+	assert.NoError(t, err)
+	if assert.Len(t, computed.Programs, 1) {
+		assert.Equal(t, "cat", computed.Programs[0].Command)
+	}
+	assert.Equal(t, summary.StreamBytes{}, computed.Bytes)
+}
+
+func TestSessionInfo(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	logger := log.NewTestLogger(t)
+	writer := &sessionInfoStorageWriter{}
+	auditLogger, err := auditlog.NewLogger(
+		auditlog.InterceptConfig{},
+		binary.NewEncoder(geoIPLookupProvider),
+		&sessionInfoStorage{writer: writer},
+		logger,
+		geoIPLookupProvider,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	connection, err := auditLogger.OnConnect(
+		newConnectionID(),
+		net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 2222,
+		},
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(0, "ls")
+	channel.OnExit(2)
+	channel.OnClose()
+	channel = connection.OnNewChannelSuccess(message.MakeChannelID(1), "session")
+	channel.OnRequestExec(0, "whoami")
+	channel.OnExit(0)
+	channel.OnClose()
+	connection.OnDisconnect()
+
+	auditLogger.Shutdown(context.Background())
+
+	assert.Equal(t, "application/octet-stream", writer.contentType)
+	assert.True(t, writer.closed)
+	if !assert.NotNil(t, writer.sessionInfo) {
+		return
+	}
+	assert.Equal(t, 2, writer.sessionInfo.Channels)
+	assert.Equal(t, []string{"ls", "whoami"}, writer.sessionInfo.Programs)
+	assert.Equal(t, uint32(0), *writer.sessionInfo.ExitStatus)
+	assert.NotEqual(t, int64(0), writer.sessionInfo.EndTime)
+}
+
+func TestMultipleOutputs(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	logger := log.NewTestLogger(t)
+	st := memory.NewStorage()
+	auditLogger, err := auditlog.NewMultiOutputLogger(
+		auditlog.InterceptConfig{Stdout: true},
+		[]auditlog.Output{
+			{Encoder: binary.NewEncoder(geoIPLookupProvider), Storage: st},
+			{Encoder: asciinema.NewEncoder(logger, geoIPLookupProvider), Storage: st, NameSuffix: "-asciinema"},
+		},
+		logger,
+		geoIPLookupProvider,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectionID := newConnectionID()
+	connection, err := auditLogger.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.OnAuthPassword("foo", []byte("bar"))
+	connection.OnAuthPasswordSuccess("foo", []byte("bar"))
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestShell(1)
+	_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+	channel.OnClose()
+	connection.OnDisconnect()
+	auditLogger.Shutdown(context.Background())
+
+	binaryLog, err := st.OpenReader(string(connectionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = binaryLog.Close()
+	}()
+	messages, errs := binary.NewDecoder().Decode(binaryLog)
+	count := 0
+	for range messages {
+		count++
+	}
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Greater(t, count, 0)
+
+	castReader, err := st.OpenReader(string(connectionID) + "-asciinema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cast, err := ioutil.ReadAll(castReader)
+	assert.NoError(t, err)
+	assert.Contains(t, string(cast), "Hello world!")
+}
+
+func TestSummary(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	geoIPLookupProvider, _ := dummy.New()
+	auditLogger, err := auditlog.New(
+		auditlog.Config{
+			Enable:    true,
+			Format:    auditlog.FormatBinary,
+			Storage:   auditlog.StorageFile,
+			File:      file.Config{Directory: dir},
+			Summary:   true,
+			Intercept: auditlog.InterceptConfig{Stdin: true, Stdout: true},
+		},
+		geoIPLookupProvider,
+		log.NewTestLogger(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connectionID := newConnectionID()
+	connection, err := auditLogger.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.OnAuthPassword("foo", []byte("baz"))
+	connection.OnAuthPasswordFailed("foo", []byte("baz"))
+	connection.OnAuthPubKey("foo", "ssh-rsa AAAA")
+	connection.OnAuthPubKeySuccess("foo", "ssh-rsa AAAA")
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(0, "cat")
+	_, _ = channel.GetStdinProxy(bytes.NewReader([]byte("Hi"))).Read(make([]byte, 10))
+	_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+	channel.OnExit(0)
+	channel.OnClose()
+	connection.OnDisconnect()
+	auditLogger.Shutdown(context.Background())
+
+	data, err := ioutil.ReadFile(path.Join(dir, string(connectionID)+summary.NameSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := summary.Summary{}
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, connectionID, written.ConnectionID)
+	assert.True(t, written.Authenticated)
+	assert.Equal(t, "foo", written.Username)
+	assert.Equal(t, []summary.AuthMethod{summary.AuthMethodPassword, summary.AuthMethodPubKey}, written.AuthMethods())
+	assert.Equal(t, 1, written.ChannelsOpened())
+	if assert.Len(t, written.Programs, 1) {
+		assert.Equal(t, "cat", written.Programs[0].Command)
+		assert.Equal(t, uint32(0), *written.Programs[0].ExitStatus)
+	}
+	assert.Equal(t, summary.StreamBytes{Stdin: 2, Stdout: 12}, written.Bytes)
+	assert.Greater(t, int64(written.Duration), int64(0))
+
+	binaryLog, err := os.Open(path.Join(dir, string(connectionID)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = binaryLog.Close()
+	}()
+	computed, err := summary.FromMessages(binary.NewDecoder().Decode(binaryLog))
+	assert.NoError(t, err)
+	assert.Equal(t, written, computed)
+}
+
+type nopWriteCloser struct {
+}
+
+func (n *nopWriteCloser) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (n *nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestLiveTap(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	auditLogger, err := auditlog.NewLogger(
+		auditlog.InterceptConfig{Stdout: true},
+		binary.NewEncoder(geoIPLookupProvider),
+		&sessionInfoStorage{writer: &sessionInfoStorageWriter{}},
+		log.NewTestLogger(t),
+		geoIPLookupProvider,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriber, ok := auditLogger.(tap.Subscriber)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	connectionID := newConnectionID()
+	connectionSubscription := subscriber.Subscribe(connectionID, 100)
+	otherSubscription := subscriber.Subscribe("other", 100)
+	defer otherSubscription.Close()
+	// A subscriber that never reads must not block the recording.
+	slowSubscription := subscriber.Subscribe("", 1)
+	defer slowSubscription.Close()
+
+	connection, err := auditLogger.OnConnect(connectionID, net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+	channel.OnClose()
+	connection.OnDisconnect()
+	auditLogger.Shutdown(context.Background())
+
+	var types []message.Type
+	for msg := range connectionSubscription.Messages() {
+		types = append(types, msg.MessageType)
+		if msg.MessageType == message.TypeIO {
+			assert.Equal(t, "Hello world!", string(msg.Payload.(message.PayloadIO).Data))
+		}
+	}
+	assert.Equal(t, []message.Type{
+		message.TypeConnect,
+		message.TypeHandshakeSuccessful,
+		message.TypeNewChannelSuccessful,
+		message.TypeIO,
+		message.TypeClose,
+		message.TypeDisconnect,
+	}, types)
+	assert.Equal(t, uint64(0), connectionSubscription.Dropped())
+	assert.Equal(t, uint64(5), slowSubscription.Dropped())
+	assert.Len(t, otherSubscription.Messages(), 0)
+}
+
+func TestMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	collector := prometheus.NewCollector()
+	geoIPLookupProvider, _ := dummy.New()
+	auditLogger, err := auditlog.New(
+		auditlog.Config{
+			Enable:    true,
+			Format:    auditlog.FormatBinary,
+			Storage:   auditlog.StorageFile,
+			File:      file.Config{Directory: dir},
+			Intercept: auditlog.InterceptConfig{Stdin: true, Stdout: true},
+		},
+		geoIPLookupProvider,
+		log.NewTestLogger(t),
+		auditlog.WithMetrics(collector),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection, err := auditLogger.OnConnect(newConnectionID(), net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(0, "cat")
+	_, _ = channel.GetStdinProxy(bytes.NewReader([]byte("Hi"))).Read(make([]byte, 10))
+	_, _ = channel.GetStdoutProxy(&nopWriteCloser{}).Write([]byte("Hello world!"))
+	channel.OnClose()
+	connection.OnDisconnect()
+	auditLogger.Shutdown(context.Background())
+
+	output := &bytes.Buffer{}
+	if _, err := collector.WriteTo(output); err != nil {
+		t.Fatal(err)
+	}
+	text := output.String()
+	assert.Contains(t, text, "# TYPE containerssh_auditlog_messages_total counter\n")
+	assert.Contains(t, text, "containerssh_auditlog_messages_total{type=\"connect\"} 1\n")
+	assert.Contains(t, text, "containerssh_auditlog_messages_total{type=\"io\"} 2\n")
+	assert.Contains(t, text, "containerssh_auditlog_intercepted_bytes_total{stream=\"stdin\"} 2\n")
+	assert.Contains(t, text, "containerssh_auditlog_intercepted_bytes_total{stream=\"stdout\"} 12\n")
+	assert.Contains(t, text, "containerssh_auditlog_active_connections 0\n")
+	assert.Contains(t, text, "containerssh_auditlog_file_open_audit_logs 0\n")
+	assert.Regexp(t, "containerssh_auditlog_file_bytes_written_total [1-9][0-9]*\n", text)
+	assert.Regexp(t, "containerssh_auditlog_encoded_bytes_total\\{mime_type=\"application/octet-stream\"\\} [1-9]", text)
+}
+
+func TestHealthCheck(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	geoIPLookupProvider, _ := dummy.New()
+	auditLogger, err := auditlog.New(
+		auditlog.Config{
+			Enable: true,
+			Outputs: []auditlog.OutputConfig{
+				{Format: auditlog.FormatBinary, Storage: auditlog.StorageFile, File: file.Config{Directory: dir}},
+				{Format: auditlog.FormatNone, Storage: auditlog.StorageNone},
+			},
+		},
+		geoIPLookupProvider,
+		log.NewTestLogger(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLogger.Shutdown(context.Background())
+
+	checker, ok := auditLogger.(auditlog.HealthChecker)
+	if !assert.True(t, ok) {
+		return
+	}
+	health := checker.HealthCheck(context.Background())
+	assert.True(t, health.Healthy())
+	assert.Equal(t, storage.HealthStatusHealthy, health.Status)
+	assert.Contains(t, health.Checks, storage.HealthCheckResult{
+		Name:   "output0.file.writable",
+		Status: storage.HealthStatusHealthy,
+	})
+
+	disabledLogger, err := auditlog.New(auditlog.Config{}, geoIPLookupProvider, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, disabledLogger.(auditlog.HealthChecker).HealthCheck(context.Background()).Healthy())
+}
+
+func TestNewReleasesOutputsOnError(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	goroutines := runtime.NumGoroutine()
+	_, err := auditlog.New(auditlog.Config{
+		Enable: true,
+		Outputs: []auditlog.OutputConfig{
+			{
+				Format:  auditlog.FormatSyslog,
+				Syslog:  syslog.Config{Server: "127.0.0.1:514"},
+				Storage: auditlog.StorageWebhook,
+				Webhook: webhook.Config{URL: "http://127.0.0.1:8080"},
+			},
+		},
+		Index: index.Config{Enable: true, Directory: "/nonexistent"},
+	}, geoIPLookupProvider, log.NewTestLogger(t))
+	assert.Error(t, err)
+
+	// The goroutines of the syslog sender and the webhook storage are stopped.
+	for i := 0; i < 500 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+}
+
+func TestFakeClock(t *testing.T) {
+	geoIPLookupProvider, _ := dummy.New()
+	logger := log.NewTestLogger(t)
+	st := memory.NewStorage()
+	auditLogger, err := auditlog.NewLogger(
+		auditlog.InterceptConfig{Stdout: true},
+		asciinema.NewEncoder(logger, geoIPLookupProvider),
+		st,
+		logger,
+		geoIPLookupProvider,
+		auditlog.WithClock(clock.NewFake(time.Unix(1600000000, 0), 500*time.Millisecond)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection, err := auditLogger.OnConnect("test", net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection.OnHandshakeSuccessful("foo")
+	channel := connection.OnNewChannelSuccess(message.MakeChannelID(0), "session")
+	channel.OnRequestExec(1, "ls")
+	_, err = channel.GetStdoutProxy(&bytes.Buffer{}).Write([]byte("Hello world!"))
+	assert.NoError(t, err)
+	channel.OnExit(0)
+	channel.OnClose()
+	connection.OnDisconnect()
+	auditLogger.Shutdown(context.Background())
+
+	reader, err := st.OpenReader("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cast, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each message advances the fake clock by 500ms, the output is written 2 seconds after the connection started.
+	assert.Equal(
+		t,
+		`{"version":2,"width":80,"height":25,"timestamp":1600000000,"command":"ls","title":"","env":{}}`+"\n"+
+			`[2,"o","Hello world!"]`+"\n",
+		string(cast),
+	)
+	info, err := st.(storage.ReadWriteStorageV2).Stat(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1600000000", info.Metadata["timestamp"])
+	assert.Equal(t, "1600000003", info.Metadata["endtimestamp"])
+}
+
+func TestMessageOffsets(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1600000000, 0), 0)
+	recorder, err := auditlogtest.NewRecorder(
+		auditlog.InterceptConfig{},
+		log.NewTestLogger(t),
+		auditlog.WithClock(fakeClock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Shutdown(context.Background())
+
+	connection, err := recorder.OnConnect("test", net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClock.Advance(time.Second)
+	connection.OnHandshakeSuccessful("foo")
+	fakeClock.Set(time.Unix(1600000005, 0))
+	connection.OnDisconnect()
+
+	messages, err := recorder.Messages(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []time.Duration
+	for _, msg := range messages {
+		offsets = append(offsets, time.Duration(msg.Offset))
+	}
+	assert.Equal(t, []time.Duration{0, time.Second, 5 * time.Second}, offsets)
+	assert.Equal(t, int64(1600000005)*int64(time.Second), messages[2].Timestamp)
+}
@@ -4,6 +4,7 @@ package message
 type ExtendedMessage struct {
 	ConnectionID ConnectionID `json:"connectionId" yaml:"connectionId"` // ConnectionID is an opaque ID of the connection.
 	Timestamp    int64        `json:"timestamp" yaml:"timestamp"`       // Timestamp is a nanosecond timestamp when the message was created.
+	Offset       int64        `json:"offset" yaml:"offset"`             // Offset is the monotonic time in nanoseconds since the first message of the connection.
 	MessageType  Type         `json:"type" yaml:"type"`                 // Type of the Payload object.
 	TypeID       string       `json:"typeId" yaml:"typeId"`             // TypeID is a machine-readable text ID of the message type.
 	TypeName     string       `json:"typeName" yaml:"typeName"`         // TypeName is the human-readable name of the message type.
@@ -14,6 +14,7 @@ func MakeChannelID(n uint64) ChannelID {
 type Message struct {
 	ConnectionID ConnectionID `json:"connectionId" yaml:"connectionId"` // ConnectionID is an opaque ID of the connection.
 	Timestamp    int64        `json:"timestamp" yaml:"timestamp"`       // Timestamp is a nanosecond timestamp when the message was created.
+	Offset       int64        `json:"offset" yaml:"offset"`             // Offset is the monotonic time in nanoseconds since the first message of the connection. Use it instead of the Timestamp to measure time within a connection.
 	MessageType  Type         `json:"type" yaml:"type"`                 // Type of the Payload object.
 	Payload      Payload      `json:"payload" yaml:"payload"`           // Payload is always a pointer to a payload object.
 	ChannelID    ChannelID    `json:"channelId" yaml:"channelId"`       // ChannelID is a identifier for an SSH channel, if applicable. -1 otherwise.
@@ -24,6 +25,7 @@ func (m Message) GetExtendedMessage() ExtendedMessage {
 	return ExtendedMessage{
 		m.ConnectionID,
 		m.Timestamp,
+		m.Offset,
 		m.MessageType,
 		m.MessageType.ID(),
 		m.MessageType.Name(),
@@ -46,6 +48,9 @@ func (m Message) Equals(other Message) bool {
 	if m.Timestamp != other.Timestamp {
 		return false
 	}
+	if m.Offset != other.Offset {
+		return false
+	}
 	if m.MessageType != other.MessageType {
 		return false
 	}
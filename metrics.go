@@ -0,0 +1,39 @@
+package auditlog
+
+import (
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/metrics"
+	"github.com/containerssh/auditlog/storage"
+)
+
+var streamNames = map[message.Stream]string{
+	message.StreamStdin:  "stdin",
+	message.StreamStdout: "stdout",
+	message.StreamStderr: "stderr",
+}
+
+func (l *loggerImplementation) collectMessageMetrics(msg message.Message) {
+	l.metrics.Add(metrics.MessagesTotal, 1, metrics.Label{Name: "type", Value: msg.MessageType.ID()})
+	if msg.MessageType == message.TypeIO {
+		payload := msg.Payload.(message.PayloadIO)
+		l.metrics.Add(
+			metrics.InterceptedBytesTotal,
+			float64(len(payload.Data)),
+			metrics.Label{Name: "stream", Value: streamNames[payload.Stream]},
+		)
+	}
+}
+
+// metricsWriter counts the bytes the encoder writes to the storage.
+type metricsWriter struct {
+	storage.Writer
+
+	collector metrics.Collector
+	mimeType  string
+}
+
+func (m *metricsWriter) Write(p []byte) (int, error) {
+	n, err := m.Writer.Write(p)
+	m.collector.Add(metrics.EncodedBytesTotal, float64(n), metrics.Label{Name: "mime_type", Value: m.mimeType})
+	return n, err
+}
@@ -0,0 +1,57 @@
+package metrics
+
+// Type is the type of a metric.
+type Type string
+
+const (
+	// TypeCounter is a metric that only increases.
+	TypeCounter Type = "counter"
+	// TypeGauge is a metric that can increase and decrease.
+	TypeGauge Type = "gauge"
+)
+
+// Metric describes a metric of the audit log pipeline.
+type Metric struct {
+	// Name is the name of the metric, for example containerssh_auditlog_messages_total.
+	Name string
+	// Help is the human-readable description of the metric.
+	Help string
+	// Type is the type of the metric.
+	Type Type
+}
+
+// Label is a dimension of a metric value.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Collector receives the metrics of the audit log pipeline. Implementations must be safe for concurrent use.
+type Collector interface {
+	// Add adds the value to a counter or gauge with the specified labels. Negative values are only allowed for gauges.
+	Add(metric Metric, value float64, labels ...Label)
+	// Set sets a gauge with the specified labels to the value.
+	Set(metric Metric, value float64, labels ...Label)
+}
+
+// NewNoopCollector returns a collector that discards all metrics.
+func NewNoopCollector() Collector {
+	return &noopCollector{}
+}
+
+// OrNoop returns the collector, or a collector discarding all metrics if the collector is nil.
+func OrNoop(collector Collector) Collector {
+	if collector == nil {
+		return NewNoopCollector()
+	}
+	return collector
+}
+
+type noopCollector struct {
+}
+
+func (n *noopCollector) Add(_ Metric, _ float64, _ ...Label) {
+}
+
+func (n *noopCollector) Set(_ Metric, _ float64, _ ...Label) {
+}
@@ -0,0 +1,131 @@
+package metrics
+
+// The metrics collected by the logger.
+var (
+	// MessagesTotal counts the audit log messages by message type.
+	MessagesTotal = Metric{
+		Name: "containerssh_auditlog_messages_total",
+		Help: "Number of audit log messages by message type.",
+		Type: TypeCounter,
+	}
+	// InterceptedBytesTotal counts the intercepted bytes by stream.
+	InterceptedBytesTotal = Metric{
+		Name: "containerssh_auditlog_intercepted_bytes_total",
+		Help: "Number of bytes intercepted by stream.",
+		Type: TypeCounter,
+	}
+	// ActiveConnections is the number of connections currently being logged.
+	ActiveConnections = Metric{
+		Name: "containerssh_auditlog_active_connections",
+		Help: "Number of connections currently being logged.",
+		Type: TypeGauge,
+	}
+)
+
+// The metrics collected for each encoder, labeled by the MIME type of the format.
+var (
+	// EncodedBytesTotal counts the bytes written by the encoders.
+	EncodedBytesTotal = Metric{
+		Name: "containerssh_auditlog_encoded_bytes_total",
+		Help: "Number of bytes written by the encoders by audit log format.",
+		Type: TypeCounter,
+	}
+	// EncoderErrorsTotal counts the audit logs the encoders failed to write.
+	EncoderErrorsTotal = Metric{
+		Name: "containerssh_auditlog_encoder_errors_total",
+		Help: "Number of audit logs the encoder failed to write by audit log format.",
+		Type: TypeCounter,
+	}
+	// OutputOverflowsTotal counts the audit logs aborted because the output did not keep up with the connection.
+	OutputOverflowsTotal = Metric{
+		Name: "containerssh_auditlog_output_overflows_total",
+		Help: "Number of audit logs aborted because the output did not keep up by audit log format.",
+		Type: TypeCounter,
+	}
+)
+
+// The metrics collected by the file storage.
+var (
+	// FileBytesWrittenTotal counts the bytes written to audit log files.
+	FileBytesWrittenTotal = Metric{
+		Name: "containerssh_auditlog_file_bytes_written_total",
+		Help: "Number of bytes written to audit log files.",
+		Type: TypeCounter,
+	}
+	// FileErrorsTotal counts failed file operations.
+	FileErrorsTotal = Metric{
+		Name: "containerssh_auditlog_file_errors_total",
+		Help: "Number of failed audit log file creations, writes and closes.",
+		Type: TypeCounter,
+	}
+	// FileOpenAuditLogs is the number of audit log files currently being written.
+	FileOpenAuditLogs = Metric{
+		Name: "containerssh_auditlog_file_open_audit_logs",
+		Help: "Number of audit log files currently being written.",
+		Type: TypeGauge,
+	}
+)
+
+// The metrics collected by the S3 storage.
+var (
+	// S3PartsUploadedTotal counts the uploaded multipart upload parts.
+	S3PartsUploadedTotal = Metric{
+		Name: "containerssh_auditlog_s3_parts_uploaded_total",
+		Help: "Number of multipart upload parts uploaded to S3.",
+		Type: TypeCounter,
+	}
+	// S3PartsFailedTotal counts the failed multipart upload part uploads.
+	S3PartsFailedTotal = Metric{
+		Name: "containerssh_auditlog_s3_parts_failed_total",
+		Help: "Number of failed multipart upload part uploads to S3.",
+		Type: TypeCounter,
+	}
+	// S3UploadedBytesTotal counts the bytes uploaded to S3.
+	S3UploadedBytesTotal = Metric{
+		Name: "containerssh_auditlog_s3_uploaded_bytes_total",
+		Help: "Number of audit log bytes uploaded to S3.",
+		Type: TypeCounter,
+	}
+	// S3UploadsCompletedTotal counts the audit logs completely uploaded to S3.
+	S3UploadsCompletedTotal = Metric{
+		Name: "containerssh_auditlog_s3_uploads_completed_total",
+		Help: "Number of audit logs completely uploaded to S3.",
+		Type: TypeCounter,
+	}
+	// S3UploadRetriesTotal counts the failed upload attempts that are retried after a backoff.
+	S3UploadRetriesTotal = Metric{
+		Name: "containerssh_auditlog_s3_upload_retries_total",
+		Help: "Number of failed S3 upload attempts that are retried.",
+		Type: TypeCounter,
+	}
+	// S3UploadsGivenUpTotal counts the audit logs whose upload was given up.
+	S3UploadsGivenUpTotal = Metric{
+		Name: "containerssh_auditlog_s3_uploads_given_up_total",
+		Help: "Number of audit logs whose upload to S3 was given up.",
+		Type: TypeCounter,
+	}
+	// S3QueueLength is the number of audit logs in the upload queue, labeled by the bucket.
+	S3QueueLength = Metric{
+		Name: "containerssh_auditlog_s3_queue_length",
+		Help: "Number of audit logs waiting to be written or uploaded to S3 by bucket.",
+		Type: TypeGauge,
+	}
+	// S3SpoolBytes is the disk space used by the local directory of the S3 storage, labeled by the bucket.
+	S3SpoolBytes = Metric{
+		Name: "containerssh_auditlog_s3_spool_bytes",
+		Help: "Disk space used by the audit logs in the local directory of the S3 storage by bucket.",
+		Type: TypeGauge,
+	}
+	// S3SpoolRejectedTotal counts the audit logs rejected because the local directory exceeded the spool limits.
+	S3SpoolRejectedTotal = Metric{
+		Name: "containerssh_auditlog_s3_spool_rejected_total",
+		Help: "Number of audit logs rejected because the local directory of the S3 storage exceeded the spool limits.",
+		Type: TypeCounter,
+	}
+	// S3SpoolEvictedTotal counts the audit logs evicted from the local directory before they were uploaded.
+	S3SpoolEvictedTotal = Metric{
+		Name: "containerssh_auditlog_s3_spool_evicted_total",
+		Help: "Number of audit logs removed from the local directory of the S3 storage before they were uploaded.",
+		Type: TypeCounter,
+	}
+)
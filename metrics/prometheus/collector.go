@@ -0,0 +1,151 @@
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containerssh/auditlog/metrics"
+)
+
+// ContentType is the MIME type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector is a metrics collector keeping the metrics in memory and exposing them in the Prometheus text exposition
+// format. It is also an http.Handler that can be mounted as the scrape endpoint, for example on /metrics.
+type Collector interface {
+	metrics.Collector
+	http.Handler
+
+	// WriteTo writes the current metrics in the Prometheus text exposition format.
+	WriteTo(writer io.Writer) (int64, error)
+}
+
+// NewCollector creates an empty Prometheus collector.
+func NewCollector() Collector {
+	return &collector{
+		lock:     &sync.Mutex{},
+		families: map[string]*family{},
+	}
+}
+
+type family struct {
+	metric metrics.Metric
+	series map[string]*series
+}
+
+type series struct {
+	labels string
+	value  float64
+}
+
+type collector struct {
+	lock     *sync.Mutex
+	families map[string]*family
+}
+
+func (c *collector) Add(metric metrics.Metric, value float64, labels ...metrics.Label) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.getSeries(metric, labels).value += value
+}
+
+func (c *collector) Set(metric metrics.Metric, value float64, labels ...metrics.Label) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.getSeries(metric, labels).value = value
+}
+
+// getSeries returns the series of the metric with the labels, creating it if needed. The caller must hold the lock.
+func (c *collector) getSeries(metric metrics.Metric, labels []metrics.Label) *series {
+	f, ok := c.families[metric.Name]
+	if !ok {
+		f = &family{
+			metric: metric,
+			series: map[string]*series{},
+		}
+		c.families[metric.Name] = f
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (c *collector) WriteTo(writer io.Writer) (int64, error) {
+	c.lock.Lock()
+	names := make([]string, 0, len(c.families))
+	for name := range c.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var builder strings.Builder
+	for _, name := range names {
+		f := c.families[name]
+		builder.WriteString("# HELP " + name + " " + escapeHelp(f.metric.Help) + "\n")
+		builder.WriteString("# TYPE " + name + " " + string(f.metric.Type) + "\n")
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			builder.WriteString(name + key + " " + strconv.FormatFloat(f.series[key].value, 'g', -1, 64) + "\n")
+		}
+	}
+	c.lock.Unlock()
+
+	bufferedWriter := bufio.NewWriter(writer)
+	n, err := bufferedWriter.WriteString(builder.String())
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), bufferedWriter.Flush()
+}
+
+func (c *collector) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writer.Header().Set("Content-Type", ContentType)
+	writer.WriteHeader(http.StatusOK)
+	if request.Method == http.MethodGet {
+		_, _ = c.WriteTo(writer)
+	}
+}
+
+// formatLabels returns the labels in the exposition format, sorted by name, or an empty string if there are no labels.
+func formatLabels(labels []metrics.Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	sorted := append([]metrics.Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	parts := make([]string, len(sorted))
+	for i, label := range sorted {
+		parts[i] = label.Name + "=\"" + escapeLabelValue(label.Value) + "\""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
@@ -0,0 +1,84 @@
+package prometheus_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/metrics"
+	"github.com/containerssh/auditlog/metrics/prometheus"
+)
+
+var testCounter = metrics.Metric{
+	Name: "test_requests_total",
+	Help: "Number of requests.\nSecond line with a \\ backslash.",
+	Type: metrics.TypeCounter,
+}
+
+var testGauge = metrics.Metric{
+	Name: "test_temperature",
+	Help: "Current temperature.",
+	Type: metrics.TypeGauge,
+}
+
+func TestExposition(t *testing.T) {
+	collector := prometheus.NewCollector()
+	collector.Add(testCounter, 1, metrics.Label{Name: "path", Value: "/b"})
+	collector.Add(testCounter, 2, metrics.Label{Name: "path", Value: "/b"})
+	collector.Add(
+		testCounter,
+		1,
+		metrics.Label{Name: "path", Value: "/a\"\n\\"},
+		metrics.Label{Name: "method", Value: "GET"},
+	)
+	collector.Set(testGauge, 10)
+	collector.Set(testGauge, 21.5)
+
+	output := &bytes.Buffer{}
+	if _, err := collector.WriteTo(output); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(
+		t,
+		"# HELP test_requests_total Number of requests.\\nSecond line with a \\\\ backslash.\n"+
+			"# TYPE test_requests_total counter\n"+
+			"test_requests_total{method=\"GET\",path=\"/a\\\"\\n\\\\\"} 1\n"+
+			"test_requests_total{path=\"/b\"} 3\n"+
+			"# HELP test_temperature Current temperature.\n"+
+			"# TYPE test_temperature gauge\n"+
+			"test_temperature 21.5\n",
+		output.String(),
+	)
+}
+
+func TestHandler(t *testing.T) {
+	collector := prometheus.NewCollector()
+	collector.Add(testCounter, 5)
+
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, prometheus.ContentType, response.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "test_requests_total 5\n")
+
+	response, err = http.Post(server.URL+"/metrics", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
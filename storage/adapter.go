@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ToV2 adapts a storage implementing the original interface to the context-aware V2 interface. If the storage already
+// implements the V2 interface it is returned as is. The adapter checks the context before each call, reads ranges by
+// skipping the bytes before the offset, and returns ErrNotSupported from Stat and Delete.
+func ToV2(s ReadWriteStorage) ReadWriteStorageV2 {
+	if v2, ok := s.(ReadWriteStorageV2); ok {
+		return v2
+	}
+	return &v2Adapter{
+		writableV2Adapter: writableV2Adapter{backend: s},
+		backend:           s,
+	}
+}
+
+// WritableToV2 adapts a writable storage implementing the original interface to the context-aware V2 interface. If the
+// storage already implements the V2 interface it is returned as is.
+func WritableToV2(s WritableStorage) WritableStorageV2 {
+	if v2, ok := s.(WritableStorageV2); ok {
+		return v2
+	}
+	return &writableV2Adapter{backend: s}
+}
+
+// FromV2 adapts a V2 storage to the original interface. The original methods use a background context.
+func FromV2(s ReadWriteStorageV2) ReadWriteStorage {
+	if v1, ok := s.(ReadWriteStorage); ok {
+		return v1
+	}
+	return &v1Adapter{
+		writableV1Adapter: writableV1Adapter{backend: s},
+		backend:           s,
+	}
+}
+
+// WritableFromV2 adapts a writable V2 storage to the original interface. OpenWriter uses a background context.
+func WritableFromV2(s WritableStorageV2) WritableStorage {
+	if v1, ok := s.(WritableStorage); ok {
+		return v1
+	}
+	return &writableV1Adapter{backend: s}
+}
+
+// RangeReader returns a reader for length bytes of the reader starting at offset. A negative length reads until the
+// end. If the reader implements io.Seeker it seeks to the offset, otherwise the bytes before the offset are skipped.
+// The reader is closed if skipping fails.
+func RangeReader(reader io.ReadCloser, offset int64, length int64) (io.ReadCloser, error) {
+	if err := ValidateRange(offset); err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+	if offset > 0 {
+		var err error
+		if seeker, ok := reader.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, reader, offset)
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		if err != nil {
+			_ = reader.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return reader, nil
+	}
+	return &limitedReadCloser{
+		Reader: io.LimitReader(reader, length),
+		Closer: reader,
+	}, nil
+}
+
+// ValidateRange returns ErrInvalidRange if the offset of a range read is negative.
+func ValidateRange(offset int64) error {
+	if offset < 0 {
+		return fmt.Errorf("negative offset %d (%w)", offset, ErrInvalidRange)
+	}
+	return nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type writableV2Adapter struct {
+	backend WritableStorage
+}
+
+func (w *writableV2Adapter) Create(ctx context.Context, name string) (Writer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return w.backend.OpenWriter(name)
+}
+
+func (w *writableV2Adapter) Shutdown(shutdownContext context.Context) {
+	w.backend.Shutdown(shutdownContext)
+}
+
+type v2Adapter struct {
+	writableV2Adapter
+	backend ReadWriteStorage
+}
+
+func (v *v2Adapter) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return v.backend.OpenReader(name)
+}
+
+func (v *v2Adapter) OpenRange(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error) {
+	reader, err := v.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return RangeReader(reader, offset, length)
+}
+
+func (v *v2Adapter) Stat(_ context.Context, _ string) (EntryInfo, error) {
+	return EntryInfo{}, ErrNotSupported
+}
+
+func (v *v2Adapter) Delete(_ context.Context, _ string) error {
+	return ErrNotSupported
+}
+
+func (v *v2Adapter) List(ctx context.Context, query Query) (<-chan Entry, <-chan error) {
+	return v.backend.List(ctx, query)
+}
+
+type writableV1Adapter struct {
+	backend WritableStorageV2
+}
+
+func (w *writableV1Adapter) OpenWriter(name string) (Writer, error) {
+	return w.backend.Create(context.Background(), name)
+}
+
+func (w *writableV1Adapter) Shutdown(shutdownContext context.Context) {
+	w.backend.Shutdown(shutdownContext)
+}
+
+type v1Adapter struct {
+	writableV1Adapter
+	backend ReadWriteStorageV2
+}
+
+func (v *v1Adapter) OpenReader(name string) (io.ReadCloser, error) {
+	return v.backend.Open(context.Background(), name)
+}
+
+func (v *v1Adapter) List(ctx context.Context, query Query) (<-chan Entry, <-chan error) {
+	return v.backend.List(ctx, query)
+}
@@ -8,6 +8,9 @@ import (
 // Config is the configuration for the file storage.
 type Config struct {
 	Directory string `json:"directory" yaml:"directory" default:"/var/log/audit"`
+	// MinFreeSpace is the number of bytes that must be available in the directory for the storage to be reported
+	// healthy. The free space is not checked if 0.
+	MinFreeSpace uint64 `json:"minFreeSpace" yaml:"minFreeSpace"`
 }
 
 func (c *Config) Validate() error {
@@ -0,0 +1,287 @@
+package file_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/containerssh/geoip/dummy"
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/codec/binary"
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/file"
+)
+
+func TestStorageV2(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-file-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	st, err := file.NewStorageV2(file.Config{Directory: dir}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	writer, err := st.Create(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := st.Stat(ctx, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), info.Size)
+	assert.False(t, info.Finished)
+	assert.True(t, errors.Is(st.Delete(ctx, "test"), storage.ErrInUse))
+	assert.NoError(t, writer.Close())
+
+	info, err = st.Stat(ctx, "test")
+	assert.NoError(t, err)
+	assert.True(t, info.Finished)
+
+	reader, err := st.OpenRange(ctx, "test", 6, 5)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "world", string(data))
+
+	reader, err = st.OpenRange(ctx, "test", 6, -1)
+	assert.NoError(t, err)
+	data, err = ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "world!", string(data))
+
+	_, err = st.OpenRange(ctx, "test", -1, 5)
+	assert.True(t, errors.Is(err, storage.ErrInvalidRange))
+
+	assert.NoError(t, st.Delete(ctx, "test"))
+	_, err = st.Stat(ctx, "test")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+	_, err = st.Open(ctx, "test")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+	assert.True(t, errors.Is(st.Delete(ctx, "test"), storage.ErrNotFound))
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = st.Create(cancelledCtx, "test")
+	assert.Error(t, err)
+}
+
+func TestListUnsupportedFilter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-file-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	st, err := file.NewStorage(file.Config{Directory: dir}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "test"), []byte("Hello world!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, errorChannel := st.List(context.Background(), storage.Query{Prefix: "te"})
+	var names []string
+	for entry := range entries {
+		names = append(names, entry.Name)
+	}
+	assert.NoError(t, <-errorChannel)
+	assert.Equal(t, []string{"test"}, names)
+
+	entries, errorChannel = st.List(context.Background(), storage.Query{Username: "foo"})
+	assert.True(t, errors.Is(<-errorChannel, storage.ErrUnsupportedFilter))
+	_, ok := <-entries
+	assert.False(t, ok)
+}
+
+func TestAbort(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-file-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	st, err := file.NewStorage(file.Config{Directory: dir}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, writer.(storage.AbortableWriter).Abort())
+	_, err = os.Stat(path.Join(dir, "test"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// v1Storage hides the V2 methods of a storage to test the adapter.
+type v1Storage struct {
+	storage.ReadWriteStorage
+}
+
+func TestToV2Adapter(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-file-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	v1, err := file.NewStorage(file.Config{Directory: dir}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := storage.ToV2(&v1Storage{v1})
+	ctx := context.Background()
+
+	writer, err := st.Create(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, writer.Close())
+
+	reader, err := st.OpenRange(ctx, "test", 6, 5)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "world", string(data))
+
+	_, err = st.Stat(ctx, "test")
+	assert.True(t, errors.Is(err, storage.ErrNotSupported))
+
+	back := storage.FromV2(st)
+	reader, err = back.OpenReader("test")
+	assert.NoError(t, err)
+	data, err = ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "Hello world!", string(data))
+}
+
+func TestFollow(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-file-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	st, err := file.NewStorageV2(file.Config{Directory: dir}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	writer, err := st.Create(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	geoIPProvider, _ := dummy.New()
+	messages := make(chan message.Message)
+	encodeDone := make(chan struct{})
+	go func() {
+		defer close(encodeDone)
+		assert.NoError(t, binary.NewEncoder(geoIPProvider).Encode(messages, writer))
+	}()
+	messages <- message.Message{
+		ConnectionID: "test",
+		Timestamp:    time.Now().UnixNano(),
+		MessageType:  message.TypeConnect,
+		Payload:      message.PayloadConnect{RemoteAddr: "127.0.0.1"},
+	}
+
+	reader, err := st.(storage.FollowableStorage).Follow(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	decoded, errs := binary.NewDecoder().Decode(reader)
+
+	// The connect message must be readable while the audit log is still being written.
+	select {
+	case msg := <-decoded:
+		assert.Equal(t, message.TypeConnect, msg.MessageType)
+	case err := <-errs:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal("timeout while waiting for the in-progress message")
+	}
+
+	messages <- message.Message{
+		ConnectionID: "test",
+		Timestamp:    time.Now().UnixNano(),
+		MessageType:  message.TypeDisconnect,
+	}
+	<-encodeDone
+
+	msg, ok := <-decoded
+	assert.True(t, ok)
+	assert.Equal(t, message.TypeDisconnect, msg.MessageType)
+	_, ok = <-decoded
+	assert.False(t, ok)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-auditlog-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	st, err := file.NewStorage(file.Config{Directory: dir}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Shutdown(context.Background())
+
+	health := storage.HealthCheck(context.Background(), st)
+	assert.Equal(t, storage.HealthStatusHealthy, health.Status, "%v", health.Checks)
+	assert.Equal(t, "file.writable", health.Checks[0].Name)
+	_, err = os.Stat(path.Join(dir, ".healthcheck"))
+	assert.True(t, os.IsNotExist(err))
+
+	if _, err := storage.FreeSpace(dir); err != nil {
+		return
+	}
+	st, err = file.NewStorage(file.Config{Directory: dir, MinFreeSpace: 1 << 62}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Shutdown(context.Background())
+	health = storage.HealthCheck(context.Background(), st)
+	assert.False(t, health.Healthy())
+	assert.Equal(t, "file.freeSpace", health.Checks[1].Name)
+	assert.Equal(t, storage.HealthStatusUnhealthy, health.Checks[1].Status)
+}
@@ -0,0 +1,40 @@
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+// healthCheckFile is written and removed to check the directory is writable. The name contains a dot so it is never
+// listed as an audit log.
+const healthCheckFile = ".healthcheck"
+
+// HealthCheck checks that the directory is writable and has the configured free space.
+func (s *fileStorage) HealthCheck(_ context.Context) storage.Health {
+	return storage.NewHealth(
+		s.checkWritable(),
+		storage.CheckFreeSpace("file.freeSpace", s.directory, s.minFreeSpace),
+	)
+}
+
+func (s *fileStorage) checkWritable() storage.HealthCheckResult {
+	result := storage.HealthCheckResult{
+		Name:   "file.writable",
+		Status: storage.HealthStatusHealthy,
+	}
+	fileName := path.Join(s.directory, healthCheckFile)
+	if err := ioutil.WriteFile(fileName, []byte{}, 0644); err != nil {
+		result.Status = storage.HealthStatusUnhealthy
+		result.Message = err.Error()
+		return result
+	}
+	if err := os.Remove(fileName); err != nil {
+		result.Status = storage.HealthStatusUnhealthy
+		result.Message = err.Error()
+	}
+	return result
+}
@@ -7,13 +7,34 @@ import (
 	"path"
 	"sync"
 
+	"github.com/containerssh/auditlog/metrics"
 	"github.com/containerssh/auditlog/storage"
 
 	"github.com/containerssh/log"
 )
 
 // NewStorage Create a file storage that stores data in a local directory. The file storage cannot store metadata.
-func NewStorage(cfg Config, _ log.Logger) (storage.ReadWriteStorage, error) {
+func NewStorage(cfg Config, logger log.Logger, options ...Option) (storage.ReadWriteStorage, error) {
+	return newStorage(cfg, logger, options)
+}
+
+// NewStorageV2 Create a context-aware file storage that stores data in a local directory. The file storage cannot store
+// metadata.
+func NewStorageV2(cfg Config, logger log.Logger, options ...Option) (storage.ReadWriteStorageV2, error) {
+	return newStorage(cfg, logger, options)
+}
+
+// Option configures optional features of the file storage.
+type Option func(s *fileStorage)
+
+// WithMetrics sets the collector receiving the metrics of the file storage. By default the metrics are discarded.
+func WithMetrics(collector metrics.Collector) Option {
+	return func(s *fileStorage) {
+		s.metrics = metrics.OrNoop(collector)
+	}
+}
+
+func newStorage(cfg Config, _ log.Logger, options []Option) (*fileStorage, error) {
 	if cfg.Directory == "" {
 		return nil, fmt.Errorf("invalid audit log directory")
 	}
@@ -28,8 +49,16 @@ func NewStorage(cfg Config, _ log.Logger) (storage.ReadWriteStorage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file in audit log directory %s (%w)", cfg.Directory, err)
 	}
-	return &fileStorage{
-		directory: cfg.Directory,
-		wg:        &sync.WaitGroup{},
-	}, nil
+	s := &fileStorage{
+		directory:    cfg.Directory,
+		minFreeSpace: cfg.MinFreeSpace,
+		wg:           &sync.WaitGroup{},
+		lock:         &sync.Mutex{},
+		writing:      map[string]bool{},
+		metrics:      metrics.NewNoopCollector(),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
 }
@@ -2,6 +2,7 @@ package file
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -9,12 +10,18 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/containerssh/auditlog/metrics"
 	"github.com/containerssh/auditlog/storage"
 )
 
 type fileStorage struct {
-	directory string
-	wg        *sync.WaitGroup
+	directory    string
+	minFreeSpace uint64
+	wg           *sync.WaitGroup
+	lock         *sync.Mutex
+	// writing contains the audit logs currently open for writing.
+	writing map[string]bool
+	metrics metrics.Collector
 }
 
 func (s *fileStorage) Shutdown(_ context.Context) {
@@ -26,22 +33,46 @@ func (s *fileStorage) OpenReader(name string) (io.ReadCloser, error) {
 	return os.Open(path.Join(s.directory, name))
 }
 
-// List lists the available audit logs
-func (s *fileStorage) List() (<-chan storage.Entry, <-chan error) {
+// List lists the available audit logs. The file storage has no metadata, so only the prefix filter of the query is
+// supported. Queries with other filters fail with storage.ErrUnsupportedFilter.
+func (s *fileStorage) List(ctx context.Context, query storage.Query) (<-chan storage.Entry, <-chan error) {
 	result := make(chan storage.Entry)
 	errorChannel := make(chan error)
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
+		if query.NeedsMetadata() {
+			select {
+			case errorChannel <- fmt.Errorf(
+				"the file storage only supports the prefix filter (%w)",
+				storage.ErrUnsupportedFilter,
+			):
+			case <-ctx.Done():
+			}
+			close(result)
+			close(errorChannel)
+			return
+		}
 		if err := filepath.Walk(s.directory, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 			if !info.IsDir() && info.Size() > 0 && !strings.Contains(info.Name(), ".") {
-				result <- storage.Entry{
+				entry := storage.Entry{
 					Name:     info.Name(),
 					Metadata: map[string]string{},
 				}
+				if !query.Matches(entry) {
+					return nil
+				}
+				select {
+				case result <- entry:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
-			return err
-		}); err != nil {
+			return nil
+		}); err != nil && ctx.Err() == nil {
 			errorChannel <- err
 		}
 		close(result)
@@ -54,24 +85,145 @@ func (s *fileStorage) List() (<-chan storage.Entry, <-chan error) {
 func (s *fileStorage) OpenWriter(name string) (storage.Writer, error) {
 	file, err := os.Create(path.Join(s.directory, name))
 	if err != nil {
+		s.metrics.Add(metrics.FileErrorsTotal, 1)
 		return nil, err
 	}
+	s.lock.Lock()
+	s.writing[name] = true
+	s.lock.Unlock()
+	s.metrics.Add(metrics.FileOpenAuditLogs, 1)
 	return &writer{
-		file: file,
+		file:    file,
+		path:    path.Join(s.directory, name),
+		metrics: s.metrics,
+		onClose: func() {
+			s.lock.Lock()
+			delete(s.writing, name)
+			s.lock.Unlock()
+			s.metrics.Add(metrics.FileOpenAuditLogs, -1)
+		},
+	}, nil
+
+}
+
+// Create opens a writer to store an audit log
+func (s *fileStorage) Create(ctx context.Context, name string) (storage.Writer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.OpenWriter(name)
+}
+
+// Open opens a reader for a specific audit log
+func (s *fileStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path.Join(s.directory, name))
+	if err != nil {
+		return nil, wrapNotFound(name, err)
+	}
+	return file, nil
+}
+
+// Follow opens a reader for a specific audit log that waits for more data until the audit log is closed by this storage
+// instance.
+func (s *fileStorage) Follow(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := s.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return storage.FollowReader(ctx, reader, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return !s.writing[name]
+	}), nil
+}
+
+// OpenRange opens a reader for a byte range of a specific audit log
+func (s *fileStorage) OpenRange(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error) {
+	reader, err := s.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return storage.RangeReader(reader, offset, length)
+}
+
+// Stat returns the size of an audit log. The audit log is reported as finished if it is not currently being written by
+// this storage instance.
+func (s *fileStorage) Stat(ctx context.Context, name string) (storage.EntryInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.EntryInfo{}, err
+	}
+	stat, err := os.Stat(path.Join(s.directory, name))
+	if err != nil {
+		return storage.EntryInfo{}, wrapNotFound(name, err)
+	}
+	s.lock.Lock()
+	writing := s.writing[name]
+	s.lock.Unlock()
+	return storage.EntryInfo{
+		Name:     name,
+		Size:     stat.Size(),
+		Metadata: map[string]string{},
+		Finished: !writing,
 	}, nil
+}
 
+// Delete removes an audit log. Audit logs that are still being written by this storage instance are not removed.
+func (s *fileStorage) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.writing[name] {
+		return fmt.Errorf("audit log %s is still being written (%w)", name, storage.ErrInUse)
+	}
+	if err := os.Remove(path.Join(s.directory, name)); err != nil {
+		return wrapNotFound(name, err)
+	}
+	return nil
+}
+
+func wrapNotFound(name string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("audit log %s does not exist (%w)", name, storage.ErrNotFound)
+	}
+	return err
 }
 
 type writer struct {
-	file *os.File
+	file    *os.File
+	path    string
+	metrics metrics.Collector
+	onClose func()
 }
 
 func (w *writer) Write(p []byte) (n int, err error) {
-	return w.file.Write(p)
+	n, err = w.file.Write(p)
+	w.metrics.Add(metrics.FileBytesWrittenTotal, float64(n))
+	if err != nil {
+		w.metrics.Add(metrics.FileErrorsTotal, 1)
+	}
+	return n, err
 }
 
 func (w *writer) Close() error {
-	return w.file.Close()
+	w.onClose()
+	err := w.file.Close()
+	if err != nil {
+		w.metrics.Add(metrics.FileErrorsTotal, 1)
+	}
+	return err
+}
+
+// Abort closes the file and removes it.
+func (w *writer) Abort() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Remove(w.path)
 }
 
 func (w *writer) SetMetadata(_ int64, _ string, _ string, _ *string) {
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// FollowPollInterval is the interval at which a follow reader checks for new data at the end of an audit log.
+const FollowPollInterval = 100 * time.Millisecond
+
+// FollowableStorage is a storage that can read audit logs while they are still being written.
+type FollowableStorage interface {
+	// Follow opens a reader for an audit log that may still be written. At the end of the data written so far the
+	// reader waits for more data instead of returning io.EOF until the audit log is finished. When the context is
+	// cancelled the reader returns the context error. Returns ErrNotFound if the audit log does not exist.
+	Follow(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// FollowReader returns a reader that polls the reader for new data at the end instead of returning io.EOF until
+// finished returns true. The storages use it to implement Follow.
+func FollowReader(ctx context.Context, reader io.ReadCloser, finished func() bool) io.ReadCloser {
+	return &followReader{
+		ctx:      ctx,
+		backend:  reader,
+		finished: finished,
+	}
+}
+
+type followReader struct {
+	ctx      context.Context
+	backend  io.ReadCloser
+	finished func() bool
+}
+
+func (f *followReader) Read(p []byte) (int, error) {
+	finished := false
+	for {
+		if err := f.ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := f.backend.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if finished {
+			return 0, io.EOF
+		}
+		if f.finished() {
+			// Read once more, the last data may have been written after the previous read.
+			finished = true
+			continue
+		}
+		select {
+		case <-time.After(FollowPollInterval):
+		case <-f.ctx.Done():
+		}
+	}
+}
+
+func (f *followReader) Close() error {
+	return f.backend.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package storage
+
+// FreeSpace returns ErrFreeSpaceUnsupported on this platform.
+func FreeSpace(_ string) (uint64, error) {
+	return 0, ErrFreeSpaceUnsupported
+}
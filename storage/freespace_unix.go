@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package storage
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeSpace returns the number of bytes available to unprivileged users on the filesystem of the directory.
+func FreeSpace(directory string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(directory, &stat); err != nil {
+		return 0, fmt.Errorf("failed to determine free disk space of %s (%w)", directory, err)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// HealthStatus is the outcome of a health check.
+type HealthStatus string
+
+const (
+	// HealthStatusHealthy means the storage works as expected.
+	HealthStatusHealthy HealthStatus = "healthy"
+	// HealthStatusDegraded means the storage still records audit logs, but a problem needs attention, for example a
+	// growing upload backlog.
+	HealthStatusDegraded HealthStatus = "degraded"
+	// HealthStatusUnhealthy means audit logs may be lost. New connections should not be accepted.
+	HealthStatusUnhealthy HealthStatus = "unhealthy"
+)
+
+// severity orders the statuses from best to worst.
+func (s HealthStatus) severity() int {
+	switch s {
+	case HealthStatusHealthy:
+		return 0
+	case HealthStatusDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// HealthCheckResult is the result of a single check.
+type HealthCheckResult struct {
+	// Name identifies the check, for example "s3.bucket".
+	Name string `json:"name" yaml:"name"`
+	// Status is the outcome of the check.
+	Status HealthStatus `json:"status" yaml:"status"`
+	// Message describes the problem or the measured value.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Health is the combined result of the health checks of a storage or logger.
+type Health struct {
+	// Status is the worst status of the checks, or healthy if there are no checks.
+	Status HealthStatus `json:"status" yaml:"status"`
+	// Checks lists the individual checks.
+	Checks []HealthCheckResult `json:"checks" yaml:"checks"`
+}
+
+// NewHealth combines the results of the checks.
+func NewHealth(checks ...HealthCheckResult) Health {
+	health := Health{Status: HealthStatusHealthy}
+	for _, check := range checks {
+		health.add(check)
+	}
+	return health
+}
+
+// Healthy returns true if the status is not unhealthy. Degraded storages are still considered healthy.
+func (h Health) Healthy() bool {
+	return h.Status != HealthStatusUnhealthy
+}
+
+// Merge returns the health combined with the checks of another health, prefixing their names with the prefix.
+func (h Health) Merge(prefix string, other Health) Health {
+	result := Health{
+		Status: h.Status,
+		Checks: append([]HealthCheckResult(nil), h.Checks...),
+	}
+	if result.Status == "" {
+		result.Status = HealthStatusHealthy
+	}
+	for _, check := range other.Checks {
+		check.Name = prefix + check.Name
+		result.add(check)
+	}
+	if other.Status.severity() > result.Status.severity() {
+		result.Status = other.Status
+	}
+	return result
+}
+
+func (h *Health) add(check HealthCheckResult) {
+	h.Checks = append(h.Checks, check)
+	if check.Status.severity() > h.Status.severity() {
+		h.Status = check.Status
+	}
+}
+
+// HealthCheckableStorage is a storage that can check whether it is able to record audit logs.
+type HealthCheckableStorage interface {
+	// HealthCheck runs the health checks of the storage. Checks involving remote services stop when the context is
+	// cancelled.
+	HealthCheck(ctx context.Context) Health
+}
+
+// HealthCheck checks the storage if it implements HealthCheckableStorage. Other storages are reported healthy.
+func HealthCheck(ctx context.Context, storage interface{}) Health {
+	if checkable, ok := storage.(HealthCheckableStorage); ok {
+		return checkable.HealthCheck(ctx)
+	}
+	return NewHealth()
+}
+
+// ErrFreeSpaceUnsupported is returned by FreeSpace on platforms where the free disk space cannot be determined.
+var ErrFreeSpaceUnsupported = errors.New("free disk space cannot be determined on this platform")
+
+// CheckFreeSpace returns the result of a check named name comparing the space available to unprivileged users on the
+// filesystem of the directory with minFreeBytes. The check is skipped and reported healthy if minFreeBytes is 0 or the
+// platform is not supported.
+func CheckFreeSpace(name string, directory string, minFreeBytes uint64) HealthCheckResult {
+	if minFreeBytes == 0 {
+		return HealthCheckResult{Name: name, Status: HealthStatusHealthy, Message: "free space check disabled"}
+	}
+	free, err := FreeSpace(directory)
+	if err != nil {
+		if errors.Is(err, ErrFreeSpaceUnsupported) {
+			return HealthCheckResult{Name: name, Status: HealthStatusHealthy, Message: err.Error()}
+		}
+		return HealthCheckResult{Name: name, Status: HealthStatusUnhealthy, Message: err.Error()}
+	}
+	if free < minFreeBytes {
+		return HealthCheckResult{
+			Name:    name,
+			Status:  HealthStatusUnhealthy,
+			Message: formatFreeSpace(free, minFreeBytes),
+		}
+	}
+	return HealthCheckResult{Name: name, Status: HealthStatusHealthy, Message: formatFreeSpace(free, minFreeBytes)}
+}
+
+func formatFreeSpace(free uint64, minFreeBytes uint64) string {
+	return fmt.Sprintf("%d bytes free, minimum %d bytes", free, minFreeBytes)
+}
@@ -0,0 +1,80 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/memory"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	st := memory.NewStorageV2()
+	writer, err := st.Create(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	username := "foo"
+	writer.SetMetadata(1000, "127.0.0.1", "DE", &username)
+	_, err = writer.Write([]byte("Hello world!"))
+	assert.NoError(t, err)
+
+	info, err := st.Stat(context.Background(), "test")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), info.Size)
+	assert.False(t, info.Finished)
+	assert.Equal(t, "foo", info.Metadata["username"])
+	assert.True(t, errors.Is(st.Delete(context.Background(), "test"), storage.ErrInUse))
+
+	assert.NoError(t, writer.Close())
+	_, err = writer.Write([]byte("!"))
+	assert.Error(t, err)
+
+	reader, err := st.OpenRange(context.Background(), "test", 6, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(data))
+
+	entries, errorChannel := st.List(context.Background(), storage.Query{Country: "DE"})
+	var names []string
+	for entry := range entries {
+		names = append(names, entry.Name)
+	}
+	assert.NoError(t, <-errorChannel)
+	assert.Equal(t, []string{"test"}, names)
+
+	assert.NoError(t, st.Delete(context.Background(), "test"))
+	_, err = st.Stat(context.Background(), "test")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+}
+
+func TestFollow(t *testing.T) {
+	st := memory.NewStorage()
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte("Hello "))
+	assert.NoError(t, err)
+
+	reader, err := st.(storage.FollowableStorage).Follow(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = writer.Write([]byte("world!"))
+		_ = writer.Close()
+	}()
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world!", string(data))
+}
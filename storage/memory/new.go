@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+// NewStorage Creates a storage that keeps the audit logs in memory. The audit logs are lost when the storage is
+// discarded, so this storage is intended for tests of applications using the audit log.
+func NewStorage() storage.ReadWriteStorage {
+	return newStorage()
+}
+
+// NewStorageV2 Creates a context-aware storage that keeps the audit logs in memory.
+func NewStorageV2() storage.ReadWriteStorageV2 {
+	return newStorage()
+}
+
+func newStorage() *memoryStorage {
+	return &memoryStorage{
+		lock: &sync.Mutex{},
+		logs: map[string]*auditLog{},
+	}
+}
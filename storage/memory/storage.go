@@ -0,0 +1,211 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+type memoryStorage struct {
+	lock *sync.Mutex
+	logs map[string]*auditLog
+}
+
+// auditLog is a stored audit log. All fields are guarded by the storage lock.
+type auditLog struct {
+	data     []byte
+	metadata map[string]string
+	finished bool
+}
+
+func (s *memoryStorage) Shutdown(_ context.Context) {
+}
+
+// OpenWriter opens a writer to store an audit log. An existing audit log with the same name is replaced.
+func (s *memoryStorage) OpenWriter(name string) (storage.Writer, error) {
+	log := &auditLog{
+		metadata: map[string]string{},
+	}
+	s.lock.Lock()
+	s.logs[name] = log
+	s.lock.Unlock()
+	return &writer{
+		lock: s.lock,
+		log:  log,
+		onAbort: func() {
+			if s.logs[name] == log {
+				delete(s.logs, name)
+			}
+		},
+	}, nil
+}
+
+// Create opens a writer to store an audit log
+func (s *memoryStorage) Create(ctx context.Context, name string) (storage.Writer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.OpenWriter(name)
+}
+
+// OpenReader opens a reader for the data written to an audit log so far
+func (s *memoryStorage) OpenReader(name string) (io.ReadCloser, error) {
+	return s.Open(context.Background(), name)
+}
+
+// Open opens a reader for the data written to an audit log so far
+func (s *memoryStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	log, ok := s.logs[name]
+	if !ok {
+		s.lock.Unlock()
+		return nil, notFound(name)
+	}
+	size := len(log.data)
+	s.lock.Unlock()
+	return &reader{lock: s.lock, log: log, end: size}, nil
+}
+
+// Follow opens a reader for a specific audit log that waits for more data until the writer is closed.
+func (s *memoryStorage) Follow(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	log, ok := s.logs[name]
+	s.lock.Unlock()
+	if !ok {
+		return nil, notFound(name)
+	}
+	return storage.FollowReader(ctx, &reader{lock: s.lock, log: log, end: -1}, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return log.finished
+	}), nil
+}
+
+// OpenRange opens a reader for a byte range of a specific audit log
+func (s *memoryStorage) OpenRange(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error) {
+	r, err := s.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return storage.RangeReader(r, offset, length)
+}
+
+// Stat returns the size, metadata and state of an audit log.
+func (s *memoryStorage) Stat(ctx context.Context, name string) (storage.EntryInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return storage.EntryInfo{}, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	log, ok := s.logs[name]
+	if !ok {
+		return storage.EntryInfo{}, notFound(name)
+	}
+	return storage.EntryInfo{
+		Name:     name,
+		Size:     int64(len(log.data)),
+		Metadata: copyMetadata(log.metadata),
+		Finished: log.finished,
+	}, nil
+}
+
+// Delete removes an audit log. Audit logs that are still being written are not removed.
+func (s *memoryStorage) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	log, ok := s.logs[name]
+	if !ok {
+		return notFound(name)
+	}
+	if !log.finished {
+		return fmt.Errorf("audit log %s is still being written (%w)", name, storage.ErrInUse)
+	}
+	delete(s.logs, name)
+	return nil
+}
+
+// List lists the audit logs matching the query in the order of their names.
+func (s *memoryStorage) List(ctx context.Context, query storage.Query) (<-chan storage.Entry, <-chan error) {
+	s.lock.Lock()
+	var entries []storage.Entry
+	for name, log := range s.logs {
+		entry := storage.Entry{
+			Name:     name,
+			Metadata: copyMetadata(log.metadata),
+		}
+		if query.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	s.lock.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	result := make(chan storage.Entry)
+	errorChannel := make(chan error)
+	go func() {
+		defer close(errorChannel)
+		defer close(result)
+		for _, entry := range entries {
+			select {
+			case result <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return result, errorChannel
+}
+
+func notFound(name string) error {
+	return fmt.Errorf("audit log %s does not exist (%w)", name, storage.ErrNotFound)
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	result := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		result[key] = value
+	}
+	return result
+}
+
+// reader reads an audit log up to end, or up to the data written so far if end is negative.
+type reader struct {
+	lock   *sync.Mutex
+	log    *auditLog
+	offset int
+	end    int
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	end := r.end
+	if end < 0 {
+		end = len(r.log.data)
+	}
+	if r.offset >= end {
+		return 0, io.EOF
+	}
+	n := copy(p, r.log.data[r.offset:end])
+	r.offset += n
+	return n, nil
+}
+
+func (r *reader) Close() error {
+	return nil
+}
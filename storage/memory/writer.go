@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+type writer struct {
+	lock *sync.Mutex
+	log  *auditLog
+	// onAbort removes the audit log from the storage. It is called with the lock held.
+	onAbort func()
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.log.finished {
+		return 0, fmt.Errorf("audit log is already closed")
+	}
+	w.log.data = append(w.log.data, p...)
+	return len(p), nil
+}
+
+func (w *writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.log.finished = true
+	return nil
+}
+
+// Abort closes the audit log and removes it from the storage.
+func (w *writer) Abort() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.log.finished = true
+	w.onAbort()
+	return nil
+}
+
+// SetMetadata stores the metadata under the same keys as the S3 storage so storage.Query filters work.
+func (w *writer) SetMetadata(startTime int64, sourceIP string, country string, username *string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.log.metadata["timestamp"] = fmt.Sprintf("%d", startTime)
+	w.log.metadata["ip"] = sourceIP
+	w.log.metadata["country"] = country
+	w.log.metadata["authenticated"] = fmt.Sprintf("%t", username != nil)
+	if username != nil {
+		w.log.metadata["username"] = *username
+	}
+}
+
+func (w *writer) SetContentType(contentType string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.log.metadata["contenttype"] = contentType
+}
+
+func (w *writer) SetSessionInfo(info storage.SessionInfo) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.log.metadata["endtimestamp"] = fmt.Sprintf("%d", info.EndTime)
+	if info.ExitStatus != nil {
+		w.log.metadata["exitstatus"] = fmt.Sprintf("%d", *info.ExitStatus)
+	}
+}
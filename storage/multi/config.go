@@ -0,0 +1,40 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+// Policy describes how failures of a backend are handled.
+type Policy string
+
+const (
+	// PolicyRequired fails opening, writing or closing the audit log if the backend fails.
+	PolicyRequired Policy = "required"
+	// PolicyBestEffort logs a warning and stops writing the audit log to the backend if it fails. The other backends
+	// are not affected.
+	PolicyBestEffort Policy = "bestEffort"
+)
+
+// Validate checks the policy.
+func (p Policy) Validate() error {
+	switch p {
+	case "":
+	case PolicyRequired:
+	case PolicyBestEffort:
+	default:
+		return fmt.Errorf("invalid storage policy: %s", p)
+	}
+	return nil
+}
+
+// Backend is a storage the multi storage writes audit logs to.
+type Backend struct {
+	// Name identifies the backend in log messages.
+	Name string
+	// Storage is the backend storage.
+	Storage storage.WritableStorage
+	// Policy is the failure policy of the backend. Defaults to PolicyRequired.
+	Policy Policy
+}
@@ -0,0 +1,201 @@
+package multi_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/memory"
+	"github.com/containerssh/auditlog/storage/multi"
+)
+
+// faultyStorage is a memory storage that fails on request and records its shutdown.
+type faultyStorage struct {
+	storage.ReadWriteStorage
+
+	failOpen  bool
+	failWrite bool
+	health    storage.HealthStatus
+	shutdown  bool
+}
+
+func newFaultyStorage() *faultyStorage {
+	return &faultyStorage{ReadWriteStorage: memory.NewStorage()}
+}
+
+func (f *faultyStorage) OpenWriter(name string) (storage.Writer, error) {
+	if f.failOpen {
+		return nil, fmt.Errorf("open failed")
+	}
+	writer, err := f.ReadWriteStorage.OpenWriter(name)
+	if err != nil || !f.failWrite {
+		return writer, err
+	}
+	return &faultyWriter{Writer: writer}, nil
+}
+
+func (f *faultyStorage) Shutdown(shutdownContext context.Context) {
+	f.shutdown = true
+	f.ReadWriteStorage.Shutdown(shutdownContext)
+}
+
+func (f *faultyStorage) HealthCheck(_ context.Context) storage.Health {
+	if f.health == "" {
+		return storage.NewHealth()
+	}
+	return storage.NewHealth(storage.HealthCheckResult{Name: "memory", Status: f.health})
+}
+
+// faultyWriter fails all writes, but can be closed.
+type faultyWriter struct {
+	storage.Writer
+}
+
+func (f *faultyWriter) Write(_ []byte) (int, error) {
+	return 0, fmt.Errorf("write failed")
+}
+
+// readAuditLog returns the data and the details of an audit log in a backend.
+func readAuditLog(t *testing.T, st storage.ReadWriteStorage, name string) (string, storage.EntryInfo) {
+	info, err := storage.ToV2(st).Stat(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := st.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), info
+}
+
+func TestWritesToAllBackends(t *testing.T) {
+	backend1 := newFaultyStorage()
+	backend2 := newFaultyStorage()
+	st, err := multi.NewStorage([]multi.Backend{
+		{Storage: backend1},
+		{Storage: backend2, Policy: multi.PolicyBestEffort},
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	assert.NoError(t, err)
+	writer.SetMetadata(0, "127.0.0.1", "XX", nil)
+	_, err = writer.Write([]byte("Hello world!"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	st.Shutdown(context.Background())
+
+	for _, backend := range []*faultyStorage{backend1, backend2} {
+		data, info := readAuditLog(t, backend.ReadWriteStorage, "test")
+		assert.Equal(t, "Hello world!", data)
+		assert.Equal(t, "XX", info.Metadata["country"])
+		assert.True(t, info.Finished)
+		assert.True(t, backend.shutdown)
+	}
+}
+
+func TestRequiredBackendFailure(t *testing.T) {
+	// The audit log already opened on the other backend is discarded instead of being left behind empty.
+	backend := memory.NewStorage()
+	failing := newFaultyStorage()
+	failing.failOpen = true
+	st, err := multi.NewStorage([]multi.Backend{
+		{Storage: backend},
+		{Storage: failing, Policy: multi.PolicyRequired},
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.OpenWriter("test")
+	assert.Error(t, err)
+	_, err = storage.ToV2(backend).Stat(context.Background(), "test")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+
+	failing = newFaultyStorage()
+	failing.failWrite = true
+	st, err = multi.NewStorage([]multi.Backend{
+		{Storage: memory.NewStorage()},
+		{Storage: failing},
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	assert.NoError(t, err)
+	n, err := writer.Write([]byte("Hello world!"))
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestBestEffortBackendFailure(t *testing.T) {
+	backend1 := memory.NewStorage()
+	backend2 := newFaultyStorage()
+	backend2.failWrite = true
+	backend3 := newFaultyStorage()
+	backend3.failOpen = true
+	st, err := multi.NewStorage([]multi.Backend{
+		{Storage: backend1},
+		{Storage: backend2, Policy: multi.PolicyBestEffort},
+		{Storage: backend3, Policy: multi.PolicyBestEffort},
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("Hello "))
+	assert.NoError(t, err)
+	_, info := readAuditLog(t, backend2.ReadWriteStorage, "test")
+	assert.True(t, info.Finished)
+	_, err = writer.Write([]byte("world!"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	data, _ := readAuditLog(t, backend1, "test")
+	assert.Equal(t, "Hello world!", data)
+}
+
+func TestHealthCheck(t *testing.T) {
+	healthy := newFaultyStorage()
+	healthy.health = storage.HealthStatusHealthy
+	unhealthy := newFaultyStorage()
+	unhealthy.health = storage.HealthStatusUnhealthy
+	st, err := multi.NewStorage([]multi.Backend{
+		{Name: "required", Storage: healthy},
+		{Name: "optional", Storage: unhealthy, Policy: multi.PolicyBestEffort},
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	health := storage.HealthCheck(context.Background(), st)
+	assert.True(t, health.Healthy())
+	assert.Equal(t, storage.HealthStatusDegraded, health.Status)
+	assert.Equal(t, []storage.HealthCheckResult{
+		{Name: "required.memory", Status: storage.HealthStatusHealthy},
+		{Name: "optional.memory", Status: storage.HealthStatusDegraded},
+	}, health.Checks)
+
+	st, err = multi.NewStorage([]multi.Backend{
+		{Name: "required", Storage: unhealthy},
+		{Name: "optional", Storage: newFaultyStorage(), Policy: multi.PolicyBestEffort},
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	health = storage.HealthCheck(context.Background(), st)
+	assert.False(t, health.Healthy())
+	assert.Equal(t, storage.HealthStatusUnhealthy, health.Status)
+}
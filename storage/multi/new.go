@@ -0,0 +1,32 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+// NewStorage creates a storage that writes each audit log to all backends. At least one backend must be provided.
+func NewStorage(backends []Backend, logger log.Logger) (storage.WritableStorage, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no storage backends provided")
+	}
+	backends = append([]Backend(nil), backends...)
+	for i, backend := range backends {
+		if backend.Storage == nil {
+			return nil, fmt.Errorf("no storage provided for backend %d", i)
+		}
+		if err := backend.Policy.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid policy for backend %d (%w)", i, err)
+		}
+		if backend.Name == "" {
+			backends[i].Name = fmt.Sprintf("%d", i)
+		}
+	}
+	return &multiStorage{
+		backends: backends,
+		logger:   logger,
+	}, nil
+}
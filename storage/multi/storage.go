@@ -0,0 +1,91 @@
+package multi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/storage"
+)
+
+type multiStorage struct {
+	backends []Backend
+	logger   log.Logger
+}
+
+func (m *multiStorage) OpenWriter(name string) (storage.Writer, error) {
+	w := &writer{
+		name:   name,
+		logger: m.logger,
+	}
+	for _, backend := range m.backends {
+		openedWriter, err := backend.Storage.OpenWriter(name)
+		if err != nil {
+			if backend.Policy == PolicyBestEffort {
+				m.logger.Warning(log.Wrap(
+					err,
+					codes.EMultiStorageBackendFailed,
+					"failed to open audit log %s on best effort storage backend %s, skipping backend",
+					name,
+					backend.Name,
+				).Label("log", name))
+				continue
+			}
+			// The audit logs already opened on the other backends would otherwise be left behind empty.
+			if err := w.Abort(); err != nil {
+				m.logger.Warning(err)
+			}
+			return nil, log.Wrap(
+				err,
+				codes.EMultiStorageBackendFailed,
+				"failed to open audit log %s on required storage backend %s",
+				name,
+				backend.Name,
+			)
+		}
+		w.writers = append(w.writers, &backendWriter{
+			Writer:  openedWriter,
+			backend: backend,
+		})
+	}
+	return w, nil
+}
+
+func (m *multiStorage) Shutdown(shutdownContext context.Context) {
+	wg := &sync.WaitGroup{}
+	for _, backend := range m.backends {
+		wg.Add(1)
+		go func(backend Backend) {
+			defer wg.Done()
+			backend.Storage.Shutdown(shutdownContext)
+		}(backend)
+	}
+	wg.Wait()
+}
+
+// HealthCheck checks all backends. The checks of each backend are prefixed with the backend name. Failing best effort
+// backends only degrade the multi storage.
+func (m *multiStorage) HealthCheck(ctx context.Context) storage.Health {
+	health := storage.NewHealth()
+	for _, backend := range m.backends {
+		backendHealth := storage.HealthCheck(ctx, backend.Storage)
+		if backend.Policy == PolicyBestEffort {
+			backendHealth = downgradeUnhealthy(backendHealth)
+		}
+		health = health.Merge(backend.Name+".", backendHealth)
+	}
+	return health
+}
+
+func downgradeUnhealthy(health storage.Health) storage.Health {
+	checks := make([]storage.HealthCheckResult, len(health.Checks))
+	for i, check := range health.Checks {
+		if check.Status == storage.HealthStatusUnhealthy {
+			check.Status = storage.HealthStatusDegraded
+		}
+		checks[i] = check
+	}
+	return storage.NewHealth(checks...)
+}
@@ -0,0 +1,146 @@
+package multi
+
+import (
+	"io"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/storage"
+)
+
+type backendWriter struct {
+	storage.Writer
+
+	backend Backend
+	failed  bool
+}
+
+type writer struct {
+	name    string
+	logger  log.Logger
+	writers []*backendWriter
+}
+
+// fail handles a failed backend. Best effort backends are closed and skipped from now on, the error is returned for
+// required backends.
+func (w *writer) fail(backendWriter *backendWriter, err error, operation string) error {
+	wrappedErr := log.Wrap(
+		err,
+		codes.EMultiStorageBackendFailed,
+		"failed to %s audit log %s on storage backend %s",
+		operation,
+		w.name,
+		backendWriter.backend.Name,
+	).Label("log", w.name)
+	if backendWriter.backend.Policy != PolicyBestEffort {
+		return wrappedErr
+	}
+	w.logger.Warning(wrappedErr)
+	backendWriter.failed = true
+	if operation != "close" && operation != "abort" {
+		_ = backendWriter.Close()
+	}
+	return nil
+}
+
+// Write writes the data to all backends. If a required backend fails, the number of bytes written is the least number
+// of bytes a failing required backend has written.
+func (w *writer) Write(p []byte) (int, error) {
+	written := len(p)
+	var result error
+	for _, backendWriter := range w.writers {
+		if backendWriter.failed {
+			continue
+		}
+		n, err := backendWriter.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			if err := w.fail(backendWriter, err, "write"); err != nil {
+				if result == nil {
+					result = err
+				}
+				if n < written {
+					written = n
+				}
+			}
+		}
+	}
+	return written, result
+}
+
+func (w *writer) Close() error {
+	var result error
+	for _, backendWriter := range w.writers {
+		if backendWriter.failed {
+			continue
+		}
+		if err := backendWriter.Close(); err != nil {
+			if err := w.fail(backendWriter, err, "close"); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+// Abort discards the audit log on all backends. Backends that cannot discard an audit log close it instead.
+func (w *writer) Abort() error {
+	var result error
+	for _, backendWriter := range w.writers {
+		if backendWriter.failed {
+			continue
+		}
+		var err error
+		if abortableWriter, ok := backendWriter.Writer.(storage.AbortableWriter); ok {
+			err = abortableWriter.Abort()
+		} else {
+			err = backendWriter.Close()
+		}
+		if err != nil {
+			if err := w.fail(backendWriter, err, "abort"); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+func (w *writer) SetMetadata(startTime int64, sourceIP string, country string, username *string) {
+	for _, backendWriter := range w.writers {
+		if !backendWriter.failed {
+			backendWriter.SetMetadata(startTime, sourceIP, country, username)
+		}
+	}
+}
+
+func (w *writer) SetContentType(contentType string) {
+	for _, backendWriter := range w.writers {
+		if contentTypeWriter, ok := backendWriter.Writer.(storage.ContentTypeWriter); ok && !backendWriter.failed {
+			contentTypeWriter.SetContentType(contentType)
+		}
+	}
+}
+
+func (w *writer) SetSessionInfo(info storage.SessionInfo) {
+	for _, backendWriter := range w.writers {
+		if sessionInfoWriter, ok := backendWriter.Writer.(storage.SessionInfoWriter); ok && !backendWriter.failed {
+			sessionInfoWriter.SetSessionInfo(info)
+		}
+	}
+}
+
+// AcceptsIO returns false if a required backend does not accept I/O. Best effort backends cannot stop the I/O being
+// written to the other backends.
+func (w *writer) AcceptsIO() bool {
+	for _, backendWriter := range w.writers {
+		if filterWriter, ok := backendWriter.Writer.(storage.IOFilterWriter); ok && !backendWriter.failed {
+			if backendWriter.backend.Policy != PolicyBestEffort && !filterWriter.AcceptsIO() {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -6,3 +6,9 @@ import "github.com/containerssh/auditlog/storage"
 func NewStorage() storage.WritableStorage {
 	return &nopStorage{}
 }
+
+// NewStorageV2 Creates a context-aware storage that swallows everything. Reading from it always returns
+// storage.ErrNotFound.
+func NewStorageV2() storage.ReadWriteStorageV2 {
+	return &nopStorage{}
+}
@@ -1,7 +1,15 @@
 package none
 
-import "github.com/containerssh/auditlog/storage"
+import (
+	"context"
+
+	"github.com/containerssh/auditlog/storage"
+)
 
 func (s nopStorage) OpenWriter(_ string) (storage.Writer, error) {
 	return &nullWriteCloser{}, nil
 }
+
+func (s nopStorage) Create(_ context.Context, _ string) (storage.Writer, error) {
+	return &nullWriteCloser{}, nil
+}
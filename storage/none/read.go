@@ -0,0 +1,37 @@
+package none
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+func (s *nopStorage) Open(_ context.Context, name string) (io.ReadCloser, error) {
+	return nil, notFound(name)
+}
+
+func (s *nopStorage) OpenRange(_ context.Context, name string, _ int64, _ int64) (io.ReadCloser, error) {
+	return nil, notFound(name)
+}
+
+func (s *nopStorage) Stat(_ context.Context, name string) (storage.EntryInfo, error) {
+	return storage.EntryInfo{}, notFound(name)
+}
+
+func (s *nopStorage) Delete(_ context.Context, name string) error {
+	return notFound(name)
+}
+
+func (s *nopStorage) List(_ context.Context, _ storage.Query) (<-chan storage.Entry, <-chan error) {
+	result := make(chan storage.Entry)
+	errorChannel := make(chan error)
+	close(result)
+	close(errorChannel)
+	return result, errorChannel
+}
+
+func notFound(name string) error {
+	return fmt.Errorf("audit log %s does not exist (%w)", name, storage.ErrNotFound)
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedFilter is returned by ReadableStorage.List if the storage cannot apply a filter of the query.
+var ErrUnsupportedFilter = errors.New("filter not supported by the storage")
+
+// Query filters the audit logs returned by ReadableStorage.List. Empty fields do not filter.
+//
+// The time, username and country filters are matched against the entry metadata using the timestamp, username and
+// country keys. Audit logs that do not have the required metadata do not match. Storages that cannot store metadata,
+// such as the file storage, only support the prefix filter and return ErrUnsupportedFilter for the other filters.
+//
+// The S3 storage cannot filter on metadata when listing the bucket. It passes the prefix to S3 and skips audit logs
+// uploaded before the start time, then fetches the metadata of each remaining audit log with a separate request.
+// Metadata filters are therefore only efficient if the prefix or the start time narrows the listing down.
+type Query struct {
+	// Prefix returns only audit logs whose name starts with this prefix.
+	Prefix string
+	// StartTime returns only audit logs of sessions that started at or after this time.
+	StartTime time.Time
+	// EndTime returns only audit logs of sessions that started before this time.
+	EndTime time.Time
+	// Username returns only audit logs of sessions authenticated with this username.
+	Username string
+	// Country returns only audit logs of sessions from this ISO country code.
+	Country string
+	// SkipMetadata allows the storage to return entries without metadata if no filter requires it. This avoids an
+	// additional request per audit log on some storages.
+	SkipMetadata bool
+}
+
+// NeedsMetadata returns true if the query filters on metadata.
+func (q Query) NeedsMetadata() bool {
+	return !q.StartTime.IsZero() || !q.EndTime.IsZero() || q.Username != "" || q.Country != ""
+}
+
+// MatchesName returns true if the audit log name matches the prefix filter.
+func (q Query) MatchesName(name string) bool {
+	return strings.HasPrefix(name, q.Prefix)
+}
+
+// Matches returns true if the entry matches all filters of the query.
+func (q Query) Matches(entry Entry) bool {
+	if !q.MatchesName(entry.Name) {
+		return false
+	}
+	if !q.StartTime.IsZero() || !q.EndTime.IsZero() {
+		timestamp, err := strconv.ParseInt(getMetadata(entry.Metadata, "timestamp"), 10, 64)
+		if err != nil {
+			return false
+		}
+		startTime := time.Unix(timestamp, 0)
+		if !q.StartTime.IsZero() && startTime.Before(q.StartTime.Truncate(time.Second)) {
+			return false
+		}
+		if !q.EndTime.IsZero() && !startTime.Before(q.EndTime) {
+			return false
+		}
+	}
+	if q.Username != "" && getMetadata(entry.Metadata, "username") != q.Username {
+		return false
+	}
+	if q.Country != "" && !strings.EqualFold(getMetadata(entry.Metadata, "country"), q.Country) {
+		return false
+	}
+	return true
+}
+
+// getMetadata looks up a metadata key case-insensitively as some storages canonicalize the keys.
+func getMetadata(metadata map[string]string, key string) string {
+	if value, ok := metadata[key]; ok {
+		return value
+	}
+	for k, value := range metadata {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Bandwidth limits the upload rate and schedules the upload of audit logs that are still being written.
+type Bandwidth struct {
+	// Limit is the maximum upload rate of all uploads together in bytes per second. Not limited if 0.
+	Limit uint64 `json:"limit" yaml:"limit"`
+	// PerLogLimit is the maximum upload rate of a single audit log in bytes per second. Not limited if 0.
+	PerLogLimit uint64 `json:"perLogLimit" yaml:"perLogLimit"`
+	// IntermediateSchedule lists the time windows in which parts of audit logs still being written are uploaded. Parts
+	// of finished audit logs are always uploaded. Intermediate parts are always uploaded if the list is empty.
+	IntermediateSchedule []TimeWindow `json:"intermediateSchedule" yaml:"intermediateSchedule"`
+	// Timezone is the IANA time zone of the schedule, for example Europe/Vienna. Defaults to the local time zone.
+	Timezone string `json:"timezone" yaml:"timezone"`
+}
+
+// Validate validates the bandwidth configuration.
+func (b Bandwidth) Validate() error {
+	if _, err := b.location(); err != nil {
+		return err
+	}
+	for i, window := range b.IntermediateSchedule {
+		if _, err := window.parse(); err != nil {
+			return fmt.Errorf("invalid intermediate schedule window %d (%w)", i, err)
+		}
+	}
+	return nil
+}
+
+func (b Bandwidth) location() (*time.Location, error) {
+	if b.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(b.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s (%w)", b.Timezone, err)
+	}
+	return location, nil
+}
+
+// newRateLimiter creates a token bucket limiting the rate to the bytes per second with a burst of one second.
+func newRateLimiter(bytesPerSecond uint64) *rateLimiter {
+	return &rateLimiter{
+		lock:   &sync.Mutex{},
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// newOptionalRateLimiter returns a rate limiter, or nil if the bytes per second are 0.
+func newOptionalRateLimiter(bytesPerSecond uint64) *rateLimiter {
+	if bytesPerSecond == 0 {
+		return nil
+	}
+	return newRateLimiter(bytesPerSecond)
+}
+
+type rateLimiter struct {
+	lock   *sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// wait blocks until n bytes may be sent.
+func (r *rateLimiter) wait(ctx context.Context, n int) error {
+	r.lock.Lock()
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+	r.tokens -= float64(n)
+	delay := time.Duration(0)
+	if r.tokens < 0 {
+		delay = time.Duration(-r.tokens / r.rate * float64(time.Second))
+	}
+	r.lock.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttle returns a request option limiting the upload rate of the request body with the global and the per audit
+// log rate limits. The body is throttled while it is sent, so the request signing, which reads the body beforehand, is
+// not affected.
+func (q *uploadQueue) throttle(entry *queueEntry) request.Option {
+	var limiters []*rateLimiter
+	for _, limiter := range []*rateLimiter{q.rateLimiter, entry.rateLimiter} {
+		if limiter != nil {
+			limiters = append(limiters, limiter)
+		}
+	}
+	return func(r *request.Request) {
+		if len(limiters) == 0 {
+			return
+		}
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			if r.HTTPRequest.Body == nil || r.HTTPRequest.Body == request.NoBody {
+				return
+			}
+			r.HTTPRequest.Body = &throttledBody{
+				backend:  r.HTTPRequest.Body,
+				ctx:      r.Context(),
+				limiters: limiters,
+			}
+		})
+	}
+}
+
+// throttledChunkSize is the maximum number of bytes read from a throttled body at once, so the rate is even.
+const throttledChunkSize = 32 * 1024
+
+type throttledBody struct {
+	backend  io.ReadCloser
+	ctx      context.Context
+	limiters []*rateLimiter
+}
+
+func (t *throttledBody) Read(p []byte) (int, error) {
+	chunkSize := throttledChunkSize
+	for _, limiter := range t.limiters {
+		if limiter.rate < float64(chunkSize) {
+			chunkSize = int(limiter.rate)
+		}
+	}
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := t.backend.Read(p)
+	for _, limiter := range t.limiters {
+		if waitErr := limiter.wait(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (t *throttledBody) Close() error {
+	return t.backend.Close()
+}
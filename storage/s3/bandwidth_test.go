@@ -0,0 +1,77 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+)
+
+func setupBandwidthStorage(t *testing.T, bandwidth s3.Bandwidth) (storage.ReadWriteStorage, *s3test.Server) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+	config.Bandwidth = bandwidth
+	return newS3Storage(t, config), server
+}
+
+func TestRateLimit(t *testing.T) {
+	st, server := setupBandwidthStorage(t, s3.Bandwidth{Limit: 20 * 1024})
+
+	data := bytes.Repeat([]byte("a"), 40*1024)
+	start := time.Now()
+	writeAuditLog(t, st, "test", data)
+	st.Shutdown(context.Background())
+
+	assert.Equal(t, int64(len(data)), server.ReceivedBytes(s3test.OperationPutObject))
+	// The first second is sent as a burst, the rest at the limit.
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(800*time.Millisecond))
+}
+
+func TestIntermediateSchedule(t *testing.T) {
+	now := time.Now().UTC()
+	closedWindow := s3.TimeWindow{
+		Start: now.Add(2 * time.Hour).Format("15:04"),
+		End:   now.Add(3 * time.Hour).Format("15:04"),
+	}
+	st, server := setupBandwidthStorage(t, s3.Bandwidth{
+		IntermediateSchedule: []s3.TimeWindow{closedWindow},
+		Timezone:             "UTC",
+	})
+
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("a"), 6*1024*1024)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Empty(t, server.Requests(), "intermediate parts were uploaded outside the schedule")
+
+	assert.NoError(t, writer.Close())
+	st.Shutdown(context.Background())
+	object, ok := server.GetObject("auditlog", "test")
+	assert.True(t, ok)
+	assert.Equal(t, len(data), len(object.Data))
+}
+
+func TestBandwidthConfig(t *testing.T) {
+	assert.NoError(t, s3.Bandwidth{
+		Limit:                1024,
+		IntermediateSchedule: []s3.TimeWindow{{Start: "18:00", End: "08:00", Days: []string{"mon", "Fri"}}},
+		Timezone:             "Europe/Vienna",
+	}.Validate())
+	assert.Error(t, s3.Bandwidth{IntermediateSchedule: []s3.TimeWindow{{Start: "25:00", End: "08:00"}}}.Validate())
+	assert.Error(t, s3.Bandwidth{IntermediateSchedule: []s3.TimeWindow{{Start: "18:00", End: "8"}}}.Validate())
+	assert.Error(t, s3.Bandwidth{
+		IntermediateSchedule: []s3.TimeWindow{{Start: "18:00", End: "08:00", Days: []string{"someday"}}},
+	}.Validate())
+	assert.Error(t, s3.Bandwidth{Timezone: "Nowhere/Special"}.Validate())
+}
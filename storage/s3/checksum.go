@@ -0,0 +1,166 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	awsS3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/storage"
+)
+
+// checksumMetadataKey is the object metadata key holding the hex-encoded SHA-256 digest of the full audit log.
+const checksumMetadataKey = "sha256"
+
+// sha256Sum calculates the SHA-256 digest of the data read from reader.
+func sha256Sum(reader io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// withChecksum returns a request option sending the SHA-256 digest of the uploaded object or part. S3 rejects the
+// upload if the received data does not match and stores the checksum with the object.
+func (q *uploadQueue) withChecksum(digest []byte) request.Option {
+	return func(r *request.Request) {
+		if q.disableChecksums {
+			return
+		}
+		r.HTTPRequest.Header.Set("x-amz-checksum-sha256", base64.StdEncoding.EncodeToString(digest))
+	}
+}
+
+// withChecksumAlgorithm returns a request option announcing the SHA-256 part checksums when creating a multipart
+// upload.
+func (q *uploadQueue) withChecksumAlgorithm() request.Option {
+	return func(r *request.Request) {
+		if q.disableChecksums {
+			return
+		}
+		r.HTTPRequest.Header.Set("x-amz-checksum-algorithm", "SHA256")
+	}
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	ChecksumSHA256 string `xml:"ChecksumSHA256,omitempty"`
+	ETag           string `xml:"ETag"`
+	PartNumber     int64  `xml:"PartNumber"`
+}
+
+// withPartChecksums returns a request option adding the part checksums to the completion of a multipart upload. S3
+// requires them if the upload was created with a checksum algorithm, but the SDK has no fields for them, so the
+// request body is replaced.
+func (q *uploadQueue) withPartChecksums(parts []*awsS3.CompletedPart, checksums map[int64]string) request.Option {
+	return func(r *request.Request) {
+		if q.disableChecksums {
+			return
+		}
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			body := completeMultipartUpload{}
+			for _, part := range parts {
+				partNumber := aws.Int64Value(part.PartNumber)
+				body.Parts = append(body.Parts, completedPart{
+					ChecksumSHA256: checksums[partNumber],
+					ETag:           aws.StringValue(part.ETag),
+					PartNumber:     partNumber,
+				})
+			}
+			data, err := xml.Marshal(body)
+			if err != nil {
+				r.Error = err
+				return
+			}
+			r.SetBufferBody(data)
+		})
+	}
+}
+
+// isDuplicate returns true if the bucket already holds an audit log with the same name, size, and checksum. This
+// happens when an upload completed, but the process stopped before the local copy was removed.
+func (q *uploadQueue) isDuplicate(s3Connection *awsS3.S3, name string, size int64, digest []byte) bool {
+	headObjectOutput, err := s3Connection.HeadObject(&awsS3.HeadObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return false
+	}
+	return aws.Int64Value(headObjectOutput.ContentLength) == size &&
+		strings.EqualFold(metadataValue(headObjectOutput.Metadata, checksumMetadataKey), hex.EncodeToString(digest))
+}
+
+// Verify downloads an uploaded audit log and compares it with the SHA-256 digest stored in the object metadata.
+// Audit logs uploaded in multiple parts with object lock enabled or larger than 5 GB have no digest in the metadata,
+// as the metadata cannot be updated after the upload.
+func (q *uploadQueue) Verify(ctx context.Context, name string) error {
+	s3Connection := awsS3.New(q.awsSession)
+
+	getObjectOutput, err := s3Connection.GetObjectWithContext(ctx, &awsS3.GetObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return wrapNotFound(name, err)
+	}
+	defer func() {
+		_ = getObjectOutput.Body.Close()
+	}()
+	expected := metadataValue(getObjectOutput.Metadata, checksumMetadataKey)
+	if expected == "" {
+		return fmt.Errorf("cannot verify audit log %s (%w)", name, storage.ErrNoChecksum)
+	}
+	digest, err := sha256Sum(getObjectOutput.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download audit log %s for verification (%w)", name, err)
+	}
+	if actual := hex.EncodeToString(digest); !strings.EqualFold(actual, expected) {
+		q.logger.Warning(log.NewMessage(
+			codes.EChecksumMismatch,
+			"audit log %s has the SHA-256 checksum %s instead of %s",
+			name,
+			actual,
+			expected,
+		).Label("log", name))
+		return fmt.Errorf(
+			"audit log %s has the SHA-256 checksum %s instead of %s (%w)",
+			name,
+			actual,
+			expected,
+			storage.ErrChecksumMismatch,
+		)
+	}
+	return nil
+}
+
+// metadataValue looks up an object metadata value. The SDK returns the keys in the canonical header format, so the
+// keys are compared case-insensitively.
+func metadataValue(metadata map[string]*string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
+
+// partChecksum calculates the SHA-256 digest of a section of the audit log.
+func partChecksum(handle io.ReaderAt, offset int64, length int64) ([]byte, error) {
+	return sha256Sum(io.NewSectionReader(handle, offset, length))
+}
@@ -0,0 +1,121 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChecksumSingleUpload(t *testing.T) {
+	server := newS3Server(t)
+	st := newS3Storage(t, newS3Config(t, server))
+
+	data := []byte("Hello world!")
+	writeAuditLog(t, st, "test", data)
+	st.Shutdown(context.Background())
+
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, data, object.Data)
+	assert.Equal(t, sha256Hex(data), object.Metadata["sha256"])
+	assert.NotEmpty(t, object.ChecksumSHA256)
+
+	verifiable := st.(storage.VerifiableStorage)
+	assert.NoError(t, verifiable.Verify(context.Background(), "test"))
+
+	object.Data = []byte("Hello World!")
+	assert.NoError(t, server.PutObject("auditlog", "test", object))
+	assert.True(t, errors.Is(verifiable.Verify(context.Background(), "test"), storage.ErrChecksumMismatch))
+}
+
+func TestChecksumMultipartUpload(t *testing.T) {
+	server := newS3Server(t)
+	st := newS3Storage(t, newS3Config(t, server))
+
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("a"), 11*1024*1024)
+	// Write in two steps so the first part is uploaded before the audit log is finished.
+	if _, err := writer.Write(data[:6*1024*1024]); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return server.RequestCount(s3test.OperationUploadPart) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	if _, err := writer.Write(data[6*1024*1024:]); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, writer.Close())
+	st.Shutdown(context.Background())
+
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, len(data), len(object.Data))
+	assert.Equal(t, sha256Hex(data), object.Metadata["sha256"])
+	// S3 stores the checksum of the part checksums for multipart uploads. The second part is either uploaded with the
+	// rest of the audit log or on its own, depending on whether the upload loop sees it before the close.
+	parts := server.RequestCount(s3test.OperationUploadPart)
+	assert.True(t, strings.HasSuffix(object.ChecksumSHA256, fmt.Sprintf("-%d", parts)), object.ChecksumSHA256)
+	assert.NoError(t, st.(storage.VerifiableStorage).Verify(context.Background(), "test"))
+}
+
+func TestVerifyErrors(t *testing.T) {
+	server := newS3Server(t)
+	st := newS3Storage(t, newS3Config(t, server))
+	defer st.Shutdown(context.Background())
+	verifiable := st.(storage.VerifiableStorage)
+
+	assert.True(t, errors.Is(verifiable.Verify(context.Background(), "missing"), storage.ErrNotFound))
+
+	assert.NoError(t, server.PutObject("auditlog", "old", s3test.Object{Data: []byte("Hello world!")}))
+	assert.True(t, errors.Is(verifiable.Verify(context.Background(), "old"), storage.ErrNoChecksum))
+}
+
+func TestRecoveredUploadDeduplication(t *testing.T) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+
+	data := []byte("Hello world!")
+	assert.NoError(t, server.PutObject("auditlog", "uploaded", s3test.Object{
+		Data:     data,
+		Metadata: map[string]string{"sha256": sha256Hex(data)},
+	}))
+	for _, name := range []string{"uploaded", "pending"} {
+		if err := ioutil.WriteFile(path.Join(config.Local, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newS3Storage(t, config).Shutdown(context.Background())
+
+	// Only the audit log missing from the bucket is uploaded.
+	assert.Equal(t, 1, server.RequestCount(s3test.OperationPutObject))
+	assert.Equal(t, []string{"pending", "uploaded"}, server.Keys("auditlog"))
+	_, err := os.Stat(path.Join(config.Local, "uploaded"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -19,6 +19,26 @@ type Config struct {
 	UploadPartSize  uint     `json:"uploadPartSize" yaml:"uploadPartSize" default:"5242880"`
 	ParallelUploads uint     `json:"parallelUploads" yaml:"parallelUploads" default:"20"`
 	Metadata        Metadata `json:"metadata" yaml:"metadata"`
+	// ListConcurrency is the number of metadata requests made in parallel when listing audit logs.
+	ListConcurrency uint `json:"listConcurrency" yaml:"listConcurrency" default:"10"`
+	// Tags configures which session details are attached to the audit logs as S3 object tags.
+	Tags Tags `json:"tags" yaml:"tags"`
+	// Credentials configures where the credentials for the S3 storage are obtained from. Defaults to using the
+	// accessKey and secretKey options.
+	Credentials Credentials `json:"credentials" yaml:"credentials"`
+	// ObjectLock configures the S3 Object Lock retention and legal hold for uploaded audit logs.
+	ObjectLock ObjectLock `json:"objectLock" yaml:"objectLock"`
+	// Retry configures the backoff between failed upload attempts and what happens when the upload is given up.
+	Retry Retry `json:"retry" yaml:"retry"`
+	// Spool limits the disk space and number of audit logs in the local directory.
+	Spool Spool `json:"spool" yaml:"spool"`
+	// Bandwidth limits the upload rate and schedules the upload of audit logs that are still being written.
+	Bandwidth Bandwidth `json:"bandwidth" yaml:"bandwidth"`
+	// DisableChecksumHeaders stops sending the SHA-256 checksums of uploads as S3 checksum headers for S3-compatible
+	// object storages that reject them. The checksum of the full audit log is still stored in the object metadata.
+	DisableChecksumHeaders bool `json:"disableChecksumHeaders" yaml:"disableChecksumHeaders"`
+	// HealthCheck configures the health checks of the S3 storage.
+	HealthCheck HealthCheck `json:"healthCheck" yaml:"healthCheck"`
 }
 
 // Validate validates the
@@ -33,14 +53,8 @@ func (config Config) Validate() error {
 	if !stat.IsDir() {
 		return fmt.Errorf("invalid local directory: %s (not a directory)", config.Local)
 	}
-	if config.AccessKey == "" {
-		return fmt.Errorf("no access key provided")
-	}
-	if config.SecretKey == "" {
-		return fmt.Errorf("no secret key provided")
-	}
-	if config.Bucket == "" {
-		return fmt.Errorf("no bucket name provided")
+	if err := config.validateBucketAccess(); err != nil {
+		return err
 	}
 	if config.UploadPartSize < 5242880 {
 		return fmt.Errorf("upload part size too low %d (minimum 5 MB)", config.UploadPartSize)
@@ -48,11 +62,64 @@ func (config Config) Validate() error {
 	if config.ParallelUploads < 1 {
 		return fmt.Errorf("parallel uploads invalid: %d (must be positive)", config.ParallelUploads)
 	}
+	if err := config.ObjectLock.Validate(); err != nil {
+		return fmt.Errorf("invalid object lock configuration (%w)", err)
+	}
+	if err := config.Spool.Validate(); err != nil {
+		return fmt.Errorf("invalid spool configuration (%w)", err)
+	}
+	if err := config.Bandwidth.Validate(); err != nil {
+		return fmt.Errorf("invalid bandwidth configuration (%w)", err)
+	}
+	if err := config.HealthCheck.Validate(); err != nil {
+		return fmt.Errorf("invalid health check configuration (%w)", err)
+	}
+	return nil
+}
+
+// validateBucketAccess validates the options needed to read from the bucket.
+func (config Config) validateBucketAccess() error {
+	if err := config.Credentials.Validate(config.AccessKey, config.SecretKey); err != nil {
+		return fmt.Errorf("invalid credentials configuration (%w)", err)
+	}
+	if config.Bucket == "" {
+		return fmt.Errorf("no bucket name provided")
+	}
+	if err := config.Retry.Validate(); err != nil {
+		return fmt.Errorf("invalid retry configuration (%w)", err)
+	}
 	return nil
 }
 
+func (config Config) withDefaults() Config {
+	if config.UploadPartSize == 0 {
+		config.UploadPartSize = 5242880
+	}
+	if config.ParallelUploads == 0 {
+		config.ParallelUploads = 20
+	}
+	if config.ListConcurrency == 0 {
+		config.ListConcurrency = 10
+	}
+	return config
+}
+
 // Metadata Metadata configuration for the S3 storage
 type Metadata struct {
 	IP       bool `json:"ip" yaml:"ip"`
 	Username bool `json:"username" yaml:"username"`
 }
+
+// Tags configures which session details are attached to the audit logs as S3 object tags, for example to use in
+// lifecycle rules.
+type Tags struct {
+	// Username adds the username as the "username" tag if the user authenticated.
+	Username bool `json:"username" yaml:"username"`
+	// Country adds the country code as the "country" tag.
+	Country bool `json:"country" yaml:"country"`
+	// Outcome adds the session outcome as the "outcome" tag. The outcome is one of "unauthenticated", "success",
+	// "failure" (the last program exited with a non-zero status), or "incomplete" (the session end was not recorded).
+	Outcome bool `json:"outcome" yaml:"outcome"`
+	// AuthMethods adds the authentication methods the user tried as the "authmethods" tag, joined with a "+" sign.
+	AuthMethods bool `json:"authMethods" yaml:"authMethods"`
+}
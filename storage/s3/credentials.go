@@ -0,0 +1,220 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/containerssh/log"
+)
+
+// CredentialSource describes where the S3 storage obtains its credentials from.
+type CredentialSource string
+
+const (
+	// CredentialSourceStatic uses the accessKey and secretKey options from the configuration.
+	CredentialSourceStatic CredentialSource = "static"
+	// CredentialSourceEnvironment reads the credentials from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN environment variables.
+	CredentialSourceEnvironment CredentialSource = "environment"
+	// CredentialSourceProfile reads the credentials from a profile in the shared AWS config and credentials files.
+	CredentialSourceProfile CredentialSource = "profile"
+	// CredentialSourceEC2 fetches the credentials of the instance role from the EC2 instance metadata service.
+	CredentialSourceEC2 CredentialSource = "ec2"
+	// CredentialSourceECS fetches the credentials of the task role from the ECS container credentials endpoint.
+	CredentialSourceECS CredentialSource = "ecs"
+	// CredentialSourceWebIdentity exchanges a web identity token file (e.g. a Kubernetes service account token) for
+	// role credentials.
+	CredentialSourceWebIdentity CredentialSource = "webIdentity"
+)
+
+// Validate checks the credential source.
+func (c CredentialSource) Validate() error {
+	switch c {
+	case "":
+	case CredentialSourceStatic:
+	case CredentialSourceEnvironment:
+	case CredentialSourceProfile:
+	case CredentialSourceEC2:
+	case CredentialSourceECS:
+	case CredentialSourceWebIdentity:
+	default:
+		return fmt.Errorf("invalid credential source: %s", c)
+	}
+	return nil
+}
+
+// Credentials configures the credential source for the S3 storage.
+type Credentials struct {
+	// Source selects where the credentials are obtained from. Defaults to static credentials.
+	Source CredentialSource `json:"source" yaml:"source" default:"static"`
+	// Profile is the profile name to use with the profile source. Defaults to the AWS_PROFILE environment variable
+	// or "default".
+	Profile string `json:"profile" yaml:"profile"`
+	// SharedCredentialsFile overrides the location of the shared credentials file for the profile source.
+	SharedCredentialsFile string `json:"sharedCredentialsFile" yaml:"sharedCredentialsFile"`
+	// SharedConfigFile overrides the location of the shared config file for the profile source.
+	SharedConfigFile string `json:"sharedConfigFile" yaml:"sharedConfigFile"`
+	// MetadataEndpoint overrides the EC2 instance metadata service endpoint for the ec2 source, or the full
+	// credentials URL for the ecs source.
+	MetadataEndpoint string `json:"metadataEndpoint" yaml:"metadataEndpoint"`
+	// RoleARN is the role to assume. Required for the webIdentity source. With any other source the credentials
+	// obtained from the source are used to assume this role.
+	RoleARN string `json:"roleARN" yaml:"roleARN"`
+	// RoleSessionName is the session name to use when assuming a role.
+	RoleSessionName string `json:"roleSessionName" yaml:"roleSessionName"`
+	// ExternalID is the external ID to pass when assuming a role.
+	ExternalID string `json:"externalID" yaml:"externalID"`
+	// WebIdentityTokenFile is the file containing the web identity token for the webIdentity source.
+	WebIdentityTokenFile string `json:"webIdentityTokenFile" yaml:"webIdentityTokenFile"`
+	// STSEndpoint overrides the STS endpoint used for assuming roles.
+	STSEndpoint string `json:"stsEndpoint" yaml:"stsEndpoint"`
+}
+
+// Validate validates the credentials configuration. The access and secret keys are only required for the static
+// source.
+func (c Credentials) Validate(accessKey string, secretKey string) error {
+	if err := c.Source.Validate(); err != nil {
+		return err
+	}
+	switch c.Source {
+	case "", CredentialSourceStatic:
+		if accessKey == "" {
+			return fmt.Errorf("no access key provided")
+		}
+		if secretKey == "" {
+			return fmt.Errorf("no secret key provided")
+		}
+	case CredentialSourceWebIdentity:
+		if c.RoleARN == "" {
+			return fmt.Errorf("no role ARN provided for web identity credentials")
+		}
+		if c.WebIdentityTokenFile == "" {
+			return fmt.Errorf("no web identity token file provided")
+		}
+	}
+	if c.ExternalID != "" && c.RoleARN == "" {
+		return fmt.Errorf("external ID provided without a role ARN")
+	}
+	return nil
+}
+
+func getCredentials(cfg Config, logger log.Logger, httpClient *http.Client) (*credentials.Credentials, error) {
+	baseConfig := &aws.Config{
+		Region:     &cfg.Region,
+		HTTPClient: httpClient,
+		Logger:     logger,
+	}
+	sess, err := session.NewSession(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds *credentials.Credentials
+	switch cfg.Credentials.Source {
+	case "", CredentialSourceStatic:
+		creds = credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, "")
+	case CredentialSourceEnvironment:
+		creds = credentials.NewEnvCredentials()
+	case CredentialSourceProfile:
+		creds, err = getProfileCredentials(cfg.Credentials, baseConfig)
+	case CredentialSourceEC2:
+		var metadataConfigs []*aws.Config
+		if cfg.Credentials.MetadataEndpoint != "" {
+			metadataConfigs = append(metadataConfigs, &aws.Config{Endpoint: aws.String(cfg.Credentials.MetadataEndpoint)})
+		}
+		creds = ec2rolecreds.NewCredentialsWithClient(ec2metadata.New(sess, metadataConfigs...))
+	case CredentialSourceECS:
+		creds, err = getECSCredentials(cfg.Credentials, sess)
+	case CredentialSourceWebIdentity:
+		return credentials.NewCredentials(stscreds.NewWebIdentityRoleProvider(
+			getSTSClient(cfg.Credentials, sess),
+			cfg.Credentials.RoleARN,
+			cfg.Credentials.RoleSessionName,
+			cfg.Credentials.WebIdentityTokenFile,
+		)), nil
+	default:
+		return nil, fmt.Errorf("invalid credential source: %s", cfg.Credentials.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Credentials.RoleARN == "" {
+		return creds, nil
+	}
+	return assumeRole(cfg.Credentials, sess, creds), nil
+}
+
+func getProfileCredentials(cfg Credentials, baseConfig *aws.Config) (*credentials.Credentials, error) {
+	var sharedConfigFiles []string
+	if cfg.SharedConfigFile != "" {
+		sharedConfigFiles = append(sharedConfigFiles, cfg.SharedConfigFile)
+	}
+	if cfg.SharedCredentialsFile != "" {
+		sharedConfigFiles = append(sharedConfigFiles, cfg.SharedCredentialsFile)
+	}
+	profileSession, err := session.NewSessionWithOptions(session.Options{
+		Config:            *baseConfig,
+		Profile:           cfg.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+		SharedConfigFiles: sharedConfigFiles,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile %s (%w)", cfg.Profile, err)
+	}
+	return profileSession.Config.Credentials, nil
+}
+
+func getECSCredentials(cfg Credentials, sess *session.Session) (*credentials.Credentials, error) {
+	endpoint := cfg.MetadataEndpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	}
+	if endpoint == "" {
+		relativeURI := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+		if relativeURI == "" {
+			return nil, fmt.Errorf(
+				"no ECS credentials endpoint configured and AWS_CONTAINER_CREDENTIALS_RELATIVE_URI is not set",
+			)
+		}
+		endpoint = "http://169.254.170.2" + relativeURI
+	}
+	return endpointcreds.NewCredentialsClient(
+		*sess.Config,
+		defaults.Handlers(),
+		endpoint,
+		func(provider *endpointcreds.Provider) {
+			provider.AuthorizationToken = os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		},
+	), nil
+}
+
+func getSTSClient(cfg Credentials, sess *session.Session, configs ...*aws.Config) *sts.STS {
+	if cfg.STSEndpoint != "" {
+		configs = append(configs, &aws.Config{Endpoint: aws.String(cfg.STSEndpoint)})
+	}
+	return sts.New(sess, configs...)
+}
+
+func assumeRole(cfg Credentials, sess *session.Session, baseCredentials *credentials.Credentials) *credentials.Credentials {
+	return stscreds.NewCredentialsWithClient(
+		getSTSClient(cfg, sess, &aws.Config{Credentials: baseCredentials}),
+		cfg.RoleARN,
+		func(provider *stscreds.AssumeRoleProvider) {
+			provider.RoleSessionName = cfg.RoleSessionName
+			if cfg.ExternalID != "" {
+				provider.ExternalID = aws.String(cfg.ExternalID)
+			}
+		},
+	)
+}
@@ -0,0 +1,193 @@
+package s3_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage/s3"
+)
+
+func credentialsJSON(accessKey string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"Code":            "Success",
+		"AccessKeyId":     accessKey,
+		"SecretAccessKey": "secret",
+		"Token":           "token",
+		"Expiration":      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+	return data
+}
+
+func stsResponse(action string, accessKey string) []byte {
+	return []byte(fmt.Sprintf(
+		`<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><%[1]sResult><Credentials>`+
+			`<AccessKeyId>%[2]s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>`+
+			`<SessionToken>token</SessionToken><Expiration>%[3]s</Expiration>`+
+			`</Credentials></%[1]sResult></%[1]sResponse>`,
+		action,
+		accessKey,
+		time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	))
+}
+
+// listWithCredentials lists the bucket with the credentials configuration and returns the access keys the requests
+// were signed with.
+func listWithCredentials(t *testing.T, credentials s3.Credentials, accessKey string) []string {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+	config.AccessKey = accessKey
+	config.SecretKey = "secret"
+	config.ParallelUploads = 1
+	config.Credentials = credentials
+	getS3Objects(t, newS3Storage(t, config))
+	var accessKeys []string
+	for _, request := range server.Requests() {
+		accessKeys = append(accessKeys, request.AccessKey)
+	}
+	return accessKeys
+}
+
+func TestStaticCredentials(t *testing.T) {
+	accessKeys := listWithCredentials(t, s3.Credentials{}, "STATICKEY")
+	assert.Equal(t, []string{"STATICKEY"}, accessKeys)
+}
+
+func TestEnvironmentCredentials(t *testing.T) {
+	assert.NoError(t, os.Setenv("AWS_ACCESS_KEY_ID", "ENVKEY"))
+	assert.NoError(t, os.Setenv("AWS_SECRET_ACCESS_KEY", "secret"))
+	defer func() {
+		_ = os.Unsetenv("AWS_ACCESS_KEY_ID")
+		_ = os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	}()
+	accessKeys := listWithCredentials(t, s3.Credentials{Source: s3.CredentialSourceEnvironment}, "")
+	assert.Equal(t, []string{"ENVKEY"}, accessKeys)
+}
+
+func TestProfileCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-s3-profile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	credentialsFile := path.Join(dir, "credentials")
+	if err := ioutil.WriteFile(
+		credentialsFile,
+		[]byte("[auditlog]\naws_access_key_id = PROFILEKEY\naws_secret_access_key = secret\n"),
+		0600,
+	); err != nil {
+		t.Fatal(err)
+	}
+	accessKeys := listWithCredentials(t, s3.Credentials{
+		Source:                s3.CredentialSourceProfile,
+		Profile:               "auditlog",
+		SharedCredentialsFile: credentialsFile,
+	}, "")
+	assert.Equal(t, []string{"PROFILEKEY"}, accessKeys)
+}
+
+func TestEC2Credentials(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			_, _ = w.Write([]byte("imds-token"))
+		case "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("auditlog-role"))
+		case "/latest/meta-data/iam/security-credentials/auditlog-role":
+			_, _ = w.Write(credentialsJSON("EC2KEY"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer metadata.Close()
+
+	accessKeys := listWithCredentials(t, s3.Credentials{
+		Source:           s3.CredentialSourceEC2,
+		MetadataEndpoint: metadata.URL,
+	}, "")
+	assert.Equal(t, []string{"EC2KEY"}, accessKeys)
+}
+
+func TestECSCredentials(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(credentialsJSON("ECSKEY"))
+	}))
+	defer metadata.Close()
+
+	accessKeys := listWithCredentials(t, s3.Credentials{
+		Source:           s3.CredentialSourceECS,
+		MetadataEndpoint: metadata.URL + "/v2/credentials",
+	}, "")
+	assert.Equal(t, []string{"ECSKEY"}, accessKeys)
+}
+
+func TestAssumeRoleCredentials(t *testing.T) {
+	var externalID string
+	var baseAuthorization string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		externalID = r.PostForm.Get("ExternalId")
+		baseAuthorization = r.Header.Get("Authorization")
+		_, _ = w.Write(stsResponse("AssumeRole", "ASSUMEDKEY"))
+	}))
+	defer sts.Close()
+
+	accessKeys := listWithCredentials(t, s3.Credentials{
+		RoleARN:     "arn:aws:iam::123456789012:role/auditlog",
+		ExternalID:  "containerssh",
+		STSEndpoint: sts.URL,
+	}, "BASEKEY")
+	assert.Equal(t, []string{"ASSUMEDKEY"}, accessKeys)
+	assert.Equal(t, "containerssh", externalID)
+	assert.Contains(t, baseAuthorization, "Credential=BASEKEY/")
+}
+
+func TestWebIdentityCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-s3-webidentity-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	tokenFile := path.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("web-identity-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var token string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		token = r.PostForm.Get("WebIdentityToken")
+		_, _ = w.Write(stsResponse("AssumeRoleWithWebIdentity", "WEBIDENTITYKEY"))
+	}))
+	defer sts.Close()
+
+	accessKeys := listWithCredentials(t, s3.Credentials{
+		Source:               s3.CredentialSourceWebIdentity,
+		RoleARN:              "arn:aws:iam::123456789012:role/auditlog",
+		WebIdentityTokenFile: tokenFile,
+		STSEndpoint:          sts.URL,
+	}, "")
+	assert.Equal(t, []string{"WEBIDENTITYKEY"}, accessKeys)
+	assert.Equal(t, "web-identity-token", token)
+}
+
+func TestCredentialsValidation(t *testing.T) {
+	assert.Error(t, s3.Credentials{}.Validate("", ""))
+	assert.NoError(t, s3.Credentials{}.Validate("key", "secret"))
+	assert.NoError(t, s3.Credentials{Source: s3.CredentialSourceEC2}.Validate("", ""))
+	assert.Error(t, s3.Credentials{Source: "invalid"}.Validate("", ""))
+	assert.Error(t, s3.Credentials{Source: s3.CredentialSourceWebIdentity}.Validate("", ""))
+	assert.Error(t, s3.Credentials{Source: s3.CredentialSourceEC2, ExternalID: "test"}.Validate("", ""))
+}
@@ -0,0 +1,140 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+// HealthCheck configures the health checks of the S3 storage.
+type HealthCheck struct {
+	// WriteProbe uploads and deletes a small probe object to check the write permission in addition to the bucket
+	// reachability. Requires the permission to delete the probe object. The write probe is skipped if object lock is
+	// configured, because the locked versions of the probe object could not be removed.
+	WriteProbe bool `json:"writeProbe" yaml:"writeProbe"`
+	// ProbeObject is the name of the object uploaded by the write probe.
+	ProbeObject string `json:"probeObject" yaml:"probeObject" default:".containerssh-healthcheck"`
+	// MinFreeSpace is the number of bytes that must be available in the local directory for the storage to be reported
+	// healthy. The free space is not checked if 0.
+	MinFreeSpace uint64 `json:"minFreeSpace" yaml:"minFreeSpace"`
+	// BacklogWarning is the number of finished audit logs waiting for upload above which the storage is reported
+	// degraded. Not checked if 0.
+	BacklogWarning uint `json:"backlogWarning" yaml:"backlogWarning"`
+	// BacklogLimit is the number of finished audit logs waiting for upload above which the storage is reported
+	// unhealthy. Not checked if 0.
+	BacklogLimit uint `json:"backlogLimit" yaml:"backlogLimit"`
+}
+
+// Validate validates the health check configuration.
+func (h HealthCheck) Validate() error {
+	if h.BacklogWarning != 0 && h.BacklogLimit != 0 && h.BacklogLimit < h.BacklogWarning {
+		return fmt.Errorf(
+			"backlog limit %d is lower than the backlog warning threshold %d",
+			h.BacklogLimit,
+			h.BacklogWarning,
+		)
+	}
+	return nil
+}
+
+// withDefaults returns the health check configuration with the defaults filled in for unset values.
+func (h HealthCheck) withDefaults() HealthCheck {
+	if h.ProbeObject == "" {
+		h.ProbeObject = ".containerssh-healthcheck"
+	}
+	return h
+}
+
+// HealthCheck checks the bucket is reachable (and writable if the write probe is enabled), the local directory has the
+// configured free space, and the upload backlog and the spool are below the configured thresholds.
+func (q *uploadQueue) HealthCheck(ctx context.Context) storage.Health {
+	return storage.NewHealth(
+		q.checkBucket(ctx),
+		storage.CheckFreeSpace("s3.freeSpace", q.directory, q.healthCheck.MinFreeSpace),
+		q.checkBacklog(),
+		q.checkSpool(),
+	)
+}
+
+func (q *uploadQueue) checkBucket(ctx context.Context) storage.HealthCheckResult {
+	result := storage.HealthCheckResult{
+		Name:   "s3.bucket",
+		Status: storage.HealthStatusHealthy,
+	}
+	s3Connection := s3.New(q.awsSession)
+	if _, err := s3Connection.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(q.bucket),
+	}); err != nil {
+		result.Status = storage.HealthStatusUnhealthy
+		result.Message = fmt.Sprintf("bucket %s is not reachable (%v)", q.bucket, err)
+		return result
+	}
+	if !q.healthCheck.WriteProbe {
+		return result
+	}
+	if q.objectLock.Enabled() {
+		result.Message = "write probe skipped because object lock is enabled"
+		return result
+	}
+	checksum, err := contentMD5(bytes.NewReader([]byte{}))
+	if err != nil {
+		result.Status = storage.HealthStatusUnhealthy
+		result.Message = fmt.Sprintf("failed to calculate probe object checksum (%v)", err)
+		return result
+	}
+	// The MD5 checksum is required if the bucket applies a default object lock retention.
+	if _, err := s3Connection.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Body:       bytes.NewReader([]byte{}),
+		Bucket:     aws.String(q.bucket),
+		ContentMD5: checksum,
+		Key:        aws.String(q.healthCheck.ProbeObject),
+	}); err != nil {
+		result.Status = storage.HealthStatusUnhealthy
+		result.Message = fmt.Sprintf("failed to write probe object to bucket %s (%v)", q.bucket, err)
+		return result
+	}
+	if _, err := s3Connection.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(q.healthCheck.ProbeObject),
+	}); err != nil {
+		result.Status = storage.HealthStatusDegraded
+		result.Message = fmt.Sprintf("failed to delete probe object from bucket %s (%v)", q.bucket, err)
+	}
+	return result
+}
+
+// checkBacklog compares the number of finished audit logs waiting for upload with the thresholds. Audit logs with
+// failing uploads degrade the storage even below the thresholds.
+func (q *uploadQueue) checkBacklog() storage.HealthCheckResult {
+	backlog := uint(0)
+	failing := uint(0)
+	q.queue.Range(func(_, value interface{}) bool {
+		entry := value.(*queueEntry)
+		if entry.isFinished() {
+			backlog++
+		}
+		if entry.getFailures() > 0 {
+			failing++
+		}
+		return true
+	})
+	result := storage.HealthCheckResult{
+		Name:    "s3.backlog",
+		Status:  storage.HealthStatusHealthy,
+		Message: fmt.Sprintf("%d audit logs waiting for upload, %d failing", backlog, failing),
+	}
+	switch {
+	case q.healthCheck.BacklogLimit != 0 && backlog > q.healthCheck.BacklogLimit:
+		result.Status = storage.HealthStatusUnhealthy
+	case q.healthCheck.BacklogWarning != 0 && backlog > q.healthCheck.BacklogWarning:
+		result.Status = storage.HealthStatusDegraded
+	case failing > 0:
+		result.Status = storage.HealthStatusDegraded
+	}
+	return result
+}
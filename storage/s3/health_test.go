@@ -0,0 +1,85 @@
+package s3_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+)
+
+func setupHealthStorage(t *testing.T, server *s3test.Server, healthCheck s3.HealthCheck) storage.ReadWriteStorage {
+	config := newS3Config(t, server)
+	config.ParallelUploads = 1
+	config.HealthCheck = healthCheck
+	st := newS3Storage(t, config)
+	t.Cleanup(func() {
+		st.Shutdown(context.Background())
+	})
+	return st
+}
+
+func TestHealthCheck(t *testing.T) {
+	server := newS3Server(t)
+	st := setupHealthStorage(t, server, s3.HealthCheck{WriteProbe: true})
+
+	health := storage.HealthCheck(context.Background(), st)
+	assert.Equal(t, storage.HealthStatusHealthy, health.Status, "%v", health.Checks)
+	var requests []string
+	for _, request := range server.Requests() {
+		requests = append(requests, string(request.Operation)+" "+request.Key)
+	}
+	assert.Equal(t, []string{
+		"HeadBucket ",
+		"PutObject .containerssh-healthcheck",
+		"DeleteObject .containerssh-healthcheck",
+	}, requests)
+	assert.Empty(t, server.Keys("auditlog"))
+
+	server.InjectFault(s3test.Fault{StatusCode: http.StatusForbidden, Code: "AccessDenied"})
+	health = storage.HealthCheck(context.Background(), st)
+	assert.False(t, health.Healthy())
+	assert.Equal(t, "s3.bucket", health.Checks[0].Name)
+	assert.Equal(t, storage.HealthStatusUnhealthy, health.Checks[0].Status)
+}
+
+func TestHealthCheckFreeSpace(t *testing.T) {
+	if _, err := storage.FreeSpace(os.TempDir()); err != nil {
+		t.Skipf("free space cannot be determined (%v)", err)
+	}
+	st := setupHealthStorage(t, newS3Server(t), s3.HealthCheck{MinFreeSpace: 1 << 62})
+
+	health := storage.HealthCheck(context.Background(), st)
+	assert.False(t, health.Healthy())
+	assert.Equal(t, "s3.freeSpace", health.Checks[1].Name)
+	assert.Equal(t, storage.HealthStatusUnhealthy, health.Checks[1].Status)
+}
+
+func TestHealthCheckConfig(t *testing.T) {
+	assert.Error(t, s3.HealthCheck{BacklogWarning: 10, BacklogLimit: 5}.Validate())
+	assert.NoError(t, s3.HealthCheck{BacklogWarning: 5, BacklogLimit: 10}.Validate())
+	assert.NoError(t, s3.HealthCheck{BacklogWarning: 5}.Validate())
+}
+
+func TestHealthCheckObjectLock(t *testing.T) {
+	server := newS3Server(t, s3test.Bucket{Name: "auditlog", ObjectLock: true})
+	config := newS3Config(t, server)
+	config.ObjectLock = s3.ObjectLock{Mode: s3.ObjectLockModeGovernance, Retention: time.Hour}
+	config.HealthCheck = s3.HealthCheck{WriteProbe: true}
+	st := newS3Storage(t, config)
+	t.Cleanup(func() {
+		st.Shutdown(context.Background())
+	})
+
+	health := storage.HealthCheck(context.Background(), st)
+	assert.Equal(t, storage.HealthStatusHealthy, health.Status, "%v", health.Checks)
+	assert.Equal(t, 0, server.RequestCount(s3test.OperationPutObject))
+	assert.Equal(t, 0, server.RequestCount(s3test.OperationDeleteObject))
+	assert.Empty(t, server.Keys("auditlog"))
+}
@@ -1,65 +1,137 @@
 package s3
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	awsS3 "github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
 )
 
-func (q *uploadQueue) List() (<-chan storage.Entry, <-chan error) {
+// List lists the audit logs in the bucket matching the query. The prefix filter is passed to S3. Session summaries
+// stored next to the audit logs are not listed. Audit logs last modified before the start time filter are skipped
+// without fetching their metadata, as the session must have started before the upload. The metadata of the remaining
+// audit logs is fetched concurrently, unless the query allows skipping it.
+func (q *uploadQueue) List(ctx context.Context, query storage.Query) (<-chan storage.Entry, <-chan error) {
 	s3Connection := awsS3.New(q.awsSession)
 
 	result := make(chan storage.Entry)
 	errChannel := make(chan error)
 
 	go func() {
+		wg := &sync.WaitGroup{}
+		defer func() {
+			wg.Wait()
+			close(result)
+			close(errChannel)
+		}()
+		headSem := make(chan struct{}, q.listConcurrency)
+		var prefix *string
+		if query.Prefix != "" {
+			prefix = aws.String(query.Prefix)
+		}
 		var continuationToken *string = nil
 		for {
-			listObjectsResult, err := s3Connection.ListObjectsV2(&awsS3.ListObjectsV2Input{
+			listObjectsResult, err := s3Connection.ListObjectsV2WithContext(ctx, &awsS3.ListObjectsV2Input{
 				Bucket:            aws.String(q.bucket),
 				ContinuationToken: continuationToken,
+				Prefix:            prefix,
 			})
 			if err != nil {
-				errChannel <- err
-				close(result)
-				close(errChannel)
+				sendListError(ctx, errChannel, err)
 				return
 			}
 			for _, object := range listObjectsResult.Contents {
-				name := object.Key
-
-				headObjectResult, err := s3Connection.HeadObject(&awsS3.HeadObjectInput{
-					Bucket: aws.String(q.bucket),
-					Key:    name,
-				})
-				if err != nil {
-					errChannel <- fmt.Errorf("failed to fetch metadata for audit log %s (%w)", *name, err)
+				name := *object.Key
+				if strings.HasSuffix(name, summary.NameSuffix) {
 					continue
 				}
-
-				meta := map[string]string{}
-				for k, v := range headObjectResult.Metadata {
-					if v != nil {
-						meta[k] = *v
+				if !query.StartTime.IsZero() && object.LastModified != nil && object.LastModified.Before(query.StartTime) {
+					continue
+				}
+				if query.SkipMetadata && !query.NeedsMetadata() {
+					if !sendListEntry(ctx, result, storage.Entry{Name: name, Metadata: map[string]string{}}) {
+						return
 					}
+					continue
 				}
-
-				result <- storage.Entry{
-					Name:     *name,
-					Metadata: meta,
+				select {
+				case headSem <- struct{}{}:
+				case <-ctx.Done():
+					return
 				}
+				wg.Add(1)
+				go func() {
+					defer func() {
+						<-headSem
+						wg.Done()
+					}()
+					q.listEntry(ctx, s3Connection, name, query, result, errChannel)
+				}()
 			}
 			continuationToken = listObjectsResult.NextContinuationToken
 			if continuationToken == nil {
 				break
 			}
 		}
-		close(result)
-		close(errChannel)
 	}()
 
 	return result, errChannel
 }
+
+func (q *uploadQueue) listEntry(
+	ctx context.Context,
+	s3Connection *awsS3.S3,
+	name string,
+	query storage.Query,
+	result chan<- storage.Entry,
+	errChannel chan<- error,
+) {
+	headObjectResult, err := s3Connection.HeadObjectWithContext(ctx, &awsS3.HeadObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		sendListError(ctx, errChannel, fmt.Errorf("failed to fetch metadata for audit log %s (%w)", name, err))
+		return
+	}
+
+	meta := map[string]string{}
+	for k, v := range headObjectResult.Metadata {
+		if v != nil {
+			meta[k] = *v
+		}
+	}
+
+	entry := storage.Entry{
+		Name:     name,
+		Metadata: meta,
+	}
+	if query.Matches(entry) {
+		sendListEntry(ctx, result, entry)
+	}
+}
+
+func sendListEntry(ctx context.Context, result chan<- storage.Entry, entry storage.Entry) bool {
+	select {
+	case result <- entry:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func sendListError(ctx context.Context, errChannel chan<- error, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	select {
+	case errChannel <- err:
+	case <-ctx.Done():
+	}
+}
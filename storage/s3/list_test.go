@@ -0,0 +1,221 @@
+package s3_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+	"github.com/containerssh/auditlog/summary"
+)
+
+type listObject struct {
+	name         string
+	lastModified time.Time
+	startTime    time.Time
+	username     string
+	country      string
+}
+
+// newListStorage creates a storage for a bucket holding audit logs with their names as content.
+func newListStorage(t *testing.T) (storage.ReadWriteStorageV2, *s3test.Server) {
+	server := newS3Server(t)
+	now := time.Now().Truncate(time.Second)
+	for _, object := range []listObject{
+		{"abc", now.Add(-48 * time.Hour), now.Add(-49 * time.Hour), "foo", "DE"},
+		{"abd", now.Add(-time.Hour), now.Add(-2 * time.Hour), "bar", "US"},
+		{"bcd", now, now.Add(-time.Minute), "foo", "US"},
+	} {
+		if err := server.PutObject("auditlog", object.name, s3test.Object{
+			Data:         []byte(object.name),
+			LastModified: object.lastModified,
+			Metadata: map[string]string{
+				"timestamp": fmt.Sprintf("%d", object.startTime.Unix()),
+				"username":  object.username,
+				"country":   object.country,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := newS3Config(t, server)
+	config.ParallelUploads = 1
+	config.ListConcurrency = 2
+	st, err := s3.NewStorageV2(config, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st, server
+}
+
+// listPrefixes returns the prefixes of the bucket listings.
+func listPrefixes(server *s3test.Server) []string {
+	var prefixes []string
+	for _, request := range server.Requests() {
+		if request.Operation == s3test.OperationListObjectsV2 {
+			prefix := ""
+			if values := request.Query["prefix"]; len(values) > 0 {
+				prefix = values[0]
+			}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func listNames(t *testing.T, st storage.ReadableStorageV2, query storage.Query) []string {
+	var names []string
+	entries, errs := st.List(context.Background(), query)
+	for entries != nil || errs != nil {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				entries = nil
+				continue
+			}
+			names = append(names, entry.Name)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestListAll(t *testing.T) {
+	st, s3Server := newListStorage(t)
+	assert.Equal(t, []string{"abc", "abd", "bcd"}, listNames(t, st, storage.Query{}))
+	assert.Equal(t, 3, s3Server.RequestCount(s3test.OperationHeadObject))
+}
+
+func TestListSkipsSummaries(t *testing.T) {
+	st, s3Server := newListStorage(t)
+	assert.NoError(t, s3Server.PutObject("auditlog", "abc"+summary.NameSuffix, s3test.Object{Data: []byte("{}")}))
+	assert.Equal(t, []string{"abc", "abd", "bcd"}, listNames(t, st, storage.Query{}))
+	assert.Equal(t, 3, s3Server.RequestCount(s3test.OperationHeadObject))
+}
+
+func TestListSkipMetadata(t *testing.T) {
+	st, s3Server := newListStorage(t)
+	assert.Equal(t, []string{"abc", "abd", "bcd"}, listNames(t, st, storage.Query{SkipMetadata: true}))
+	assert.Equal(t, 0, s3Server.RequestCount(s3test.OperationHeadObject))
+}
+
+func TestListPrefix(t *testing.T) {
+	st, s3Server := newListStorage(t)
+	assert.Equal(t, []string{"abc", "abd"}, listNames(t, st, storage.Query{Prefix: "ab", SkipMetadata: true}))
+	assert.Equal(t, []string{"ab"}, listPrefixes(s3Server))
+}
+
+func TestListTimeRange(t *testing.T) {
+	st, s3Server := newListStorage(t)
+	assert.Equal(t, []string{"abd"}, listNames(t, st, storage.Query{
+		StartTime: time.Now().Add(-24 * time.Hour),
+		EndTime:   time.Now().Add(-30 * time.Minute),
+	}))
+	// The oldest audit log was modified before the start time and must be skipped without a HEAD request.
+	assert.Equal(t, 2, s3Server.RequestCount(s3test.OperationHeadObject))
+}
+
+func TestListUsernameCountry(t *testing.T) {
+	st, _ := newListStorage(t)
+	assert.Equal(t, []string{"abc", "bcd"}, listNames(t, st, storage.Query{Username: "foo"}))
+	assert.Equal(t, []string{"bcd"}, listNames(t, st, storage.Query{Username: "foo", Country: "US"}))
+}
+
+func TestListCancel(t *testing.T) {
+	st, _ := newListStorage(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entries, errs := st.List(ctx, storage.Query{})
+	select {
+	case <-entries:
+	case <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("listing did not stop after the context was cancelled")
+	}
+}
+
+func TestStorageV2(t *testing.T) {
+	st, _ := newListStorage(t)
+	ctx := context.Background()
+
+	info, err := st.Stat(ctx, "abd")
+	assert.NoError(t, err)
+	assert.True(t, info.Finished)
+	assert.Equal(t, int64(3), info.Size)
+	assert.Equal(t, "bar", info.Metadata["Username"])
+
+	reader, err := st.OpenRange(ctx, "abd", 1, 1)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "b", string(data))
+
+	reader, err = st.OpenRange(ctx, "abd", 1, -1)
+	assert.NoError(t, err)
+	data, err = ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, "bd", string(data))
+
+	_, err = st.OpenRange(ctx, "abd", -1, 1)
+	assert.True(t, errors.Is(err, storage.ErrInvalidRange))
+
+	assert.NoError(t, st.Delete(ctx, "abd"))
+	_, err = st.Stat(ctx, "abd")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+	_, err = st.Open(ctx, "abd")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+}
+
+func TestReadOnlyStorage(t *testing.T) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+	data := []byte("Hello world!")
+	assert.NoError(t, server.PutObject("auditlog", "uploaded", s3test.Object{Data: data}))
+	if err := ioutil.WriteFile(filepath.Join(config.Local, "pending"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The upload options and the local directory are not needed for reading.
+	readConfig := config
+	readConfig.Local = ""
+	readConfig.UploadPartSize = 0
+	readConfig.ParallelUploads = 0
+	st, err := s3.NewReadOnlyStorage(readConfig, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := st.OpenReader("uploaded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readData, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.NoError(t, reader.Close())
+	assert.Equal(t, data, readData)
+
+	// The audit logs in the local directory are not uploaded.
+	assert.Equal(t, []string{"uploaded"}, server.Keys("auditlog"))
+	assert.Equal(t, 0, server.RequestCount(s3test.OperationPutObject))
+	_, err = os.Stat(filepath.Join(config.Local, "pending"))
+	assert.NoError(t, err)
+}
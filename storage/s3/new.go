@@ -10,52 +10,96 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	awsS3 "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/containerssh/log"
 
+	"github.com/containerssh/auditlog/clock"
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/metrics"
 	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
 )
 
 // NewStorage Creates a storage driver for an S3-compatible object storage.
-func NewStorage(cfg Config, logger log.Logger) (storage.ReadWriteStorage, error) {
-	if err := cfg.Validate(); err != nil {
-		return nil, err
+func NewStorage(cfg Config, logger log.Logger, options ...Option) (storage.ReadWriteStorage, error) {
+	return newStorage(cfg, logger, options)
+}
+
+// NewStorageV2 Creates a context-aware storage driver for an S3-compatible object storage.
+func NewStorageV2(cfg Config, logger log.Logger, options ...Option) (storage.ReadWriteStorageV2, error) {
+	return newStorage(cfg, logger, options)
+}
+
+// Option configures optional features of the S3 storage.
+type Option func(q *uploadQueue)
+
+// WithMetrics sets the collector receiving the metrics of the S3 storage. The queue length and spool size gauges are
+// labeled with the bucket name. By default the metrics are discarded.
+func WithMetrics(collector metrics.Collector) Option {
+	return func(q *uploadQueue) {
+		q.metrics = metrics.OrNoop(collector)
 	}
+}
 
-	httpClient, err := getHTTPClient(cfg)
-	if err != nil {
+// WithClock sets the clock the object lock retention dates and the upload schedule are calculated from. S3 rejects
+// retention dates in the past, so with object lock the clock must not run behind the real time. By default the system
+// clock is used.
+func WithClock(c clock.Clock) Option {
+	return func(q *uploadQueue) {
+		q.clock = clock.OrSystem(c)
+	}
+}
+
+// NewReadOnlyStorage creates a storage driver that only reads the audit logs from an S3-compatible object storage, for
+// example for tools processing the stored audit logs next to a running ContainerSSH. Unlike NewStorage it does not
+// require the local directory and does not upload the audit logs found in it. The options for uploading are ignored
+// and may be left at their defaults.
+func NewReadOnlyStorage(cfg Config, logger log.Logger) (storage.ReadableStorage, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.validateBucketAccess(); err != nil {
 		return nil, err
 	}
+	return newQueue(cfg, logger)
+}
 
-	awsConfig, err := getAWSConfig(cfg, logger, httpClient)
-	if err != nil {
+func newStorage(cfg Config, logger log.Logger, options []Option) (*uploadQueue, error) {
+	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
-	sess, err := session.NewSession(awsConfig)
+	queue, err := newQueue(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
+	for _, option := range options {
+		option(queue)
+	}
 
-	queue := newUploadQueue(
-		cfg.Local,
-		cfg.UploadPartSize,
-		cfg.ParallelUploads,
-		cfg.Bucket,
-		cfg.ACL,
-		cfg.Metadata.Username,
-		cfg.Metadata.IP,
-		sess,
-		logger,
-	)
+	if cfg.ObjectLock.Enabled() {
+		if err := queue.checkObjectLockEnabled(awsS3.New(queue.awsSession)); err != nil {
+			return nil, err
+		}
+	}
 
 	if _, err := os.Stat(cfg.Local); err != nil {
 		return nil, fmt.Errorf("invalid local audit directory %s (%w)", cfg.Local, err)
 	}
 
 	if err := filepath.Walk(cfg.Local, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() && info.Size() > 0 && !strings.Contains(info.Name(), ".") {
+		if err != nil {
+			if path == cfg.Local {
+				return fmt.Errorf("failed to read local audit directory %s (%w)", cfg.Local, err)
+			}
+			// Entries that cannot be read, for example because they were removed in the meantime, are skipped.
+			logger.Warning(log.Wrap(err, codes.ERecoveryFailed, "failed to recover local audit log file %s", path))
+			return nil
+		}
+		if info.IsDir() && path != cfg.Local {
+			// Subdirectories, such as the quarantine directory, are not recovered.
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && info.Size() > 0 && isRecoverable(info.Name()) {
 			if err := queue.recover(info.Name()); err != nil {
 				return fmt.Errorf("failed to enqueue old audit log file %s (%w)", info.Name(), err)
 			}
@@ -64,10 +108,56 @@ func NewStorage(cfg Config, logger log.Logger) (storage.ReadWriteStorage, error)
 	}); err != nil {
 		return nil, err
 	}
+	queue.wg.Add(1)
+	go queue.spoolLoop()
 
 	return queue, nil
 }
 
+// isRecoverable returns true for the audit logs and their summaries, but not for the metadata and temporary files next
+// to them.
+func isRecoverable(name string) bool {
+	return !strings.Contains(strings.TrimSuffix(name, summary.NameSuffix), ".")
+}
+
+// newQueue creates the upload queue without starting the upload of the audit logs.
+func newQueue(cfg Config, logger log.Logger) (*uploadQueue, error) {
+	httpClient, err := getHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig, err := getAWSConfig(cfg, logger, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newUploadQueue(
+		cfg.Local,
+		cfg.UploadPartSize,
+		cfg.ParallelUploads,
+		cfg.ListConcurrency,
+		cfg.Bucket,
+		cfg.ACL,
+		cfg.Metadata.Username,
+		cfg.Metadata.IP,
+		cfg.Tags,
+		cfg.ObjectLock,
+		cfg.DisableChecksumHeaders,
+		cfg.Retry,
+		cfg.HealthCheck,
+		cfg.Spool,
+		cfg.Bandwidth,
+		sess,
+		logger,
+	), nil
+}
+
 func getAWSConfig(
 	cfg Config, logger log.Logger, httpClient *http.Client,
 ) (
@@ -78,16 +168,13 @@ func getAWSConfig(
 		endpoint = &cfg.Endpoint
 	}
 
+	creds, err := getCredentials(cfg, logger, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
 	awsConfig := &aws.Config{
-		Credentials: credentials.NewCredentials(&credentials.StaticProvider{
-			Value: credentials.Value{
-				AccessKeyID:     cfg.AccessKey,
-				SecretAccessKey: cfg.SecretKey,
-
-				SessionToken: "",
-				ProviderName: "",
-			},
-		}),
+		Credentials:      creds,
 		Endpoint:         endpoint,
 		Region:           &cfg.Region,
 		HTTPClient:       httpClient,
@@ -0,0 +1,130 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectLockMode is the S3 Object Lock retention mode applied to uploaded audit logs.
+type ObjectLockMode string
+
+const (
+	// ObjectLockModeNone disables setting a retention on uploaded audit logs.
+	ObjectLockModeNone ObjectLockMode = ""
+	// ObjectLockModeGovernance sets a governance-mode retention. Users with the s3:BypassGovernanceRetention permission
+	// can still delete or overwrite the audit log.
+	ObjectLockModeGovernance ObjectLockMode = "governance"
+	// ObjectLockModeCompliance sets a compliance-mode retention. Nobody, including the root account, can delete or
+	// overwrite the audit log until the retention period expires.
+	ObjectLockModeCompliance ObjectLockMode = "compliance"
+)
+
+// Validate checks the object lock mode.
+func (m ObjectLockMode) Validate() error {
+	switch m {
+	case ObjectLockModeNone:
+	case ObjectLockModeGovernance:
+	case ObjectLockModeCompliance:
+	default:
+		return fmt.Errorf("invalid object lock mode: %s", m)
+	}
+	return nil
+}
+
+func (m ObjectLockMode) s3Mode() *string {
+	switch m {
+	case ObjectLockModeGovernance:
+		return aws.String(s3.ObjectLockModeGovernance)
+	case ObjectLockModeCompliance:
+		return aws.String(s3.ObjectLockModeCompliance)
+	default:
+		return nil
+	}
+}
+
+// ObjectLock configures the S3 Object Lock (WORM) settings for uploaded audit logs. The bucket must have been created
+// with object lock enabled.
+type ObjectLock struct {
+	// Mode is the retention mode to set on the audit logs.
+	Mode ObjectLockMode `json:"mode" yaml:"mode"`
+	// Retention is the duration for which the audit log is retained, counted from the start of the session. If the
+	// retention has already expired when the audit log is uploaded, for example after a long upload outage, the
+	// retention is counted from the upload instead.
+	Retention time.Duration `json:"retention" yaml:"retention"`
+	// LegalHold places a legal hold on each uploaded audit log. A legal hold has no expiry and must be removed
+	// manually.
+	LegalHold bool `json:"legalHold" yaml:"legalHold"`
+}
+
+// Validate validates the object lock configuration.
+func (o ObjectLock) Validate() error {
+	if err := o.Mode.Validate(); err != nil {
+		return err
+	}
+	if o.Mode != ObjectLockModeNone && o.Retention <= 0 {
+		return fmt.Errorf("object lock mode %s requires a positive retention period", o.Mode)
+	}
+	if o.Mode == ObjectLockModeNone && o.Retention != 0 {
+		return fmt.Errorf("object lock retention set without an object lock mode")
+	}
+	return nil
+}
+
+// Enabled returns true if any object lock setting is configured.
+func (o ObjectLock) Enabled() bool {
+	return o.Mode != ObjectLockModeNone || o.LegalHold
+}
+
+// retainUntil returns the retention date for an audit log whose session started at the given unix timestamp. If the
+// start time is not known, or the retention counted from the start time has already expired, the retention is counted
+// from the current time. S3 rejects retention dates in the past.
+func (o ObjectLock) retainUntil(startTime int64, now time.Time) *time.Time {
+	if o.Mode == ObjectLockModeNone {
+		return nil
+	}
+	retainUntil := now.Add(o.Retention)
+	if startTime > 0 {
+		if fromStart := time.Unix(startTime, 0).Add(o.Retention); fromStart.After(now) {
+			retainUntil = fromStart
+		}
+	}
+	retainUntil = retainUntil.UTC()
+	return &retainUntil
+}
+
+func (o ObjectLock) legalHoldStatus() *string {
+	if !o.LegalHold {
+		return nil
+	}
+	return aws.String(s3.ObjectLockLegalHoldStatusOn)
+}
+
+func (q *uploadQueue) checkObjectLockEnabled(s3Connection *s3.S3) error {
+	result, err := s3Connection.GetObjectLockConfiguration(&s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(q.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch object lock configuration for bucket %s (%w)", q.bucket, err)
+	}
+	if result.ObjectLockConfiguration == nil ||
+		result.ObjectLockConfiguration.ObjectLockEnabled == nil ||
+		*result.ObjectLockConfiguration.ObjectLockEnabled != s3.ObjectLockEnabledEnabled {
+		return fmt.Errorf("object lock is configured, but bucket %s does not have object lock enabled", q.bucket)
+	}
+	return nil
+}
+
+// contentMD5 calculates the base64-encoded MD5 checksum S3 requires for uploads with an object lock retention.
+func contentMD5(reader io.Reader) (*string, error) {
+	hash := md5.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return nil, err
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(hash.Sum(nil))), nil
+}
@@ -5,28 +5,65 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"strings"
 	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 
 	"github.com/containerssh/log"
 
+	"github.com/containerssh/auditlog/clock"
 	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/metrics"
 	"github.com/containerssh/auditlog/storage"
 )
 
 var minPartSize = uint(5 * 1024 * 1024)
 var maxPartSize = uint(5 * 1024 * 1024 * 1024)
 
+// maxCopySize is the largest object that can be copied in a single CopyObject call.
+const maxCopySize = int64(5 * 1024 * 1024 * 1024)
+
 type queueEntryMetadata struct {
 	StartTime     int64  `json:"startTime" yaml:"startTime"`
 	RemoteAddr    string `json:"remoteAddr" yaml:"remoteAddr"`
 	Authenticated bool   `json:"authenticated" yaml:"authenticated"`
 	Username      string `json:"username" yaml:"username"`
 	Country       string `json:"country" yaml:"country"`
+	ContentType   string `json:"contentType" yaml:"contentType"`
+
+	// The following fields are only set once the session has ended.
+	EndTime    int64    `json:"endTime" yaml:"endTime"`
+	Channels   int      `json:"channels" yaml:"channels"`
+	Programs   []string `json:"programs" yaml:"programs"`
+	ExitStatus *uint32  `json:"exitStatus" yaml:"exitStatus"`
+
+	AuthMethods []string `json:"authMethods" yaml:"authMethods"`
+	StdinBytes  uint64   `json:"stdinBytes" yaml:"stdinBytes"`
+	StdoutBytes uint64   `json:"stdoutBytes" yaml:"stdoutBytes"`
+	StderrBytes uint64   `json:"stderrBytes" yaml:"stderrBytes"`
+
+	// IOSuspensions is the number of times the recording of I/O was suspended because the spool was full.
+	IOSuspensions int `json:"ioSuspensions,omitempty" yaml:"ioSuspensions,omitempty"`
+
+	// SHA256 is the hex-encoded SHA-256 digest of the full audit log, only set once the upload is complete.
+	SHA256 string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+}
+
+// maxProgramsMetadataLength limits the length of the programs metadata field to stay within the 2 KB S3 user metadata
+// limit.
+const maxProgramsMetadataLength = 1024
+
+func (meta queueEntryMetadata) getContentType() *string {
+	if meta.ContentType == "" {
+		return aws.String("application/octet-stream")
+	}
+	return aws.String(meta.ContentType)
 }
 
 func (meta queueEntryMetadata) ToMap(showUsername bool, showIP bool) map[string]*string {
@@ -45,19 +82,104 @@ func (meta queueEntryMetadata) ToMap(showUsername bool, showIP bool) map[string]
 	if showIP {
 		metadata["ip"] = aws.String(meta.RemoteAddr)
 	}
+	if meta.EndTime != 0 {
+		metadata["endtimestamp"] = aws.String(fmt.Sprintf("%d", meta.EndTime))
+		metadata["duration"] = aws.String(fmt.Sprintf("%d", meta.EndTime-meta.StartTime))
+		metadata["channels"] = aws.String(fmt.Sprintf("%d", meta.Channels))
+		programs := make([]string, len(meta.Programs))
+		for i, program := range meta.Programs {
+			programs[i] = url.QueryEscape(program)
+		}
+		metadata["programs"] = aws.String(joinEscaped(programs, maxProgramsMetadataLength))
+		if meta.ExitStatus != nil {
+			metadata["exitstatus"] = aws.String(fmt.Sprintf("%d", *meta.ExitStatus))
+		}
+		// The authentication methods and byte counts are left out when not recorded, for example for streams that are
+		// not intercepted or audit logs recovered from a version that did not record them.
+		if len(meta.AuthMethods) > 0 {
+			metadata["authmethods"] = aws.String(strings.Join(meta.AuthMethods, ","))
+		}
+		for key, value := range map[string]uint64{
+			"stdinbytes":  meta.StdinBytes,
+			"stdoutbytes": meta.StdoutBytes,
+			"stderrbytes": meta.StderrBytes,
+		} {
+			if value > 0 {
+				metadata[key] = aws.String(fmt.Sprintf("%d", value))
+			}
+		}
+	}
+	if meta.IOSuspensions > 0 {
+		metadata["iosuspended"] = aws.String(fmt.Sprintf("%d", meta.IOSuspensions))
+	}
+	if meta.SHA256 != "" {
+		metadata[checksumMetadataKey] = aws.String(meta.SHA256)
+	}
 	return metadata
 }
 
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length]
+}
+
+// joinEscaped joins the URL-escaped values with commas, leaving out the values that no longer fit in the length so
+// each value in the result can be decoded. If even the first value does not fit, it is cut before the escape sequence
+// the length would split.
+func joinEscaped(values []string, length int) string {
+	result := ""
+	for i, value := range values {
+		if i == 0 {
+			if len(value) > length {
+				return truncateEscaped(value, length)
+			}
+			result = value
+			continue
+		}
+		if len(result)+1+len(value) > length {
+			break
+		}
+		result += "," + value
+	}
+	return result
+}
+
+// truncateEscaped truncates a URL-escaped value without leaving an incomplete escape sequence at the end.
+func truncateEscaped(value string, length int) string {
+	value = truncate(value, length)
+	if i := strings.LastIndex(value, "%"); i >= 0 && i > len(value)-3 {
+		value = value[:i]
+	}
+	return value
+}
+
 type queueEntry struct {
-	logger        log.Logger
-	name          string
-	progress      int64
-	finished      bool
+	logger       log.Logger
+	name         string
+	progress     int64
+	finishedLock *sync.Mutex
+	finished     bool
+	// failures is the number of consecutive failed upload attempts, guarded by finishedLock.
+	failures uint
+	// rateLimiter limits the upload rate of this audit log, nil if not limited.
+	rateLimiter *rateLimiter
+	// evicted is closed when the audit log is evicted from the spool, guarded by finishedLock.
+	evicted chan struct{}
+	// recovered is set if the audit log was left in the local directory by a previous run.
+	recovered bool
+	// partChecksums holds the base64-encoded SHA-256 checksums of the uploaded parts by part number. It is only
+	// accessed by the upload loop.
+	partChecksums map[int64]string
+	// createdTags are the tags the multipart upload was created with. It is only accessed by the upload loop.
+	createdTags   []*s3.Tag
 	readHandle    *os.File
 	writeHandle   *os.File
 	partAvailable chan bool
 	file          string
-	metadata      queueEntryMetadata
+	// metadata is updated by the writer while the upload loop reads it, guarded by finishedLock.
+	metadata queueEntryMetadata
 }
 
 // This method marks the the part as available if it has not been marked yet. This unfreezes the upload loop waiting in
@@ -69,6 +191,72 @@ func (e *queueEntry) markPartAvailable() {
 	}
 }
 
+// markFinished marks the entry as completely written.
+func (e *queueEntry) markFinished() {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	e.finished = true
+}
+
+// isFinished returns true if the entry has been completely written.
+func (e *queueEntry) isFinished() bool {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	return e.finished
+}
+
+// updateMetadata changes the metadata of the entry and returns a copy of the result.
+func (e *queueEntry) updateMetadata(update func(metadata *queueEntryMetadata)) queueEntryMetadata {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	update(&e.metadata)
+	return e.metadata
+}
+
+// getMetadata returns a copy of the metadata of the entry.
+func (e *queueEntry) getMetadata() queueEntryMetadata {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	return e.metadata
+}
+
+// setFailures records the number of consecutive failed upload attempts.
+func (e *queueEntry) setFailures(failures uint) {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	e.failures = failures
+}
+
+// getFailures returns the number of consecutive failed upload attempts.
+func (e *queueEntry) getFailures() uint {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	return e.failures
+}
+
+// evict marks the entry as evicted and wakes up its upload loop, which removes the local copy without finishing the
+// upload.
+func (e *queueEntry) evict() {
+	e.finishedLock.Lock()
+	defer e.finishedLock.Unlock()
+	select {
+	case <-e.evicted:
+	default:
+		close(e.evicted)
+		e.markPartAvailable()
+	}
+}
+
+// isEvicted returns true if the entry has been evicted from the spool.
+func (e *queueEntry) isEvicted() bool {
+	select {
+	case <-e.evicted:
+		return true
+	default:
+		return false
+	}
+}
+
 // This method waits for the next part to be available.
 func (e *queueEntry) waitPartAvailable() {
 	<-e.partAvailable
@@ -96,8 +284,9 @@ func (e *queueEntry) remove() error {
 type uploadQueue struct {
 	directory       string
 	parallelUploads uint
+	listConcurrency uint
 	partSize        uint
-	workerSem       chan int
+	slots           *uploadSlots
 	logger          log.Logger
 	awsSession      *session.Session
 	bucket          string
@@ -106,26 +295,63 @@ type uploadQueue struct {
 	queue            sync.Map
 	metadataIP       bool
 	metadataUsername bool
-	wg               *sync.WaitGroup
-	ctx              context.Context
-	cancelFunc       context.CancelFunc
-	shutdownContext  context.Context
+	tags             Tags
+	objectLock       ObjectLock
+	// disableChecksums stops sending the SHA-256 checksums as S3 checksum headers.
+	disableChecksums bool
+	retry            Retry
+	healthCheck      HealthCheck
+	spool            Spool
+	bandwidth        Bandwidth
+	schedule         schedule
+	// rateLimiter limits the upload rate of all audit logs, nil if not limited.
+	rateLimiter *rateLimiter
+	spoolState  spoolState
+	// reservationLock is held from the spool check until the new audit log is in the queue, so audit logs opened
+	// concurrently cannot all pass the check or evict the same audit logs.
+	reservationLock *sync.Mutex
+	metrics         metrics.Collector
+	clock           clock.Clock
+	wg              *sync.WaitGroup
+	ctx             context.Context
+	cancelFunc      context.CancelFunc
+	// shutdownContext is the context passed to Shutdown, guarded by shutdownLock because the uploads read it while
+	// shutting down.
+	shutdownContext context.Context
+	shutdownLock    *sync.Mutex
 }
 
 func (q *uploadQueue) Shutdown(shutdownContext context.Context) {
+	q.shutdownLock.Lock()
 	q.shutdownContext = shutdownContext
+	q.shutdownLock.Unlock()
 	q.cancelFunc()
 	q.wg.Wait()
 }
 
+// getShutdownContext returns the context passed to Shutdown, or nil if the storage is not shutting down.
+func (q *uploadQueue) getShutdownContext() context.Context {
+	q.shutdownLock.Lock()
+	defer q.shutdownLock.Unlock()
+	return q.shutdownContext
+}
+
 func newUploadQueue(
 	directory string,
 	partSize uint,
 	parallelUploads uint,
+	listConcurrency uint,
 	bucket string,
 	acl string,
 	metadataUsername bool,
 	metadataIP bool,
+	tags Tags,
+	objectLock ObjectLock,
+	disableChecksums bool,
+	retry Retry,
+	healthCheck HealthCheck,
+	spool Spool,
+	bandwidth Bandwidth,
 	awsSession *session.Session,
 	logger log.Logger,
 ) *uploadQueue {
@@ -138,6 +364,9 @@ func newUploadQueue(
 	if parallelUploads < 1 {
 		parallelUploads = 1
 	}
+	if listConcurrency < 1 {
+		listConcurrency = 10
+	}
 	var realACL *string = nil
 	if acl != "" {
 		realACL = &acl
@@ -146,8 +375,9 @@ func newUploadQueue(
 	return &uploadQueue{
 		directory:        directory,
 		parallelUploads:  parallelUploads,
+		listConcurrency:  listConcurrency,
 		partSize:         partSize,
-		workerSem:        make(chan int, parallelUploads),
+		slots:            newUploadSlots(parallelUploads),
 		logger:           logger,
 		awsSession:       awsSession,
 		bucket:           bucket,
@@ -155,13 +385,47 @@ func newUploadQueue(
 		acl:              realACL,
 		metadataIP:       metadataIP,
 		metadataUsername: metadataUsername,
+		tags:             tags,
+		objectLock:       objectLock,
+		disableChecksums: disableChecksums,
+		retry:            retry.withDefaults(directory),
+		healthCheck:      healthCheck.withDefaults(),
+		spool:            spool,
+		bandwidth:        bandwidth,
+		schedule:         newSchedule(bandwidth),
+		rateLimiter:      newOptionalRateLimiter(bandwidth.Limit),
+		spoolState:       spoolState{lock: &sync.Mutex{}},
+		reservationLock:  &sync.Mutex{},
+		metrics:          metrics.NewNoopCollector(),
+		clock:            clock.System(),
 		wg:               &sync.WaitGroup{},
 		ctx:              ctx,
 		cancelFunc:       cancelFunc,
+		shutdownLock:     &sync.Mutex{},
 	}
 }
 
 func (q *uploadQueue) OpenWriter(name string) (storage.Writer, error) {
+	entry, err := q.createEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	q.updateSpool()
+	err = q.upload(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.getMonitoringWriter(name, entry.writeHandle, entry), nil
+}
+
+// createEntry reserves room in the spool and adds a new audit log to the queue.
+func (q *uploadQueue) createEntry(name string) (*queueEntry, error) {
+	q.reservationLock.Lock()
+	defer q.reservationLock.Unlock()
+	if err := q.reserveSpool(name); err != nil {
+		return nil, err
+	}
 	file := path.Join(q.directory, name)
 	writeHandle, err := os.Create(file)
 	if err != nil {
@@ -169,6 +433,7 @@ func (q *uploadQueue) OpenWriter(name string) (storage.Writer, error) {
 	}
 	readHandle, err := os.Open(file)
 	if err != nil {
+		_ = writeHandle.Close()
 		return nil, err
 	}
 	entry := &queueEntry{
@@ -176,10 +441,14 @@ func (q *uploadQueue) OpenWriter(name string) (storage.Writer, error) {
 		name:          name,
 		file:          file,
 		progress:      0,
+		finishedLock:  &sync.Mutex{},
 		finished:      false,
 		readHandle:    readHandle,
 		writeHandle:   writeHandle,
 		partAvailable: make(chan bool, 1),
+		partChecksums: map[int64]string{},
+		evicted:       make(chan struct{}),
+		rateLimiter:   newOptionalRateLimiter(q.bandwidth.PerLogLimit),
 		metadata: queueEntryMetadata{
 			StartTime:     0,
 			RemoteAddr:    "",
@@ -188,32 +457,51 @@ func (q *uploadQueue) OpenWriter(name string) (storage.Writer, error) {
 		},
 	}
 	q.queue.Store(name, entry)
-	err = q.upload(name)
-	if err != nil {
+	return entry, nil
+}
+
+// Create opens a writer for an audit log. The context only applies to opening the writer.
+func (q *uploadQueue) Create(ctx context.Context, name string) (storage.Writer, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-
-	return q.getMonitoringWriter(name, writeHandle, entry, file), nil
+	return q.OpenWriter(name)
 }
 
-func (q *uploadQueue) getMonitoringWriter(name string, writeHandle *os.File, entry *queueEntry, file string) storage.Writer {
+func (q *uploadQueue) getMonitoringWriter(name string, writeHandle *os.File, entry *queueEntry) storage.Writer {
 	return newMonitoringWriter(
 		writeHandle,
 		q.partSize,
 		func(startTime int64, remoteAddr string, country string, username *string) {
-			entry.metadata.StartTime = startTime
-			entry.metadata.RemoteAddr = remoteAddr
-			entry.metadata.Country = country
-			if username == nil {
-				entry.metadata.Authenticated = false
-				entry.metadata.Username = ""
-			} else {
-				entry.metadata.Authenticated = true
-				entry.metadata.Username = *username
-			}
-
-			metadataFile := fmt.Sprintf("%s.metadata.json", file)
-			q.writeMetadataFile(metadataFile, name, entry)
+			q.writeMetadataFile(name, entry, entry.updateMetadata(func(metadata *queueEntryMetadata) {
+				metadata.StartTime = startTime
+				metadata.RemoteAddr = remoteAddr
+				metadata.Country = country
+				if username == nil {
+					metadata.Authenticated = false
+					metadata.Username = ""
+				} else {
+					metadata.Authenticated = true
+					metadata.Username = *username
+				}
+			}))
+		},
+		func(contentType string) {
+			q.writeMetadataFile(name, entry, entry.updateMetadata(func(metadata *queueEntryMetadata) {
+				metadata.ContentType = contentType
+			}))
+		},
+		func(info storage.SessionInfo) {
+			q.writeMetadataFile(name, entry, entry.updateMetadata(func(metadata *queueEntryMetadata) {
+				metadata.EndTime = info.EndTime
+				metadata.Channels = info.Channels
+				metadata.Programs = info.Programs
+				metadata.ExitStatus = info.ExitStatus
+				metadata.AuthMethods = info.AuthMethods
+				metadata.StdinBytes = info.StdinBytes
+				metadata.StdoutBytes = info.StdoutBytes
+				metadata.StderrBytes = info.StderrBytes
+			}))
 		},
 		func() {
 			entry.markPartAvailable()
@@ -224,11 +512,48 @@ func (q *uploadQueue) getMonitoringWriter(name string, writeHandle *os.File, ent
 				q.logger.Warning(err)
 			}
 		},
+		func() {
+			// The upload loop removes evicted audit logs and aborts their multipart upload.
+			entry.evict()
+		},
+		q.ioFilter(name, entry),
 	)
 }
 
-func (q *uploadQueue) writeMetadataFile(metadataFile string, name string, entry *queueEntry) {
-	metadataFileHandle, err := os.Create(metadataFile)
+// ioFilter returns the function reporting if the audit log accepts I/O. The suspension and the resumption of the I/O
+// recording are logged and the number of suspensions is stored in the metadata, so the gaps in the audit log are
+// visible.
+func (q *uploadQueue) ioFilter(name string, entry *queueEntry) func() bool {
+	suspended := false
+	return func() bool {
+		accepts := q.acceptsIO()
+		if accepts != suspended {
+			return accepts
+		}
+		suspended = !accepts
+		if suspended {
+			q.writeMetadataFile(name, entry, entry.updateMetadata(func(metadata *queueEntryMetadata) {
+				metadata.IOSuspensions++
+			}))
+			q.logger.Warning(log.NewMessage(
+				codes.ES3SpoolIOSuspended,
+				"suspending the recording of I/O in audit log %s, the local directory %s exceeds the spool limits",
+				name,
+				q.directory,
+			).Label("log", name))
+		} else {
+			q.logger.Info(log.NewMessage(
+				codes.MS3SpoolIOResumed,
+				"resuming the recording of I/O in audit log %s",
+				name,
+			).Label("log", name))
+		}
+		return accepts
+	}
+}
+
+func (q *uploadQueue) writeMetadataFile(name string, entry *queueEntry, metadata queueEntryMetadata) {
+	metadataFileHandle, err := os.Create(fmt.Sprintf("%s.metadata.json", entry.file))
 	if err != nil {
 		q.logger.Warning(
 			log.Wrap(
@@ -251,7 +576,7 @@ func (q *uploadQueue) writeMetadataFile(metadataFile string, name string, entry
 				)
 			}
 		}()
-		jsonData, err := json.Marshal(entry.metadata)
+		jsonData, err := json.Marshal(metadata)
 		if err != nil {
 			q.logger.Warning(
 				log.Wrap(
@@ -283,7 +608,7 @@ func (q *uploadQueue) finish(name string) error {
 		return log.NewMessage(codes.ENoSuchQueueEntry, "no such queue entry: %s", name)
 	}
 	entry := rawEntry.(*queueEntry)
-	entry.finished = true
+	entry.markFinished()
 	entry.markPartAvailable()
 	return nil
 }
@@ -313,13 +638,19 @@ func (q *uploadQueue) recover(name string) error {
 		name:          name,
 		file:          file,
 		progress:      0,
+		finishedLock:  &sync.Mutex{},
 		finished:      true,
+		recovered:     true,
 		readHandle:    readHandle,
 		writeHandle:   nil,
 		partAvailable: make(chan bool, 1),
+		partChecksums: map[int64]string{},
+		evicted:       make(chan struct{}),
+		rateLimiter:   newOptionalRateLimiter(q.bandwidth.PerLogLimit),
 		metadata:      *metadata,
 	}
 	q.queue.Store(name, entry)
+	q.updateSpool()
 	entry.markPartAvailable()
 	return q.upload(name)
 }
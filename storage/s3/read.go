@@ -1,10 +1,18 @@
 package s3
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"os"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	awsS3 "github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/containerssh/auditlog/storage"
 )
 
 func (q *uploadQueue) OpenReader(name string) (io.ReadCloser, error) {
@@ -20,3 +28,144 @@ func (q *uploadQueue) OpenReader(name string) (io.ReadCloser, error) {
 
 	return getObjectOutput.Body, nil
 }
+
+// Open opens a reader for an uploaded audit log.
+func (q *uploadQueue) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return q.OpenRange(ctx, name, 0, -1)
+}
+
+// Follow opens a reader for an audit log that may still be written. Audit logs that are still in the upload queue are
+// read from the local directory, waiting for more data until the writer is closed. Other audit logs are read from the
+// bucket.
+func (q *uploadQueue) Follow(ctx context.Context, name string) (io.ReadCloser, error) {
+	if rawEntry, ok := q.queue.Load(name); ok {
+		entry := rawEntry.(*queueEntry)
+		// The local file is removed once the upload is complete, the bucket has the full audit log then.
+		if file, err := os.Open(entry.file); err == nil {
+			return storage.FollowReader(ctx, file, entry.isFinished), nil
+		}
+	}
+	return q.Open(ctx, name)
+}
+
+// OpenRange opens a reader for a byte range of an uploaded audit log using a ranged GET request.
+func (q *uploadQueue) OpenRange(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error) {
+	if err := storage.ValidateRange(offset); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return q.emptyRange(ctx, name)
+	}
+	s3Connection := awsS3.New(q.awsSession)
+
+	var byteRange *string
+	if length > 0 {
+		byteRange = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		byteRange = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	getObjectOutput, err := s3Connection.GetObjectWithContext(ctx, &awsS3.GetObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(name),
+		Range:  byteRange,
+	})
+	if err != nil {
+		var requestFailure awserr.RequestFailure
+		if errors.As(err, &requestFailure) && requestFailure.StatusCode() == http.StatusRequestedRangeNotSatisfiable {
+			return q.emptyRange(ctx, name)
+		}
+		return nil, wrapNotFound(name, err)
+	}
+
+	return getObjectOutput.Body, nil
+}
+
+// emptyRange returns an empty reader if the audit log exists. S3 rejects ranges starting at or after the end of the
+// object, but reading past the end is not an error for the other storages.
+func (q *uploadQueue) emptyRange(ctx context.Context, name string) (io.ReadCloser, error) {
+	if _, err := q.Stat(ctx, name); err != nil {
+		return nil, err
+	}
+	return &emptyReadCloser{}, nil
+}
+
+// Stat returns the size and metadata of an audit log. Audit logs that have not been fully uploaded yet are reported
+// from the local directory with the finished flag unset.
+func (q *uploadQueue) Stat(ctx context.Context, name string) (storage.EntryInfo, error) {
+	s3Connection := awsS3.New(q.awsSession)
+
+	headObjectOutput, err := s3Connection.HeadObjectWithContext(ctx, &awsS3.HeadObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(name),
+	})
+	if err == nil {
+		meta := map[string]string{}
+		for k, v := range headObjectOutput.Metadata {
+			if v != nil {
+				meta[k] = *v
+			}
+		}
+		return storage.EntryInfo{
+			Name:     name,
+			Size:     aws.Int64Value(headObjectOutput.ContentLength),
+			Metadata: meta,
+			Finished: true,
+		}, nil
+	}
+	if rawEntry, ok := q.queue.Load(name); ok {
+		entry := rawEntry.(*queueEntry)
+		stat, statErr := os.Stat(entry.file)
+		if statErr == nil {
+			meta := map[string]string{}
+			for k, v := range entry.getMetadata().ToMap(q.metadataUsername, q.metadataIP) {
+				if v != nil {
+					meta[k] = *v
+				}
+			}
+			return storage.EntryInfo{
+				Name:     name,
+				Size:     stat.Size(),
+				Metadata: meta,
+				Finished: false,
+			}, nil
+		}
+	}
+	return storage.EntryInfo{}, wrapNotFound(name, err)
+}
+
+// Delete removes an uploaded audit log from the bucket. S3 does not report deleting a non-existent object as an error.
+func (q *uploadQueue) Delete(ctx context.Context, name string) error {
+	// The upload of an audit log in the queue would recreate the object.
+	if _, ok := q.queue.Load(name); ok {
+		return fmt.Errorf("audit log %s is still being uploaded (%w)", name, storage.ErrInUse)
+	}
+	s3Connection := awsS3.New(q.awsSession)
+
+	if _, err := s3Connection.DeleteObjectWithContext(ctx, &awsS3.DeleteObjectInput{
+		Bucket: aws.String(q.bucket),
+		Key:    aws.String(name),
+	}); err != nil {
+		return wrapNotFound(name, err)
+	}
+	return nil
+}
+
+func wrapNotFound(name string, err error) error {
+	var requestFailure awserr.RequestFailure
+	if errors.As(err, &requestFailure) && requestFailure.StatusCode() == http.StatusNotFound &&
+		requestFailure.Code() != awsS3.ErrCodeNoSuchBucket {
+		return fmt.Errorf("audit log %s does not exist (%w)", name, storage.ErrNotFound)
+	}
+	return err
+}
+
+type emptyReadCloser struct {
+}
+
+func (e *emptyReadCloser) Read(_ []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (e *emptyReadCloser) Close() error {
+	return nil
+}
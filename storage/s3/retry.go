@@ -0,0 +1,181 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+)
+
+// GiveUpAction describes what happens to the local copy of an audit log when the upload is given up.
+type GiveUpAction string
+
+const (
+	// GiveUpQuarantine moves the audit log and its metadata into the quarantine directory for manual inspection.
+	GiveUpQuarantine GiveUpAction = "quarantine"
+	// GiveUpKeep leaves the audit log in the local directory. The upload is retried on the next start.
+	GiveUpKeep GiveUpAction = "keep"
+	// GiveUpDelete removes the local copy of the audit log. The audit log is lost.
+	GiveUpDelete GiveUpAction = "delete"
+)
+
+// Validate checks the give up action.
+func (g GiveUpAction) Validate() error {
+	switch g {
+	case "":
+	case GiveUpQuarantine:
+	case GiveUpKeep:
+	case GiveUpDelete:
+	default:
+		return fmt.Errorf("invalid give up action: %s", g)
+	}
+	return nil
+}
+
+// Retry configures how failed uploads are retried.
+type Retry struct {
+	// InitialBackoff is the time to wait after the first failure. Doubles with every subsequent failure.
+	InitialBackoff time.Duration `json:"initialBackoff" yaml:"initialBackoff" default:"1s"`
+	// MaxBackoff is the maximum time to wait between two attempts.
+	MaxBackoff time.Duration `json:"maxBackoff" yaml:"maxBackoff" default:"5m"`
+	// Jitter randomizes the backoff by up to this fraction in both directions. Must be between 0 and 1.
+	Jitter float64 `json:"jitter" yaml:"jitter" default:"0.2"`
+	// MaxAttempts is the number of consecutive failed attempts after which the upload is given up.
+	MaxAttempts uint `json:"maxAttempts" yaml:"maxAttempts" default:"20"`
+	// ShutdownMaxAttempts is the number of consecutive failed attempts after which the upload is given up when a
+	// shutdown has been requested.
+	ShutdownMaxAttempts uint `json:"shutdownMaxAttempts" yaml:"shutdownMaxAttempts" default:"3"`
+	// GiveUp is the action to take with the local copy when the upload is given up.
+	GiveUp GiveUpAction `json:"giveUp" yaml:"giveUp" default:"quarantine"`
+	// QuarantineDirectory is the directory audit logs are moved to by the quarantine action. Defaults to the
+	// quarantine subdirectory of the local directory.
+	QuarantineDirectory string `json:"quarantineDirectory" yaml:"quarantineDirectory"`
+}
+
+// Validate validates the retry configuration.
+func (r Retry) Validate() error {
+	if r.InitialBackoff < 0 {
+		return fmt.Errorf("negative initial backoff: %s", r.InitialBackoff)
+	}
+	if r.MaxBackoff < 0 {
+		return fmt.Errorf("negative maximum backoff: %s", r.MaxBackoff)
+	}
+	if r.MaxBackoff != 0 && r.MaxBackoff < r.InitialBackoff {
+		return fmt.Errorf("maximum backoff %s is lower than the initial backoff %s", r.MaxBackoff, r.InitialBackoff)
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("invalid jitter: %f (must be between 0 and 1)", r.Jitter)
+	}
+	return r.GiveUp.Validate()
+}
+
+// withDefaults returns the retry policy with the defaults filled in for unset values.
+func (r Retry) withDefaults(localDirectory string) Retry {
+	if r.InitialBackoff == 0 {
+		r.InitialBackoff = time.Second
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = 5 * time.Minute
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		r.MaxBackoff = r.InitialBackoff
+	}
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = 20
+	}
+	if r.ShutdownMaxAttempts == 0 {
+		r.ShutdownMaxAttempts = 3
+	}
+	if r.GiveUp == "" {
+		r.GiveUp = GiveUpQuarantine
+	}
+	if r.QuarantineDirectory == "" {
+		r.QuarantineDirectory = path.Join(localDirectory, "quarantine")
+	}
+	return r
+}
+
+// backoff returns the time to wait after the specified number of consecutive failures.
+func (r Retry) backoff(failures uint) time.Duration {
+	backoff := float64(r.MaxBackoff)
+	if failures < 63 {
+		backoff = math.Min(float64(r.InitialBackoff)*math.Pow(2, float64(failures-1)), backoff)
+	}
+	//nolint:gosec // The jitter does not need a cryptographically secure random number.
+	backoff *= 1 + r.Jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+// permanentErrorCodes are the S3 error codes that will not go away by retrying.
+var permanentErrorCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccountProblem":        true,
+	"AllAccessDisabled":     true,
+	"InvalidAccessKeyId":    true,
+	"InvalidBucketName":     true,
+	"InvalidObjectState":    true,
+	"NoSuchBucket":          true,
+	"SignatureDoesNotMatch": true,
+}
+
+// isPermanentError returns true if the error is an S3 error that will not go away by retrying.
+func isPermanentError(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	return permanentErrorCodes[awsErr.Code()]
+}
+
+// giveUp handles the local copy of an audit log whose upload has been given up according to the give up action.
+func (q *uploadQueue) giveUp(name string, entry *queueEntry) {
+	switch q.retry.GiveUp {
+	case GiveUpKeep:
+	case GiveUpDelete:
+		if err := entry.remove(); err != nil {
+			q.logger.Error(err)
+		}
+	default:
+		if err := entry.quarantine(q.retry.QuarantineDirectory); err != nil {
+			q.logger.Error(err)
+			return
+		}
+		q.logger.Warning(log.NewMessage(
+			codes.EUploadQuarantined,
+			"audit log %s has been moved to the quarantine directory %s",
+			name,
+			q.retry.QuarantineDirectory,
+		).Label("log", name))
+	}
+}
+
+// quarantine moves the audit log and its metadata file into the quarantine directory.
+func (e *queueEntry) quarantine(directory string) error {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return log.Wrap(err, codes.EQuarantineFailed, "failed to create quarantine directory %s", directory)
+	}
+	if e.readHandle != nil {
+		if err := e.readHandle.Close(); err != nil {
+			return log.Wrap(err, codes.ECloseAuditLogFileFailed, "failed to close audit log file %s", e.file)
+		}
+		e.readHandle = nil
+	}
+	if err := os.Rename(e.file, path.Join(directory, e.name)); err != nil {
+		return log.Wrap(err, codes.EQuarantineFailed, "failed to move audit log %s to quarantine", e.name)
+	}
+	metadataFile := fmt.Sprintf("%s.metadata.json", e.file)
+	if _, err := os.Stat(metadataFile); err == nil {
+		if err := os.Rename(metadataFile, path.Join(directory, e.name+".metadata.json")); err != nil {
+			return log.Wrap(err, codes.EQuarantineFailed, "failed to move audit log %s metadata to quarantine", e.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package s3_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+)
+
+// uploadWithRetry uploads an audit log while the fault is injected into the PutObject requests. The tests use errors
+// the AWS SDK does not retry internally.
+func uploadWithRetry(t *testing.T, fault s3test.Fault, retry s3.Retry) (string, int) {
+	server := newS3Server(t)
+	fault.Operation = s3test.OperationPutObject
+	server.InjectFault(fault)
+	config := newS3Config(t, server)
+	config.ParallelUploads = 1
+	config.Retry = retry
+	st := newS3Storage(t, config)
+	writeAuditLog(t, st, "test", []byte("Hello world!"))
+	st.Shutdown(context.Background())
+	return config.Local, server.RequestCount(s3test.OperationPutObject)
+}
+
+func TestRetryTransientError(t *testing.T) {
+	dir, puts := uploadWithRetry(
+		t,
+		s3test.Fault{StatusCode: http.StatusBadRequest, Code: "InvalidRequest", Count: 2},
+		s3.Retry{InitialBackoff: 10 * time.Millisecond, ShutdownMaxAttempts: 5},
+	)
+	assert.Equal(t, 3, puts)
+	_, err := os.Stat(path.Join(dir, "test"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRetryPermanentErrorQuarantine(t *testing.T) {
+	dir, puts := uploadWithRetry(
+		t,
+		s3test.Fault{StatusCode: http.StatusForbidden, Code: "AccessDenied"},
+		s3.Retry{InitialBackoff: 10 * time.Millisecond},
+	)
+	assert.Equal(t, 1, puts)
+	_, err := os.Stat(path.Join(dir, "test"))
+	assert.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile(path.Join(dir, "quarantine", "test"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world!", string(data))
+}
+
+func TestRetryMaxAttemptsKeep(t *testing.T) {
+	dir, puts := uploadWithRetry(
+		t,
+		s3test.Fault{StatusCode: http.StatusBadRequest, Code: "InvalidRequest"},
+		s3.Retry{
+			InitialBackoff:      10 * time.Millisecond,
+			MaxAttempts:         2,
+			ShutdownMaxAttempts: 2,
+			GiveUp:              s3.GiveUpKeep,
+		},
+	)
+	assert.Equal(t, 2, puts)
+	data, err := ioutil.ReadFile(path.Join(dir, "test"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world!", string(data))
+}
+
+func TestRetryValidation(t *testing.T) {
+	assert.NoError(t, s3.Retry{}.Validate())
+	assert.Error(t, s3.Retry{Jitter: 2}.Validate())
+	assert.Error(t, s3.Retry{InitialBackoff: time.Minute, MaxBackoff: time.Second}.Validate())
+	assert.Error(t, s3.Retry{GiveUp: "invalid"}.Validate())
+}
@@ -0,0 +1,77 @@
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// blobStore holds the data of objects and parts.
+type blobStore interface {
+	put(id string, data []byte) error
+	get(id string) ([]byte, error)
+	remove(id string)
+}
+
+func objectBlobID(bucketName string, key string) string {
+	return fmt.Sprintf("object/%s/%s", bucketName, key)
+}
+
+func partBlobID(uploadID string, partNumber int) string {
+	return fmt.Sprintf("part/%s/%d", uploadID, partNumber)
+}
+
+type memoryBlobStore struct {
+	blobs map[string][]byte
+}
+
+func newMemoryBlobStore() *memoryBlobStore {
+	return &memoryBlobStore{blobs: map[string][]byte{}}
+}
+
+func (m *memoryBlobStore) put(id string, data []byte) error {
+	m.blobs[id] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memoryBlobStore) get(id string) ([]byte, error) {
+	data, ok := m.blobs[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *memoryBlobStore) remove(id string) {
+	delete(m.blobs, id)
+}
+
+// directoryBlobStore stores each blob in a file named after the hash of the blob ID, as object keys may contain
+// characters that are not valid in file names.
+type directoryBlobStore struct {
+	directory string
+}
+
+func newDirectoryBlobStore(directory string) *directoryBlobStore {
+	return &directoryBlobStore{directory: directory}
+}
+
+func (d *directoryBlobStore) file(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(d.directory, hex.EncodeToString(sum[:]))
+}
+
+func (d *directoryBlobStore) put(id string, data []byte) error {
+	return ioutil.WriteFile(d.file(id), data, 0600)
+}
+
+func (d *directoryBlobStore) get(id string) ([]byte, error) {
+	return ioutil.ReadFile(d.file(id))
+}
+
+func (d *directoryBlobStore) remove(id string) {
+	_ = os.Remove(d.file(id))
+}
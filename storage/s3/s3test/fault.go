@@ -0,0 +1,80 @@
+package s3test
+
+import (
+	"net/http"
+	"time"
+)
+
+// Fault describes an error or delay injected into the responses of the test server.
+type Fault struct {
+	// Operation restricts the fault to an operation. The fault applies to all operations if empty.
+	Operation Operation
+	// Key restricts the fault to requests for an object key. The fault applies to all keys if empty.
+	Key string
+	// Skip is the number of matching requests that are answered normally before the fault applies. For example, a
+	// fault for OperationUploadPart with Skip set to 2 fails the third part upload.
+	Skip int
+	// Count is the number of matching requests the fault applies to after the skipped ones. The fault applies to all
+	// following requests if 0.
+	Count int
+	// Delay delays the response, for example to simulate a slow connection.
+	Delay time.Duration
+	// StatusCode is the HTTP status code of the error response. No error is returned if 0, only the delay is applied.
+	StatusCode int
+	// Code is the S3 error code of the error response. Defaults to InternalError.
+	Code string
+}
+
+// FailPart returns a fault failing the upload of the nth part (counting from 1) of the multipart uploads with a
+// non-retryable error.
+func FailPart(n int) Fault {
+	return Fault{
+		Operation:  OperationUploadPart,
+		Skip:       n - 1,
+		Count:      1,
+		StatusCode: http.StatusBadRequest,
+		Code:       "InvalidRequest",
+	}
+}
+
+type faultState struct {
+	fault   Fault
+	matched int
+}
+
+// InjectFault adds a fault to the server. Faults are checked in the order they were added, the first fault applying
+// to a request is used.
+func (s *Server) InjectFault(fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, &faultState{fault: fault})
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+// matchFault returns the fault that applies to the request, if any. It must be called with the lock held.
+func (s *Server) matchFault(operation Operation, key string) *Fault {
+	for _, state := range s.faults {
+		if state.fault.Operation != "" && state.fault.Operation != operation {
+			continue
+		}
+		if state.fault.Key != "" && state.fault.Key != key {
+			continue
+		}
+		state.matched++
+		if state.matched <= state.fault.Skip {
+			continue
+		}
+		if state.fault.Count > 0 && state.matched > state.fault.Skip+state.fault.Count {
+			continue
+		}
+		fault := state.fault
+		return &fault
+	}
+	return nil
+}
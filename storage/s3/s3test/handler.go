@@ -0,0 +1,282 @@
+package s3test
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Operation is an S3 API operation supported by the test server.
+type Operation string
+
+const (
+	OperationCreateBucket               Operation = "CreateBucket"
+	OperationHeadBucket                 Operation = "HeadBucket"
+	OperationGetObjectLockConfiguration Operation = "GetObjectLockConfiguration"
+	OperationListObjectsV2              Operation = "ListObjectsV2"
+	OperationListMultipartUploads       Operation = "ListMultipartUploads"
+	OperationPutObject                  Operation = "PutObject"
+	OperationCopyObject                 Operation = "CopyObject"
+	OperationGetObject                  Operation = "GetObject"
+	OperationHeadObject                 Operation = "HeadObject"
+	OperationDeleteObject               Operation = "DeleteObject"
+	OperationGetObjectTagging           Operation = "GetObjectTagging"
+	OperationPutObjectTagging           Operation = "PutObjectTagging"
+	OperationCreateMultipartUpload      Operation = "CreateMultipartUpload"
+	OperationUploadPart                 Operation = "UploadPart"
+	OperationCompleteMultipartUpload    Operation = "CompleteMultipartUpload"
+	OperationAbortMultipartUpload       Operation = "AbortMultipartUpload"
+	// OperationUnsupported is recorded for requests the test server does not implement. They are answered with a
+	// NotImplemented error.
+	OperationUnsupported Operation = "Unsupported"
+)
+
+// s3Error is an error response of the S3 API.
+type s3Error struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func (e *s3Error) Error() string {
+	return e.code + ": " + e.message
+}
+
+func newError(statusCode int, code string, message string) *s3Error {
+	return &s3Error{statusCode: statusCode, code: code, message: message}
+}
+
+var (
+	errNoSuchBucket = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	errNoSuchKey    = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+	errNoSuchUpload = newError(http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+)
+
+// splitPath returns the bucket and the key from a path-style request path.
+func splitPath(path string) (string, string) {
+	path = strings.TrimPrefix(path, "/")
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func hasQuery(query url.Values, key string) bool {
+	_, ok := query[key]
+	return ok
+}
+
+// operation determines the S3 operation of a request.
+func operation(r *http.Request, bucketName string, key string) Operation {
+	query := r.URL.Query()
+	if bucketName == "" {
+		return OperationUnsupported
+	}
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut && len(query) == 0:
+			return OperationCreateBucket
+		case r.Method == http.MethodHead:
+			return OperationHeadBucket
+		case r.Method == http.MethodGet && hasQuery(query, "object-lock"):
+			return OperationGetObjectLockConfiguration
+		case r.Method == http.MethodGet && hasQuery(query, "uploads"):
+			return OperationListMultipartUploads
+		case r.Method == http.MethodGet && query.Get("list-type") == "2":
+			return OperationListObjectsV2
+		}
+		return OperationUnsupported
+	}
+	switch r.Method {
+	case http.MethodPut:
+		switch {
+		case hasQuery(query, "uploadId"):
+			return OperationUploadPart
+		case hasQuery(query, "tagging"):
+			return OperationPutObjectTagging
+		case r.Header.Get("x-amz-copy-source") != "":
+			return OperationCopyObject
+		case len(query) == 0:
+			return OperationPutObject
+		}
+	case http.MethodPost:
+		switch {
+		case hasQuery(query, "uploads"):
+			return OperationCreateMultipartUpload
+		case hasQuery(query, "uploadId"):
+			return OperationCompleteMultipartUpload
+		}
+	case http.MethodDelete:
+		if hasQuery(query, "uploadId") {
+			return OperationAbortMultipartUpload
+		}
+		if len(query) == 0 {
+			return OperationDeleteObject
+		}
+	case http.MethodGet:
+		if hasQuery(query, "tagging") {
+			return OperationGetObjectTagging
+		}
+		return OperationGetObject
+	case http.MethodHead:
+		return OperationHeadObject
+	}
+	return OperationUnsupported
+}
+
+// accessKey extracts the access key from the AWS signature version 4 authorization header.
+func accessKey(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	start := strings.Index(authorization, "Credential=")
+	if start < 0 {
+		return ""
+	}
+	credential := authorization[start+len("Credential="):]
+	if end := strings.Index(credential, "/"); end >= 0 {
+		return credential[:end]
+	}
+	return credential
+}
+
+// ServeHTTP handles an S3 API request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, newError(http.StatusBadRequest, "IncompleteBody", err.Error()))
+		return
+	}
+	bucketName, key := splitPath(r.URL.Path)
+	op := operation(r, bucketName, key)
+
+	s.lock.Lock()
+	s.requests = append(s.requests, Request{
+		Operation: op,
+		Bucket:    bucketName,
+		Key:       key,
+		Query:     r.URL.Query(),
+		AccessKey: accessKey(r),
+		BodySize:  int64(len(body)),
+	})
+	fault := s.matchFault(op, key)
+	s.lock.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.StatusCode != 0 {
+			code := fault.Code
+			if code == "" {
+				code = "InternalError"
+			}
+			writeError(w, r, newError(fault.StatusCode, code, "injected fault"))
+			return
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if op == OperationUnsupported {
+		writeError(w, r, newError(http.StatusNotImplemented, "NotImplemented", "the test server does not support this request"))
+		return
+	}
+	if op == OperationCreateBucket {
+		if _, ok := s.buckets[bucketName]; !ok {
+			s.buckets[bucketName] = &bucket{
+				objectLock: strings.EqualFold(r.Header.Get("x-amz-bucket-object-lock-enabled"), "true"),
+				objects:    map[string]*Object{},
+			}
+		}
+		return
+	}
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, r, errNoSuchBucket)
+		return
+	}
+	if err := s.handle(w, r, op, b, bucketName, key, body); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// handle executes an operation on an existing bucket. It must be called with the lock held.
+func (s *Server) handle(
+	w http.ResponseWriter,
+	r *http.Request,
+	op Operation,
+	b *bucket,
+	bucketName string,
+	key string,
+	body []byte,
+) *s3Error {
+	switch op {
+	case OperationHeadBucket:
+		return nil
+	case OperationGetObjectLockConfiguration:
+		return s.getObjectLockConfiguration(w, b)
+	case OperationListObjectsV2:
+		return s.listObjectsV2(w, r, b, bucketName)
+	case OperationListMultipartUploads:
+		return s.listMultipartUploads(w, r, bucketName)
+	case OperationPutObject:
+		return s.putObject(w, r, b, bucketName, key, body)
+	case OperationCopyObject:
+		return s.copyObject(w, r, b, bucketName, key)
+	case OperationGetObject, OperationHeadObject:
+		return s.getObject(w, r, b, bucketName, key, op == OperationHeadObject)
+	case OperationDeleteObject:
+		s.blobs.remove(objectBlobID(bucketName, key))
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case OperationGetObjectTagging:
+		return s.getObjectTagging(w, b, key)
+	case OperationPutObjectTagging:
+		return s.putObjectTagging(b, key, body)
+	case OperationCreateMultipartUpload:
+		return s.createMultipartUpload(w, r, b, bucketName, key)
+	case OperationUploadPart:
+		return s.uploadPart(w, r, bucketName, key, body)
+	case OperationCompleteMultipartUpload:
+		return s.completeMultipartUpload(w, r, b, bucketName, key, body)
+	case OperationAbortMultipartUpload:
+		return s.abortMultipartUpload(w, r, bucketName, key)
+	}
+	return newError(http.StatusNotImplemented, "NotImplemented", "the test server does not support this request")
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err *s3Error) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(err.statusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+	writeXMLBody(w, struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string   `xml:"Code"`
+		Message  string   `xml:"Message"`
+		Resource string   `xml:"Resource"`
+	}{Code: err.code, Message: err.message, Resource: r.URL.Path})
+}
+
+func writeXML(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	writeXMLBody(w, value)
+}
+
+func writeXMLBody(w http.ResponseWriter, value interface{}) {
+	data, err := xml.Marshal(value)
+	if err != nil {
+		return
+	}
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
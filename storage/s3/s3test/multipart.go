@@ -0,0 +1,260 @@
+package s3test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type multipartUpload struct {
+	bucket            string
+	key               string
+	object            Object
+	checksumAlgorithm string
+	initiated         time.Time
+	parts             map[int]*uploadedPart
+}
+
+type uploadedPart struct {
+	etag           string
+	size           int64
+	checksumSHA256 string
+}
+
+// findUpload returns the multipart upload of the request. It must be called with the lock held.
+func (s *Server) findUpload(r *http.Request, bucketName string, key string) (string, *multipartUpload, *s3Error) {
+	uploadID := r.URL.Query().Get("uploadId")
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.bucket != bucketName || upload.key != key {
+		return "", nil, errNoSuchUpload
+	}
+	return uploadID, upload, nil
+}
+
+func (s *Server) createMultipartUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	b *bucket,
+	bucketName string,
+	key string,
+) *s3Error {
+	object, err := objectFromHeaders(r, b)
+	if err != nil {
+		return err
+	}
+	checksumAlgorithm := strings.ToUpper(r.Header.Get("x-amz-checksum-algorithm"))
+	if checksumAlgorithm != "" && checksumAlgorithm != "SHA256" {
+		return newError(
+			http.StatusBadRequest,
+			"InvalidRequest",
+			fmt.Sprintf("the test server does not support the %s checksum algorithm", checksumAlgorithm),
+		)
+	}
+	s.nextUploadID++
+	uploadID := strconv.Itoa(s.nextUploadID)
+	s.uploads[uploadID] = &multipartUpload{
+		bucket:            bucketName,
+		key:               key,
+		object:            object,
+		checksumAlgorithm: checksumAlgorithm,
+		initiated:         time.Now(),
+		parts:             map[int]*uploadedPart{},
+	}
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Bucket: bucketName, Key: key, UploadID: uploadID})
+	return nil
+}
+
+func (s *Server) uploadPart(
+	w http.ResponseWriter,
+	r *http.Request,
+	bucketName string,
+	key string,
+	body []byte,
+) *s3Error {
+	uploadID, upload, err := s.findUpload(r, bucketName, key)
+	if err != nil {
+		return err
+	}
+	partNumber, parseErr := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if parseErr != nil || partNumber < 1 || partNumber > 10000 {
+		return newError(
+			http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive",
+		)
+	}
+	if upload.object.hasObjectLock() && r.Header.Get("Content-MD5") == "" {
+		return newError(
+			http.StatusBadRequest,
+			"InvalidRequest",
+			"Content-MD5 HTTP header is required for Upload Part requests with Object Lock parameters",
+		)
+	}
+	if upload.checksumAlgorithm != "" && r.Header.Get("x-amz-checksum-sha256") == "" {
+		return newError(
+			http.StatusBadRequest, "InvalidRequest", "the upload was created with a checksum algorithm",
+		)
+	}
+	checksum, err := checkDigests(r, body)
+	if err != nil {
+		return err
+	}
+	if storeErr := s.blobs.put(partBlobID(uploadID, partNumber), body); storeErr != nil {
+		return newError(http.StatusInternalServerError, "InternalError", storeErr.Error())
+	}
+	part := &uploadedPart{etag: etag(body), size: int64(len(body)), checksumSHA256: checksum}
+	upload.parts[partNumber] = part
+	w.Header().Set("ETag", part.etag)
+	return nil
+}
+
+type completeMultipartUploadRequest struct {
+	Parts []struct {
+		ChecksumSHA256 string `xml:"ChecksumSHA256"`
+		ETag           string `xml:"ETag"`
+		PartNumber     int    `xml:"PartNumber"`
+	} `xml:"Part"`
+}
+
+func (s *Server) completeMultipartUpload(
+	w http.ResponseWriter,
+	r *http.Request,
+	b *bucket,
+	bucketName string,
+	key string,
+	body []byte,
+) *s3Error {
+	uploadID, upload, err := s.findUpload(r, bucketName, key)
+	if err != nil {
+		return err
+	}
+	request := completeMultipartUploadRequest{}
+	if xmlErr := xml.Unmarshal(body, &request); xmlErr != nil || len(request.Parts) == 0 {
+		return newError(
+			http.StatusBadRequest,
+			"MalformedXML",
+			"The XML you provided was not well-formed or did not validate against our published schema",
+		)
+	}
+	var data []byte
+	etags := md5.New()
+	checksums := sha256.New()
+	for i, requestedPart := range request.Parts {
+		if i > 0 && requestedPart.PartNumber <= request.Parts[i-1].PartNumber {
+			return newError(
+				http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.",
+			)
+		}
+		part, ok := upload.parts[requestedPart.PartNumber]
+		if !ok || part.etag != requestedPart.ETag {
+			return newError(
+				http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.",
+			)
+		}
+		if upload.checksumAlgorithm != "" && requestedPart.ChecksumSHA256 != part.checksumSHA256 {
+			return newError(
+				http.StatusBadRequest,
+				"InvalidPart",
+				fmt.Sprintf("Invalid checksum for part %d.", requestedPart.PartNumber),
+			)
+		}
+		if i < len(request.Parts)-1 && part.size < s.minPartSize {
+			return newError(
+				http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed size",
+			)
+		}
+		partData, getErr := s.blobs.get(partBlobID(uploadID, requestedPart.PartNumber))
+		if getErr != nil {
+			return newError(http.StatusInternalServerError, "InternalError", getErr.Error())
+		}
+		data = append(data, partData...)
+		partETag, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		_, _ = etags.Write(partETag)
+		if part.checksumSHA256 != "" {
+			partChecksum, _ := base64.StdEncoding.DecodeString(part.checksumSHA256)
+			_, _ = checksums.Write(partChecksum)
+		}
+	}
+	object := upload.object
+	object.Data = data
+	object.ETag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etags.Sum(nil)), len(request.Parts))
+	if upload.checksumAlgorithm != "" {
+		object.ChecksumSHA256 = fmt.Sprintf(
+			"%s-%d", base64.StdEncoding.EncodeToString(checksums.Sum(nil)), len(request.Parts),
+		)
+	}
+	object.LastModified = time.Now()
+	if storeErr := s.storeObject(b, bucketName, key, object); storeErr != nil {
+		return newError(http.StatusInternalServerError, "InternalError", storeErr.Error())
+	}
+	s.removeUpload(uploadID)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Bucket: bucketName, Key: key, ETag: object.ETag})
+	return nil
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName string, key string) *s3Error {
+	uploadID, _, err := s.findUpload(r, bucketName, key)
+	if err != nil {
+		return err
+	}
+	s.removeUpload(uploadID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) removeUpload(uploadID string) {
+	for partNumber := range s.uploads[uploadID].parts {
+		s.blobs.remove(partBlobID(uploadID, partNumber))
+	}
+	delete(s.uploads, uploadID)
+}
+
+type listedUpload struct {
+	Key       string `xml:"Key"`
+	UploadID  string `xml:"UploadId"`
+	Initiated string `xml:"Initiated"`
+}
+
+func (s *Server) listMultipartUploads(w http.ResponseWriter, r *http.Request, bucketName string) *s3Error {
+	prefix := r.URL.Query().Get("prefix")
+	result := struct {
+		XMLName     xml.Name       `xml:"ListMultipartUploadsResult"`
+		Bucket      string         `xml:"Bucket"`
+		Prefix      string         `xml:"Prefix"`
+		IsTruncated bool           `xml:"IsTruncated"`
+		Uploads     []listedUpload `xml:"Upload"`
+	}{Bucket: bucketName, Prefix: prefix}
+	for uploadID, upload := range s.uploads {
+		if upload.bucket == bucketName && strings.HasPrefix(upload.key, prefix) {
+			result.Uploads = append(result.Uploads, listedUpload{
+				Key:       upload.key,
+				UploadID:  uploadID,
+				Initiated: upload.initiated.UTC().Format(isoTimeFormat),
+			})
+		}
+	}
+	sort.Slice(result.Uploads, func(i, j int) bool {
+		if result.Uploads[i].Key != result.Uploads[j].Key {
+			return result.Uploads[i].Key < result.Uploads[j].Key
+		}
+		return result.Uploads[i].UploadID < result.Uploads[j].UploadID
+	})
+	writeXML(w, result)
+	return nil
+}
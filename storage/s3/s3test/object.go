@@ -0,0 +1,387 @@
+package s3test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	metadataHeaderPrefix = "x-amz-meta-"
+	isoTimeFormat        = "2006-01-02T15:04:05.000Z"
+)
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// checkDigests verifies the Content-MD5 and SHA-256 checksum headers against the received data and returns the
+// SHA-256 checksum header.
+func checkDigests(r *http.Request, data []byte) (string, *s3Error) {
+	if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+		sum := md5.Sum(data)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			return "", newError(
+				http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.",
+			)
+		}
+	}
+	checksum := r.Header.Get("x-amz-checksum-sha256")
+	if checksum != "" {
+		sum := sha256.Sum256(data)
+		if checksum != base64.StdEncoding.EncodeToString(sum[:]) {
+			return "", newError(
+				http.StatusBadRequest, "BadDigest", "The SHA256 you specified did not match the calculated checksum.",
+			)
+		}
+	}
+	return checksum, nil
+}
+
+// objectFromHeaders reads the content type, metadata, tags and object lock settings of an object from the request.
+func objectFromHeaders(r *http.Request, b *bucket) (Object, *s3Error) {
+	object := Object{
+		ContentType: r.Header.Get("Content-Type"),
+		Metadata:    map[string]string{},
+	}
+	if object.ContentType == "" {
+		object.ContentType = "binary/octet-stream"
+	}
+	for name, values := range r.Header {
+		lowerName := strings.ToLower(name)
+		if strings.HasPrefix(lowerName, metadataHeaderPrefix) && len(values) > 0 {
+			object.Metadata[strings.TrimPrefix(lowerName, metadataHeaderPrefix)] = values[0]
+		}
+	}
+	if tagging := r.Header.Get("x-amz-tagging"); tagging != "" {
+		tags, err := url.ParseQuery(tagging)
+		if err != nil {
+			return Object{}, newError(http.StatusBadRequest, "InvalidArgument", "invalid tagging header")
+		}
+		object.Tags = map[string]string{}
+		for k, v := range tags {
+			object.Tags[k] = v[0]
+		}
+	}
+	object.ObjectLockMode = r.Header.Get("x-amz-object-lock-mode")
+	if retainUntil := r.Header.Get("x-amz-object-lock-retain-until-date"); retainUntil != "" {
+		var err error
+		if object.ObjectLockRetainUntilDate, err = time.Parse(time.RFC3339Nano, retainUntil); err != nil {
+			return Object{}, newError(http.StatusBadRequest, "InvalidArgument", "invalid retain until date")
+		}
+	}
+	object.ObjectLockLegalHold = r.Header.Get("x-amz-object-lock-legal-hold") == "ON"
+	if (object.ObjectLockMode == "") != object.ObjectLockRetainUntilDate.IsZero() {
+		return Object{}, newError(
+			http.StatusBadRequest,
+			"InvalidArgument",
+			"x-amz-object-lock-retain-until-date and x-amz-object-lock-mode must both be supplied",
+		)
+	}
+	if object.hasObjectLock() && !b.objectLock {
+		return Object{}, newError(
+			http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration",
+		)
+	}
+	return object, nil
+}
+
+func (o Object) hasObjectLock() bool {
+	return o.ObjectLockMode != "" || o.ObjectLockLegalHold
+}
+
+func (s *Server) putObject(
+	w http.ResponseWriter,
+	r *http.Request,
+	b *bucket,
+	bucketName string,
+	key string,
+	body []byte,
+) *s3Error {
+	object, err := objectFromHeaders(r, b)
+	if err != nil {
+		return err
+	}
+	if object.hasObjectLock() && r.Header.Get("Content-MD5") == "" {
+		return newError(
+			http.StatusBadRequest,
+			"InvalidRequest",
+			"Content-MD5 HTTP header is required for Put Object requests with Object Lock parameters",
+		)
+	}
+	if object.ChecksumSHA256, err = checkDigests(r, body); err != nil {
+		return err
+	}
+	object.Data = body
+	object.ETag = etag(body)
+	object.LastModified = time.Now()
+	if err := s.storeObject(b, bucketName, key, object); err != nil {
+		return newError(http.StatusInternalServerError, "InternalError", err.Error())
+	}
+	w.Header().Set("ETag", object.ETag)
+	return nil
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, b *bucket, bucketName string, key string) *s3Error {
+	copySource, parseErr := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+	if parseErr != nil {
+		return newError(http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+	}
+	sourceBucketName, sourceKey := splitPath(copySource)
+	sourceBucket, ok := s.buckets[sourceBucketName]
+	if !ok {
+		return errNoSuchBucket
+	}
+	source, ok := sourceBucket.objects[sourceKey]
+	if !ok {
+		return errNoSuchKey
+	}
+	data, getErr := s.blobs.get(objectBlobID(sourceBucketName, sourceKey))
+	if getErr != nil {
+		return newError(http.StatusInternalServerError, "InternalError", getErr.Error())
+	}
+	object, err := objectFromHeaders(r, b)
+	if err != nil {
+		return err
+	}
+	if r.Header.Get("x-amz-metadata-directive") != "REPLACE" {
+		object.ContentType = source.ContentType
+		object.Metadata = source.Metadata
+	}
+	if r.Header.Get("x-amz-tagging-directive") != "REPLACE" {
+		object.Tags = source.Tags
+	}
+	object.Data = data
+	object.ETag = source.ETag
+	object.ChecksumSHA256 = source.ChecksumSHA256
+	object.LastModified = time.Now()
+	if err := s.storeObject(b, bucketName, key, object); err != nil {
+		return newError(http.StatusInternalServerError, "InternalError", err.Error())
+	}
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string   `xml:"ETag"`
+		LastModified string   `xml:"LastModified"`
+	}{ETag: object.ETag, LastModified: object.LastModified.UTC().Format(isoTimeFormat)})
+	return nil
+}
+
+func (s *Server) getObject(
+	w http.ResponseWriter,
+	r *http.Request,
+	b *bucket,
+	bucketName string,
+	key string,
+	head bool,
+) *s3Error {
+	object, ok := b.objects[key]
+	if !ok {
+		return errNoSuchKey
+	}
+	data, getErr := s.blobs.get(objectBlobID(bucketName, key))
+	if getErr != nil {
+		return newError(http.StatusInternalServerError, "InternalError", getErr.Error())
+	}
+	header := w.Header()
+	header.Set("Content-Type", object.ContentType)
+	header.Set("ETag", object.ETag)
+	header.Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	for k, v := range object.Metadata {
+		header.Set(metadataHeaderPrefix+k, v)
+	}
+	if len(object.Tags) > 0 {
+		header.Set("x-amz-tagging-count", strconv.Itoa(len(object.Tags)))
+	}
+	if object.ObjectLockMode != "" {
+		header.Set("x-amz-object-lock-mode", object.ObjectLockMode)
+		header.Set("x-amz-object-lock-retain-until-date", object.ObjectLockRetainUntilDate.UTC().Format(isoTimeFormat))
+	}
+	if object.ObjectLockLegalHold {
+		header.Set("x-amz-object-lock-legal-hold", "ON")
+	}
+	status := http.StatusOK
+	if byteRange := r.Header.Get("Range"); byteRange != "" && !head {
+		start, end, err := parseRange(byteRange, int64(len(data)))
+		if err != nil {
+			return err
+		}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if !head {
+		_, _ = w.Write(data)
+	}
+	return nil
+}
+
+// parseRange parses a single HTTP byte range and returns the first and last byte.
+func parseRange(byteRange string, size int64) (int64, int64, *s3Error) {
+	invalid := newError(
+		http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable",
+	)
+	spec := strings.TrimPrefix(byteRange, "bytes=")
+	parts := strings.SplitN(spec, "-", 2)
+	if spec == byteRange || len(parts) != 2 || strings.Contains(spec, ",") {
+		return 0, 0, newError(http.StatusBadRequest, "InvalidArgument", "invalid range")
+	}
+	if parts[0] == "" {
+		suffix, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || suffix <= 0 || size == 0 {
+			return 0, 0, invalid
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, nil
+	}
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, invalid
+	}
+	end := size - 1
+	if parts[1] != "" {
+		if end, err = strconv.ParseInt(parts[1], 10, 64); err != nil || end < start {
+			return 0, 0, invalid
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, nil
+}
+
+type tagSet struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+func (s *Server) getObjectTagging(w http.ResponseWriter, b *bucket, key string) *s3Error {
+	object, ok := b.objects[key]
+	if !ok {
+		return errNoSuchKey
+	}
+	result := tagSet{}
+	for k, v := range object.Tags {
+		result.Tags = append(result.Tags, tag{Key: k, Value: v})
+	}
+	writeXML(w, result)
+	return nil
+}
+
+func (s *Server) putObjectTagging(b *bucket, key string, body []byte) *s3Error {
+	object, ok := b.objects[key]
+	if !ok {
+		return errNoSuchKey
+	}
+	request := tagSet{}
+	if err := xml.Unmarshal(body, &request); err != nil {
+		return newError(http.StatusBadRequest, "MalformedXML", err.Error())
+	}
+	object.Tags = map[string]string{}
+	for _, t := range request.Tags {
+		object.Tags[t.Key] = t.Value
+	}
+	return nil
+}
+
+func (s *Server) getObjectLockConfiguration(w http.ResponseWriter, b *bucket) *s3Error {
+	if !b.objectLock {
+		return newError(
+			http.StatusNotFound,
+			"ObjectLockConfigurationNotFoundError",
+			"Object Lock configuration does not exist for this bucket",
+		)
+	}
+	writeXML(w, struct {
+		XMLName           xml.Name `xml:"ObjectLockConfiguration"`
+		ObjectLockEnabled string   `xml:"ObjectLockEnabled"`
+	}{ObjectLockEnabled: "Enabled"})
+	return nil
+}
+
+type listEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type listObjectsV2Result struct {
+	XMLName               xml.Name    `xml:"ListBucketResult"`
+	Name                  string      `xml:"Name"`
+	Prefix                string      `xml:"Prefix"`
+	KeyCount              int         `xml:"KeyCount"`
+	MaxKeys               int         `xml:"MaxKeys"`
+	IsTruncated           bool        `xml:"IsTruncated"`
+	ContinuationToken     string      `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string      `xml:"NextContinuationToken,omitempty"`
+	Contents              []listEntry `xml:"Contents"`
+}
+
+// listObjectsV2 lists the objects in key order. The continuation token is the last returned key.
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, b *bucket, bucketName string) *s3Error {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	maxKeys := 1000
+	if value := query.Get("max-keys"); value != "" {
+		var err error
+		if maxKeys, err = strconv.Atoi(value); err != nil || maxKeys < 0 {
+			return newError(http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+		}
+	}
+	after := query.Get("start-after")
+	if token := query.Get("continuation-token"); token != "" {
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return newError(http.StatusBadRequest, "InvalidArgument", "invalid continuation token")
+		}
+		after = string(decoded)
+	}
+	result := listObjectsV2Result{
+		Name:              bucketName,
+		Prefix:            prefix,
+		MaxKeys:           maxKeys,
+		ContinuationToken: query.Get("continuation-token"),
+	}
+	for _, key := range b.sortedKeys() {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = true
+			lastKey := result.Contents[len(result.Contents)-1].Key
+			result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(lastKey))
+			break
+		}
+		object := b.objects[key]
+		result.Contents = append(result.Contents, listEntry{
+			Key:          key,
+			LastModified: object.LastModified.UTC().Format(isoTimeFormat),
+			ETag:         object.ETag,
+			Size:         object.size,
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	writeXML(w, result)
+	return nil
+}
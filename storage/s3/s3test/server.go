@@ -0,0 +1,272 @@
+package s3test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config is the configuration of the test server.
+type Config struct {
+	// Directory stores the object and part data in files in this directory instead of memory. The directory must
+	// exist.
+	Directory string
+	// Buckets are created when the server starts.
+	Buckets []Bucket
+	// MinPartSize is the minimum size of all parts of a multipart upload except the last one. Defaults to 5 MB like
+	// S3.
+	MinPartSize int64
+}
+
+// Bucket describes a bucket to create.
+type Bucket struct {
+	Name string
+	// ObjectLock enables S3 Object Lock for the bucket.
+	ObjectLock bool
+}
+
+// Object is an object stored in the test server.
+type Object struct {
+	Data        []byte
+	ContentType string
+	// Metadata holds the user metadata with lowercase keys without the x-amz-meta- prefix.
+	Metadata map[string]string
+	Tags     map[string]string
+	// LastModified is set to the current time when the object is written through the API, or when it is stored
+	// with PutObject without a modification time.
+	LastModified time.Time
+	// ETag is calculated by the server.
+	ETag string
+	// ChecksumSHA256 is the base64-encoded SHA-256 checksum sent by the client, if any. For multipart uploads it is
+	// the checksum of the part checksums with the number of parts appended.
+	ChecksumSHA256 string
+
+	ObjectLockMode            string
+	ObjectLockRetainUntilDate time.Time
+	ObjectLockLegalHold       bool
+
+	size int64
+}
+
+// Request is a request received by the test server.
+type Request struct {
+	Operation Operation
+	Bucket    string
+	Key       string
+	// Query holds the query parameters of the request.
+	Query map[string][]string
+	// AccessKey is the access key the request was signed with.
+	AccessKey string
+	// BodySize is the number of bytes received in the request body.
+	BodySize int64
+}
+
+// Server is an in-memory S3-compatible server for testing S3 integrations offline. It implements the single and
+// multipart uploads, object reads, listings, tagging and object lock headers the audit log storage uses, and can
+// inject errors and delays into responses. Clients must use path-style access. Signatures are not checked.
+type Server struct {
+	httpServer  *httptest.Server
+	minPartSize int64
+
+	lock         sync.Mutex
+	blobs        blobStore
+	buckets      map[string]*bucket
+	uploads      map[string]*multipartUpload
+	nextUploadID int
+	faults       []*faultState
+	requests     []Request
+}
+
+type bucket struct {
+	objectLock bool
+	objects    map[string]*Object
+}
+
+// NewServer starts a test server. The server must be stopped with Close.
+func NewServer(config Config) (*Server, error) {
+	var blobs blobStore = newMemoryBlobStore()
+	if config.Directory != "" {
+		stat, err := os.Stat(config.Directory)
+		if err != nil {
+			return nil, fmt.Errorf("invalid test server directory %s (%w)", config.Directory, err)
+		}
+		if !stat.IsDir() {
+			return nil, fmt.Errorf("invalid test server directory %s (not a directory)", config.Directory)
+		}
+		blobs = newDirectoryBlobStore(config.Directory)
+	}
+	minPartSize := config.MinPartSize
+	if minPartSize == 0 {
+		minPartSize = 5 * 1024 * 1024
+	}
+	s := &Server{
+		minPartSize: minPartSize,
+		blobs:       blobs,
+		buckets:     map[string]*bucket{},
+		uploads:     map[string]*multipartUpload{},
+	}
+	for _, b := range config.Buckets {
+		s.CreateBucket(b.Name, b.ObjectLock)
+	}
+	s.httpServer = httptest.NewServer(s)
+	return s, nil
+}
+
+// URL returns the endpoint of the server.
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+// Close stops the server and removes the stored data.
+func (s *Server) Close() {
+	s.httpServer.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for bucketName, b := range s.buckets {
+		for key := range b.objects {
+			s.blobs.remove(objectBlobID(bucketName, key))
+		}
+	}
+	for uploadID, upload := range s.uploads {
+		for partNumber := range upload.parts {
+			s.blobs.remove(partBlobID(uploadID, partNumber))
+		}
+	}
+}
+
+// CreateBucket creates a bucket if it does not exist yet.
+func (s *Server) CreateBucket(name string, objectLock bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = &bucket{objectLock: objectLock, objects: map[string]*Object{}}
+	}
+}
+
+// PutObject stores an object in an existing bucket, for example to prepare a test. The ETag is calculated from the
+// data.
+func (s *Server) PutObject(bucketName string, key string, object Object) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+	if object.LastModified.IsZero() {
+		object.LastModified = time.Now()
+	}
+	object.ETag = etag(object.Data)
+	return s.storeObject(b, bucketName, key, object)
+}
+
+// GetObject returns a copy of a stored object.
+func (s *Server) GetObject(bucketName string, key string) (Object, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return Object{}, false
+	}
+	object, ok := b.objects[key]
+	if !ok {
+		return Object{}, false
+	}
+	result := *object
+	data, err := s.blobs.get(objectBlobID(bucketName, key))
+	if err != nil {
+		return Object{}, false
+	}
+	result.Data = data
+	result.Metadata = copyMap(object.Metadata)
+	result.Tags = copyMap(object.Tags)
+	return result, true
+}
+
+// Keys returns the sorted keys of the objects in a bucket.
+func (s *Server) Keys(bucketName string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil
+	}
+	return b.sortedKeys()
+}
+
+// MultipartUploads returns the number of multipart uploads that have been created, but not completed or aborted.
+func (s *Server) MultipartUploads() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.uploads)
+}
+
+// Requests returns the requests received so far, in order of arrival.
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestCount returns the number of requests received for an operation.
+func (s *Server) RequestCount(operation Operation) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	count := 0
+	for _, request := range s.requests {
+		if request.Operation == operation {
+			count++
+		}
+	}
+	return count
+}
+
+// ReceivedBytes returns the number of request body bytes received for an operation, or for all operations if
+// operation is empty.
+func (s *Server) ReceivedBytes(operation Operation) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	received := int64(0)
+	for _, request := range s.requests {
+		if operation == "" || request.Operation == operation {
+			received += request.BodySize
+		}
+	}
+	return received
+}
+
+// storeObject stores the object data in the blob store and the rest of the object in the bucket. The data field of
+// the stored object is cleared.
+func (s *Server) storeObject(b *bucket, bucketName string, key string, object Object) error {
+	if err := s.blobs.put(objectBlobID(bucketName, key), object.Data); err != nil {
+		return err
+	}
+	object.size = int64(len(object.Data))
+	object.Data = nil
+	object.Metadata = copyMap(object.Metadata)
+	object.Tags = copyMap(object.Tags)
+	b.objects[key] = &object
+	return nil
+}
+
+func (b *bucket) sortedKeys() []string {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func copyMap(source map[string]string) map[string]string {
+	if source == nil {
+		return nil
+	}
+	result := make(map[string]string, len(source))
+	for k, v := range source {
+		result[k] = v
+	}
+	return result
+}
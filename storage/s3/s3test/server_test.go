@@ -0,0 +1,111 @@
+package s3test_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+)
+
+func newServer(t *testing.T, config s3test.Config) *s3test.Server {
+	server, err := s3test.NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, url string, header http.Header) (int, string) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header = header
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, string(body)
+}
+
+func TestFaultSkipAndCount(t *testing.T) {
+	server := newServer(t, s3test.Config{Buckets: []s3test.Bucket{{Name: "test"}}})
+	assert.NoError(t, server.PutObject("test", "foo", s3test.Object{Data: []byte("Hello world!")}))
+	server.InjectFault(s3test.Fault{
+		Operation:  s3test.OperationGetObject,
+		Skip:       1,
+		Count:      2,
+		StatusCode: http.StatusServiceUnavailable,
+		Code:       "SlowDown",
+	})
+
+	var statusCodes []int
+	for i := 0; i < 4; i++ {
+		statusCode, _ := get(t, server.URL()+"/test/foo", http.Header{})
+		statusCodes = append(statusCodes, statusCode)
+	}
+	assert.Equal(t, []int{200, 503, 503, 200}, statusCodes)
+	assert.Equal(t, 4, server.RequestCount(s3test.OperationGetObject))
+}
+
+func TestRangeRequest(t *testing.T) {
+	server := newServer(t, s3test.Config{Buckets: []s3test.Bucket{{Name: "test"}}})
+	assert.NoError(t, server.PutObject("test", "foo", s3test.Object{Data: []byte("Hello world!")}))
+
+	statusCode, body := get(t, server.URL()+"/test/foo", http.Header{"Range": []string{"bytes=6-10"}})
+	assert.Equal(t, http.StatusPartialContent, statusCode)
+	assert.Equal(t, "world", body)
+
+	statusCode, _ = get(t, server.URL()+"/test/foo", http.Header{"Range": []string{"bytes=20-"}})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, statusCode)
+
+	statusCode, _ = get(t, server.URL()+"/test/bar", http.Header{})
+	assert.Equal(t, http.StatusNotFound, statusCode)
+}
+
+func TestDirectoryStorage(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-s3test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	server, err := s3test.NewServer(s3test.Config{Directory: dir, Buckets: []s3test.Bucket{{Name: "test"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, server.PutObject("test", "foo/bar", s3test.Object{Data: []byte("Hello world!")}))
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(files))
+
+	object, ok := server.GetObject("test", "foo/bar")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("Hello world!"), object.Data)
+
+	server.Close()
+	files, err = ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(files))
+
+	_, err = s3test.NewServer(s3test.Config{Directory: dir + "/missing"})
+	assert.Error(t, err)
+}
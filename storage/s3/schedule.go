@@ -0,0 +1,183 @@
+package s3
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeWindow is a daily time window, for example outside business hours.
+type TimeWindow struct {
+	// Start is the start of the window in HH:MM format.
+	Start string `json:"start" yaml:"start"`
+	// End is the end of the window in HH:MM format. If the end is before the start the window spans midnight. If the end
+	// equals the start the window spans the whole day.
+	End string `json:"end" yaml:"end"`
+	// Days lists the days of the week the window applies on, for example "sat" and "sun". The window applies on every
+	// day if empty. Windows spanning midnight apply by the day of the current time, not the day the window started.
+	Days []string `json:"days" yaml:"days"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type parsedWindow struct {
+	start int
+	end   int
+	days  map[time.Weekday]bool
+}
+
+func (w TimeWindow) parse() (parsedWindow, error) {
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return parsedWindow{}, fmt.Errorf("invalid start (%w)", err)
+	}
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return parsedWindow{}, fmt.Errorf("invalid end (%w)", err)
+	}
+	result := parsedWindow{start: start, end: end}
+	if len(w.Days) > 0 {
+		result.days = map[time.Weekday]bool{}
+		for _, day := range w.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return parsedWindow{}, fmt.Errorf("invalid day: %s", day)
+			}
+			result.days[weekday] = true
+		}
+	}
+	return result, nil
+}
+
+// parseTimeOfDay returns the minutes since midnight.
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s (must be in HH:MM format)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w parsedWindow) contains(now time.Time) bool {
+	if w.days != nil && !w.days[now.Weekday()] {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if w.start == w.end {
+		return true
+	}
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// schedule decides when intermediate parts are uploaded.
+type schedule struct {
+	windows  []parsedWindow
+	location *time.Location
+}
+
+func newSchedule(bandwidth Bandwidth) schedule {
+	// The configuration is validated before the storage is created.
+	location, err := bandwidth.location()
+	if err != nil {
+		location = time.Local
+	}
+	result := schedule{location: location}
+	for _, window := range bandwidth.IntermediateSchedule {
+		if parsed, err := window.parse(); err == nil {
+			result.windows = append(result.windows, parsed)
+		}
+	}
+	return result
+}
+
+// allowsIntermediate returns true if intermediate parts may be uploaded at the specified time.
+func (s schedule) allowsIntermediate(now time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+	now = now.In(s.location)
+	for _, window := range s.windows {
+		if window.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleCheckInterval is the interval at which an upload waiting for the intermediate schedule checks the time.
+const scheduleCheckInterval = 30 * time.Second
+
+// waitIntermediateWindow blocks an unfinished audit log until intermediate parts may be uploaded, the audit log is
+// finished or evicted, or shutdown is requested.
+func (q *uploadQueue) waitIntermediateWindow(entry *queueEntry) {
+	for !entry.isFinished() && !q.schedule.allowsIntermediate(q.clock.Now()) {
+		select {
+		case <-entry.partAvailable:
+		case <-time.After(scheduleCheckInterval):
+		case <-entry.evicted:
+			return
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// newUploadSlots creates a semaphore limiting the number of parallel uploads. Audit logs that are finished get the
+// free slots before audit logs that are still being written.
+func newUploadSlots(slots uint) *uploadSlots {
+	lock := &sync.Mutex{}
+	return &uploadSlots{
+		lock: lock,
+		cond: sync.NewCond(lock),
+		free: slots,
+	}
+}
+
+type uploadSlots struct {
+	lock           *sync.Mutex
+	cond           *sync.Cond
+	free           uint
+	waitingPrimary uint
+}
+
+// acquire waits for a free slot. Primary uploads are served first.
+func (u *uploadSlots) acquire(primary bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if !primary {
+		for u.free == 0 || u.waitingPrimary > 0 {
+			u.cond.Wait()
+		}
+		u.free--
+		return
+	}
+	u.waitingPrimary++
+	for u.free == 0 {
+		u.cond.Wait()
+	}
+	u.free--
+	u.waitingPrimary--
+	if u.waitingPrimary == 0 && u.free > 0 {
+		// Wake up the secondary uploads waiting for the primary uploads to be served.
+		u.cond.Broadcast()
+	}
+}
+
+func (u *uploadSlots) release() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.free++
+	u.cond.Broadcast()
+}
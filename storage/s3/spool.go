@@ -0,0 +1,318 @@
+package s3
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/metrics"
+	"github.com/containerssh/auditlog/storage"
+)
+
+// SpoolFullAction describes what happens when the local directory exceeds the spool limits.
+type SpoolFullAction string
+
+const (
+	// SpoolFullReject rejects new audit logs. The logger refuses the connection.
+	SpoolFullReject SpoolFullAction = "reject"
+	// SpoolFullDropIO accepts new audit logs, but stops recording the I/O of all connections until the spool is below
+	// the limits again. The audit logs missing I/O carry the number of suspensions in their iosuspended metadata.
+	SpoolFullDropIO SpoolFullAction = "dropIO"
+	// SpoolFullEvict removes the oldest finished audit logs waiting for upload to make room for new audit logs. The
+	// evicted audit logs are lost. New audit logs are rejected if there is nothing to evict.
+	SpoolFullEvict SpoolFullAction = "evict"
+)
+
+// Validate checks the spool full action.
+func (s SpoolFullAction) Validate() error {
+	switch s {
+	case "":
+	case SpoolFullReject:
+	case SpoolFullDropIO:
+	case SpoolFullEvict:
+	default:
+		return fmt.Errorf("invalid spool full action: %s", s)
+	}
+	return nil
+}
+
+// Spool limits how much the local directory can accumulate while audit logs are not uploaded fast enough.
+type Spool struct {
+	// MaxBytes is the disk space the audit logs in the local directory and the quarantine directory may use. Not limited
+	// if 0.
+	MaxBytes uint64 `json:"maxBytes" yaml:"maxBytes"`
+	// MaxPending is the number of audit logs that may be written or waiting for upload at the same time. Not limited
+	// if 0.
+	MaxPending uint `json:"maxPending" yaml:"maxPending"`
+	// WarnBytes is the disk space used in the local directory above which a warning is logged. Not checked if 0.
+	WarnBytes uint64 `json:"warnBytes" yaml:"warnBytes"`
+	// WarnPending is the number of pending audit logs above which a warning is logged. Not checked if 0.
+	WarnPending uint `json:"warnPending" yaml:"warnPending"`
+	// FullAction is the action taken when a limit is exceeded.
+	FullAction SpoolFullAction `json:"fullAction" yaml:"fullAction" default:"reject"`
+}
+
+// Validate validates the spool configuration.
+func (s Spool) Validate() error {
+	if s.MaxBytes != 0 && s.WarnBytes > s.MaxBytes {
+		return fmt.Errorf("spool warning threshold %d bytes is higher than the limit %d bytes", s.WarnBytes, s.MaxBytes)
+	}
+	if s.MaxPending != 0 && s.WarnPending > s.MaxPending {
+		return fmt.Errorf(
+			"spool warning threshold %d audit logs is higher than the limit %d audit logs",
+			s.WarnPending,
+			s.MaxPending,
+		)
+	}
+	return s.FullAction.Validate()
+}
+
+// limited returns true if a limit or warning threshold is configured and the spool must be checked frequently.
+func (s Spool) limited() bool {
+	return s.MaxBytes != 0 || s.MaxPending != 0 || s.WarnBytes != 0 || s.WarnPending != 0
+}
+
+// exceeded returns true if the usage exceeds the limits after adding the specified number of audit logs.
+func (s Spool) exceeded(usage spoolUsage, newAuditLogs uint) bool {
+	if s.MaxBytes != 0 && usage.bytes >= s.MaxBytes {
+		return true
+	}
+	return s.MaxPending != 0 && usage.pending+newAuditLogs > s.MaxPending
+}
+
+// warning returns true if the usage exceeds a warning threshold.
+func (s Spool) warning(usage spoolUsage) bool {
+	if s.WarnBytes != 0 && usage.bytes >= s.WarnBytes {
+		return true
+	}
+	return s.WarnPending != 0 && usage.pending > s.WarnPending
+}
+
+type spoolUsage struct {
+	// bytes is the disk space used, including the quarantined audit logs.
+	bytes uint64
+	// quarantinedBytes is the disk space used by the quarantined audit logs, which cannot be evicted.
+	quarantinedBytes uint64
+	pending          uint
+}
+
+// spoolState tracks which thresholds the spool exceeds so crossing a threshold is only logged once.
+type spoolState struct {
+	lock    *sync.Mutex
+	warning bool
+	full    bool
+}
+
+const (
+	// spoolMetricsInterval is the interval at which the disk usage of the local directory is measured while no spool
+	// limits are configured.
+	spoolMetricsInterval = 10 * time.Second
+	// spoolCheckInterval is the interval at which the disk usage of the local directory is measured while spool limits
+	// are configured.
+	spoolCheckInterval = time.Second
+)
+
+// spoolLoop measures the spool periodically until shutdown is requested.
+func (q *uploadQueue) spoolLoop() {
+	defer q.wg.Done()
+	interval := spoolMetricsInterval
+	if q.spool.limited() {
+		interval = spoolCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		q.updateSpool()
+		select {
+		case <-ticker.C:
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// getSpoolUsage returns the number of pending audit logs and the disk space used by the files in the local directory
+// and the quarantine directory. The quarantined audit logs are only removed manually, so they count towards the limit
+// to keep them from filling up the disk.
+func (q *uploadQueue) getSpoolUsage() spoolUsage {
+	usage := spoolUsage{}
+	q.queue.Range(func(_, value interface{}) bool {
+		if !value.(*queueEntry).isEvicted() {
+			usage.pending++
+		}
+		return true
+	})
+	usage.bytes = getDirectorySize(q.directory)
+	if q.retry.GiveUp == GiveUpQuarantine && path.Clean(q.retry.QuarantineDirectory) != path.Clean(q.directory) {
+		usage.quarantinedBytes = getDirectorySize(q.retry.QuarantineDirectory)
+		usage.bytes += usage.quarantinedBytes
+	}
+	return usage
+}
+
+// getDirectorySize returns the size of the files in the directory, not including subdirectories.
+func getDirectorySize(directory string) uint64 {
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return 0
+	}
+	size := uint64(0)
+	for _, file := range files {
+		if !file.IsDir() {
+			size += uint64(file.Size())
+		}
+	}
+	return size
+}
+
+// updateSpool measures the spool, updates the metrics and logs a warning when a threshold is crossed.
+func (q *uploadQueue) updateSpool() spoolUsage {
+	usage := q.getSpoolUsage()
+	bucket := metrics.Label{Name: "bucket", Value: q.bucket}
+	q.metrics.Set(metrics.S3QueueLength, float64(usage.pending), bucket)
+	q.metrics.Set(metrics.S3SpoolBytes, float64(usage.bytes), bucket)
+
+	warning := q.spool.warning(usage)
+	full := q.spool.exceeded(usage, 0)
+	q.spoolState.lock.Lock()
+	defer q.spoolState.lock.Unlock()
+	if warning && !q.spoolState.warning {
+		q.logger.Warning(log.NewMessage(
+			codes.ES3SpoolWarning,
+			"the local directory %s holds %d audit logs using %d bytes waiting for upload",
+			q.directory,
+			usage.pending,
+			usage.bytes,
+		))
+	}
+	if full && !q.spoolState.full {
+		q.logger.Warning(log.NewMessage(
+			codes.ES3SpoolFull,
+			"the local directory %s exceeds the spool limits with %d audit logs using %d bytes (action: %s)",
+			q.directory,
+			usage.pending,
+			usage.bytes,
+			q.spool.FullAction,
+		))
+	}
+	q.spoolState.warning = warning
+	q.spoolState.full = full
+	return usage
+}
+
+// acceptsIO returns false if I/O should not be recorded because the spool is full and the full action is dropIO.
+func (q *uploadQueue) acceptsIO() bool {
+	if q.spool.FullAction != SpoolFullDropIO {
+		return true
+	}
+	q.spoolState.lock.Lock()
+	defer q.spoolState.lock.Unlock()
+	return !q.spoolState.full
+}
+
+// reserveSpool checks if a new audit log fits in the spool, evicting old audit logs if configured. Returns an error if
+// the audit log must be rejected.
+func (q *uploadQueue) reserveSpool(name string) error {
+	if !q.spool.limited() {
+		return nil
+	}
+	usage := q.updateSpool()
+	if !q.spool.exceeded(usage, 1) {
+		return nil
+	}
+	switch q.spool.FullAction {
+	case SpoolFullDropIO:
+		return nil
+	case SpoolFullEvict:
+		if usage = q.evict(usage); !q.spool.exceeded(usage, 1) {
+			return nil
+		}
+	}
+	q.metrics.Add(metrics.S3SpoolRejectedTotal, 1)
+	return log.NewMessage(
+		codes.ES3SpoolFull,
+		"rejecting audit log %s, the local directory %s exceeds the spool limits with %d audit logs using %d bytes",
+		name,
+		q.directory,
+		usage.pending,
+		usage.bytes,
+	).Label("log", name)
+}
+
+// evict evicts the oldest finished audit logs until the usage is below the limits with room for a new audit log.
+// Returns the usage expected after the evicted audit logs are removed.
+func (q *uploadQueue) evict(usage spoolUsage) spoolUsage {
+	if q.spool.MaxBytes != 0 && usage.quarantinedBytes >= q.spool.MaxBytes {
+		// Evicting would lose audit logs without making room.
+		return usage
+	}
+	type candidate struct {
+		entry   *queueEntry
+		size    uint64
+		modTime time.Time
+	}
+	var candidates []candidate
+	q.queue.Range(func(_, value interface{}) bool {
+		entry := value.(*queueEntry)
+		if !entry.isFinished() || entry.isEvicted() {
+			return true
+		}
+		stat, err := os.Stat(entry.file)
+		if err != nil {
+			return true
+		}
+		size := uint64(stat.Size())
+		if metadataStat, err := os.Stat(entry.file + ".metadata.json"); err == nil {
+			size += uint64(metadataStat.Size())
+		}
+		candidates = append(candidates, candidate{entry: entry, size: size, modTime: stat.ModTime()})
+		return true
+	})
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].modTime.Before(candidates[j].modTime)
+	})
+	for _, c := range candidates {
+		if !q.spool.exceeded(usage, 1) {
+			break
+		}
+		c.entry.evict()
+		q.metrics.Add(metrics.S3SpoolEvictedTotal, 1)
+		q.logger.Warning(log.NewMessage(
+			codes.ES3SpoolEvicted,
+			"evicting audit log %s from the local directory %s before upload, the spool limits are exceeded",
+			c.entry.name,
+			q.directory,
+		).Label("log", c.entry.name))
+		if usage.bytes > c.size {
+			usage.bytes -= c.size
+		} else {
+			usage.bytes = 0
+		}
+		usage.pending--
+	}
+	return usage
+}
+
+// checkSpool reports the spool usage as a health check.
+func (q *uploadQueue) checkSpool() storage.HealthCheckResult {
+	usage := q.getSpoolUsage()
+	result := storage.HealthCheckResult{
+		Name:    "s3.spool",
+		Status:  storage.HealthStatusHealthy,
+		Message: fmt.Sprintf("%d audit logs using %d bytes", usage.pending, usage.bytes),
+	}
+	switch {
+	case q.spool.exceeded(usage, 0):
+		result.Status = storage.HealthStatusUnhealthy
+	case q.spool.warning(usage):
+		result.Status = storage.HealthStatusDegraded
+	}
+	return result
+}
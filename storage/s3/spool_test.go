@@ -0,0 +1,245 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/metrics/prometheus"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+)
+
+// setupSpoolStorage creates an S3 storage with the spool configuration whose uploads always fail, so the audit logs
+// stay in the local directory.
+func setupSpoolStorage(t *testing.T, spool s3.Spool) (storage.ReadWriteStorage, string) {
+	server := newS3Server(t)
+	server.InjectFault(s3test.Fault{StatusCode: http.StatusBadRequest, Code: "InvalidRequest"})
+	config := newS3Config(t, server)
+	config.ParallelUploads = 10
+	config.Retry = s3.Retry{
+		InitialBackoff:      time.Hour,
+		MaxBackoff:          time.Hour,
+		ShutdownMaxAttempts: 1,
+		GiveUp:              s3.GiveUpKeep,
+	}
+	config.Spool = spool
+	st := newS3Storage(t, config)
+	t.Cleanup(func() {
+		st.Shutdown(context.Background())
+	})
+	return st, config.Local
+}
+
+func writeAuditLog(t *testing.T, st storage.WritableStorage, name string, data []byte) {
+	writer, err := st.OpenWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolReject(t *testing.T) {
+	st, _ := setupSpoolStorage(t, s3.Spool{MaxPending: 2})
+
+	writeAuditLog(t, st, "test1", []byte("Hello world!"))
+	writeAuditLog(t, st, "test2", []byte("Hello world!"))
+	_, err := st.OpenWriter("test3")
+	assert.Error(t, err)
+
+	health := storage.HealthCheck(context.Background(), st)
+	assert.False(t, health.Healthy())
+}
+
+func TestSpoolConcurrentReject(t *testing.T) {
+	st, _ := setupSpoolStorage(t, s3.Spool{MaxPending: 5})
+
+	writers := make(chan storage.Writer, 50)
+	start := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if writer, err := st.OpenWriter(fmt.Sprintf("test%d", i)); err == nil {
+				writers <- writer
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(writers)
+
+	// Only as many audit logs as the limit allows are accepted, even if they are opened at the same time.
+	opened := 0
+	for writer := range writers {
+		opened++
+		_, _ = writer.Write([]byte("Hello world!"))
+		assert.NoError(t, writer.Close())
+	}
+	assert.Equal(t, 5, opened)
+}
+
+func TestSpoolEvict(t *testing.T) {
+	st, dir := setupSpoolStorage(t, s3.Spool{MaxPending: 2, FullAction: s3.SpoolFullEvict})
+
+	writeAuditLog(t, st, "test1", []byte("Hello world!"))
+	time.Sleep(10 * time.Millisecond)
+	writeAuditLog(t, st, "test2", []byte("Hello world!"))
+
+	var writer storage.Writer
+	assert.Eventually(t, func() bool {
+		var err error
+		// The audit logs can only be evicted once they are finished in the background.
+		writer, err = st.OpenWriter("test3")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	if writer == nil {
+		return
+	}
+	defer func() {
+		_ = writer.Close()
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(path.Join(dir, "test1"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err := os.Stat(path.Join(dir, "test2"))
+	assert.NoError(t, err)
+}
+
+func TestSpoolDropIO(t *testing.T) {
+	st, dir := setupSpoolStorage(t, s3.Spool{MaxBytes: 10, FullAction: s3.SpoolFullDropIO})
+
+	writer, err := st.OpenWriter("test1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, writer.(storage.IOFilterWriter).AcceptsIO())
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatal(err)
+	}
+
+	writer2, err := st.OpenWriter("test2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, writer.(storage.IOFilterWriter).AcceptsIO())
+	assert.False(t, writer.(storage.IOFilterWriter).AcceptsIO())
+	assert.False(t, writer2.(storage.IOFilterWriter).AcceptsIO())
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, writer2.Close())
+
+	// The suspension is recorded once in the metadata of the audit log.
+	metadata, err := ioutil.ReadFile(path.Join(dir, "test1.metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(metadata), `"ioSuspensions":1`)
+}
+
+func TestSpoolQuarantine(t *testing.T) {
+	config := newS3Config(t, newS3Server(t))
+	config.Spool = s3.Spool{MaxBytes: 100, FullAction: s3.SpoolFullReject}
+	// An audit log quarantined in a previous run uses up the spool.
+	quarantine := path.Join(config.Local, "quarantine")
+	if err := os.Mkdir(quarantine, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(quarantine, "old"), bytes.Repeat([]byte("a"), 200), 0600); err != nil {
+		t.Fatal(err)
+	}
+	st := newS3Storage(t, config)
+	t.Cleanup(func() {
+		st.Shutdown(context.Background())
+	})
+
+	_, err := st.OpenWriter("test")
+	assert.Error(t, err)
+}
+
+func TestSpoolQuarantineNoEviction(t *testing.T) {
+	server := newS3Server(t)
+	server.InjectFault(s3test.Fault{StatusCode: http.StatusInternalServerError})
+	config := newS3Config(t, server)
+	config.Retry = s3.Retry{InitialBackoff: time.Hour, MaxBackoff: time.Hour, ShutdownMaxAttempts: 1}
+	config.Spool = s3.Spool{MaxBytes: 100, FullAction: s3.SpoolFullEvict}
+	st := newS3Storage(t, config)
+	t.Cleanup(func() {
+		st.Shutdown(context.Background())
+	})
+	writeAuditLog(t, st, "test1", []byte("Hello world!"))
+
+	quarantine := path.Join(config.Local, "quarantine")
+	if err := os.Mkdir(quarantine, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(quarantine, "old"), bytes.Repeat([]byte("a"), 200), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Evicting the pending audit log would not make room, so it is kept, also once it is finished in the background.
+	assert.Never(t, func() bool {
+		if _, err := st.OpenWriter("test2"); err == nil {
+			return true
+		}
+		_, err := os.Stat(path.Join(config.Local, "test1"))
+		return os.IsNotExist(err)
+	}, 300*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestSpoolConfig(t *testing.T) {
+	assert.Error(t, s3.Spool{MaxBytes: 10, WarnBytes: 20}.Validate())
+	assert.Error(t, s3.Spool{MaxPending: 10, WarnPending: 20}.Validate())
+	assert.Error(t, s3.Spool{FullAction: "panic"}.Validate())
+	assert.NoError(t, s3.Spool{MaxBytes: 20, WarnBytes: 10, FullAction: s3.SpoolFullEvict}.Validate())
+}
+
+func TestSpoolMetrics(t *testing.T) {
+	server := newS3Server(t)
+	server.InjectFault(s3test.Fault{StatusCode: http.StatusBadRequest, Code: "InvalidRequest"})
+	config := newS3Config(t, server)
+	config.Retry = s3.Retry{
+		InitialBackoff:      time.Hour,
+		MaxBackoff:          time.Hour,
+		ShutdownMaxAttempts: 1,
+		GiveUp:              s3.GiveUpKeep,
+	}
+	collector := prometheus.NewCollector()
+	st, err := s3.NewStorage(config, log.NewTestLogger(t), s3.WithMetrics(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		st.Shutdown(context.Background())
+	})
+
+	writeAuditLog(t, st, "test1", []byte("Hello world!"))
+
+	assert.Eventually(t, func() bool {
+		output := &bytes.Buffer{}
+		if _, err := collector.WriteTo(output); err != nil {
+			return false
+		}
+		return strings.Contains(output.String(), "containerssh_auditlog_s3_queue_length{bucket=\"auditlog\"} 1\n")
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,93 @@
+package s3
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxTagValueLength is the maximum length of an S3 object tag value.
+const maxTagValueLength = 256
+
+const (
+	outcomeUnauthenticated = "unauthenticated"
+	outcomeSuccess         = "success"
+	outcomeFailure         = "failure"
+	outcomeIncomplete      = "incomplete"
+)
+
+func (meta queueEntryMetadata) outcome() string {
+	switch {
+	case !meta.Authenticated:
+		return outcomeUnauthenticated
+	case meta.EndTime == 0:
+		return outcomeIncomplete
+	case meta.ExitStatus != nil && *meta.ExitStatus != 0:
+		return outcomeFailure
+	default:
+		return outcomeSuccess
+	}
+}
+
+// ToTags returns the S3 object tags for the audit log as configured.
+func (meta queueEntryMetadata) ToTags(tags Tags) []*s3.Tag {
+	var result []*s3.Tag
+	if tags.Username && meta.Authenticated {
+		result = append(result, &s3.Tag{Key: aws.String("username"), Value: aws.String(tagValue(meta.Username))})
+	}
+	if tags.Country {
+		result = append(result, &s3.Tag{Key: aws.String("country"), Value: aws.String(tagValue(meta.Country))})
+	}
+	if tags.Outcome {
+		result = append(result, &s3.Tag{Key: aws.String("outcome"), Value: aws.String(meta.outcome())})
+	}
+	if tags.AuthMethods && len(meta.AuthMethods) > 0 {
+		result = append(
+			result,
+			&s3.Tag{Key: aws.String("authmethods"), Value: aws.String(tagValue(strings.Join(meta.AuthMethods, "+")))},
+		)
+	}
+	return result
+}
+
+// tagging returns the tags in the URL-encoded form required by the x-amz-tagging header, or nil if there are no tags.
+func tagging(tags []*s3.Tag) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	for _, tag := range tags {
+		values.Set(*tag.Key, *tag.Value)
+	}
+	return aws.String(values.Encode())
+}
+
+// equalTags returns true if both tag sets contain the same tags in the same order.
+func equalTags(a []*s3.Tag, b []*s3.Tag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i].Key != *b[i].Key || *a[i].Value != *b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// tagValue replaces the characters not allowed in S3 tag values and truncates the value to the maximum length.
+func tagValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(" +-=._:/@", r):
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+	return truncate(value, maxTagValueLength)
+}
@@ -1,7 +1,11 @@
 package s3
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"io"
+	"net/url"
 	"os"
 	"time"
 
@@ -11,19 +15,26 @@ import (
 	"github.com/containerssh/log"
 
 	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/metrics"
 )
 
-func (q *uploadQueue) initializeMultiPartUpload(s3Connection *s3.S3, name string, metadata queueEntryMetadata) (*string, error) {
+func (q *uploadQueue) initializeMultiPartUpload(s3Connection *s3.S3, name string, entry *queueEntry) (*string, error) {
 	q.logger.Debug(
 		log.NewMessage(codes.MMultipartUpload, "initializing multipart upload for audit log %s...", name),
 	)
-	multipartUpload, err := s3Connection.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
-		ACL:         q.acl,
-		Bucket:      aws.String(q.bucket),
-		ContentType: aws.String("application/octet-stream"),
-		Key:         aws.String(name),
-		Metadata:    metadata.ToMap(q.metadataUsername, q.metadataIP),
-	})
+	metadata := entry.getMetadata()
+	tags := metadata.ToTags(q.tags)
+	multipartUpload, err := s3Connection.CreateMultipartUploadWithContext(context.Background(), &s3.CreateMultipartUploadInput{
+		ACL:                       q.acl,
+		Bucket:                    aws.String(q.bucket),
+		ContentType:               metadata.getContentType(),
+		Key:                       aws.String(name),
+		Metadata:                  metadata.ToMap(q.metadataUsername, q.metadataIP),
+		ObjectLockMode:            q.objectLock.Mode.s3Mode(),
+		ObjectLockRetainUntilDate: q.objectLock.retainUntil(metadata.StartTime, q.clock.Now()),
+		ObjectLockLegalHoldStatus: q.objectLock.legalHoldStatus(),
+		Tagging:                   tagging(tags),
+	}, q.withChecksumAlgorithm())
 	if err != nil {
 		return nil, log.Wrap(
 			err,
@@ -31,6 +42,7 @@ func (q *uploadQueue) initializeMultiPartUpload(s3Connection *s3.S3, name string
 			"failed to initialize multipart upload",
 		)
 	}
+	entry.createdTags = tags
 	return multipartUpload.UploadId, nil
 }
 
@@ -39,7 +51,7 @@ func (q *uploadQueue) processMultiPartUploadPart(
 	name string,
 	uploadID string,
 	partNumber int64,
-	handle *os.File,
+	entry *queueEntry,
 	startingByte int64,
 	endingByte int64,
 ) (int64, string, error) {
@@ -53,16 +65,39 @@ func (q *uploadQueue) processMultiPartUploadPart(
 		),
 	)
 	contentLength := endingByte - startingByte
-	response, err := s3Connection.UploadPart(&s3.UploadPartInput{
+	handle := entry.readHandle
+	digest, err := partChecksum(handle, startingByte, contentLength)
+	if err != nil {
+		return 0, "", log.Wrap(err,
+			codes.EChecksumFailed,
+			"failed to calculate the SHA-256 checksum for part %d of audit log file %s",
+			partNumber,
+			name,
+		)
+	}
+	var md5 *string
+	if q.objectLock.Enabled() {
+		if md5, err = contentMD5(io.NewSectionReader(handle, startingByte, contentLength)); err != nil {
+			return 0, "", log.Wrap(err,
+				codes.EContentMD5Failed,
+				"failed to calculate the MD5 checksum for part %d of audit log file %s",
+				partNumber,
+				name,
+			)
+		}
+	}
+	response, err := s3Connection.UploadPartWithContext(context.Background(), &s3.UploadPartInput{
 		Body:          io.NewSectionReader(handle, startingByte, contentLength),
 		Bucket:        aws.String(q.bucket),
 		ContentLength: aws.Int64(contentLength),
+		ContentMD5:    md5,
 		Key:           aws.String(name),
 		PartNumber:    aws.Int64(partNumber),
 		UploadId:      aws.String(uploadID),
-	})
+	}, q.throttle(entry), q.withChecksum(digest))
 	etag := ""
 	if err != nil {
+		q.metrics.Add(metrics.S3PartsFailedTotal, 1)
 		return 0, "", log.Wrap(err,
 			codes.EMultipartPartUploadFailed,
 			"failed to upload part %d of audit log file %s (%w)",
@@ -71,6 +106,9 @@ func (q *uploadQueue) processMultiPartUploadPart(
 		)
 	}
 	etag = *response.ETag
+	entry.partChecksums[partNumber] = base64.StdEncoding.EncodeToString(digest)
+	q.metrics.Add(metrics.S3PartsUploadedTotal, 1)
+	q.metrics.Add(metrics.S3UploadedBytesTotal, float64(contentLength))
 	q.logger.Debug(log.NewMessage(
 		codes.MMultipartPartUploadComplete,
 		"completed upload of part %d of audit log %s",
@@ -80,32 +118,70 @@ func (q *uploadQueue) processMultiPartUploadPart(
 	return contentLength, etag, nil
 }
 
-func (q *uploadQueue) processSingleUpload(s3Connection *s3.S3, name string, handle *os.File, metadata queueEntryMetadata) (int64, error) {
+func (q *uploadQueue) processSingleUpload(s3Connection *s3.S3, name string, entry *queueEntry) (int64, error) {
 	q.logger.Debug(log.NewMessage(codes.MSingleUpload, "processing single upload for audit log %s...", name))
+	handle := entry.readHandle
+	metadata := entry.getMetadata()
 	stat, err := handle.Stat()
 	if err != nil {
 		return 0, log.Wrap(err, codes.MSingleUploadFailed, "single upload failed for audit log %s", name)
 	}
 	contentLength := stat.Size()
-	_, err = s3Connection.PutObject(&s3.PutObjectInput{
-		ACL:           q.acl,
-		Body:          handle,
-		Bucket:        aws.String(q.bucket),
-		ContentLength: aws.Int64(contentLength),
-		ContentType:   aws.String("application/octet-stream"),
-		Key:           aws.String(name),
-		Metadata:      metadata.ToMap(q.metadataUsername, q.metadataIP),
-	})
+	digest, err := partChecksum(handle, 0, contentLength)
+	if err != nil {
+		return 0, log.Wrap(err, codes.EChecksumFailed, "failed to calculate the SHA-256 checksum of audit log %s", name)
+	}
+	if entry.recovered && q.isDuplicate(s3Connection, name, contentLength, digest) {
+		q.logger.Debug(log.NewMessage(
+			codes.MUploadDeduplicated,
+			"audit log %s is already present in the bucket, skipping upload",
+			name,
+		).Label("log", name))
+		return contentLength, nil
+	}
+	metadata.SHA256 = hex.EncodeToString(digest)
+	var md5 *string
+	if q.objectLock.Enabled() {
+		if md5, err = contentMD5(io.NewSectionReader(handle, 0, contentLength)); err != nil {
+			return 0, log.Wrap(
+				err,
+				codes.EContentMD5Failed,
+				"failed to calculate the MD5 checksum of audit log %s",
+				name,
+			)
+		}
+	}
+	_, err = s3Connection.PutObjectWithContext(context.Background(), &s3.PutObjectInput{
+		ACL:                       q.acl,
+		Body:                      io.NewSectionReader(handle, 0, contentLength),
+		Bucket:                    aws.String(q.bucket),
+		ContentLength:             aws.Int64(contentLength),
+		ContentMD5:                md5,
+		ContentType:               metadata.getContentType(),
+		Key:                       aws.String(name),
+		Metadata:                  metadata.ToMap(q.metadataUsername, q.metadataIP),
+		ObjectLockMode:            q.objectLock.Mode.s3Mode(),
+		ObjectLockRetainUntilDate: q.objectLock.retainUntil(metadata.StartTime, q.clock.Now()),
+		ObjectLockLegalHoldStatus: q.objectLock.legalHoldStatus(),
+		Tagging:                   tagging(metadata.ToTags(q.tags)),
+	}, q.throttle(entry), q.withChecksum(digest))
 	if err != nil {
 		return contentLength, log.Wrap(err, codes.MSingleUploadFailed, "single upload failed for audit log %s", name)
 	}
+	q.metrics.Add(metrics.S3UploadedBytesTotal, float64(contentLength))
 	q.logger.Debug(log.NewMessage(codes.MSingleUploadComplete, "single upload complete for audit log %s", name))
 	return contentLength, nil
 }
 
-func (q *uploadQueue) finalizeUpload(s3Connection *s3.S3, name string, uploadID string, completedParts []*s3.CompletedPart) error {
+func (q *uploadQueue) finalizeUpload(
+	s3Connection *s3.S3,
+	name string,
+	entry *queueEntry,
+	uploadID string,
+	completedParts []*s3.CompletedPart,
+) error {
 	q.logger.Debug(log.NewMessage(codes.MMultipartUploadFinalizing, "finalizing multipart upload for audit log %s...", name))
-	_, err := s3Connection.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+	_, err := s3Connection.CompleteMultipartUploadWithContext(context.Background(), &s3.CompleteMultipartUploadInput{
 		Bucket: aws.String(q.bucket),
 		Key:    aws.String(name),
 		MultipartUpload: &s3.CompletedMultipartUpload{
@@ -115,7 +191,7 @@ func (q *uploadQueue) finalizeUpload(s3Connection *s3.S3, name string, uploadID
 
 		ExpectedBucketOwner: nil,
 		RequestPayer:        nil,
-	})
+	}, q.withPartChecksums(completedParts, entry.partChecksums))
 	if err != nil {
 		return log.Wrap(
 			err,
@@ -132,8 +208,63 @@ func (q *uploadQueue) finalizeUpload(s3Connection *s3.S3, name string, uploadID
 	return nil
 }
 
-func (q *uploadQueue) processShouldAbort(s3Connection *s3.S3, name string, failures int, uploadID *string) bool {
-	abort := func() {
+// updateFinishedObject writes the metadata and tags that are only known at the end of the session to an audit log
+// uploaded in multiple parts. The tags are replaced if they differ from the tags the upload was created with. The
+// metadata is replaced by copying the object onto itself, keeping the tags. Copying is skipped if object lock is
+// enabled, as it would leave a locked copy of the original object version behind, and for objects too large for a
+// single copy.
+func (q *uploadQueue) updateFinishedObject(
+	s3Connection *s3.S3,
+	name string,
+	metadata queueEntryMetadata,
+	createdTags []*s3.Tag,
+	size int64,
+) {
+	if tags := metadata.ToTags(q.tags); !equalTags(tags, createdTags) {
+		if _, err := s3Connection.PutObjectTagging(&s3.PutObjectTaggingInput{
+			Bucket:  aws.String(q.bucket),
+			Key:     aws.String(name),
+			Tagging: &s3.Tagging{TagSet: tags},
+		}); err != nil {
+			q.logger.Warning(log.Wrap(
+				err,
+				codes.EFailedUpdatingMetadata,
+				"failed to update tags of audit log %s",
+				name,
+			).Label("log", name))
+		}
+	}
+	if q.objectLock.Enabled() || size > maxCopySize {
+		return
+	}
+	if _, err := s3Connection.CopyObject(&s3.CopyObjectInput{
+		ACL:               q.acl,
+		Bucket:            aws.String(q.bucket),
+		ContentType:       metadata.getContentType(),
+		CopySource:        aws.String(url.PathEscape(q.bucket) + "/" + url.PathEscape(name)),
+		Key:               aws.String(name),
+		Metadata:          metadata.ToMap(q.metadataUsername, q.metadataIP),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		TaggingDirective:  aws.String(s3.TaggingDirectiveCopy),
+	}); err != nil {
+		q.logger.Warning(log.Wrap(
+			err,
+			codes.EFailedUpdatingMetadata,
+			"failed to update metadata of audit log %s",
+			name,
+		).Label("log", name))
+	}
+}
+
+func (q *uploadQueue) processShouldAbort(
+	s3Connection *s3.S3,
+	name string,
+	entry *queueEntry,
+	failures uint,
+	lastError error,
+	uploadID *string,
+) bool {
+	abort := func(giveUp bool) {
 		if uploadID != nil {
 			if err := q.abortSpecificMultipartUpload(name, s3Connection, &name, uploadID); err != nil {
 				q.logger.Warning(
@@ -146,32 +277,56 @@ func (q *uploadQueue) processShouldAbort(s3Connection *s3.S3, name string, failu
 			}
 		}
 		q.queue.Delete(name)
+		if giveUp {
+			q.metrics.Add(metrics.S3UploadsGivenUpTotal, 1)
+			q.giveUp(name, entry)
+		}
+		q.updateSpool()
 	}
-	if q.shutdownContext != nil {
+	if entry.isEvicted() {
+		abort(false)
+		if err := entry.remove(); err != nil {
+			q.logger.Error(err)
+		}
+		return true
+	}
+	// When shutting down the audit log is left in the local directory so the upload is retried on the next start.
+	if shutdownContext := q.getShutdownContext(); shutdownContext != nil {
 		select {
-		case <-q.shutdownContext.Done():
+		case <-shutdownContext.Done():
 			q.logger.Warning(log.NewMessage(
 				codes.EMultipartAborting,
 				"shutdown context expired, aborting upload of audit log %s", name).Label("log", name))
-			abort()
+			abort(false)
 			return true
 		default:
 		}
 	}
-	if failures > 20 {
+	if lastError != nil && isPermanentError(lastError) {
+		q.logger.Warning(log.Wrap(
+			lastError,
+			codes.EMultipartAborting,
+			"permanent error while uploading audit log %s, giving up", name).Label("log", name))
+		abort(true)
+		return true
+	}
+	if failures >= q.retry.MaxAttempts {
 		q.logger.Warning(log.NewMessage(
 			codes.EMultipartAborting,
-			"failed to upload audit log %s for 20 times in a row, giving up", name).Label("log", name))
-		abort()
+			"failed to upload audit log %s for %d times in a row, giving up", name, failures).Label("log", name))
+		abort(true)
 		return true
 	}
-	if failures > 3 {
+	if failures >= q.retry.ShutdownMaxAttempts {
 		select {
 		case <-q.ctx.Done():
 			q.logger.Warning(log.NewMessage(
 				codes.EMultipartAborting,
-				"failed to upload audit log %s 3 times and shutdown is requested, giving up", name).Label("log", name))
-			abort()
+				"failed to upload audit log %s %d times and shutdown is requested, giving up",
+				name,
+				failures,
+			).Label("log", name))
+			abort(false)
 			return true
 		default:
 		}
@@ -179,36 +334,47 @@ func (q *uploadQueue) processShouldAbort(s3Connection *s3.S3, name string, failu
 	return false
 }
 
+// waitRetry waits for the backoff period before the next upload attempt. Once shutdown is requested the next attempt
+// is made immediately as the number of attempts is limited by the shutdown attempt limit.
+func (q *uploadQueue) waitRetry(entry *queueEntry, failures uint) {
+	select {
+	case <-time.After(q.retry.backoff(failures)):
+	case <-q.ctx.Done():
+	case <-entry.evicted:
+	}
+}
+
 func (q *uploadQueue) uploadLoop(s3Connection *s3.S3, name string, entry *queueEntry) {
 	defer q.wg.Done()
 	var uploadID *string = nil
 	uploadedBytes := int64(0)
-	var errorHappened bool
+	var lastError error
 	var completedParts []*s3.CompletedPart
-	failures := 0
+	failures := uint(0)
 	for {
-		if q.processShouldAbort(s3Connection, name, failures, uploadID) {
+		if q.processShouldAbort(s3Connection, name, entry, failures, lastError, uploadID) {
 			break
 		}
 
 		entry.waitPartAvailable()
-		q.workerSem <- 42
-		errorHappened = false
+		if !entry.isFinished() {
+			q.waitIntermediateWindow(entry)
+		}
+		// Finished audit logs are uploaded first, so closed sessions are not held up by the running ones.
+		q.slots.acquire(entry.isFinished())
+		lastError = nil
 
 		stat, err := entry.readHandle.Stat()
 		if err != nil {
-			q.logger.Error(log.Wrap(
+			lastError = log.Wrap(
 				err,
 				codes.EFailedQueueStat,
 				"failed to stat audit queue file %s before upload",
 				name,
-			).Label("log", name))
-			errorHappened = true
-		}
-
-		if !errorHappened {
+			).Label("log", name)
+		} else {
 			var finished bool
-			errorHappened, finished, uploadedBytes, completedParts, uploadID = q.processUpload(
+			finished, uploadedBytes, completedParts, uploadID, lastError = q.processUpload(
 				entry,
 				uploadedBytes,
 				s3Connection,
@@ -219,22 +385,26 @@ func (q *uploadQueue) uploadLoop(s3Connection *s3.S3, name string, entry *queueE
 				completedParts,
 			)
 			if finished {
-				<-q.workerSem
+				q.slots.release()
 				break
 			}
 		}
 
-		<-q.workerSem
-		if errorHappened || entry.finished {
-			// If an error happened, retry immediately.
+		q.slots.release()
+		if lastError != nil || entry.isFinished() {
+			// If an error happened, retry after the backoff.
 			// Also go back if the entry is finished to finish uploading the parts.
 			entry.markPartAvailable()
 		}
-		if errorHappened {
+		if lastError != nil {
+			q.logger.Error(lastError)
+			q.metrics.Add(metrics.S3UploadRetriesTotal, 1)
 			failures++
-			time.Sleep(10 * time.Second)
+			entry.setFailures(failures)
+			q.waitRetry(entry, failures)
 		} else {
 			failures = 0
+			entry.setFailures(failures)
 		}
 	}
 }
@@ -260,43 +430,65 @@ func (q *uploadQueue) processUpload(
 	uploadID *string,
 	stat os.FileInfo,
 	completedParts []*s3.CompletedPart,
-) (bool, bool, int64, []*s3.CompletedPart, *string) {
-	if entry.finished && uploadedBytes == 0 {
+) (bool, int64, []*s3.CompletedPart, *string, error) {
+	if entry.isFinished() && uploadedBytes == 0 {
 		// If the entry is finished and nothing has been uploaded yet, upload it as a single file.
-		partBytes, err := q.processSingleUpload(s3Connection, name, entry.readHandle, entry.metadata)
+		partBytes, err := q.processSingleUpload(s3Connection, name, entry)
 		if err != nil {
-			q.logger.Error(err)
-			return true, false, uploadedBytes, completedParts, uploadID
+			return false, uploadedBytes, completedParts, uploadID, err
 		}
 		uploadedBytes = uploadedBytes + partBytes
-	} else if (entry.finished && remainingBytes > 0) || remainingBytes >= int64(q.partSize) {
+	} else if (entry.isFinished() && remainingBytes > 0) || remainingBytes >= int64(q.partSize) {
 		// If the entry is finished and there are bytes remaining, upload. Otherwise, we only upload if
 		// more than the part size is available.
 		if uploadID == nil {
 			var err error
-			uploadID, err = q.initializeMultiPartUpload(s3Connection, name, entry.metadata)
+			uploadID, err = q.initializeMultiPartUpload(s3Connection, name, entry)
 			if err != nil {
-				return true, false, uploadedBytes, completedParts, uploadID
+				return false, uploadedBytes, completedParts, uploadID, err
 			}
 		}
 		if uploadID != nil {
-			uploadedBytes, completedParts = q.doMultipartUpload(entry, uploadedBytes, s3Connection, name, stat, uploadID, completedParts)
+			var err error
+			uploadedBytes, completedParts, err = q.doMultipartUpload(
+				entry, uploadedBytes, s3Connection, name, stat, uploadID, completedParts,
+			)
+			if err != nil {
+				return false, uploadedBytes, completedParts, uploadID, err
+			}
 		}
-	} else if entry.finished && remainingBytes == 0 {
+	} else if entry.isFinished() && remainingBytes == 0 {
 		//If the entry is finished and no data is left to be uploaded, finalize the upload.
 		if uploadID != nil {
-			err := q.finalizeUpload(s3Connection, name, *uploadID, completedParts)
+			// The checksum of the full audit log is stored in the metadata, S3 only records the checksum of the
+			// part checksums for multipart uploads.
+			digest, err := partChecksum(entry.readHandle, 0, uploadedBytes)
+			if err != nil {
+				return false, uploadedBytes, completedParts, uploadID, log.Wrap(
+					err,
+					codes.EMultipartUploadFinalizationFailed,
+					"failed to calculate checksum of audit log %s",
+					name,
+				)
+			}
+			metadata := entry.updateMetadata(func(metadata *queueEntryMetadata) {
+				metadata.SHA256 = hex.EncodeToString(digest)
+			})
+			err = q.finalizeUpload(s3Connection, name, entry, *uploadID, completedParts)
 			if err != nil {
-				return true, false, uploadedBytes, completedParts, uploadID
+				return false, uploadedBytes, completedParts, uploadID, err
 			}
+			q.updateFinishedObject(s3Connection, name, metadata, entry.createdTags, uploadedBytes)
 		}
 		if err := entry.remove(); err != nil {
 			q.logger.Error(err)
 		}
 		q.queue.Delete(name)
-		return false, true, uploadedBytes, completedParts, uploadID
+		q.metrics.Add(metrics.S3UploadsCompletedTotal, 1)
+		q.updateSpool()
+		return true, uploadedBytes, completedParts, uploadID, nil
 	}
-	return false, false, uploadedBytes, completedParts, uploadID
+	return false, uploadedBytes, completedParts, uploadID, nil
 }
 
 func (q *uploadQueue) doMultipartUpload(
@@ -307,27 +499,32 @@ func (q *uploadQueue) doMultipartUpload(
 	stat os.FileInfo,
 	uploadID *string,
 	completedParts []*s3.CompletedPart,
-) (int64, []*s3.CompletedPart) {
-	partNumber := uploadedBytes / int64(q.partSize)
-	startingByte := partNumber * int64(q.partSize)
-	endingByte := (partNumber + 1) * int64(q.partSize)
+) (int64, []*s3.CompletedPart, error) {
+	partIndex := uploadedBytes / int64(q.partSize)
+	// S3 part numbers start at 1.
+	partNumber := partIndex + 1
+	startingByte := partIndex * int64(q.partSize)
+	endingByte := (partIndex + 1) * int64(q.partSize)
 	if stat.Size() < endingByte {
 		endingByte = stat.Size()
 	}
 
-	if entry.finished && stat.Size()-endingByte < int64(q.partSize) {
+	if entry.isFinished() && stat.Size()-endingByte < int64(q.partSize) {
 		endingByte = stat.Size()
 	}
 
-	partBytes, etag, err := q.processMultiPartUploadPart(s3Connection, name, *uploadID, partNumber, entry.readHandle, startingByte, endingByte)
-	if err == nil {
-		uploadedBytes = uploadedBytes + partBytes
-		completedParts = append(completedParts, &s3.CompletedPart{
-			ETag:       aws.String(etag),
-			PartNumber: aws.Int64(partNumber),
-		})
+	partBytes, etag, err := q.processMultiPartUploadPart(
+		s3Connection, name, *uploadID, partNumber, entry, startingByte, endingByte,
+	)
+	if err != nil {
+		return uploadedBytes, completedParts, err
 	}
-	return uploadedBytes, completedParts
+	uploadedBytes = uploadedBytes + partBytes
+	completedParts = append(completedParts, &s3.CompletedPart{
+		ETag:       aws.String(etag),
+		PartNumber: aws.Int64(partNumber),
+	})
+	return uploadedBytes, completedParts, nil
 }
 
 func (q *uploadQueue) abortMultiPartUpload(name string) error {
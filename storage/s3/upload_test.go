@@ -1,412 +1,525 @@
 package s3_test
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"io"
 	"io/ioutil"
-	goLog "log"
-	"net"
+	"net/url"
 	"os"
+	"path"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	awsS3 "github.com/aws/aws-sdk-go/service/s3"
 	"github.com/containerssh/log"
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/containerssh/auditlog/clock"
 	auditLogStorage "github.com/containerssh/auditlog/storage"
 	"github.com/containerssh/auditlog/storage/s3"
+	"github.com/containerssh/auditlog/storage/s3/s3test"
+	"github.com/containerssh/auditlog/summary"
 )
 
-type minio struct {
-	containerID string
-	dir         string
-	storage     auditLogStorage.ReadWriteStorage
-}
-
-func (m *minio) getClient() (*client.Client, error) {
-	cli, err := client.NewClientWithOpts()
+// newS3Server starts an in-memory S3 server with the given buckets, or the "auditlog" bucket if none are given.
+func newS3Server(t *testing.T, buckets ...s3test.Bucket) *s3test.Server {
+	if len(buckets) == 0 {
+		buckets = []s3test.Bucket{{Name: "auditlog"}}
+	}
+	server, err := s3test.NewServer(s3test.Config{Buckets: buckets})
 	if err != nil {
-		return cli, err
+		t.Fatal(err)
 	}
-	cli.NegotiateAPIVersion(context.Background())
-	return cli, nil
+	t.Cleanup(server.Close)
+	return server
 }
 
-func (m *minio) Start(
-	t *testing.T,
-	accessKey string,
-	secretKey string,
-	region string,
-	bucket string,
-	endpoint string,
-) (auditLogStorage.ReadWriteStorage, error) {
-	if m.containerID == "" {
-		if err := m.startMinio(t, accessKey, secretKey); err != nil {
-			return nil, err
-		}
+func newTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-s3-test")
+	if err != nil {
+		t.Fatal(err)
 	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	return dir
+}
 
-	var err error
-	for i := 0; i < 6; i++ {
-		if err = setupS3(accessKey, secretKey, endpoint, region, bucket); err != nil {
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		break
+// newS3Config returns a storage configuration for the "auditlog" bucket of the test server using a new local
+// directory.
+func newS3Config(t *testing.T, server *s3test.Server) s3.Config {
+	return s3.Config{
+		Local:           newTempDir(t),
+		AccessKey:       "test",
+		SecretKey:       "test",
+		Bucket:          "auditlog",
+		Region:          "us-east-1",
+		Endpoint:        server.URL(),
+		PathStyleAccess: true,
+		UploadPartSize:  5 * 1024 * 1024,
+		ParallelUploads: 2,
 	}
+}
 
+func newS3Storage(t *testing.T, config s3.Config) auditLogStorage.ReadWriteStorage {
+	st, err := s3.NewStorage(config, log.NewTestLogger(t))
 	if err != nil {
-		return nil, err
+		t.Fatal(err)
 	}
+	return st
+}
 
-	m.dir, err = ioutil.TempDir(os.TempDir(), "containerssh-s3-upload-test")
-	if err != nil {
-		assert.Fail(t, "failed to create temporary directory (%v)", err)
-		return nil, err
+func getS3Objects(t *testing.T, storage auditLogStorage.ReadWriteStorage) []auditLogStorage.Entry {
+	var objects []auditLogStorage.Entry
+	objectChan, errChan := storage.List(context.Background(), auditLogStorage.Query{})
+	for {
+		finished := false
+		select {
+		case object, ok := <-objectChan:
+			if !ok {
+				finished = true
+				break
+			}
+			objects = append(objects, object)
+		case err, ok := <-errChan:
+			if !ok {
+				finished = true
+				break
+			}
+			assert.Fail(t, "error while fetching objects from object storage", err)
+		}
+		if finished {
+			break
+		}
 	}
+	return objects
+}
 
-	err = m.setupStorage(t, accessKey, secretKey, region, bucket, endpoint)
+func readS3Object(t *testing.T, storage auditLogStorage.ReadWriteStorage, name string) []byte {
+	r, err := storage.OpenReader(name)
 	if err != nil {
-		return nil, err
+		t.Fatalf("failed to open reader for recently stored object (%v)", err)
 	}
-
-	return m.storage, nil
-}
-
-func (m *minio) setupStorage(
-	t *testing.T,
-	accessKey string,
-	secretKey string,
-	region string,
-	bucket string,
-	endpoint string,
-) error {
-	logger := log.NewTestLogger(t)
-	var err error
-	m.storage, err = s3.NewStorage(
-		s3.Config{
-			Local:           m.dir,
-			AccessKey:       accessKey,
-			SecretKey:       secretKey,
-			Bucket:          bucket,
-			Region:          region,
-			Endpoint:        endpoint,
-			PathStyleAccess: true,
-			UploadPartSize:  5 * 1024 * 1024,
-			ParallelUploads: 20,
-			Metadata:        s3.Metadata{},
-		},
-		logger,
-	)
+	defer func() {
+		_ = r.Close()
+	}()
+	d, err := ioutil.ReadAll(r)
 	if err != nil {
-		assert.Fail(t, "failed to create storage (%v)", err)
-		return err
+		t.Fatalf("failed to read from S3 (%v)", err)
 	}
-	return nil
+	return d
 }
 
-var hostConfig = &container.HostConfig{
-	AutoRemove: true,
-	PortBindings: map[nat.Port][]nat.PortBinding{
-		"9000/tcp": {
-			{
-				HostIP:   "127.0.0.1",
-				HostPort: "9000",
-			},
-		},
-	},
-}
+func TestSmallUpload(t *testing.T) {
+	server := newS3Server(t)
+	storage := newS3Storage(t, newS3Config(t, server))
 
-func (m *minio) startMinio(t *testing.T, accessKey string, secretKey string) error {
-	ctx := context.Background()
+	var data = []byte("Hello world!")
+	writeAuditLog(t, storage, "test", data)
+	storage.Shutdown(context.Background())
 
-	cli, err := m.getClient()
-	if err != nil {
-		assert.Fail(t, "failed to create Docker client (%v)", err)
-		return err
+	objects := getS3Objects(t, storage)
+	if !assert.Equal(t, 1, len(objects)) {
+		return
 	}
+	assert.Equal(t, data, readS3Object(t, storage, objects[0].Name))
+	assert.Equal(t, 1, server.RequestCount(s3test.OperationPutObject))
+}
 
-	reader, err := cli.ImagePull(ctx, "docker.io/minio/minio", types.ImagePullOptions{})
-	if err != nil {
-		assert.Fail(t, "failed to pull Minio image (%v)", err)
-		return err
-	}
-	if _, err := io.Copy(os.Stdout, reader); err != nil {
-		assert.Fail(t, "failed to stream logs from Minio image pull (%v)", err)
-		return err
-	}
-
-	env := []string{
-		fmt.Sprintf("MINIO_ACCESS_KEY=%s", accessKey),
-		fmt.Sprintf("MINIO_SECRET_KEY=%s", secretKey),
-	}
-
-	resp, err := cli.ContainerCreate(
-		ctx,
-		&container.Config{
-			Image: "minio/minio",
-			Cmd:   []string{"server", "/data"},
-			Env:   env,
-		},
-		hostConfig,
-		nil,
-		nil,
-		"",
-	)
+func TestLargeUpload(t *testing.T) {
+	server := newS3Server(t)
+	storage := newS3Storage(t, newS3Config(t, server))
+
+	writer, err := storage.OpenWriter("test")
 	if err != nil {
-		assert.Fail(t, "failed to create Minio container (%v)", err)
-		return err
+		t.Fatalf("failed to open storage writer (%v)", err)
 	}
-
-	m.containerID = resp.ID
-
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		assert.Fail(t, "failed to start minio container (%v)", err)
-		return err
+	size := 25 * 1000 * 1000
+	var data = bytes.Repeat([]byte("0123456789"), 100*1000)
+	for i := 0; i < size/len(data); i++ {
+		if _, err := writer.Write(data); err != nil {
+			t.Fatalf("failed to write to storage writer (%v)", err)
+		}
 	}
-
-	if err := m.waitForMinio(t); err != nil {
-		return err
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close storage writer (%v)", err)
 	}
 
-	return nil
+	storage.Shutdown(context.Background())
+
+	objects := getS3Objects(t, storage)
+	if !assert.Equal(t, 1, len(objects)) {
+		return
+	}
+	assert.Equal(t, bytes.Repeat(data, size/len(data)), readS3Object(t, storage, objects[0].Name))
+	assert.Equal(t, 0, server.MultipartUploads())
 }
 
-func (m *minio) waitForMinio(t *testing.T) error {
-	tries := 0
-	for {
-		if tries > 30 {
-			m.Stop()
-			assert.Fail(t, "minio failed to come up within 30 seconds")
-			return fmt.Errorf("minio failed to come up")
-		}
-		sock, err := net.Dial("tcp", "127.0.0.1:9000")
-		if err != nil {
-			tries++
-			time.Sleep(time.Second)
-		} else {
-			_ = sock.Close()
+func TestMultipartUploadPartFailure(t *testing.T) {
+	server := newS3Server(t)
+	server.InjectFault(s3test.FailPart(2))
+	config := newS3Config(t, server)
+	config.Retry = s3.Retry{InitialBackoff: 10 * time.Millisecond}
+	storage := newS3Storage(t, config)
 
-			break
+	writer, err := storage.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 1200*1024)
+	// Write in two steps so the first part is uploaded before the audit log is finished.
+	if _, err := writer.Write(data[:6*1024*1024]); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return server.RequestCount(s3test.OperationUploadPart) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	if _, err := writer.Write(data[6*1024*1024:]); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, writer.Close())
+	storage.Shutdown(context.Background())
+
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, data, object.Data)
+	// The failed part is uploaded again.
+	secondPartUploads := 0
+	for _, request := range server.Requests() {
+		if request.Operation == s3test.OperationUploadPart && request.Query["partNumber"][0] == "2" {
+			secondPartUploads++
 		}
 	}
-	return nil
+	assert.Equal(t, 2, secondPartUploads)
 }
 
-func (m *minio) Stop() {
-	if m.containerID != "" {
-		ctx := context.Background()
-
-		cli, err := m.getClient()
-		if err != nil {
-			goLog.Printf("failed to create Docker client (%v)\n", err)
-		}
+func TestSlowUploadShutdownRecovery(t *testing.T) {
+	server := newS3Server(t)
+	server.InjectFault(s3test.Fault{Operation: s3test.OperationPutObject, Delay: 300 * time.Millisecond})
+	config := newS3Config(t, server)
+	storage := newS3Storage(t, config)
 
-		if err := cli.ContainerRemove(ctx, m.containerID, types.ContainerRemoveOptions{
-			RemoveVolumes: false,
-			RemoveLinks:   false,
-			Force:         true,
-		}); err != nil {
-			goLog.Println("failed to stop Minio container", err)
-		}
+	writeAuditLog(t, storage, "test", []byte("Hello world!"))
+	shutdownContext, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	storage.Shutdown(shutdownContext)
 
-		ok, errChan := cli.ContainerWait(ctx, m.containerID, container.WaitConditionRemoved)
-		select {
-		case <-ok:
-			m.containerID = ""
-		case <-errChan:
-		}
+	// The shutdown context expires before the upload is finished, so the audit log is kept for the next start.
+	_, err := os.Stat(path.Join(config.Local, "test"))
+	if !assert.NoError(t, err) {
+		return
 	}
 
-	if m.dir != "" {
-		m.dir = ""
-		if err := os.RemoveAll(m.dir); err != nil {
-			goLog.Printf("failed to remove temporary directory (%v)", err)
-		}
-	}
+	// The slow upload completed in the meantime, so the recovered audit log is not uploaded again.
+	server.ClearFaults()
+	newS3Storage(t, config).Shutdown(context.Background())
+	assert.Equal(t, 1, server.RequestCount(s3test.OperationPutObject))
+	_, err = os.Stat(path.Join(config.Local, "test"))
+	assert.True(t, os.IsNotExist(err))
 }
 
-func setupS3(accessKey string, secretKey string, endpoint string, region string, bucket string) error {
-	awsConfig := &aws.Config{
-		CredentialsChainVerboseErrors: nil,
-		Credentials: credentials.NewCredentials(&credentials.StaticProvider{
-			Value: credentials.Value{
-				AccessKeyID:     accessKey,
-				SecretAccessKey: secretKey,
-			},
-		}),
-		Endpoint:         aws.String(endpoint),
-		Region:           aws.String(region),
-		S3ForcePathStyle: aws.Bool(true),
-	}
-	sess := session.Must(session.NewSession(awsConfig))
-	s3Connection := awsS3.New(sess)
-	if _, err := s3Connection.CreateBucket(&awsS3.CreateBucketInput{
-		Bucket: aws.String(bucket),
-	}); err != nil {
-		return err
-	}
-	return nil
-}
+func TestSummaryRecovery(t *testing.T) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
 
-func getS3Objects(t *testing.T, storage auditLogStorage.ReadWriteStorage) []auditLogStorage.Entry {
-	var objects []auditLogStorage.Entry
-	objectChan, errChan := storage.List()
-	for {
-		finished := false
-		select {
-		case object, ok := <-objectChan:
-			if !ok {
-				finished = true
-				break
-			}
-			objects = append(objects, object)
-		case err, ok := <-errChan:
-			if !ok {
-				finished = true
-				break
-			}
-			assert.Fail(t, "error while fetching objects from object storage", err)
+	// The audit log and its summary were left in the local directory by a previous run.
+	for _, name := range []string{"test", "test" + summary.NameSuffix} {
+		if err := ioutil.WriteFile(path.Join(config.Local, name), []byte("Hello world!"), 0600); err != nil {
+			t.Fatal(err)
 		}
-		if finished {
-			break
+		metadata := []byte(`{"startTime":1}`)
+		if err := ioutil.WriteFile(path.Join(config.Local, name+".metadata.json"), metadata, 0600); err != nil {
+			t.Fatal(err)
 		}
 	}
-	return objects
-}
 
-func waitForS3Objects(t *testing.T, storage auditLogStorage.ReadWriteStorage, count int) []auditLogStorage.Entry {
-	tries := 0
-	var objects []auditLogStorage.Entry
-	for {
-		if tries > 10 {
-			break
-		}
-		objects = getS3Objects(t, storage)
-		if len(objects) > count-1 {
-			break
-		} else {
-			tries++
-			time.Sleep(10 * time.Second)
-		}
+	newS3Storage(t, config).Shutdown(context.Background())
+
+	assert.Equal(t, []string{"test", "test" + summary.NameSuffix}, server.Keys("auditlog"))
+	for _, name := range []string{"test", "test" + summary.NameSuffix} {
+		_, err := os.Stat(path.Join(config.Local, name))
+		assert.True(t, os.IsNotExist(err))
 	}
-	return objects
 }
 
-func TestSmallUpload(t *testing.T) {
-	if testing.Short() {
-		t.Skipf("skipping test in short mode")
+func TestObjectLockUpload(t *testing.T) {
+	server := newS3Server(t, s3test.Bucket{Name: "auditlog", ObjectLock: true})
+	config := newS3Config(t, server)
+	config.ObjectLock = s3.ObjectLock{
+		Mode:      s3.ObjectLockModeGovernance,
+		Retention: 24 * time.Hour,
+		LegalHold: true,
 	}
-	accessKey := "asdfasdfasdf"
-	secretKey := "asdfasdfasdf"
+	storage := newS3Storage(t, config)
 
-	region := "us-east-1"
-	bucket := "auditlog"
-	endpoint := "http://127.0.0.1:9000"
+	writer, err := storage.OpenWriter("test")
+	if err != nil {
+		t.Fatalf("failed to open storage writer (%v)", err)
+	}
+	startTime := time.Now().Unix()
+	writer.SetMetadata(startTime, "127.0.0.1", "XX", nil)
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatalf("failed to write to storage writer (%v)", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close storage writer (%v)", err)
+	}
 
-	m := &minio{}
+	storage.Shutdown(context.Background())
 
-	storage, err := m.Start(t, accessKey, secretKey, region, bucket, endpoint)
-	defer m.Stop()
-	if err != nil {
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
 		return
 	}
+	assert.Equal(t, "GOVERNANCE", object.ObjectLockMode)
+	assert.True(t, object.ObjectLockLegalHold)
+	assert.Equal(t, startTime+int64((24*time.Hour).Seconds()), object.ObjectLockRetainUntilDate.Unix())
+}
+
+func TestObjectLockExpiredRetention(t *testing.T) {
+	server := newS3Server(t, s3test.Bucket{Name: "auditlog", ObjectLock: true})
+	config := newS3Config(t, server)
+	config.ObjectLock = s3.ObjectLock{
+		Mode:      s3.ObjectLockModeCompliance,
+		Retention: time.Hour,
+	}
+	storage := newS3Storage(t, config)
 
 	writer, err := storage.OpenWriter("test")
 	if err != nil {
-		assert.Fail(t, "failed to open storage writer (%v)", err)
-		return
+		t.Fatalf("failed to open storage writer (%v)", err)
 	}
-	var data = []byte("Hello world!")
-	if _, err := writer.Write(data); err != nil {
-		assert.Fail(t, "failed to write to storage writer (%v)", err)
-		return
+	// The retention counted from the session start has already expired.
+	writer.SetMetadata(time.Now().Add(-2*time.Hour).Unix(), "127.0.0.1", "XX", nil)
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatalf("failed to write to storage writer (%v)", err)
 	}
 	if err := writer.Close(); err != nil {
-		assert.Fail(t, "failed to close storage writer (%v)", err)
-		return
+		t.Fatalf("failed to close storage writer (%v)", err)
 	}
+	uploadTime := time.Now()
 
 	storage.Shutdown(context.Background())
 
-	objects := waitForS3Objects(t, storage, 1)
-	assert.Equal(t, 1, len(objects))
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.False(t, object.ObjectLockRetainUntilDate.Before(uploadTime.Add(time.Hour).Truncate(time.Second)))
+}
 
-	r, err := storage.OpenReader(objects[0].Name)
+func TestObjectLockClock(t *testing.T) {
+	server := newS3Server(t, s3test.Bucket{Name: "auditlog", ObjectLock: true})
+	config := newS3Config(t, server)
+	config.ObjectLock = s3.ObjectLock{
+		Mode:      s3.ObjectLockModeGovernance,
+		Retention: time.Hour,
+	}
+	now := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	storage, err := s3.NewStorage(config, log.NewTestLogger(t), s3.WithClock(clock.NewFake(now, 0)))
 	if err != nil {
-		assert.Fail(t, "failed to open reader for recently stored object", err)
-		return
+		t.Fatal(err)
 	}
-	d, err := ioutil.ReadAll(r)
+
+	writer, err := storage.OpenWriter("test")
 	if err != nil {
-		assert.Fail(t, "failed to open read from S3", err)
+		t.Fatalf("failed to open storage writer (%v)", err)
+	}
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatalf("failed to write to storage writer (%v)", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close storage writer (%v)", err)
+	}
+
+	storage.Shutdown(context.Background())
+
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
 		return
 	}
+	// Without a start time the retention is counted from the time of the clock.
+	assert.Equal(t, now.Add(time.Hour).Unix(), object.ObjectLockRetainUntilDate.Unix())
+}
+
+func TestObjectLockUnsupportedBucket(t *testing.T) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+	config.ObjectLock = s3.ObjectLock{
+		Mode:      s3.ObjectLockModeCompliance,
+		Retention: time.Hour,
+	}
 
-	assert.Equal(t, data, d)
+	_, err := s3.NewStorage(config, log.NewTestLogger(t))
+	assert.Error(t, err)
 }
 
-func TestLargeUpload(t *testing.T) {
-	if testing.Short() {
-		t.Skipf("skipping test in short mode")
+func TestProgramsMetadataTruncation(t *testing.T) {
+	server := newS3Server(t)
+	storage := newS3Storage(t, newS3Config(t, server))
+
+	// Each of the first two programs is escaped to 600 characters, so only the first one fits in the metadata. A
+	// single program longer than the limit is cut between escape sequences.
+	program := strings.Repeat("é", 100)
+	longProgram := strings.Repeat("é", 1000)
+	for name, programs := range map[string][]string{
+		"test1": {program, program, longProgram},
+		"test2": {longProgram},
+	} {
+		writer, err := storage.OpenWriter(name)
+		if err != nil {
+			t.Fatalf("failed to open storage writer (%v)", err)
+		}
+		writer.SetMetadata(1000, "127.0.0.1", "DE", nil)
+		if _, err := writer.Write([]byte("Hello world!")); err != nil {
+			t.Fatalf("failed to write to storage writer (%v)", err)
+		}
+		writer.(auditLogStorage.SessionInfoWriter).SetSessionInfo(auditLogStorage.SessionInfo{
+			EndTime:  1060,
+			Programs: programs,
+		})
+		if err := writer.Close(); err != nil {
+			t.Fatalf("failed to close storage writer (%v)", err)
+		}
 	}
-	accessKey := "asdfasdfasdf"
-	secretKey := "asdfasdfasdf"
+	storage.Shutdown(context.Background())
 
-	region := "us-east-1"
-	bucket := "auditlog"
-	endpoint := "http://127.0.0.1:9000"
+	object, ok := server.GetObject("auditlog", "test1")
+	if assert.True(t, ok) {
+		assert.Equal(t, url.QueryEscape(program), object.Metadata["programs"])
+	}
+	object, ok = server.GetObject("auditlog", "test2")
+	if assert.True(t, ok) {
+		programs := object.Metadata["programs"]
+		assert.LessOrEqual(t, len(programs), 1024)
+		decoded, err := url.QueryUnescape(programs)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, decoded)
+		assert.True(t, strings.HasPrefix(longProgram, decoded))
+	}
+}
 
-	m := &minio{}
+func TestTagsAndSessionMetadata(t *testing.T) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+	config.Tags = s3.Tags{
+		Username:    true,
+		Country:     true,
+		Outcome:     true,
+		AuthMethods: true,
+	}
+	storage := newS3Storage(t, config)
 
-	storage, err := m.Start(t, accessKey, secretKey, region, bucket, endpoint)
-	defer m.Stop()
+	writer, err := storage.OpenWriter("test")
 	if err != nil {
+		t.Fatalf("failed to open storage writer (%v)", err)
+	}
+	writer.(auditLogStorage.ContentTypeWriter).SetContentType("application/x-asciicast")
+	username := "foo"
+	writer.SetMetadata(1000, "127.0.0.1", "DE", &username)
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatalf("failed to write to storage writer (%v)", err)
+	}
+	exitStatus := uint32(1)
+	writer.(auditLogStorage.SessionInfoWriter).SetSessionInfo(auditLogStorage.SessionInfo{
+		EndTime:     1060,
+		Channels:    1,
+		Programs:    []string{"ls -l"},
+		ExitStatus:  &exitStatus,
+		AuthMethods: []string{"password", "pubkey"},
+		StdoutBytes: 42,
+	})
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close storage writer (%v)", err)
+	}
+
+	storage.Shutdown(context.Background())
+
+	objects := getS3Objects(t, storage)
+	if !assert.Equal(t, 1, len(objects)) {
 		return
 	}
+	assert.Equal(t, "60", objects[0].Metadata["Duration"])
+	assert.Equal(t, "ls+-l", objects[0].Metadata["Programs"])
+	assert.Equal(t, "1", objects[0].Metadata["Exitstatus"])
+	assert.Equal(t, "password,pubkey", objects[0].Metadata["Authmethods"])
+	assert.Equal(t, "42", objects[0].Metadata["Stdoutbytes"])
+	assert.NotContains(t, objects[0].Metadata, "Stdinbytes")
+
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "application/x-asciicast", object.ContentType)
+	assert.Equal(
+		t,
+		map[string]string{"username": "foo", "country": "DE", "outcome": "failure", "authmethods": "password+pubkey"},
+		object.Tags,
+	)
+}
+
+func TestMultipartUploadTags(t *testing.T) {
+	server := newS3Server(t, s3test.Bucket{Name: "auditlog", ObjectLock: true})
+	config := newS3Config(t, server)
+	config.Tags = s3.Tags{Username: true, Country: true}
+	config.ObjectLock = s3.ObjectLock{LegalHold: true}
+	storage := newS3Storage(t, config)
 
 	writer, err := storage.OpenWriter("test")
 	if err != nil {
-		assert.Fail(t, "failed to open storage writer (%v)", err)
-		return
+		t.Fatalf("failed to open storage writer (%v)", err)
 	}
-	size := 25 * 1000 * 1000
-	var data = []byte("0123456789")
-	for i := 0; i < size/len(data); i++ {
-		if _, err := writer.Write(data); err != nil {
-			assert.Fail(t, "failed to write to storage writer (%v)", err)
-			return
-		}
+	username := "foo"
+	writer.SetMetadata(1000, "127.0.0.1", "DE", &username)
+	data := bytes.Repeat([]byte("a"), 11*1024*1024)
+	// Write in two steps so the multipart upload is created before the audit log is finished.
+	if _, err := writer.Write(data[:6*1024*1024]); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return server.RequestCount(s3test.OperationUploadPart) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	if _, err := writer.Write(data[6*1024*1024:]); err != nil {
+		t.Fatal(err)
 	}
 	if err := writer.Close(); err != nil {
-		assert.Fail(t, "failed to close storage writer (%v)", err)
-		return
+		t.Fatalf("failed to close storage writer (%v)", err)
 	}
 
 	storage.Shutdown(context.Background())
 
-	objects := waitForS3Objects(t, storage, 1)
-	assert.Equal(t, 1, len(objects))
-
-	r, err := storage.OpenReader(objects[0].Name)
-	if err != nil {
-		assert.Fail(t, "failed to open reader for recently stored object", err)
+	object, ok := server.GetObject("auditlog", "test")
+	if !assert.True(t, ok) {
 		return
 	}
-	d, err := ioutil.ReadAll(r)
+	assert.Equal(t, map[string]string{"username": "foo", "country": "DE"}, object.Tags)
+	// The tags are set when the upload is created, so they need no update afterwards.
+	assert.Equal(t, 0, server.RequestCount(s3test.OperationPutObjectTagging))
+	assert.Equal(t, 0, server.RequestCount(s3test.OperationCopyObject))
+}
+
+func TestAbortUpload(t *testing.T) {
+	server := newS3Server(t)
+	config := newS3Config(t, server)
+	storage := newS3Storage(t, config)
+
+	writer, err := storage.OpenWriter("test")
 	if err != nil {
-		assert.Fail(t, "failed to open read from S3", err)
-		return
+		t.Fatalf("failed to open storage writer (%v)", err)
 	}
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatalf("failed to write to storage writer (%v)", err)
+	}
+	assert.NoError(t, writer.(auditLogStorage.AbortableWriter).Abort())
+
+	storage.Shutdown(context.Background())
 
-	assert.Equal(t, size, len(d))
+	assert.Empty(t, server.Keys("auditlog"))
+	files, err := ioutil.ReadDir(config.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, files)
 }
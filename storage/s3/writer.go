@@ -10,8 +10,12 @@ func newMonitoringWriter(
 	backingWriter io.WriteCloser,
 	partSize uint,
 	onMetadata func(startTime int64, remoteAddr string, country string, username *string),
+	onContentType func(contentType string),
+	onSessionInfo func(info storage.SessionInfo),
 	onPart func(),
 	onClose func(),
+	onAbort func(),
+	acceptsIO func() bool,
 ) storage.Writer {
 	return &monitoringWriter{
 		backingWriter: backingWriter,
@@ -19,8 +23,12 @@ func newMonitoringWriter(
 		partSize:      partSize,
 		lastPart:      0,
 		onMetadata:    onMetadata,
+		onContentType: onContentType,
+		onSessionInfo: onSessionInfo,
 		onPart:        onPart,
 		onClose:       onClose,
+		onAbort:       onAbort,
+		acceptsIO:     acceptsIO,
 	}
 }
 
@@ -31,8 +39,12 @@ type monitoringWriter struct {
 	bytesWritten  uint64
 	partSize      uint
 	onMetadata    func(startTime int64, remoteAddr string, country string, username *string)
+	onContentType func(contentType string)
+	onSessionInfo func(info storage.SessionInfo)
 	onPart        func()
 	onClose       func()
+	onAbort       func()
+	acceptsIO     func() bool
 	lastPart      int
 }
 
@@ -40,6 +52,18 @@ func (m *monitoringWriter) SetMetadata(startTime int64, sourceIP string, country
 	m.onMetadata(startTime, sourceIP, country, username)
 }
 
+func (m *monitoringWriter) SetContentType(contentType string) {
+	m.onContentType(contentType)
+}
+
+func (m *monitoringWriter) SetSessionInfo(info storage.SessionInfo) {
+	m.onSessionInfo(info)
+}
+
+func (m *monitoringWriter) AcceptsIO() bool {
+	return m.acceptsIO()
+}
+
 func (m *monitoringWriter) Write(p []byte) (n int, err error) {
 	bytes, err := m.backingWriter.Write(p)
 	m.bytesWritten += uint64(bytes)
@@ -55,3 +79,10 @@ func (m *monitoringWriter) Close() error {
 	go m.onClose()
 	return err
 }
+
+// Abort closes the local file and discards the audit log without uploading it.
+func (m *monitoringWriter) Abort() error {
+	err := m.backingWriter.Close()
+	m.onAbort()
+	return err
+}
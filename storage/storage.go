@@ -5,7 +5,8 @@ import (
 	"io"
 )
 
-// Entry is a storage entry returned from readers
+// Entry is a storage entry returned from readers. The metadata may contain the timestamp, username and country keys,
+// depending on the storage.
 type Entry struct {
 	Name     string
 	Metadata map[string]string
@@ -29,7 +30,9 @@ type WritableStorage interface {
 // ReadableStorage is an audit log storage type that can be read from
 type ReadableStorage interface {
 	OpenReader(name string) (io.ReadCloser, error)
-	List() (<-chan Entry, <-chan error)
+	// List lists the audit logs matching the query. Both channels are closed when the listing is complete. Listing
+	// stops early and closes the channels when the context is cancelled.
+	List(ctx context.Context, query Query) (<-chan Entry, <-chan error)
 }
 
 // Writer the Writer is a regular WriteCloser with an added function to set the connection metadata for indexing.
@@ -46,3 +49,49 @@ type Writer interface {
 	//           may be called subsequently is the user authenticated.
 	SetMetadata(startTime int64, sourceIP string, country string, username *string)
 }
+
+// ContentTypeWriter is an optional interface a Writer can implement to receive the MIME type of the audit log format.
+type ContentTypeWriter interface {
+	// SetContentType sets the MIME type of the audit log. It is called once, before the first write.
+	SetContentType(contentType string)
+}
+
+// IOFilterWriter is an optional interface a Writer can implement to stop the recording of the I/O of a connection, for
+// example while the storage is running out of space. Other messages are still written.
+type IOFilterWriter interface {
+	// AcceptsIO returns false while I/O messages should not be written to the audit log.
+	AcceptsIO() bool
+}
+
+// SessionInfo contains the details of a session that are only known when the session has ended.
+type SessionInfo struct {
+	// EndTime is the time the connection ended in unix timestamp.
+	EndTime int64
+	// Channels is the number of successfully opened channels.
+	Channels int
+	// Programs lists the programs executed in the session, in order.
+	Programs []string
+	// ExitStatus is the exit status of the last program that exited, or nil if no program exited.
+	ExitStatus *uint32
+	// AuthMethods lists the distinct authentication methods the user tried, in order.
+	AuthMethods []string
+	// StdinBytes is the number of intercepted bytes sent by the user.
+	StdinBytes uint64
+	// StdoutBytes is the number of intercepted bytes sent to the user on the standard output.
+	StdoutBytes uint64
+	// StderrBytes is the number of intercepted bytes sent to the user on the standard error.
+	StderrBytes uint64
+}
+
+// SessionInfoWriter is an optional interface a Writer can implement to store details about the ended session.
+type SessionInfoWriter interface {
+	// SetSessionInfo stores the details of the ended session. It is called once, right before Close.
+	SetSessionInfo(info SessionInfo)
+}
+
+// AbortableWriter is an optional interface a Writer can implement to discard an audit log instead of finishing it, for
+// example when the audit log cannot be written to all required storages.
+type AbortableWriter interface {
+	// Abort closes the writer and removes the audit log written so far. It is called instead of Close.
+	Abort() error
+}
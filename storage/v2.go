@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned by the V2 storage methods when the requested audit log does not exist.
+var ErrNotFound = errors.New("audit log not found")
+
+// ErrNotSupported is returned when the storage does not support the requested operation.
+var ErrNotSupported = errors.New("operation not supported by the storage")
+
+// ErrInUse is returned by Delete when the audit log is still being written.
+var ErrInUse = errors.New("audit log is still being written")
+
+// ErrInvalidRange is returned by OpenRange when the offset is negative.
+var ErrInvalidRange = errors.New("invalid audit log range")
+
+// EntryInfo describes a stored audit log.
+type EntryInfo struct {
+	// Name is the name of the audit log.
+	Name string
+	// Size is the size of the audit log in bytes. For audit logs that are still being written this is the number of
+	// bytes written so far.
+	Size int64
+	// Metadata contains the metadata stored with the audit log. See Entry for the keys.
+	Metadata map[string]string
+	// Finished is true if the audit log has been completely written and will not change anymore.
+	Finished bool
+}
+
+// ReadWriteStorageV2 is a context-aware storage that can store as well as retrieve and manage audit logs.
+type ReadWriteStorageV2 interface {
+	ReadableStorageV2
+	WritableStorageV2
+}
+
+// WritableStorageV2 is a context-aware audit log storage that can be written to.
+type WritableStorageV2 interface {
+	// Create opens a writer for a specific audit log. The context only applies to opening the writer.
+	Create(ctx context.Context, name string) (Writer, error)
+	// Shutdown waits until all uploads are complete and then shuts down the storage. If the shutdownContext expires it
+	// will wait for all running audit logs to finish, then abort all uploads and exit immediately.
+	Shutdown(shutdownContext context.Context)
+}
+
+// ReadableStorageV2 is a context-aware audit log storage that can be read from and managed.
+type ReadableStorageV2 interface {
+	// Open opens a reader for the full audit log. Returns ErrNotFound if the audit log does not exist.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// OpenRange opens a reader for length bytes of the audit log, starting at offset. A negative length reads until
+	// the end of the audit log. Returns ErrNotFound if the audit log does not exist and ErrInvalidRange if the offset
+	// is negative.
+	OpenRange(ctx context.Context, name string, offset int64, length int64) (io.ReadCloser, error)
+	// Stat returns the size, metadata and state of an audit log. Returns ErrNotFound if the audit log does not exist.
+	Stat(ctx context.Context, name string) (EntryInfo, error)
+	// Delete removes an audit log from the storage. Returns ErrNotFound if the audit log does not exist, if the
+	// storage can tell, and ErrInUse if the audit log is still being written by this storage instance.
+	Delete(ctx context.Context, name string) error
+	// List lists the audit logs matching the query. Both channels are closed when the listing is complete. Listing
+	// stops early and closes the channels when the context is cancelled.
+	List(ctx context.Context, query Query) (<-chan Entry, <-chan error)
+}
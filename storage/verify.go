@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrChecksumMismatch is returned by Verify when the stored audit log does not match the checksum recorded during
+// the upload.
+var ErrChecksumMismatch = errors.New("audit log checksum mismatch")
+
+// ErrNoChecksum is returned by Verify when no checksum was recorded for the audit log, for example because it was
+// uploaded by an older version.
+var ErrNoChecksum = errors.New("no checksum recorded for the audit log")
+
+// VerifiableStorage is an optional interface a storage can implement to check the integrity of stored audit logs.
+type VerifiableStorage interface {
+	// Verify downloads the audit log and compares it with the checksum recorded during the upload. Returns
+	// ErrChecksumMismatch if the content differs, ErrNoChecksum if no checksum was recorded, and ErrNotFound if the
+	// audit log does not exist.
+	Verify(ctx context.Context, name string) error
+}
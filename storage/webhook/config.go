@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the configuration for the webhook storage.
+type Config struct {
+	// URL is the HTTP or HTTPS URL the batches are POSTed to.
+	URL string `json:"url" yaml:"url"`
+	// Headers are additional HTTP headers sent with every request, for example for authentication.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Timeout is the timeout for a single request.
+	Timeout time.Duration `json:"timeout" yaml:"timeout" default:"10s"`
+	// CACert is the PEM-encoded CA certificate to verify the server certificate with. Defaults to the system CAs.
+	CACert string `json:"cacert" yaml:"cacert"`
+	// Cert is the PEM-encoded client certificate for mutual TLS authentication.
+	Cert string `json:"cert" yaml:"cert"`
+	// Key is the PEM-encoded private key of the client certificate.
+	Key string `json:"key" yaml:"key"`
+	// BatchSize is the number of bytes after which the buffered audit log data is sent.
+	BatchSize uint `json:"batchSize" yaml:"batchSize" default:"65536"`
+	// FlushInterval is the maximum time audit log data is buffered before it is sent.
+	FlushInterval time.Duration `json:"flushInterval" yaml:"flushInterval" default:"1s"`
+	// InitialBackoff is the time to wait before retrying a failed request. Doubles with every failure.
+	InitialBackoff time.Duration `json:"initialBackoff" yaml:"initialBackoff" default:"1s"`
+	// MaxBackoff is the maximum time to wait between retries.
+	MaxBackoff time.Duration `json:"maxBackoff" yaml:"maxBackoff" default:"1m"`
+	// SpoolDirectory is the directory batches are stored in until they are delivered. Batches in the spool directory
+	// survive endpoint outages and restarts. If empty, batches are kept in memory.
+	SpoolDirectory string `json:"spoolDirectory" yaml:"spoolDirectory"`
+	// MaxMemoryBatches is the maximum number of undelivered batches kept in memory if no spool directory is set. When
+	// the limit is reached new batches are rejected and their audit logs are aborted.
+	MaxMemoryBatches uint `json:"maxMemoryBatches" yaml:"maxMemoryBatches" default:"1000"`
+	// ShutdownTimeout is the maximum time the shutdown waits for the open audit logs to be closed and the spool to be
+	// delivered, even if the shutdown context has no deadline.
+	ShutdownTimeout time.Duration `json:"shutdownTimeout" yaml:"shutdownTimeout" default:"30s"`
+}
+
+// Validate validates the webhook configuration.
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("no webhook URL provided")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %s (%w)", c.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook URL scheme: %s (must be http or https)", u.Scheme)
+	}
+	for header, value := range c.Headers {
+		if err := validateHeader(header, value); err != nil {
+			return err
+		}
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("the client certificate and key must be provided together")
+	}
+	if c.MaxBackoff != 0 && c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("maximum backoff %s is lower than the initial backoff %s", c.MaxBackoff, c.InitialBackoff)
+	}
+	if c.SpoolDirectory != "" {
+		stat, err := os.Stat(c.SpoolDirectory)
+		if err != nil {
+			return fmt.Errorf("invalid spool directory: %s (%w)", c.SpoolDirectory, err)
+		}
+		if !stat.IsDir() {
+			return fmt.Errorf("invalid spool directory: %s (not a directory)", c.SpoolDirectory)
+		}
+	}
+	return nil
+}
+
+// validateHeader checks if the header name is a token and the value contains no control characters, as the HTTP client
+// refuses to send such headers.
+func validateHeader(name string, value string) error {
+	invalidName := strings.IndexFunc(name, func(r rune) bool {
+		return r <= ' ' || r >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r)
+	})
+	if name == "" || invalidName >= 0 {
+		return fmt.Errorf("invalid HTTP header name: %q", name)
+	}
+	invalidValue := strings.IndexFunc(value, func(r rune) bool {
+		return (r < ' ' && r != '\t') || r == 0x7f
+	})
+	if invalidValue >= 0 {
+		return fmt.Errorf("invalid value for HTTP header %s", name)
+	}
+	return nil
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 65536
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = time.Minute
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		c.MaxBackoff = c.InitialBackoff
+	}
+	if c.MaxMemoryBatches == 0 {
+		c.MaxMemoryBatches = 1000
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 30 * time.Second
+	}
+	return c
+}
+
+func (c Config) getHTTPClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CACert != "" {
+		rootCAs := x509.NewCertPool()
+		if ok := rootCAs.AppendCertsFromPEM([]byte(c.CACert)); !ok {
+			return nil, fmt.Errorf("failed to add CA certificate from config file")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if c.Cert != "" {
+		cert, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate (%w)", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: c.Timeout,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/storage"
+)
+
+// NewStorage creates a storage that POSTs the audit logs in batches to an HTTP endpoint, for example the HTTP collector
+// of a SIEM. Each request contains a chunk of the encoded audit log. The receiver can reassemble the audit log from the
+// name and sequence headers. Undelivered batches are retried with a backoff and kept in the spool until delivered.
+func NewStorage(cfg Config, logger log.Logger) (storage.WritableStorage, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.withDefaults()
+	client, err := cfg.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	var s spool
+	if cfg.SpoolDirectory != "" {
+		s, err = newDiskSpool(cfg.SpoolDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the spool directory %s (%w)", cfg.SpoolDirectory, err)
+		}
+	} else {
+		s = newMemorySpool(cfg.MaxMemoryBatches)
+	}
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	st := &webhookStorage{
+		config:     cfg,
+		client:     client,
+		spool:      s,
+		logger:     logger,
+		notify:     make(chan struct{}, 1),
+		writersWg:  &sync.WaitGroup{},
+		rejected:   map[string]bool{},
+		lock:       &sync.Mutex{},
+		senderDone: make(chan struct{}),
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+	}
+	go st.sendLoop()
+	return st, nil
+}
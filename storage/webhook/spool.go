@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batch is a chunk of an encoded audit log waiting to be delivered.
+type batch struct {
+	// Name is the name of the audit log.
+	Name string `json:"name"`
+	// Sequence is the number of the batch within the audit log, starting at 0.
+	Sequence uint64 `json:"sequence"`
+	// Final is set on the last batch of the audit log.
+	Final bool `json:"final"`
+	// Aborted is set on the final batch if the audit log was discarded and the batches delivered so far should be
+	// discarded by the receiver as well.
+	Aborted bool `json:"aborted"`
+	// ContentType is the MIME type of the audit log format.
+	ContentType string `json:"contentType"`
+	// Metadata contains the connection metadata known when the batch was created.
+	Metadata metadata `json:"metadata"`
+	// Data is the encoded audit log data.
+	Data []byte `json:"data"`
+}
+
+type metadata struct {
+	StartTime int64   `json:"startTime"`
+	SourceIP  string  `json:"sourceIP"`
+	Country   string  `json:"country"`
+	Username  *string `json:"username"`
+}
+
+// errSpoolFull is returned by push if the spool has no room for the batch.
+var errSpoolFull = errors.New("the webhook spool is full")
+
+// spool is a first-in-first-out queue of undelivered batches.
+type spool interface {
+	// push adds a batch to the end of the queue.
+	push(b batch) error
+	// peek returns the oldest batch and its ID, or nil if the queue is empty.
+	peek() (*batch, string, error)
+	// remove removes a delivered batch from the queue.
+	remove(id string) error
+	// len returns the number of queued batches.
+	len() int
+}
+
+type memorySpool struct {
+	lock    *sync.Mutex
+	limit   int
+	batches []batch
+	ids     []string
+	nextID  uint64
+}
+
+func newMemorySpool(limit uint) *memorySpool {
+	return &memorySpool{
+		lock:  &sync.Mutex{},
+		limit: int(limit),
+	}
+}
+
+// push adds the batch if the spool is below its limit. Empty aborted final batches are always accepted so the receiver
+// is told to discard the audit logs the spool had no room for.
+func (m *memorySpool) push(b batch) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.batches) >= m.limit && !(b.Final && b.Aborted && len(b.Data) == 0) {
+		return errSpoolFull
+	}
+	m.batches = append(m.batches, b)
+	m.ids = append(m.ids, fmt.Sprintf("%d", m.nextID))
+	m.nextID++
+	return nil
+}
+
+func (m *memorySpool) peek() (*batch, string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.batches) == 0 {
+		return nil, "", nil
+	}
+	b := m.batches[0]
+	return &b, m.ids[0], nil
+}
+
+func (m *memorySpool) remove(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.ids) > 0 && m.ids[0] == id {
+		m.batches = m.batches[1:]
+		m.ids = m.ids[1:]
+	}
+	return nil
+}
+
+func (m *memorySpool) len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.batches)
+}
+
+// diskSpool stores each batch as a JSON file in the spool directory. The file names start with the creation time so
+// the batches are delivered in order, including batches left over from a previous run. The ordered list of files is
+// read from the directory once and kept in memory afterwards.
+type diskSpool struct {
+	lock      *sync.Mutex
+	directory string
+	counter   uint64
+	files     []string
+}
+
+const spoolFileSuffix = ".batch.json"
+
+func newDiskSpool(directory string) (*diskSpool, error) {
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return &diskSpool{
+		lock:      &sync.Mutex{},
+		directory: directory,
+		files:     files,
+	}, nil
+}
+
+// push writes the batch to the spool directory. The lock is held until the file is added to the index so the files
+// are delivered in the order of their names.
+func (d *diskSpool) push(b batch) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.counter++
+	name := fmt.Sprintf("%020d-%010d%s", time.Now().UnixNano(), d.counter, spoolFileSuffix)
+	tmpFile := path.Join(d.directory, name+".tmp")
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, path.Join(d.directory, name)); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	d.files = append(d.files, name)
+	return nil
+}
+
+func (d *diskSpool) peek() (*batch, string, error) {
+	d.lock.Lock()
+	if len(d.files) == 0 {
+		d.lock.Unlock()
+		return nil, "", nil
+	}
+	id := d.files[0]
+	d.lock.Unlock()
+	data, err := ioutil.ReadFile(path.Join(d.directory, id))
+	if err != nil {
+		return nil, id, err
+	}
+	b := &batch{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, id, fmt.Errorf("corrupt spool file %s (%w)", id, err)
+	}
+	return b, id, nil
+}
+
+// remove deletes the spool file. The file is removed from the index even if it is already gone so it doesn't block
+// the queue.
+func (d *diskSpool) remove(id string) error {
+	err := os.Remove(path.Join(d.directory, id))
+	if err != nil && os.IsNotExist(err) {
+		err = nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err == nil && len(d.files) > 0 && d.files[0] == id {
+		d.files = d.files[1:]
+	}
+	return err
+}
+
+func (d *diskSpool) len() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.files)
+}
@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/containerssh/log"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/storage"
+)
+
+type webhookStorage struct {
+	config    Config
+	client    *http.Client
+	spool     spool
+	logger    log.Logger
+	notify    chan struct{}
+	writersWg *sync.WaitGroup
+	// rejected contains the audit logs the webhook permanently rejected a batch of. Guarded by lock.
+	rejected   map[string]bool
+	lock       *sync.Mutex
+	senderDone chan struct{}
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+}
+
+func (w *webhookStorage) OpenWriter(name string) (storage.Writer, error) {
+	w.writersWg.Add(1)
+	return newWriter(w, name), nil
+}
+
+// Shutdown waits for all audit logs to be closed and the spool to be delivered. If the shutdown context expires or the
+// shutdown timeout passes before the spool is empty the remaining batches are kept in the spool directory, or lost if
+// batches are kept in memory.
+func (w *webhookStorage) Shutdown(shutdownContext context.Context) {
+	ctx, cancel := context.WithTimeout(shutdownContext, w.config.ShutdownTimeout)
+	defer cancel()
+	writersDone := make(chan struct{})
+	go func() {
+		w.writersWg.Wait()
+		close(writersDone)
+	}()
+	select {
+	case <-writersDone:
+	case <-ctx.Done():
+	}
+loop:
+	for w.spool.len() > 0 {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	w.cancelFunc()
+	<-w.senderDone
+	if remaining := w.spool.len(); remaining > 0 {
+		w.logger.Warning(log.NewMessage(
+			codes.EWebhookUndelivered,
+			"shutting down with %d undelivered audit log batches",
+			remaining,
+		))
+	}
+}
+
+func (w *webhookStorage) isRejected(name string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.rejected[name]
+}
+
+func (w *webhookStorage) setRejected(name string, rejected bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if rejected {
+		w.rejected[name] = true
+	} else {
+		delete(w.rejected, name)
+	}
+}
+
+// enqueue adds a batch to the spool. If the batch cannot be spooled the receiver cannot reassemble the audit log, so
+// the audit log is aborted the same way as if the webhook rejected the batch.
+func (w *webhookStorage) enqueue(b batch) {
+	if err := w.spool.push(b); err != nil {
+		if errors.Is(err, errSpoolFull) {
+			w.logger.Warning(log.Wrap(
+				err,
+				codes.EWebhookBatchDropped,
+				"dropping batch %d of audit log %s, aborting the audit log",
+				b.Sequence,
+				b.Name,
+			).Label("log", b.Name))
+		} else {
+			w.logger.Error(log.Wrap(
+				err,
+				codes.EWebhookSpoolFailed,
+				"failed to spool batch %d of audit log %s, aborting the audit log",
+				b.Sequence,
+				b.Name,
+			).Label("log", b.Name))
+		}
+		w.setRejected(b.Name, true)
+		if b.Final {
+			b.Data = nil
+			b.Aborted = true
+			if err := w.spool.push(b); err != nil {
+				w.logger.Error(log.Wrap(
+					err,
+					codes.EWebhookSpoolFailed,
+					"failed to spool the final batch of aborted audit log %s",
+					b.Name,
+				).Label("log", b.Name))
+				w.setRejected(b.Name, false)
+			}
+		}
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *webhookStorage) sendLoop() {
+	defer close(w.senderDone)
+	failures := 0
+	for {
+		b, id, err := w.spool.peek()
+		if err != nil {
+			if id != "" {
+				// The batch cannot be read, skip it so it doesn't block the queue.
+				w.logger.Error(log.Wrap(err, codes.EWebhookBatchDropped, "dropping unreadable spooled batch %s", id))
+				_ = w.spool.remove(id)
+				continue
+			}
+			w.logger.Error(log.Wrap(err, codes.EWebhookSpoolFailed, "failed to read webhook spool"))
+			failures++
+			if !w.wait(failures) {
+				return
+			}
+			continue
+		}
+		if b == nil {
+			select {
+			case <-w.notify:
+				continue
+			case <-w.ctx.Done():
+				return
+			}
+		}
+		rejected := w.isRejected(b.Name)
+		if rejected {
+			if !b.Final {
+				// The receiver cannot reassemble the audit log without the rejected batch.
+				if err := w.spool.remove(id); err != nil {
+					w.logger.Error(log.Wrap(err, codes.EWebhookSpoolFailed, "failed to remove dropped batch %s", id))
+				}
+				continue
+			}
+			b.Data = nil
+			b.Aborted = true
+		}
+		permanent, err := w.deliver(b)
+		if err == nil || permanent {
+			if err != nil && !rejected {
+				w.logger.Error(log.Wrap(
+					err,
+					codes.EWebhookLogRejected,
+					"the webhook rejected batch %d of audit log %s, dropping the audit log",
+					b.Sequence,
+					b.Name,
+				).Label("log", b.Name))
+			}
+			if b.Final {
+				w.setRejected(b.Name, false)
+			} else if err != nil {
+				w.setRejected(b.Name, true)
+			}
+			if err := w.spool.remove(id); err != nil {
+				w.logger.Error(log.Wrap(err, codes.EWebhookSpoolFailed, "failed to remove delivered batch %s", id))
+			}
+			failures = 0
+			continue
+		}
+		failures++
+		w.logger.Warning(log.Wrap(
+			err,
+			codes.EWebhookDeliveryFailed,
+			"failed to deliver batch %d of audit log %s (attempt %d), retrying",
+			b.Sequence,
+			b.Name,
+			failures,
+		).Label("log", b.Name))
+		if !w.wait(failures) {
+			return
+		}
+	}
+}
+
+// wait waits for the backoff after the specified number of failures. Returns false if the storage is shutting down.
+func (w *webhookStorage) wait(failures int) bool {
+	backoff := float64(w.config.MaxBackoff)
+	if failures < 63 {
+		backoff = math.Min(float64(w.config.InitialBackoff)*math.Pow(2, float64(failures-1)), backoff)
+	}
+	select {
+	case <-time.After(time.Duration(backoff)):
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// deliver sends a batch to the webhook. It returns true if the error is permanent and the batch should not be retried.
+func (w *webhookStorage) deliver(b *batch) (bool, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.config.URL, bytes.NewReader(b.Data))
+	if err != nil {
+		return true, err
+	}
+	for header, value := range w.config.Headers {
+		req.Header.Set(header, value)
+	}
+	contentType := b.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	// The values taken from the connection are percent-encoded, as they may contain characters not allowed in headers.
+	req.Header.Set("X-Audit-Log-Name", url.PathEscape(b.Name))
+	req.Header.Set("X-Audit-Log-Sequence", strconv.FormatUint(b.Sequence, 10))
+	req.Header.Set("X-Audit-Log-Final", strconv.FormatBool(b.Final))
+	if b.Aborted {
+		req.Header.Set("X-Audit-Log-Aborted", "true")
+	}
+	if b.Metadata.StartTime != 0 {
+		req.Header.Set("X-Audit-Log-Start-Time", strconv.FormatInt(b.Metadata.StartTime, 10))
+		req.Header.Set("X-Audit-Log-Remote-Addr", url.PathEscape(b.Metadata.SourceIP))
+		req.Header.Set("X-Audit-Log-Country", url.PathEscape(b.Metadata.Country))
+	}
+	if b.Metadata.Username != nil {
+		req.Header.Set("X-Audit-Log-Username", url.PathEscape(*b.Metadata.Username))
+	}
+	// The request would fail the same way on every retry.
+	for header, values := range req.Header {
+		for _, value := range values {
+			if err := validateHeader(header, value); err != nil {
+				return true, err
+			}
+		}
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	permanent := resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout &&
+		resp.StatusCode != http.StatusTooManyRequests
+	return permanent, err
+}
@@ -0,0 +1,499 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/storage/webhook"
+)
+
+type receivedBatch struct {
+	name        string
+	sequence    int
+	final       bool
+	contentType string
+	token       string
+	aborted     bool
+	username    string
+	data        []byte
+}
+
+// collector records the received batches. The first failures requests are answered with a 503 status, and the
+// batches with the reject sequence number with a 400 status if reject is set.
+type collector struct {
+	// release holds up the requests until it is closed, if set.
+	release        chan struct{}
+	lock           sync.Mutex
+	failures       int
+	reject         bool
+	rejectSequence int
+	requests       int
+	batches        []receivedBatch
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	if c.release != nil {
+		<-c.release
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requests++
+	if c.failures > 0 {
+		c.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	sequence, _ := strconv.Atoi(r.Header.Get("X-Audit-Log-Sequence"))
+	if c.reject && sequence == c.rejectSequence {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.batches = append(c.batches, receivedBatch{
+		name:        r.Header.Get("X-Audit-Log-Name"),
+		sequence:    sequence,
+		final:       r.Header.Get("X-Audit-Log-Final") == "true",
+		contentType: r.Header.Get("Content-Type"),
+		token:       r.Header.Get("Authorization"),
+		aborted:     r.Header.Get("X-Audit-Log-Aborted") == "true",
+		username:    r.Header.Get("X-Audit-Log-Username"),
+		data:        data,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *collector) getBatches() []receivedBatch {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	batches := append([]receivedBatch(nil), c.batches...)
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].sequence < batches[j].sequence
+	})
+	return batches
+}
+
+func (c *collector) getRequests() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.requests
+}
+
+func (c *collector) assemble(name string) ([]byte, bool) {
+	var data []byte
+	final := false
+	for _, b := range c.getBatches() {
+		if b.name == name {
+			data = append(data, b.data...)
+			final = final || b.final
+		}
+	}
+	return data, final
+}
+
+func writeAuditLog(t *testing.T, st storage.WritableStorage, name string, parts ...string) {
+	writer, err := st.OpenWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentTypeWriter, ok := writer.(storage.ContentTypeWriter); ok {
+		contentTypeWriter.SetContentType("application/x-test")
+	}
+	writer.SetMetadata(time.Now().Unix(), "127.0.0.1", "XX", nil)
+	for _, part := range parts {
+		if _, err := writer.Write([]byte(part)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:       server.URL,
+		Headers:   map[string]string{"Authorization": "Bearer test"},
+		BatchSize: 5,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAuditLog(t, st, "test", "Hello ", "world", "!")
+	st.Shutdown(context.Background())
+
+	data, final := c.assemble("test")
+	assert.Equal(t, "Hello world!", string(data))
+	assert.True(t, final)
+	batches := c.getBatches()
+	assert.Equal(t, 3, len(batches))
+	for _, b := range batches {
+		assert.Equal(t, "Bearer test", b.token)
+		assert.Equal(t, "application/x-test", b.contentType)
+	}
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL: server.URL,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	username := "föo\r\nX-Injected: true"
+	writer.SetMetadata(time.Now().Unix(), "127.0.0.1", "XX", &username)
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, writer.Close())
+	st.Shutdown(context.Background())
+
+	batches := c.getBatches()
+	if !assert.Equal(t, 1, len(batches)) {
+		return
+	}
+	name, err := url.PathUnescape(batches[0].name)
+	assert.NoError(t, err)
+	assert.Equal(t, "test\r\n", name)
+	decodedUsername, err := url.PathUnescape(batches[0].username)
+	assert.NoError(t, err)
+	assert.Equal(t, username, decodedUsername)
+}
+
+func TestFlushInterval(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:           server.URL,
+		FlushInterval: 10 * time.Millisecond,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("Hello world!")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if data, _ := c.assemble("test"); len(data) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	data, final := c.assemble("test")
+	assert.Equal(t, "Hello world!", string(data))
+	assert.False(t, final)
+	assert.NoError(t, writer.Close())
+	st.Shutdown(context.Background())
+}
+
+func TestRetry(t *testing.T) {
+	c := &collector{failures: 2}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:            server.URL,
+		InitialBackoff: 10 * time.Millisecond,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAuditLog(t, st, "test", "Hello world!")
+	st.Shutdown(context.Background())
+
+	data, final := c.assemble("test")
+	assert.Equal(t, "Hello world!", string(data))
+	assert.True(t, final)
+	assert.Equal(t, 3, c.getRequests())
+}
+
+func TestRejectedBatch(t *testing.T) {
+	c := &collector{reject: true, rejectSequence: 1}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:       server.URL,
+		BatchSize: 5,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAuditLog(t, st, "test", "Hello ", "world", "!!!!!", "!")
+	st.Shutdown(context.Background())
+
+	// The batches after the rejected one are dropped and the receiver is told to discard the audit log.
+	batches := c.getBatches()
+	if !assert.Equal(t, 2, len(batches)) {
+		return
+	}
+	assert.Equal(t, 0, batches[0].sequence)
+	assert.Equal(t, "Hello ", string(batches[0].data))
+	assert.False(t, batches[0].aborted)
+	assert.Equal(t, 3, batches[1].sequence)
+	assert.True(t, batches[1].final)
+	assert.True(t, batches[1].aborted)
+	assert.Equal(t, 0, len(batches[1].data))
+}
+
+func TestRejectedAuditLogWrite(t *testing.T) {
+	c := &collector{reject: true, rejectSequence: 0}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:       server.URL,
+		BatchSize: 5,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte("Hello world!"))
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := writer.Write([]byte("!"))
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, writer.Close())
+	st.Shutdown(context.Background())
+}
+
+func TestMemorySpoolFull(t *testing.T) {
+	c := &collector{release: make(chan struct{})}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:              server.URL,
+		BatchSize:        5,
+		MaxMemoryBatches: 2,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, err := st.OpenWriter("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"Hello ", "world", "!!!!!"} {
+		_, err := writer.Write([]byte(part))
+		assert.NoError(t, err)
+	}
+	// The third batch did not fit in the spool, so the audit log is aborted.
+	_, err = writer.Write([]byte("!"))
+	assert.Error(t, err)
+	assert.NoError(t, writer.Close())
+	close(c.release)
+	st.Shutdown(context.Background())
+
+	// The first batch is only delivered if it was sent before the audit log was aborted, but the receiver is always told
+	// to discard the audit log.
+	batches := c.getBatches()
+	if !assert.NotEmpty(t, batches) {
+		return
+	}
+	last := batches[len(batches)-1]
+	assert.Equal(t, 3, last.sequence)
+	assert.True(t, last.final)
+	assert.True(t, last.aborted)
+	assert.Equal(t, 0, len(last.data))
+	for _, b := range batches[:len(batches)-1] {
+		assert.Equal(t, 0, b.sequence)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:             down.URL,
+		InitialBackoff:  10 * time.Millisecond,
+		ShutdownTimeout: 100 * time.Millisecond,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAuditLog(t, st, "test", "Hello world!")
+	start := time.Now()
+	st.Shutdown(context.Background())
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
+
+func TestSpoolSurvivesOutage(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "containerssh-webhook-spool-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	// The endpoint is down while the audit log is written.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:            down.URL,
+		SpoolDirectory: dir,
+		InitialBackoff: 10 * time.Millisecond,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAuditLog(t, st, "test", "Hello world!")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	st.Shutdown(ctx)
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files))
+
+	// The spooled batches are delivered once the endpoint is back.
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+	st, err = webhook.NewStorage(webhook.Config{
+		URL:            server.URL,
+		SpoolDirectory: dir,
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Shutdown(context.Background())
+	data, final := c.assemble("test")
+	assert.Equal(t, "Hello world!", string(data))
+	assert.True(t, final)
+	files, err = ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files))
+}
+
+func TestMutualTLS(t *testing.T) {
+	caCert, caKey, caPEM := createCertificate(t, nil, nil, "ca")
+	serverCert, serverKey, _ := createCertificate(t, caCert, caKey, "server")
+	_, clientKey, clientPEM := createCertificate(t, caCert, caKey, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	c := &collector{}
+	server := httptest.NewUnstartedServer(c)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	keyBytes, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := webhook.NewStorage(webhook.Config{
+		URL:    server.URL,
+		CACert: caPEM,
+		Cert:   clientPEM,
+		Key:    string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})),
+	}, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAuditLog(t, st, "test", "Hello world!")
+	st.Shutdown(context.Background())
+
+	data, _ := c.assemble("test")
+	assert.Equal(t, "Hello world!", string(data))
+}
+
+func createCertificate(
+	t *testing.T,
+	parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+	name string,
+) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := &bytes.Buffer{}
+	if err := pem.Encode(certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, certPEM.String()
+}
+
+func TestValidation(t *testing.T) {
+	assert.Error(t, webhook.Config{}.Validate())
+	assert.Error(t, webhook.Config{URL: "ftp://example.com"}.Validate())
+	assert.Error(t, webhook.Config{URL: "https://example.com", Cert: "cert"}.Validate())
+	assert.Error(t, webhook.Config{URL: "https://example.com", Headers: map[string]string{"X-Test": "a\nb"}}.Validate())
+	assert.Error(t, webhook.Config{URL: "https://example.com", Headers: map[string]string{"X Test": "a"}}.Validate())
+	assert.NoError(t, webhook.Config{URL: "https://example.com"}.Validate())
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type writer struct {
+	storage     *webhookStorage
+	name        string
+	lock        *sync.Mutex
+	buffer      []byte
+	sequence    uint64
+	contentType string
+	metadata    metadata
+	closed      bool
+	done        chan struct{}
+}
+
+func newWriter(storage *webhookStorage, name string) *writer {
+	w := &writer{
+		storage: storage,
+		name:    name,
+		lock:    &sync.Mutex{},
+		done:    make(chan struct{}),
+	}
+	go w.flushLoop(storage.config.FlushInterval)
+	return w
+}
+
+// flushLoop sends the buffered data periodically so audit events are delivered in near real time.
+func (w *writer) flushLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.lock.Lock()
+			w.flush(false)
+			w.lock.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// flush enqueues the buffered data as a batch. Must be called with the lock held.
+func (w *writer) flush(final bool) {
+	if len(w.buffer) == 0 && !final {
+		return
+	}
+	w.storage.enqueue(batch{
+		Name:        w.name,
+		Sequence:    w.sequence,
+		Final:       final,
+		ContentType: w.contentType,
+		Metadata:    w.metadata,
+		Data:        w.buffer,
+	})
+	w.buffer = nil
+	w.sequence++
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("audit log %s is already closed", w.name)
+	}
+	if w.storage.isRejected(w.name) {
+		return 0, fmt.Errorf("the webhook rejected audit log %s", w.name)
+	}
+	w.buffer = append(w.buffer, p...)
+	if uint(len(w.buffer)) >= w.storage.config.BatchSize {
+		w.flush(false)
+	}
+	return len(p), nil
+}
+
+func (w *writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.flush(true)
+	close(w.done)
+	w.storage.writersWg.Done()
+	return nil
+}
+
+// Abort discards the buffered data. If batches of the audit log have already been enqueued, an empty final batch with
+// the X-Audit-Log-Aborted header tells the receiver to discard the audit log.
+func (w *writer) Abort() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.buffer = nil
+	if w.sequence > 0 {
+		w.storage.enqueue(batch{
+			Name:        w.name,
+			Sequence:    w.sequence,
+			Final:       true,
+			Aborted:     true,
+			ContentType: w.contentType,
+			Metadata:    w.metadata,
+		})
+		w.sequence++
+	}
+	close(w.done)
+	w.storage.writersWg.Done()
+	return nil
+}
+
+func (w *writer) SetMetadata(startTime int64, sourceIP string, country string, username *string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.metadata = metadata{
+		StartTime: startTime,
+		SourceIP:  sourceIP,
+		Country:   country,
+	}
+	if username != nil {
+		u := *username
+		w.metadata.Username = &u
+	}
+}
+
+func (w *writer) SetContentType(contentType string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.contentType = contentType
+}
@@ -0,0 +1,67 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/storage"
+	"github.com/containerssh/auditlog/summary"
+
+	"github.com/containerssh/log"
+)
+
+// writeSummaries writes the summary of the connection to the outputs with summaries enabled. The summaries are written
+// in the background so the storages do not delay the disconnect.
+func (l *loggerConnection) writeSummaries() {
+	var outputs []Output
+	for _, output := range l.l.outputs {
+		if output.Summary {
+			outputs = append(outputs, output)
+		}
+	}
+	if len(outputs) == 0 {
+		return
+	}
+	s := l.summary.Summary()
+	info := l.getSessionInfo()
+	l.l.wg.Add(1)
+	go func() {
+		defer l.l.wg.Done()
+		for _, output := range outputs {
+			name := string(s.ConnectionID) + output.NameSuffix + summary.NameSuffix
+			if err := writeSummary(output.Storage, name, s, info); err != nil {
+				l.l.logger.Error(
+					log.Wrap(err, codes.ESummaryWriteFailed, "failed to write summary %s", name),
+				)
+			}
+		}
+	}()
+}
+
+func writeSummary(st storage.WritableStorage, name string, s summary.Summary, info storage.SessionInfo) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary (%w)", err)
+	}
+	writer, err := st.OpenWriter(name)
+	if err != nil {
+		return err
+	}
+	if contentTypeWriter, ok := writer.(storage.ContentTypeWriter); ok {
+		contentTypeWriter.SetContentType(summary.MimeType)
+	}
+	var username *string
+	if s.Authenticated {
+		username = &s.Username
+	}
+	writer.SetMetadata(s.StartTime/1000000000, s.RemoteAddr, s.Country, username)
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	if sessionInfoWriter, ok := writer.(storage.SessionInfoWriter); ok {
+		sessionInfoWriter.SetSessionInfo(info)
+	}
+	return writer.Close()
+}
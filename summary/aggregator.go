@@ -0,0 +1,219 @@
+package summary
+
+import (
+	"sync"
+	"time"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+// Aggregator builds a Summary from the messages of a single connection.
+type Aggregator interface {
+	// Add updates the summary with a message. Messages must be added in the order they were logged.
+	Add(msg message.Message)
+	// Summary returns a copy of the summary of the messages added so far.
+	Summary() Summary
+}
+
+// NewAggregator creates an empty aggregator. The aggregator is safe for concurrent use.
+func NewAggregator() Aggregator {
+	return &aggregator{
+		lock: &sync.Mutex{},
+	}
+}
+
+type aggregator struct {
+	lock    *sync.Mutex
+	summary Summary
+}
+
+func (a *aggregator) Add(msg message.Message) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s := &a.summary
+	if s.ConnectionID == "" {
+		s.ConnectionID = msg.ConnectionID
+	}
+	if s.StartTime == 0 {
+		s.StartTime = msg.Timestamp
+	}
+	switch msg.MessageType {
+	case message.TypeConnect:
+		payload := msg.Payload.(message.PayloadConnect)
+		s.RemoteAddr = payload.RemoteAddr
+		s.Country = payload.Country
+	case message.TypeDisconnect:
+		s.EndTime = msg.Timestamp
+		s.Duration = time.Duration(msg.Offset)
+
+	case message.TypeAuthPassword:
+		a.startAuth(msg, AuthMethodPassword, msg.Payload.(message.PayloadAuthPassword).Username)
+	case message.TypeAuthPasswordSuccessful:
+		a.finishAuth(msg, AuthMethodPassword, msg.Payload.(message.PayloadAuthPassword).Username, AuthResultSuccess)
+	case message.TypeAuthPasswordFailed:
+		a.finishAuth(msg, AuthMethodPassword, msg.Payload.(message.PayloadAuthPassword).Username, AuthResultFailed)
+	case message.TypeAuthPasswordBackendError:
+		username := msg.Payload.(message.PayloadAuthPasswordBackendError).Username
+		a.finishAuth(msg, AuthMethodPassword, username, AuthResultBackendError)
+	case message.TypeAuthPubKey:
+		a.startAuth(msg, AuthMethodPubKey, msg.Payload.(message.PayloadAuthPubKey).Username)
+	case message.TypeAuthPubKeySuccessful:
+		a.finishAuth(msg, AuthMethodPubKey, msg.Payload.(message.PayloadAuthPubKey).Username, AuthResultSuccess)
+	case message.TypeAuthPubKeyFailed:
+		a.finishAuth(msg, AuthMethodPubKey, msg.Payload.(message.PayloadAuthPubKey).Username, AuthResultFailed)
+	case message.TypeAuthPubKeyBackendError:
+		username := msg.Payload.(message.PayloadAuthPubKeyBackendError).Username
+		a.finishAuth(msg, AuthMethodPubKey, username, AuthResultBackendError)
+	case message.TypeAuthKeyboardInteractiveChallenge:
+		username := msg.Payload.(message.PayloadAuthKeyboardInteractiveChallenge).Username
+		// Several challenges may be issued during one keyboard-interactive attempt.
+		if a.pendingAuth(AuthMethodKeyboardInteractive, username) == nil {
+			a.startAuth(msg, AuthMethodKeyboardInteractive, username)
+		}
+	case message.TypeAuthKeyboardInteractiveFailed:
+		username := msg.Payload.(message.PayloadAuthKeyboardInteractiveFailed).Username
+		a.finishAuth(msg, AuthMethodKeyboardInteractive, username, AuthResultFailed)
+	case message.TypeAuthKeyboardInteractiveBackendError:
+		username := msg.Payload.(message.PayloadAuthKeyboardInteractiveBackendError).Username
+		a.finishAuth(msg, AuthMethodKeyboardInteractive, username, AuthResultBackendError)
+	case message.TypeHandshakeSuccessful:
+		username := msg.Payload.(message.PayloadHandshakeSuccessful).Username
+		s.Authenticated = true
+		s.Username = username
+		// The keyboard-interactive authentication has no success message, the successful handshake completes it.
+		if attempt := a.pendingAuth(AuthMethodKeyboardInteractive, username); attempt != nil {
+			attempt.Result = AuthResultSuccess
+		}
+
+	case message.TypeNewChannel:
+		a.channel(msg.ChannelID, msg.Payload.(message.PayloadNewChannel).ChannelType)
+	case message.TypeNewChannelSuccessful:
+		a.channel(msg.ChannelID, msg.Payload.(message.PayloadNewChannelSuccessful).ChannelType).Opened = true
+	case message.TypeNewChannelFailed:
+		payload := msg.Payload.(message.PayloadNewChannelFailed)
+		a.channel(msg.ChannelID, payload.ChannelType).Reason = payload.Reason
+
+	case message.TypeChannelRequestExec:
+		a.startProgram(msg, ProgramTypeExec, msg.Payload.(message.PayloadChannelRequestExec).Program)
+	case message.TypeChannelRequestShell:
+		a.startProgram(msg, ProgramTypeShell, "")
+	case message.TypeChannelRequestSubsystem:
+		a.startProgram(msg, ProgramTypeSubsystem, msg.Payload.(message.PayloadChannelRequestSubsystem).Subsystem)
+	case message.TypeExit:
+		if program := a.lastProgram(msg.ChannelID); program != nil {
+			exitStatus := msg.Payload.(message.PayloadExit).ExitStatus
+			program.ExitStatus = &exitStatus
+			program.ExitTimestamp = msg.Timestamp
+		}
+	case message.TypeExitSignal:
+		if program := a.lastProgram(msg.ChannelID); program != nil {
+			program.ExitSignal = msg.Payload.(message.PayloadExitSignal).Signal
+		}
+
+	case message.TypeIO:
+		payload := msg.Payload.(message.PayloadIO)
+		switch payload.Stream {
+		case message.StreamStdin:
+			s.Bytes.Stdin += uint64(len(payload.Data))
+		case message.StreamStdout:
+			s.Bytes.Stdout += uint64(len(payload.Data))
+		case message.StreamStderr:
+			s.Bytes.Stderr += uint64(len(payload.Data))
+		}
+	}
+}
+
+func (a *aggregator) Summary() Summary {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	result := a.summary
+	result.AuthAttempts = append([]AuthAttempt(nil), a.summary.AuthAttempts...)
+	result.Channels = append([]Channel(nil), a.summary.Channels...)
+	result.Programs = nil
+	for _, program := range a.summary.Programs {
+		if program.ExitStatus != nil {
+			exitStatus := *program.ExitStatus
+			program.ExitStatus = &exitStatus
+		}
+		result.Programs = append(result.Programs, program)
+	}
+	return result
+}
+
+func (a *aggregator) startAuth(msg message.Message, method AuthMethod, username string) {
+	a.summary.AuthAttempts = append(a.summary.AuthAttempts, AuthAttempt{
+		Timestamp: msg.Timestamp,
+		Method:    method,
+		Username:  username,
+		Result:    AuthResultUnknown,
+	})
+}
+
+func (a *aggregator) finishAuth(msg message.Message, method AuthMethod, username string, result AuthResult) {
+	attempt := a.pendingAuth(method, username)
+	if attempt == nil {
+		a.startAuth(msg, method, username)
+		attempt = &a.summary.AuthAttempts[len(a.summary.AuthAttempts)-1]
+	}
+	attempt.Result = result
+	if result == AuthResultSuccess && method != AuthMethodKeyboardInteractive {
+		a.summary.Authenticated = true
+		a.summary.Username = username
+	}
+}
+
+// pendingAuth returns the last attempt with the specified method and username if its result has not been recorded.
+func (a *aggregator) pendingAuth(method AuthMethod, username string) *AuthAttempt {
+	for i := len(a.summary.AuthAttempts) - 1; i >= 0; i-- {
+		attempt := &a.summary.AuthAttempts[i]
+		if attempt.Method == method && attempt.Username == username {
+			if attempt.Result == AuthResultUnknown {
+				return attempt
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// channel returns the channel with the specified ID, adding it if it was not requested yet.
+func (a *aggregator) channel(channelID message.ChannelID, channelType string) *Channel {
+	id := channelIDValue(channelID)
+	for i := len(a.summary.Channels) - 1; i >= 0; i-- {
+		if a.summary.Channels[i].ID == id {
+			return &a.summary.Channels[i]
+		}
+	}
+	a.summary.Channels = append(a.summary.Channels, Channel{
+		ID:   id,
+		Type: channelType,
+	})
+	return &a.summary.Channels[len(a.summary.Channels)-1]
+}
+
+func (a *aggregator) startProgram(msg message.Message, programType ProgramType, command string) {
+	a.summary.Programs = append(a.summary.Programs, Program{
+		Timestamp: msg.Timestamp,
+		ChannelID: channelIDValue(msg.ChannelID),
+		Type:      programType,
+		Command:   command,
+	})
+}
+
+// lastProgram returns the program most recently started in the channel.
+func (a *aggregator) lastProgram(channelID message.ChannelID) *Program {
+	id := channelIDValue(channelID)
+	for i := len(a.summary.Programs) - 1; i >= 0; i-- {
+		if a.summary.Programs[i].ChannelID == id {
+			return &a.summary.Programs[i]
+		}
+	}
+	return nil
+}
+
+func channelIDValue(channelID message.ChannelID) uint64 {
+	if channelID == nil {
+		return 0
+	}
+	return *channelID
+}
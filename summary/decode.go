@@ -0,0 +1,32 @@
+package summary
+
+import (
+	"github.com/containerssh/auditlog/message"
+)
+
+// FromMessages computes the summary of a decoded audit log, for example from the channels returned by
+// codec.Decoder.Decode. It reads both channels until they are closed and returns the first decoding error, if any,
+// along with the summary of the messages decoded successfully.
+func FromMessages(messages <-chan message.Message, errors <-chan error) (Summary, error) {
+	aggregator := NewAggregator()
+	var firstError error
+	for messages != nil || errors != nil {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			aggregator.Add(msg)
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			if firstError == nil {
+				firstError = err
+			}
+		}
+	}
+	return aggregator.Summary(), firstError
+}
@@ -0,0 +1,168 @@
+package summary
+
+import (
+	"time"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+// NameSuffix is appended to the audit log name to form the name of the summary written next to the audit log.
+const NameSuffix = ".summary.json"
+
+// MimeType is the MIME type of the JSON summary.
+const MimeType = "application/json"
+
+// Summary is a compact overview of a single connection.
+type Summary struct {
+	// ConnectionID is the ID of the summarized connection.
+	ConnectionID message.ConnectionID `json:"connectionId" yaml:"connectionId"`
+	// StartTime is the nanosecond timestamp of the connection.
+	StartTime int64 `json:"startTime" yaml:"startTime"`
+	// EndTime is the nanosecond timestamp of the disconnect, or 0 if the disconnect was not recorded.
+	EndTime int64 `json:"endTime" yaml:"endTime"`
+	// Duration is the time between the connection and the disconnect, or 0 if the disconnect was not recorded.
+	Duration time.Duration `json:"duration" yaml:"duration"`
+	// RemoteAddr is the IP address the user connected from.
+	RemoteAddr string `json:"remoteAddr" yaml:"remoteAddr"`
+	// Country is the country code looked up from the IP address, "XX" if the lookup failed.
+	Country string `json:"country" yaml:"country"`
+	// Authenticated is true if the user successfully authenticated.
+	Authenticated bool `json:"authenticated" yaml:"authenticated"`
+	// Username is the username the user authenticated with. Empty if the user did not authenticate.
+	Username string `json:"username" yaml:"username"`
+	// AuthAttempts lists the authentication attempts in order.
+	AuthAttempts []AuthAttempt `json:"authAttempts" yaml:"authAttempts"`
+	// Channels lists the channels requested by the user in order.
+	Channels []Channel `json:"channels" yaml:"channels"`
+	// Programs lists the programs, shells and subsystems started in the session in order.
+	Programs []Program `json:"programs" yaml:"programs"`
+	// Bytes contains the number of bytes transferred per stream. Only intercepted streams are counted.
+	Bytes StreamBytes `json:"bytes" yaml:"bytes"`
+}
+
+// AuthMethods returns the distinct authentication methods the user tried, in the order they were first tried.
+func (s Summary) AuthMethods() []AuthMethod {
+	var methods []AuthMethod
+	seen := map[AuthMethod]bool{}
+	for _, attempt := range s.AuthAttempts {
+		if !seen[attempt.Method] {
+			seen[attempt.Method] = true
+			methods = append(methods, attempt.Method)
+		}
+	}
+	return methods
+}
+
+// LastExitStatus returns the exit status of the program that exited last, or nil if no program exited normally.
+func (s Summary) LastExitStatus() *uint32 {
+	var exitStatus *uint32
+	exitTimestamp := int64(0)
+	for _, program := range s.Programs {
+		if program.ExitStatus != nil && (exitStatus == nil || program.ExitTimestamp >= exitTimestamp) {
+			exitStatus = program.ExitStatus
+			exitTimestamp = program.ExitTimestamp
+		}
+	}
+	return exitStatus
+}
+
+// ChannelsOpened returns the number of successfully opened channels.
+func (s Summary) ChannelsOpened() int {
+	count := 0
+	for _, channel := range s.Channels {
+		if channel.Opened {
+			count++
+		}
+	}
+	return count
+}
+
+// AuthMethod is the authentication method of an authentication attempt.
+type AuthMethod string
+
+const (
+	// AuthMethodPassword is the password authentication.
+	AuthMethodPassword AuthMethod = "password"
+	// AuthMethodPubKey is the public key authentication.
+	AuthMethodPubKey AuthMethod = "pubkey"
+	// AuthMethodKeyboardInteractive is the keyboard-interactive authentication.
+	AuthMethodKeyboardInteractive AuthMethod = "keyboard-interactive"
+)
+
+// AuthResult is the outcome of an authentication attempt.
+type AuthResult string
+
+const (
+	// AuthResultSuccess means the credentials were accepted.
+	AuthResultSuccess AuthResult = "success"
+	// AuthResultFailed means the credentials were rejected.
+	AuthResultFailed AuthResult = "failed"
+	// AuthResultBackendError means the authentication server failed to respond.
+	AuthResultBackendError AuthResult = "backendError"
+	// AuthResultUnknown means the outcome of the attempt was not recorded.
+	AuthResultUnknown AuthResult = "unknown"
+)
+
+// AuthAttempt is a single authentication attempt.
+type AuthAttempt struct {
+	// Timestamp is the nanosecond timestamp of the attempt.
+	Timestamp int64 `json:"timestamp" yaml:"timestamp"`
+	// Method is the authentication method.
+	Method AuthMethod `json:"method" yaml:"method"`
+	// Username is the username the user entered.
+	Username string `json:"username" yaml:"username"`
+	// Result is the outcome of the attempt.
+	Result AuthResult `json:"result" yaml:"result"`
+}
+
+// Channel is a channel requested by the user.
+type Channel struct {
+	// ID is the channel ID.
+	ID uint64 `json:"id" yaml:"id"`
+	// Type is the channel type, for example "session".
+	Type string `json:"type" yaml:"type"`
+	// Opened is true if the channel was successfully opened.
+	Opened bool `json:"opened" yaml:"opened"`
+	// Reason is the reason the channel could not be opened.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// ProgramType describes how a program was started.
+type ProgramType string
+
+const (
+	// ProgramTypeExec is a program executed with an exec request.
+	ProgramTypeExec ProgramType = "exec"
+	// ProgramTypeShell is a shell started with a shell request.
+	ProgramTypeShell ProgramType = "shell"
+	// ProgramTypeSubsystem is a subsystem, such as SFTP, started with a subsystem request.
+	ProgramTypeSubsystem ProgramType = "subsystem"
+)
+
+// Program is a program started in a channel.
+type Program struct {
+	// Timestamp is the nanosecond timestamp of the request starting the program.
+	Timestamp int64 `json:"timestamp" yaml:"timestamp"`
+	// ChannelID is the channel the program ran in.
+	ChannelID uint64 `json:"channelId" yaml:"channelId"`
+	// Type describes how the program was started.
+	Type ProgramType `json:"type" yaml:"type"`
+	// Command is the executed program or the subsystem name. Empty for shells.
+	Command string `json:"command" yaml:"command"`
+	// ExitStatus is the exit status of the program, or nil if it did not exit normally.
+	ExitStatus *uint32 `json:"exitStatus" yaml:"exitStatus"`
+	// ExitTimestamp is the nanosecond timestamp of the exit status, or 0 if the program did not exit normally.
+	ExitTimestamp int64 `json:"exitTimestamp,omitempty" yaml:"exitTimestamp,omitempty"`
+	// ExitSignal is the signal that terminated the program, if any.
+	ExitSignal string `json:"exitSignal,omitempty" yaml:"exitSignal,omitempty"`
+}
+
+// StreamBytes contains the number of bytes transferred per stream.
+type StreamBytes struct {
+	// Stdin is the number of bytes sent by the user.
+	Stdin uint64 `json:"stdin" yaml:"stdin"`
+	// Stdout is the number of bytes sent to the user on the standard output.
+	Stdout uint64 `json:"stdout" yaml:"stdout"`
+	// Stderr is the number of bytes sent to the user on the standard error.
+	Stderr uint64 `json:"stderr" yaml:"stderr"`
+}
@@ -0,0 +1,175 @@
+package summary_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/summary"
+)
+
+func TestAggregator(t *testing.T) {
+	aggregator := summary.NewAggregator()
+	for _, msg := range []message.Message{
+		{
+			Timestamp:   1000,
+			MessageType: message.TypeConnect,
+			Payload:     message.PayloadConnect{RemoteAddr: "127.0.0.1", Country: "XX"},
+		},
+		{
+			Timestamp:   1001,
+			MessageType: message.TypeAuthPubKeyBackendError,
+			Payload:     message.PayloadAuthPubKeyBackendError{Username: "foo", Key: "ssh-rsa AAAA", Reason: "timeout"},
+		},
+		{
+			Timestamp:   1002,
+			MessageType: message.TypeAuthKeyboardInteractiveChallenge,
+			Payload:     message.PayloadAuthKeyboardInteractiveChallenge{Username: "foo"},
+		},
+		{
+			Timestamp:   1003,
+			MessageType: message.TypeAuthKeyboardInteractiveChallenge,
+			Payload:     message.PayloadAuthKeyboardInteractiveChallenge{Username: "foo"},
+		},
+		{
+			Timestamp:   1004,
+			MessageType: message.TypeHandshakeSuccessful,
+			Payload:     message.PayloadHandshakeSuccessful{Username: "foo"},
+		},
+		{
+			Timestamp:   1005,
+			MessageType: message.TypeNewChannelFailed,
+			Payload:     message.PayloadNewChannelFailed{ChannelType: "x11", Reason: "unsupported"},
+			ChannelID:   message.MakeChannelID(0),
+		},
+		{
+			Timestamp:   1006,
+			MessageType: message.TypeNewChannelSuccessful,
+			Payload:     message.PayloadNewChannelSuccessful{ChannelType: "session"},
+			ChannelID:   message.MakeChannelID(1),
+		},
+		{
+			Timestamp:   1007,
+			MessageType: message.TypeChannelRequestShell,
+			Payload:     message.PayloadChannelRequestShell{RequestID: 0},
+			ChannelID:   message.MakeChannelID(1),
+		},
+		{
+			Timestamp:   1008,
+			MessageType: message.TypeIO,
+			Payload:     message.PayloadIO{Stream: message.StreamStderr, Data: []byte("error")},
+			ChannelID:   message.MakeChannelID(1),
+		},
+		{
+			Timestamp:   1009,
+			MessageType: message.TypeExitSignal,
+			Payload:     message.PayloadExitSignal{Signal: "KILL"},
+			ChannelID:   message.MakeChannelID(1),
+		},
+		{
+			Timestamp:   3000,
+			Offset:      2000,
+			MessageType: message.TypeDisconnect,
+		},
+	} {
+		msg.ConnectionID = "0123456789ABCDEF"
+		aggregator.Add(msg)
+	}
+
+	assert.Equal(t, summary.Summary{
+		ConnectionID:  "0123456789ABCDEF",
+		StartTime:     1000,
+		EndTime:       3000,
+		Duration:      2000 * time.Nanosecond,
+		RemoteAddr:    "127.0.0.1",
+		Country:       "XX",
+		Authenticated: true,
+		Username:      "foo",
+		AuthAttempts: []summary.AuthAttempt{
+			{
+				Timestamp: 1001,
+				Method:    summary.AuthMethodPubKey,
+				Username:  "foo",
+				Result:    summary.AuthResultBackendError,
+			},
+			{
+				Timestamp: 1002,
+				Method:    summary.AuthMethodKeyboardInteractive,
+				Username:  "foo",
+				Result:    summary.AuthResultSuccess,
+			},
+		},
+		Channels: []summary.Channel{
+			{ID: 0, Type: "x11", Opened: false, Reason: "unsupported"},
+			{ID: 1, Type: "session", Opened: true},
+		},
+		Programs: []summary.Program{
+			{Timestamp: 1007, ChannelID: 1, Type: summary.ProgramTypeShell, ExitSignal: "KILL"},
+		},
+		Bytes: summary.StreamBytes{Stderr: 5},
+	}, aggregator.Summary())
+}
+
+func TestLastExitStatus(t *testing.T) {
+	aggregator := summary.NewAggregator()
+	for _, msg := range []message.Message{
+		{
+			Timestamp:   1000,
+			MessageType: message.TypeChannelRequestExec,
+			Payload:     message.PayloadChannelRequestExec{Program: "sleep 10"},
+			ChannelID:   message.MakeChannelID(0),
+		},
+		{
+			Timestamp:   1001,
+			MessageType: message.TypeChannelRequestExec,
+			Payload:     message.PayloadChannelRequestExec{Program: "false"},
+			ChannelID:   message.MakeChannelID(1),
+		},
+		{
+			Timestamp:   1002,
+			MessageType: message.TypeExit,
+			Payload:     message.PayloadExit{ExitStatus: 1},
+			ChannelID:   message.MakeChannelID(1),
+		},
+		{
+			Timestamp:   1003,
+			MessageType: message.TypeExit,
+			Payload:     message.PayloadExit{ExitStatus: 0},
+			ChannelID:   message.MakeChannelID(0),
+		},
+	} {
+		msg.ConnectionID = "0123456789ABCDEF"
+		aggregator.Add(msg)
+	}
+
+	// The program started first exited last.
+	exitStatus := aggregator.Summary().LastExitStatus()
+	if assert.NotNil(t, exitStatus) {
+		assert.Equal(t, uint32(0), *exitStatus)
+	}
+	assert.Nil(t, summary.Summary{}.LastExitStatus())
+}
+
+func TestFromMessagesError(t *testing.T) {
+	messages := make(chan message.Message)
+	errors := make(chan error)
+	go func() {
+		messages <- message.Message{
+			ConnectionID: "0123456789ABCDEF",
+			Timestamp:    1000,
+			MessageType:  message.TypeConnect,
+			Payload:      message.PayloadConnect{RemoteAddr: "127.0.0.1", Country: "XX"},
+		}
+		errors <- fmt.Errorf("truncated audit log")
+		close(messages)
+		close(errors)
+	}()
+
+	s, err := summary.FromMessages(messages, errors)
+	assert.Error(t, err)
+	assert.Equal(t, "127.0.0.1", s.RemoteAddr)
+	assert.Equal(t, int64(0), s.EndTime)
+}
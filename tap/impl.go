@@ -0,0 +1,121 @@
+package tap
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/containerssh/auditlog/message"
+)
+
+const defaultBufferSize = 1000
+
+// maxBufferSize limits the memory a single subscription can hold.
+const maxBufferSize = 10000
+
+type tap struct {
+	lock        *sync.RWMutex
+	subscribers map[*subscription]struct{}
+	// count is the number of subscribers, allowing Publish to return without locking if there are none.
+	count int32
+}
+
+func (t *tap) Subscribe(connectionID message.ConnectionID, bufferSize uint) Subscription {
+	if bufferSize == 0 {
+		bufferSize = defaultBufferSize
+	}
+	if bufferSize > maxBufferSize {
+		bufferSize = maxBufferSize
+	}
+	s := &subscription{
+		tap:          t,
+		connectionID: connectionID,
+		messages:     make(chan message.Message, bufferSize),
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.subscribers[s] = struct{}{}
+	atomic.AddInt32(&t.count, 1)
+	return s
+}
+
+func (t *tap) Publish(msg message.Message) {
+	if atomic.LoadInt32(&t.count) == 0 {
+		return
+	}
+	t.lock.RLock()
+	copied := false
+	for s := range t.subscribers {
+		if s.connectionID != "" && s.connectionID != msg.ConnectionID {
+			continue
+		}
+		if !copied {
+			// The I/O data may be reused by the caller after logging, but subscribers read it later.
+			msg = copyMessage(msg)
+			copied = true
+		}
+		select {
+		case s.messages <- msg:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+	t.lock.RUnlock()
+
+	if msg.MessageType == message.TypeDisconnect {
+		t.closeConnection(msg.ConnectionID)
+	}
+}
+
+func (t *tap) closeConnection(connectionID message.ConnectionID) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for s := range t.subscribers {
+		if s.connectionID == connectionID {
+			t.remove(s)
+		}
+	}
+}
+
+func (t *tap) unsubscribe(s *subscription) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.remove(s)
+}
+
+// remove removes a subscriber and closes its channel. Must be called with the lock held.
+func (t *tap) remove(s *subscription) {
+	if _, ok := t.subscribers[s]; !ok {
+		return
+	}
+	delete(t.subscribers, s)
+	atomic.AddInt32(&t.count, -1)
+	close(s.messages)
+}
+
+func copyMessage(msg message.Message) message.Message {
+	if payload, ok := msg.Payload.(message.PayloadIO); ok {
+		payload.Data = append([]byte(nil), payload.Data...)
+		msg.Payload = payload
+	}
+	return msg
+}
+
+type subscription struct {
+	// dropped is the first field to keep it 64-bit aligned for atomic access on 32-bit platforms.
+	dropped      uint64
+	tap          *tap
+	connectionID message.ConnectionID
+	messages     chan message.Message
+}
+
+func (s *subscription) Messages() <-chan message.Message {
+	return s.messages
+}
+
+func (s *subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *subscription) Close() {
+	s.tap.unsubscribe(s)
+}
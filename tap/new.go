@@ -0,0 +1,13 @@
+package tap
+
+import (
+	"sync"
+)
+
+// New creates a tap that distributes audit log messages to live subscribers.
+func New() Tap {
+	return &tap{
+		lock:        &sync.RWMutex{},
+		subscribers: map[*subscription]struct{}{},
+	}
+}
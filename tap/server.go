@@ -0,0 +1,341 @@
+package tap
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerssh/log"
+	"golang.org/x/net/websocket"
+
+	"github.com/containerssh/auditlog/codes"
+	"github.com/containerssh/auditlog/message"
+)
+
+// Config is the configuration of the live streaming HTTP server. The observers must authenticate with a bearer token,
+// a client certificate, or both.
+type Config struct {
+	// Listen is the IP address and port the server listens on.
+	Listen string `json:"listen" yaml:"listen" default:"127.0.0.1:8090"`
+	// BufferSize is the number of messages buffered for each observer, at most 10000. Observers can request a smaller
+	// buffer size with the bufferSize query parameter.
+	BufferSize uint `json:"bufferSize" yaml:"bufferSize" default:"1000"`
+	// Token is the bearer token the observers must send in the Authorization header.
+	Token string `json:"token" yaml:"token"`
+	// Cert is the PEM-encoded server certificate. If set, the server uses TLS.
+	Cert string `json:"cert" yaml:"cert"`
+	// Key is the PEM-encoded private key of the server certificate.
+	Key string `json:"key" yaml:"key"`
+	// ClientCACert is the PEM-encoded CA certificate. If set, the observers must present a client certificate signed
+	// by this CA.
+	ClientCACert string `json:"clientcacert" yaml:"clientcacert"`
+	// Hosts are the accepted values of the Host header, protecting against DNS rebinding. Defaults to the listen
+	// address, and for loopback addresses also to localhost with the listen port. Required if the server listens on
+	// all interfaces.
+	Hosts []string `json:"hosts" yaml:"hosts"`
+}
+
+// Validate validates the server configuration.
+func (c Config) Validate() error {
+	host, _, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %s (%w)", c.Listen, err)
+	}
+	if c.BufferSize > maxBufferSize {
+		return fmt.Errorf("buffer size %d is larger than the maximum of %d", c.BufferSize, maxBufferSize)
+	}
+	if c.Token == "" && c.ClientCACert == "" {
+		return fmt.Errorf("no observer authentication configured, set a token or a client CA certificate")
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("the server certificate and key must be provided together")
+	}
+	if c.ClientCACert != "" && c.Cert == "" {
+		return fmt.Errorf("client certificate authentication requires a server certificate")
+	}
+	if ip := net.ParseIP(host); len(c.Hosts) == 0 && (host == "" || ip != nil && ip.IsUnspecified()) {
+		return fmt.Errorf("the accepted hosts must be set when listening on all interfaces")
+	}
+	return nil
+}
+
+// getHosts returns the accepted values of the Host header.
+func (c Config) getHosts() []string {
+	if len(c.Hosts) > 0 {
+		return c.Hosts
+	}
+	hosts := []string{c.Listen}
+	host, port, _ := net.SplitHostPort(c.Listen)
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		hosts = append(hosts, net.JoinHostPort("localhost", port))
+	}
+	return hosts
+}
+
+func (c Config) getTLSConfig() (*tls.Config, error) {
+	if c.Cert == "" {
+		return nil, nil
+	}
+	cert, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate (%w)", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if c.ClientCACert != "" {
+		clientCAs := x509.NewCertPool()
+		if ok := clientCAs.AppendCertsFromPEM([]byte(c.ClientCACert)); !ok {
+			return nil, fmt.Errorf("failed to add client CA certificate from config file")
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// NewServer creates an HTTP server exposing the live audit log messages of the subscriber with the handler returned
+// by NewHandler. The caller is responsible for starting the server with ListenAndServe, or ListenAndServeTLS("", "")
+// if a server certificate is configured, and stopping it with Shutdown. The messages contain all intercepted data,
+// including passwords if configured, so the server must only be reachable by authorized observers.
+func NewServer(config Config, subscriber Subscriber, logger log.Logger) (*http.Server, error) {
+	handler, err := NewHandler(config, subscriber, logger)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.getTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:      config.Listen,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}, nil
+}
+
+// NewHandler creates an HTTP handler streaming live audit log messages as JSON-encoded message.ExtendedMessage
+// objects. It serves two endpoints:
+//
+// - /stream responds with newline-delimited JSON, one message per line.
+// - /ws upgrades to a WebSocket connection and sends one message per text frame.
+//
+// Both endpoints accept the connectionId query parameter to observe a single connection, otherwise all connections
+// are streamed, and the bufferSize query parameter to request a buffer smaller than the configured one. The stream
+// ends when the observed connection disconnects or the client goes away.
+//
+// Requests must carry the configured bearer token, or, if no token is configured, a verified client certificate. The
+// Host header must be one of the accepted hosts and the Origin header, if sent by a browser, must match it.
+func NewHandler(config Config, subscriber Subscriber, logger log.Logger) (http.Handler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	bufferSize := config.BufferSize
+	if bufferSize == 0 {
+		bufferSize = defaultBufferSize
+	}
+	h := &handler{
+		subscriber: subscriber,
+		bufferSize: bufferSize,
+		token:      config.Token,
+		hosts:      config.getHosts(),
+		logger:     logger,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", h.stream)
+	mux.Handle("/ws", websocket.Server{
+		Handshake: setOrigin,
+		Handler:   h.websocket,
+	})
+	h.mux = mux
+	return h, nil
+}
+
+type handler struct {
+	subscriber Subscriber
+	bufferSize uint
+	token      string
+	hosts      []string
+	logger     log.Logger
+	mux        *http.ServeMux
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.isAcceptedHost(r.Host) {
+		http.Error(w, "invalid host", http.StatusMisdirectedRequest)
+		return
+	}
+	if err := h.checkOrigin(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !h.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *handler) isAcceptedHost(host string) bool {
+	for _, acceptedHost := range h.hosts {
+		if strings.EqualFold(host, acceptedHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin rejects cross-origin requests from browsers. Clients that do not send an Origin header, such as command
+// line tools, are accepted. The origin is compared to the accepted hosts and not to the Host header, which is under
+// the control of the page when its DNS record is rebound.
+func (h *handler) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin: %s", origin)
+	}
+	if !h.isAcceptedHost(originURL.Host) {
+		return fmt.Errorf("cross-origin request from %s rejected", origin)
+	}
+	return nil
+}
+
+// isAuthenticated checks the bearer token, or the client certificate if no token is configured.
+func (h *handler) isAuthenticated(r *http.Request) bool {
+	if h.token != "" {
+		expected := "Bearer " + h.token
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) == 1
+	}
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+func (h *handler) subscribe(query url.Values) (Subscription, error) {
+	bufferSize := h.bufferSize
+	if rawBufferSize := query.Get("bufferSize"); rawBufferSize != "" {
+		parsed, err := strconv.ParseUint(rawBufferSize, 10, 32)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("invalid buffer size: %s", rawBufferSize)
+		}
+		// Larger buffers are not granted, as observers could otherwise make the server allocate large buffers.
+		if uint(parsed) < bufferSize {
+			bufferSize = uint(parsed)
+		}
+	}
+	return h.subscriber.Subscribe(message.ConnectionID(query.Get("connectionId")), bufferSize), nil
+}
+
+func (h *handler) stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	subscription, err := h.subscribe(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer h.close(subscription, r)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case msg, ok := <-subscription.Messages():
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(msg.GetExtendedMessage()); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (h *handler) websocket(ws *websocket.Conn) {
+	subscription, err := h.subscribe(ws.Request().URL.Query())
+	if err != nil {
+		_ = websocket.Message.Send(ws, err.Error())
+		_ = ws.Close()
+		return
+	}
+	defer h.close(subscription, ws.Request())
+
+	// Observers do not send anything, reading only detects when the client goes away.
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		_, _ = io.Copy(ioutil.Discard, ws)
+	}()
+	defer func() {
+		_ = ws.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-subscription.Messages():
+			if !ok {
+				return
+			}
+			if err := ws.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				return
+			}
+			if err := websocket.JSON.Send(ws, msg.GetExtendedMessage()); err != nil {
+				return
+			}
+		case <-clientGone:
+			return
+		}
+	}
+}
+
+func (h *handler) close(subscription Subscription, r *http.Request) {
+	subscription.Close()
+	if dropped := subscription.Dropped(); dropped > 0 {
+		h.logger.Warning(
+			log.NewMessage(
+				codes.ELiveObserverMessagesDropped,
+				"dropped %d audit log messages for live observer %s because it could not keep up",
+				dropped,
+				r.RemoteAddr,
+			),
+		)
+	}
+}
+
+// setOrigin accepts the WebSocket handshake. The origin has already been checked by the handler, Origin headers are
+// optional for clients other than browsers.
+func setOrigin(config *websocket.Config, r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		originURL, err := url.Parse(origin)
+		if err != nil {
+			return fmt.Errorf("invalid origin: %s (%w)", origin, err)
+		}
+		config.Origin = originURL
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package tap
+
+import (
+	"github.com/containerssh/auditlog/message"
+)
+
+// Subscriber allows observing the audit log messages of ongoing connections.
+type Subscriber interface {
+	// Subscribe returns a subscription receiving the messages of the connection with the specified ID as they are
+	// logged. An empty connectionID subscribes to all connections. The subscription buffers up to bufferSize messages,
+	// further messages are dropped until the subscriber catches up. A bufferSize of 0 uses the default of 1000, buffer
+	// sizes above 10000 are capped.
+	Subscribe(connectionID message.ConnectionID, bufferSize uint) Subscription
+}
+
+// Tap distributes the audit log messages to subscribers without ever blocking the publisher.
+type Tap interface {
+	Subscriber
+
+	// Publish delivers a message to all matching subscribers. It never blocks: if the buffer of a subscriber is full
+	// the message is dropped for that subscriber. Subscriptions to a single connection are closed after its
+	// disconnect message is published.
+	Publish(msg message.Message)
+}
+
+// Subscription is a stream of audit log messages.
+type Subscription interface {
+	// Messages returns the channel the messages are delivered on. The channel is closed when the subscription is
+	// closed or the subscribed connection disconnects.
+	Messages() <-chan message.Message
+	// Dropped returns the number of messages dropped because the buffer was full.
+	Dropped() uint64
+	// Close ends the subscription. It is safe to call Close multiple times.
+	Close()
+}
@@ -0,0 +1,411 @@
+package tap_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerssh/log"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"github.com/containerssh/auditlog/message"
+	"github.com/containerssh/auditlog/tap"
+)
+
+// streamedMessage is the subset of the streamed message.ExtendedMessage fields checked by the tests. The payload is an
+// interface and cannot be decoded directly.
+type streamedMessage struct {
+	ConnectionID message.ConnectionID `json:"connectionId"`
+	TypeID       string               `json:"typeId"`
+	Payload      json.RawMessage      `json:"payload"`
+}
+
+func newMessage(connectionID message.ConnectionID, messageType message.Type) message.Message {
+	var payload message.Payload
+	switch messageType {
+	case message.TypeConnect:
+		payload = message.PayloadConnect{RemoteAddr: "127.0.0.1"}
+	case message.TypeIO:
+		payload = message.PayloadIO{Stream: message.StreamStdout, Data: []byte("Hello world!")}
+	}
+	return message.Message{
+		ConnectionID: connectionID,
+		Timestamp:    time.Now().UnixNano(),
+		MessageType:  messageType,
+		Payload:      payload,
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	tp := tap.New()
+	// Publishing without subscribers must not fail.
+	tp.Publish(newMessage("a", message.TypeConnect))
+
+	all := tp.Subscribe("", 10)
+	onlyA := tp.Subscribe("a", 10)
+	full := tp.Subscribe("a", 1)
+
+	tp.Publish(newMessage("a", message.TypeConnect))
+	tp.Publish(newMessage("b", message.TypeConnect))
+	tp.Publish(newMessage("a", message.TypeIO))
+	tp.Publish(newMessage("a", message.TypeDisconnect))
+
+	var types []message.Type
+	for msg := range onlyA.Messages() {
+		types = append(types, msg.MessageType)
+	}
+	assert.Equal(t, []message.Type{message.TypeConnect, message.TypeIO, message.TypeDisconnect}, types)
+	assert.Equal(t, uint64(2), full.Dropped())
+
+	// Subscriptions to all connections stay open after a disconnect.
+	assert.Len(t, all.Messages(), 4)
+	all.Close()
+	all.Close()
+	count := 0
+	for range all.Messages() {
+		count++
+	}
+	assert.Equal(t, 4, count)
+	tp.Publish(newMessage("b", message.TypeIO))
+}
+
+// publishUntilSubscribed publishes connect messages until the HTTP handler has subscribed and received one.
+func publishUntilSubscribed(tp tap.Tap, connectionID message.ConnectionID, subscribed <-chan struct{}) {
+	for {
+		tp.Publish(newMessage(connectionID, message.TypeConnect))
+		select {
+		case <-subscribed:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+const testToken = "secret"
+
+// newTestServer starts a server with the handler listening on the address the handler is configured with.
+func newTestServer(t *testing.T, subscriber tap.Subscriber) *httptest.Server {
+	server := httptest.NewUnstartedServer(nil)
+	handler, err := tap.NewHandler(tap.Config{
+		Listen:     server.Listener.Addr().String(),
+		BufferSize: 10,
+		Token:      testToken,
+	}, subscriber, log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Config.Handler = handler
+	server.Start()
+	return server
+}
+
+func get(url string) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	return http.DefaultClient.Do(request)
+}
+
+func dialWebSocket(server *httptest.Server, origin string) (*websocket.Conn, error) {
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", origin)
+	if err != nil {
+		return nil, err
+	}
+	config.Header.Set("Authorization", "Bearer "+testToken)
+	return websocket.DialConfig(config)
+}
+
+func TestStream(t *testing.T) {
+	tp := tap.New()
+	server := newTestServer(t, tp)
+	defer server.Close()
+
+	response, err := get(server.URL + "/stream?connectionId=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/x-ndjson", response.Header.Get("Content-Type"))
+
+	subscribed := make(chan struct{})
+	var lines []streamedMessage
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			var msg streamedMessage
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+			if len(lines) == 0 {
+				close(subscribed)
+			}
+			lines = append(lines, msg)
+		}
+	}()
+	publishUntilSubscribed(tp, "a", subscribed)
+	tp.Publish(newMessage("b", message.TypeIO))
+	tp.Publish(newMessage("a", message.TypeIO))
+	tp.Publish(newMessage("a", message.TypeDisconnect))
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("stream did not end after the connection disconnected")
+	}
+	if !assert.GreaterOrEqual(t, len(lines), 3) {
+		return
+	}
+	assert.Equal(t, "connect", lines[0].TypeID)
+	assert.Equal(t, "io", lines[len(lines)-2].TypeID)
+	assert.Equal(t, message.ConnectionID("a"), lines[len(lines)-2].ConnectionID)
+	assert.Equal(t, "disconnect", lines[len(lines)-1].TypeID)
+}
+
+func TestWebSocket(t *testing.T) {
+	tp := tap.New()
+	server := newTestServer(t, tp)
+	defer server.Close()
+
+	ws, err := dialWebSocket(server, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+
+	subscribed := make(chan struct{})
+	received := make(chan string, 100)
+	go func() {
+		defer close(received)
+		first := true
+		for {
+			var msg streamedMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			if first {
+				close(subscribed)
+				first = false
+			}
+			received <- msg.TypeID
+		}
+	}()
+	publishUntilSubscribed(tp, "", subscribed)
+	tp.Publish(newMessage("b", message.TypeIO))
+
+	for {
+		select {
+		case typeID, ok := <-received:
+			if !assert.True(t, ok, "websocket closed before the I/O message was received") {
+				return
+			}
+			if typeID == "io" {
+				return
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("I/O message not received")
+		}
+	}
+}
+
+func TestWebSocketCrossOrigin(t *testing.T) {
+	server := newTestServer(t, tap.New())
+	defer server.Close()
+
+	_, err := dialWebSocket(server, "http://evil.example.com")
+	assert.Error(t, err)
+
+	// A page whose DNS record was rebound to the server sends its own name as Host and Origin.
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Host = "evil.example.com"
+	request.Header.Set("Origin", "http://evil.example.com")
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusMisdirectedRequest, response.StatusCode)
+}
+
+// recordingSubscriber records the requested buffer sizes.
+type recordingSubscriber struct {
+	tap         tap.Tap
+	bufferSizes chan uint
+}
+
+func (s *recordingSubscriber) Subscribe(connectionID message.ConnectionID, bufferSize uint) tap.Subscription {
+	s.bufferSizes <- bufferSize
+	return s.tap.Subscribe(connectionID, bufferSize)
+}
+
+func TestBufferSizeLimit(t *testing.T) {
+	subscription := tap.New().Subscribe("", 1<<32-1)
+	assert.Equal(t, 10000, cap(subscription.Messages()))
+	subscription.Close()
+
+	subscriber := &recordingSubscriber{tap: tap.New(), bufferSizes: make(chan uint, 2)}
+	server := newTestServer(t, subscriber)
+	defer server.Close()
+
+	for _, bufferSize := range []string{"4294967295", "5"} {
+		response, err := get(server.URL + "/stream?bufferSize=" + bufferSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+	}
+	assert.Equal(t, uint(10), <-subscriber.bufferSizes)
+	assert.Equal(t, uint(5), <-subscriber.bufferSizes)
+}
+
+func TestAuthentication(t *testing.T) {
+	server := newTestServer(t, tap.New())
+	defer server.Close()
+
+	for _, authorization := range []string{"", "Bearer wrong"} {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	}
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = websocket.DialConfig(config)
+	assert.Error(t, err)
+}
+
+func TestMutualTLS(t *testing.T) {
+	caCert, caKey, caPEM := createCertificate(t, nil, nil, "ca")
+	_, serverKey, serverPEM := createCertificate(t, caCert, caKey, "server")
+	clientCert, clientKey, _ := createCertificate(t, caCert, caKey, "client")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := tap.NewServer(tap.Config{
+		Listen:       listener.Addr().String(),
+		Cert:         serverPEM,
+		Key:          encodeKey(t, serverKey),
+		ClientCACert: caPEM,
+	}, tap.New(), log.NewTestLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = server.ServeTLS(listener, "", "")
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+	newClient := func(certificates []tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certificates,
+			MinVersion:   tls.VersionTLS12,
+		}}}
+	}
+	url := "https://" + listener.Addr().String() + "/stream?connectionId=a"
+
+	_, err = newClient(nil).Get(url)
+	assert.Error(t, err)
+
+	response, err := newClient([]tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}}).Get(url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_ = response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestValidation(t *testing.T) {
+	assert.Error(t, tap.Config{Listen: "127.0.0.1:8090"}.Validate())
+	assert.Error(t, tap.Config{Listen: "127.0.0.1:8090", Token: "secret", BufferSize: 1 << 20}.Validate())
+	assert.Error(t, tap.Config{Listen: "0.0.0.0:8090", Token: "secret"}.Validate())
+	assert.Error(t, tap.Config{Listen: "127.0.0.1:8090", ClientCACert: "ca"}.Validate())
+	assert.NoError(t, tap.Config{Listen: "0.0.0.0:8090", Token: "secret", Hosts: []string{"tap.example.com"}}.Validate())
+	assert.NoError(t, tap.Config{Listen: "127.0.0.1:8090", Token: "secret"}.Validate())
+}
+
+func encodeKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}))
+}
+
+func createCertificate(
+	t *testing.T,
+	parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+	name string,
+) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent = template
+		parentKey = key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
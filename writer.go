@@ -0,0 +1,27 @@
+package auditlog
+
+import (
+	"github.com/containerssh/auditlog/storage"
+)
+
+// sessionInfoWriter passes the session details collected by the connection to the storage writer before it is closed,
+// if the storage writer supports it.
+type sessionInfoWriter struct {
+	storage.Writer
+
+	conn *loggerConnection
+	// aborted is set when the output overflowed, before the message channel of the output is closed, so it is visible
+	// to the encoder closing the writer.
+	aborted bool
+}
+
+// Close closes the storage writer. The audit logs of overflowed outputs are discarded if the writer supports it.
+func (s *sessionInfoWriter) Close() error {
+	if abortableWriter, ok := s.Writer.(storage.AbortableWriter); ok && s.aborted {
+		return abortableWriter.Abort()
+	}
+	if writer, ok := s.Writer.(storage.SessionInfoWriter); ok {
+		writer.SetSessionInfo(s.conn.getSessionInfo())
+	}
+	return s.Writer.Close()
+}